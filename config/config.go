@@ -33,6 +33,13 @@ func GlobalConfigSafe() *structs.Config {
 	return GlobalConfig
 }
 
+// GlobalConfigSnapshot 返回读锁下复制的配置（浅拷贝），读取其字段不会与 Swap/写锁下的修改竞争
+func GlobalConfigSnapshot() structs.Config {
+	globalConfigMu.RLock()
+	defer globalConfigMu.RUnlock()
+	return *GlobalConfig
+}
+
 // GlobalConfigForWrite 返回写锁下的配置指针，调用者必须调用解锁函数
 func GlobalConfigForWrite() (*structs.Config, func()) {
 	globalConfigMu.Lock()
@@ -11,6 +11,42 @@ type AgentConfig struct {
 	AutoApprove           string `default:""`                            // 自动批准表达式
 	AutoReject            string `default:""`                            // 自动拒绝表达式
 	DisableSandbox        bool   `default:"false"`                       // 禁用沙盒
+	// AllowedScopes 允许启用的命名空间，空为不限
+	AllowedScopes []string
+	// DefaultScopes 代理激活期间默认启用的命名空间
+	DefaultScopes []string
+	// AllowedTools 提供给模型的工具白名单（支持 path.Match 通配），空为不限
+	AllowedTools []string
+	// DeniedTools 不提供给模型的工具（支持 path.Match 通配），优先于 AllowedTools
+	DeniedTools []string
+	// Budget 单次激活的预算，activate_agent 调用参数可逐项覆盖
+	Budget BudgetConfig
+}
+
+// BudgetConfig 预算上限，各项为 0 表示不限
+type BudgetConfig struct {
+	MaxTokens uint64  // 最大 token 数（输入 + 输出）
+	MaxCost   float64 // 最大估算费用（按模型价格）
+	MaxTime   int32   // 最长耗时（秒）
+}
+
+// IsZero 是否未设置任何上限
+func (b BudgetConfig) IsZero() bool {
+	return b.MaxTokens == 0 && b.MaxCost == 0 && b.MaxTime == 0
+}
+
+// Override 以 o 中的非零项覆盖 b
+func (b BudgetConfig) Override(o BudgetConfig) BudgetConfig {
+	if o.MaxTokens != 0 {
+		b.MaxTokens = o.MaxTokens
+	}
+	if o.MaxCost != 0 {
+		b.MaxCost = o.MaxCost
+	}
+	if o.MaxTime != 0 {
+		b.MaxTime = o.MaxTime
+	}
+	return b
 }
 
 // FetchConfig fetch 工具配置
@@ -41,4 +77,24 @@ type AgentsConfig struct {
 	DisableSandbox bool `default:"false"`
 	// Fetch fetch 工具配置
 	Fetch FetchConfig
+	// Budget 主会话每轮（一次用户输入到停止，含子代理）的预算
+	Budget BudgetConfig
+	// Hooks 生命周期钩子，同一事件按配置顺序执行
+	Hooks []HookConfig
+	// TrustWorkspaceAgents 信任仓库 .alkaid0/agents 中的 auto_approve / disable_sandbox，默认忽略这两项
+	TrustWorkspaceAgents bool `default:"false"`
+	// RecordRequests 把每次对话请求与上游原始响应流录制到项目 .alkaid0/cassettes/<会话ID>.jsonl，供调试与回放
+	RecordRequests bool `default:"false"`
+}
+
+// HookConfig 生命周期钩子：事件发生时经沙盒执行 shell 命令，stdin 为描述事件的 JSON
+type HookConfig struct {
+	// Event 触发事件：pre_tool / post_tool / post_edit / turn_end / session_start
+	Event string
+	// Command 执行的 shell 命令（使用 UseShell，工作目录为会话根目录）
+	Command string
+	// Tools 工具名过滤（支持 path.Match 通配），空为不限；仅对 pre_tool / post_tool / post_edit 生效
+	Tools []string
+	// Timeout 超时秒数，0 取默认 30 秒
+	Timeout int32
 }
@@ -21,4 +21,27 @@ type DataMaskConfig struct {
 	MaskSession bool `json:"mask_session_cookie" default:"false"`
 	// MaskJWT 是否脱敏 JWT（构造同 header+payload、签名伪造的假 JWT）。
 	MaskJWT bool `json:"mask_jwt" default:"true"`
+	// CustomPatterns 用户自定义的正则检测器，按顺序参与检测。
+	CustomPatterns []MaskPattern `json:"custom_patterns,omitempty"`
+	// MaskEntropy 是否脱敏 password=、secret: 等关键字后的高熵字符串。默认关闭。
+	MaskEntropy bool `json:"mask_entropy" default:"false"`
+	// EntropyThreshold 高熵判定阈值（香农熵，bit/字符），0 取默认 3.0。
+	EntropyThreshold float64 `json:"entropy_threshold,omitempty"`
+	// EntropyMinLength 高熵候选值的最小长度，0 取默认 8。
+	EntropyMinLength int `json:"entropy_min_length,omitempty"`
+	// EntropyKeywords 高熵检测的关键字（不区分大小写，匹配关键字开头的键名），空为内置列表。
+	EntropyKeywords []string `json:"entropy_keywords,omitempty"`
+	// LogStats 是否为每个脱敏请求输出一行日志，按类型统计脱敏的区间数。默认关闭。
+	LogStats bool `json:"log_stats" default:"false"`
+}
+
+// MaskPattern 自定义正则检测器。
+type MaskPattern struct {
+	// Name 检测器名称，映射表中的类型记为 "pattern:<Name>"。
+	Name string `json:"name"`
+	// Regex Go 正则。含捕获组时只脱敏各捕获组（未参与匹配的组跳过），否则脱敏整段匹配。
+	Regex string `json:"regex"`
+	// Generator 假值生成类：generic（默认，保留已知前缀、按字符类替换）/ alnum / hex / digits /
+	// base64url / phone / ip / jwt。
+	Generator string `json:"generator,omitempty"`
 }
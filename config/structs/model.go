@@ -10,17 +10,32 @@ const (
 	ModelTypeRerank    ModelType = "rerank"
 )
 
+// ProviderType 模型提供方接口类型
+type ProviderType string
+
+// 模型提供方接口类型
+const (
+	ProviderTypeOpenAI    ProviderType = ""          // OpenAI 兼容 /chat/completions
+	ProviderTypeResponses ProviderType = "responses" // OpenAI /responses（推理摘要、previous_response_id 续写）
+	ProviderTypeOllama    ProviderType = "ollama"    // Ollama 原生 /api/chat（支持 think、keep_alive 与 options）
+	ProviderTypeLlamaCpp  ProviderType = "llamacpp"  // llama.cpp server（对话走其 OpenAI 兼容接口，仅用于模型发现）
+)
+
 // ProviderSpecificConfig 特定模型提供方配置结构
 type ProviderSpecificConfig struct {
-	EnableDeepseekThinking    bool `default:"false"`
-	EnableReasoningEffort     bool `default:"true"`
-	EnableTopP                bool `default:"false"`
-	EnableTemperature         bool `default:"false"`
-	EnableTopK                bool `default:"false"`
-	EnableUsage               bool `default:"true"`
-	Dimension                 int  `default:"0"`     // Embedding 模型维度, 嵌入模型必填
-	EnableToolCallingCompat   bool `default:"false"` // 历史回放兼容模式：把"一个 assistant 携带多个 tool_calls"的消息拆分为逐条"单 tool_call + 结果"，适配逐条转换 role:tool 消息的 OpenAI→Anthropic 代理（默认关闭）
-	EnableTrailingUserMessage bool `default:"false"` // 收尾消息兼容模式：请求以 role:"tool"（tool_result）结果消息结尾时追加一条 user 收尾消息，适配拒绝以 tool_result 结尾请求的 OpenAI→Anthropic 转换代理（默认关闭）
+	EnableDeepseekThinking    bool           `default:"false"`
+	EnableReasoningEffort     bool           `default:"true"`
+	EnableTopP                bool           `default:"false"`
+	EnableTemperature         bool           `default:"false"`
+	EnableTopK                bool           `default:"false"`
+	EnableUsage               bool           `default:"true"`
+	Dimension                 int            `default:"0"`     // Embedding 模型维度, 嵌入模型必填
+	EnableToolCallingCompat   bool           `default:"false"` // 历史回放兼容模式：把"一个 assistant 携带多个 tool_calls"的消息拆分为逐条"单 tool_call + 结果"，适配逐条转换 role:tool 消息的 OpenAI→Anthropic 代理（默认关闭）
+	EnableTrailingUserMessage bool           `default:"false"` // 收尾消息兼容模式：请求以 role:"tool"（tool_result）结果消息结尾时追加一条 user 收尾消息，适配拒绝以 tool_result 结尾请求的 OpenAI→Anthropic 转换代理（默认关闭）
+	OllamaKeepAlive           string         `default:""`      // Ollama：模型在内存中的保留时间（如 "10m"、"-1"），空为服务端默认
+	OllamaNumCtx              int32          `default:"0"`     // Ollama：上下文长度 num_ctx，0 取 TokenLimit
+	OllamaOptions             map[string]any // Ollama：附加 options（如 num_gpu、repeat_penalty），覆盖自动生成的同名项
+	ResponsesChaining         bool           `default:"false"` // Responses：以 previous_response_id 续写，只发送新增消息（需上游保存响应，store=true）
 }
 
 // ModelConfig 单个模型配置结构
@@ -35,19 +50,51 @@ type ModelConfig struct {
 	TokenLimit             int32                  `default:"8192"`                          // 模型Token限制
 	ProviderURL            string                 `default:"https://openrouter.com/api/v1"` // 覆写模型提供者URL
 	ProviderKey            string                 `default:"sk-or-xxx"`                     // 复写模型提供者Key
+	ProviderType           ProviderType           `default:""`                              // 提供方接口类型，空为 OpenAI 兼容
 	EnableThinking         bool                   `default:"false"`                         // 是否启用思考
 	CompressSize           uint32                 `default:"128000"`                        // 压缩大小
 	Hide                   bool                   `default:"false"`                         // 在列表中隐藏
 	Type                   ModelType              `default:""`                              // 模型类型
 	CachePriceMultiplier   float32                `default:"0.2"`                           // 缓存命中 token 相对输入价格的倍率（仅按模型，用于 trace 保留/破坏缓存成本决策）
 	CacheRetentionMinutes  int32                  `default:"180"`                           // 缓存保留时间（分钟），从会话最后活动时间起算，超过则强制清除 trace
+	InputPrice             float64                `default:"0"`                             // 输入 token 价格（每百万 token）
+	OutputPrice            float64                `default:"0"`                             // 输出 token 价格（每百万 token）
+	CachePrice             float64                `default:"0"`                             // 缓存命中 token 价格（每百万 token），0 时按 InputPrice × CachePriceMultiplier 估算
+	SummaryKeepToolResults int32                  `default:"0"`                             // 压缩上下文时原样保留最近 N 条工具结果（连同其调用），0 为仅保留默认条数
 	ProviderSpecificConfig ProviderSpecificConfig // 特定模型提供方配置
 }
 
+// KeyPoolStrategy Key 池的选取策略
+type KeyPoolStrategy string
+
+// Key 池的选取策略
+const (
+	KeyPoolRoundRobin   KeyPoolStrategy = "round_robin"   // 依次轮换
+	KeyPoolLeastLimited KeyPoolStrategy = "least_limited" // 优先最久未被限流的 key
+)
+
+// KeyPoolConfig 同一 Provider URL 的多 Key 池
+type KeyPoolConfig struct {
+	Keys     []string        // 可用的 key
+	Strategy KeyPoolStrategy // 选取策略，空为 round_robin
+}
+
 // ModelsConfig 模型配置结构
 type ModelsConfig struct {
-	ProviderURL    string                `default:"https://openrouter.com/api/v1"` // 模型提供者URL
-	ProviderKey    string                `default:"sk-or-xxx"`                     // 模型提供者Key
-	DefaultModelID int32                 `default:"0"`
-	Models         map[int32]ModelConfig `default:"{}"` // 模型列表, value为模型配置
+	ProviderURL    string                   `default:"https://openrouter.com/api/v1"` // 模型提供者URL
+	ProviderKey    string                   `default:"sk-or-xxx"`                     // 模型提供者Key
+	DefaultModelID int32                    `default:"0"`
+	Models         map[int32]ModelConfig    `default:"{}"`  // 模型列表, value为模型配置
+	Currency       string                   `default:"USD"` // 模型价格的币种（ISO 4217），仅用于展示
+	KeyPools       map[string]KeyPoolConfig `default:"{}"`  // 多 Key 池，键为 ProviderURL；请求该地址时忽略 ProviderKey，从池中轮换
+}
+
+// Cost 按模型价格估算一次请求的费用（prompt 含 cached）
+func (m ModelConfig) Cost(prompt, completion, cached uint64) float64 {
+	cachePrice := m.CachePrice
+	if cachePrice == 0 {
+		cachePrice = m.InputPrice * float64(m.CachePriceMultiplier)
+	}
+	uncached := prompt - min(cached, prompt)
+	return (float64(uncached)*m.InputPrice + float64(min(cached, prompt))*cachePrice + float64(completion)*m.OutputPrice) / 1e6
 }
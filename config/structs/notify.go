@@ -0,0 +1,19 @@
+package structs
+
+// NotifyConfig 会话状态通知配置。会话经 /notify on 开启后，状态变为 States 中的状态时发送通知
+type NotifyConfig struct {
+	// Webhook 通知 POST 地址（JSON，兼容 Slack incoming webhook 与 ntfy JSON 发布），空为不发送
+	Webhook string
+	// Topic 通知 JSON 的 topic 字段（ntfy 向根地址发布时必填），空为省略
+	Topic string
+	// Command 通知时执行的本地命令，stdin 为通知 JSON，空为不执行
+	Command string
+	// States 触发通知的会话状态，空为 requires_action 与 idle
+	States []string
+	// MinInterval 同一会话同一状态两次通知的最小间隔（秒），0 不限制
+	MinInterval int32 `default:"60"`
+	// OnlyDetached 仅在会话没有客户端连接时通知
+	OnlyDetached bool `default:"false"`
+	// DefaultOn 新加载的会话默认开启通知
+	DefaultOn bool `default:"false"`
+}
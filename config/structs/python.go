@@ -6,4 +6,12 @@ type PythonConfig struct {
 	Path string
 	// Source 指定 pip 安装源；为空时使用 pip 默认源。
 	Source string
+	// ProxyKeyTimeout Python 任务内置 OpenAI 代理临时 key 的有效期（分钟）；不大于 0 时按 30 分钟。
+	ProxyKeyTimeout int `default:"30"`
+	// ProxyModels 临时 key 可调用的模型编号；为空时不限制。
+	ProxyModels []int32
+	// ProxyMaxTokens 单个临时 key 可消耗的 token 总量（输入+输出）；0 表示不限制。
+	ProxyMaxTokens uint64 `default:"0"`
+	// ProxyMaxRequests 单个临时 key 可发出的请求数；0 表示不限制。
+	ProxyMaxRequests uint64 `default:"0"`
 }
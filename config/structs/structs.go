@@ -17,4 +17,6 @@ type Config struct {
 	Feedback FeedbackConfig
 	// Python 全局 IPython 虚拟环境配置
 	Python PythonConfig
+	// Notify 会话状态通知配置
+	Notify NotifyConfig
 }
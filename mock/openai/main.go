@@ -2,9 +2,26 @@
 
 package main
 
-import "github.com/cxykevin/alkaid0/mock/openai"
+import (
+	"flag"
+	"log"
+
+	"github.com/cxykevin/alkaid0/mock/openai"
+)
 
 func main() {
+	cassettePath := flag.String("cassette", "", "replay responses recorded in this cassette file (.alkaid0/cassettes/<id>.jsonl)")
+	scenarioPath := flag.String("scenario", "", "answer chat requests with the turns scripted in this scenario file (.json/.yaml)")
+	flag.Parse()
+	if err := openai.LoadCassette(*cassettePath); err != nil {
+		log.Fatal(err)
+	}
+	if *scenarioPath != "" {
+		if err := openai.LoadScenario(*scenarioPath); err != nil {
+			log.Fatal(err)
+		}
+	}
 	openai.StartServerTask()
+	log.Printf("mock server listening on %s", openai.BaseURL)
 	select {}
 }
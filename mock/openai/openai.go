@@ -70,6 +70,8 @@
 //
 // 5. 注意事项:
 //   - 支持流式响应 (stream: true 返回 Server-Sent Events)
+//   - 回放模式（go run main.go -cassette <file>，或 LoadCassette）按录制原样返回会话的上游响应
+//   - 场景模式（go run main.go -scenario <file>，或 LoadScenario）按 JSON/YAML 脚本逐轮响应，见 Scenario
 //   - Token 计算基于简单的空格分词，仅供参考
 //   - 嵌入向量是随机生成的，仅用于测试目的
 package openai
@@ -85,6 +87,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/cxykevin/alkaid0/provider/request/cassette"
 )
 
 // --- configs ---
@@ -183,10 +187,11 @@ type StreamToolCallFunction struct {
 
 // Message 消息结构
 type Message struct {
-	Role       string           `json:"role"`
-	Content    string           `json:"content"`
-	ToolCallID string           `json:"tool_call_id,omitempty"`
-	ToolCalls  []StreamToolCall `json:"tool_calls,omitempty"`
+	Role             string           `json:"role"`
+	Content          string           `json:"content"`
+	ReasoningContent string           `json:"reasoning_content,omitempty"`
+	ToolCallID       string           `json:"tool_call_id,omitempty"`
+	ToolCalls        []StreamToolCall `json:"tool_calls,omitempty"`
 }
 
 // ChatCompletionResponse 聊天补全响应
@@ -282,6 +287,10 @@ func calculateTokens(text string) int {
 func handleChatCompletion(w http.ResponseWriter, r *http.Request) {
 	defer func() {
 		if rec := recover(); rec != nil {
+			if rec == http.ErrAbortHandler {
+				// 场景要求断开连接
+				panic(rec)
+			}
 			log.Printf("[mock] panic in handleChatCompletion: %v", rec)
 		}
 	}()
@@ -296,6 +305,11 @@ func handleChatCompletion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 加载了场景时按脚本响应
+	if serveScenario(w, req) {
+		return
+	}
+
 	if req.Stream {
 		handleStreamingChatCompletion(w, r, req)
 		return
@@ -612,15 +626,53 @@ func acquireServer() {
 	}
 }
 
-// startServe 使用已绑定的 listener 启动 HTTP 服务
-func startServe(listener net.Listener) {
+var (
+	replayMu sync.RWMutex
+	replay   *cassette.Player
+)
+
+// LoadCassette 加载 cassette 文件进入回放模式：请求优先按录制原样返回，录制用尽后回到模拟响应。
+// path 为空时退出回放模式
+func LoadCassette(path string) error {
+	var player *cassette.Player
+	if path != "" {
+		var err error
+		if player, err = cassette.LoadPlayer(path); err != nil {
+			return err
+		}
+	}
+	SetCassette(player)
+	return nil
+}
+
+// SetCassette 设置回放器，nil 退出回放模式
+func SetCassette(player *cassette.Player) {
+	replayMu.Lock()
+	replay = player
+	replayMu.Unlock()
+}
+
+// newHandler 构建路由；回放模式下先尝试回放录制（含 /v1/responses 与 Ollama /api/chat）
+func newHandler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/chat/completions", handleChatCompletion)
 	mux.HandleFunc("/v1/embeddings", handleEmbedding)
 	mux.HandleFunc("/v1/models", handleModels)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replayMu.RLock()
+		player := replay
+		replayMu.RUnlock()
+		if player != nil && player.Serve(w, r) {
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
 
+// startServe 使用已绑定的 listener 启动 HTTP 服务
+func startServe(listener net.Listener) {
 	server := &http.Server{
-		Handler: mux,
+		Handler: newHandler(),
 	}
 
 	if err := server.Serve(listener); err != nil {
@@ -7,6 +7,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/cxykevin/alkaid0/provider/request/cassette"
 )
 
 func TestHandleChatCompletion(t *testing.T) {
@@ -267,3 +269,28 @@ func TestCalculateTokens_EdgeCases(t *testing.T) {
 		}
 	}
 }
+
+func TestReplayCassette(t *testing.T) {
+	SetCassette(cassette.NewPlayer([]cassette.Interaction{{
+		Endpoint: "/chat/completions",
+		Request:  []byte(`{"model":"test-chat","messages":[]}`),
+		Status:   http.StatusOK,
+		Response: "data: {\"choices\":[{\"delta\":{\"content\":\"from cassette\"}}]}\n\ndata: [DONE]\n\n",
+	}}))
+	defer SetCassette(nil)
+	handler := newHandler()
+
+	post := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"test-chat-flash","messages":[{"role":"user","content":"hi"}]}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if body := post(); !strings.Contains(body, "from cassette") {
+		t.Errorf("expected recorded stream, got %q", body)
+	}
+	// 录制用尽后回到模拟响应
+	if body := post(); strings.Contains(body, "from cassette") || !strings.Contains(body, "test-chat-flash") {
+		t.Errorf("expected mock response after cassette exhausted, got %q", body)
+	}
+}
@@ -0,0 +1,376 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario 脚本化的对话响应：/v1/chat/completions 的请求按顺序消费 Turns，
+// 不需要改动 mock 代码即可描述审批、重试、摘要等流程。文件格式为 JSON 或 YAML（按扩展名）
+type Scenario struct {
+	Name string `json:"name,omitempty"`
+	// Model 非空时只接管该模型的请求，其余请求仍走内置模拟响应
+	Model string `json:"model,omitempty"`
+	Turns []Turn `json:"turns"`
+	// Exhausted 轮次用尽后的行为：mock（默认，回到内置模拟响应）或 error（返回 500，便于发现多余的请求）
+	Exhausted string `json:"exhausted,omitempty"`
+}
+
+// Turn 一次请求的响应
+type Turn struct {
+	// Match 非空时该轮只响应最后一条消息包含此子串的请求；不匹配的请求跳过该轮，由后面的轮次响应
+	Match string `json:"match,omitempty"`
+	// DelayMs 开始响应前等待的毫秒数
+	DelayMs int `json:"delay_ms,omitempty"`
+	// Status 非 0 且非 200 时返回错误响应（Error 为错误信息），忽略 Chunks
+	Status  int               `json:"status,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"` // 附加响应头，如 Retry-After
+	Chunks  []Chunk           `json:"chunks,omitempty"`
+	// Finish 结束原因，省略时有工具调用为 tool_calls，否则为 stop
+	Finish string `json:"finish,omitempty"`
+	// Usage 流末尾的 usage 帧，省略时按空格分词估算
+	Usage *Usage `json:"usage,omitempty"`
+	// Drop 发送完 Chunks 后直接断开连接（不发送结束帧与 [DONE]），模拟连接中断
+	Drop bool `json:"drop,omitempty"`
+}
+
+// Chunk 流中的一个增量：文本、思考内容或一个原生工具调用
+type Chunk struct {
+	Text      string        `json:"text,omitempty"`
+	Reasoning string        `json:"reasoning,omitempty"`
+	ToolCall  *ScenarioTool `json:"tool_call,omitempty"`
+	DelayMs   int           `json:"delay_ms,omitempty"` // 发送该增量前等待的毫秒数
+}
+
+// ScenarioTool 原生工具调用。Arguments 可写成对象或 JSON 字符串；Split 大于 0 时按该长度切成多个参数增量
+type ScenarioTool struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Split     int             `json:"split,omitempty"`
+}
+
+// arguments 返回工具参数的 JSON 字符串
+func (t *ScenarioTool) arguments() string {
+	var s string
+	if err := json.Unmarshal(t.Arguments, &s); err == nil {
+		return s
+	}
+	if len(t.Arguments) == 0 {
+		return "{}"
+	}
+	return string(t.Arguments)
+}
+
+// ParseScenario 解析场景文件内容，isYAML 为 false 时按 JSON 解析
+func ParseScenario(data []byte, isYAML bool) (*Scenario, error) {
+	if isYAML {
+		// 先转为 JSON，两种格式共用同一套字段名
+		var v any
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var s Scenario
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	switch s.Exhausted {
+	case "", "mock", "error":
+	default:
+		return nil, fmt.Errorf("scenario %q: unknown exhausted mode %q", s.Name, s.Exhausted)
+	}
+	for i, turn := range s.Turns {
+		for _, c := range turn.Chunks {
+			if c.ToolCall != nil && c.ToolCall.Name == "" {
+				return nil, fmt.Errorf("scenario %q turn %d: tool_call without name", s.Name, i+1)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// LoadScenario 加载场景文件（.yaml / .yml 按 YAML，其余按 JSON）并设为当前场景
+func LoadScenario(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	s, err := ParseScenario(data, ext == ".yaml" || ext == ".yml")
+	if err != nil {
+		return err
+	}
+	SetScenario(s)
+	return nil
+}
+
+// scenarioState 当前场景的运行状态
+type scenarioState struct {
+	mu       sync.Mutex
+	scenario *Scenario
+	used     []bool
+	requests []ChatCompletionRequest
+}
+
+var scenario scenarioState
+
+// SetScenario 设置当前场景并重置进度，nil 退出场景模式
+func SetScenario(s *Scenario) {
+	scenario.mu.Lock()
+	defer scenario.mu.Unlock()
+	scenario.scenario = s
+	scenario.used = nil
+	if s != nil {
+		scenario.used = make([]bool, len(s.Turns))
+	}
+	scenario.requests = nil
+}
+
+// ScenarioRemaining 当前场景尚未消费的轮次数
+func ScenarioRemaining() int {
+	scenario.mu.Lock()
+	defer scenario.mu.Unlock()
+	n := 0
+	for _, used := range scenario.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// ScenarioRequests 返回场景接管的请求（按到达顺序），供测试断言发给模型的内容
+func ScenarioRequests() []ChatCompletionRequest {
+	scenario.mu.Lock()
+	defer scenario.mu.Unlock()
+	return append([]ChatCompletionRequest(nil), scenario.requests...)
+}
+
+// nextTurn 为请求选出下一轮。handled 为 false 时请求交回内置模拟响应
+func (st *scenarioState) nextTurn(req ChatCompletionRequest) (turn Turn, exhausted, handled bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s := st.scenario
+	if s == nil || (s.Model != "" && s.Model != req.Model) {
+		return Turn{}, false, false
+	}
+	last := ""
+	if len(req.Messages) > 0 {
+		last = req.Messages[len(req.Messages)-1].Content
+	}
+	for i, t := range s.Turns {
+		if st.used[i] || (t.Match != "" && !strings.Contains(last, t.Match)) {
+			continue
+		}
+		st.used[i] = true
+		st.requests = append(st.requests, req)
+		return t, false, true
+	}
+	if s.Exhausted == "error" {
+		st.requests = append(st.requests, req)
+		return Turn{}, true, true
+	}
+	return Turn{}, false, false
+}
+
+// serveScenario 当前场景接管请求时写出响应并返回 true
+func serveScenario(w http.ResponseWriter, req ChatCompletionRequest) bool {
+	turn, exhausted, handled := scenario.nextTurn(req)
+	if !handled {
+		return false
+	}
+	if exhausted {
+		writeScenarioError(w, http.StatusInternalServerError, "mock scenario exhausted")
+		return true
+	}
+	sleepMs(turn.DelayMs)
+	for k, v := range turn.Headers {
+		w.Header().Set(k, v)
+	}
+	if turn.Status != 0 && turn.Status != http.StatusOK {
+		msg := turn.Error
+		if msg == "" {
+			msg = http.StatusText(turn.Status)
+		}
+		writeScenarioError(w, turn.Status, msg)
+		return true
+	}
+	if !req.Stream {
+		writeScenarioJSON(w, req, turn)
+		return true
+	}
+	writeScenarioStream(w, req, turn)
+	return true
+}
+
+func sleepMs(ms int) {
+	if ms > 0 {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+	}
+}
+
+func writeScenarioError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	data, _ := json.Marshal(map[string]any{"error": map[string]string{"message": msg, "type": "mock_error"}})
+	w.Write(data)
+}
+
+// scenarioDelta 一个流式 delta 及发送前的等待
+type scenarioDelta struct {
+	msg     Message
+	delayMs int
+}
+
+// scenarioDeltas 把轮次的增量展开为流式 delta，并返回结束原因。Chunk 的等待加在它的第一个 delta 上
+func scenarioDeltas(turn Turn) ([]scenarioDelta, string) {
+	var deltas []scenarioDelta
+	calls := 0
+	for _, c := range turn.Chunks {
+		start := len(deltas)
+		if c.Text != "" || c.Reasoning != "" {
+			deltas = append(deltas, scenarioDelta{msg: Message{Role: "assistant", Content: c.Text, ReasoningContent: c.Reasoning}})
+		}
+		if tc := c.ToolCall; tc != nil {
+			id := tc.ID
+			if id == "" {
+				id = fmt.Sprintf("call_scenario_%d", calls+1)
+			}
+			deltas = append(deltas, scenarioDelta{msg: Message{Role: "assistant", ToolCalls: []StreamToolCall{{
+				Index: calls, ID: id, Type: "function", Function: &StreamToolCallFunction{Name: tc.Name},
+			}}}})
+			args := tc.arguments()
+			step := len(args)
+			if tc.Split > 0 {
+				step = tc.Split
+			}
+			for off := 0; off < len(args); off += step {
+				deltas = append(deltas, scenarioDelta{msg: Message{ToolCalls: []StreamToolCall{{
+					Index: calls, Function: &StreamToolCallFunction{Arguments: args[off:min(off+step, len(args))]},
+				}}}})
+			}
+			calls++
+		}
+		if len(deltas) > start {
+			deltas[start].delayMs = c.DelayMs
+		}
+	}
+	finish := turn.Finish
+	if finish == "" {
+		finish = "stop"
+		if calls > 0 {
+			finish = "tool_calls"
+		}
+	}
+	return deltas, finish
+}
+
+// scenarioUsage 轮次的用量，未指定时按空格分词估算
+func scenarioUsage(req ChatCompletionRequest, turn Turn) Usage {
+	if turn.Usage != nil {
+		u := *turn.Usage
+		if u.TotalTokens == 0 {
+			u.TotalTokens = u.PromptTokens + u.CompletionTokens
+		}
+		return u
+	}
+	var u Usage
+	for _, msg := range req.Messages {
+		u.PromptTokens += calculateTokens(msg.Content)
+	}
+	for _, c := range turn.Chunks {
+		u.CompletionTokens += calculateTokens(c.Text) + calculateTokens(c.Reasoning)
+	}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
+
+func writeScenarioStream(w http.ResponseWriter, req ChatCompletionRequest, turn Turn) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	responseID := generateID("chatcmpl")
+	created := time.Now().Unix()
+	write := func(v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			log.Printf("[mock] failed to marshal scenario chunk: %v", err)
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flush()
+	}
+	chunk := func(delta Message, finish string) map[string]any {
+		return map[string]any{
+			"id": responseID, "object": "chat.completion.chunk", "created": created, "model": req.Model,
+			"choices": []Choice{{Index: 0, Delta: delta, FinishReason: finish}},
+		}
+	}
+
+	deltas, finish := scenarioDeltas(turn)
+	w.WriteHeader(http.StatusOK)
+	for _, d := range deltas {
+		sleepMs(d.delayMs)
+		write(chunk(d.msg, ""))
+	}
+	if turn.Drop {
+		// 中止处理器：net/http 直接断开连接，客户端读到不完整的流
+		panic(http.ErrAbortHandler)
+	}
+	write(chunk(Message{}, finish))
+	u := scenarioUsage(req, turn)
+	write(map[string]any{
+		"id": responseID, "object": "chat.completion.chunk", "created": created, "model": req.Model,
+		"choices": []Choice{}, "usage": u,
+	})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flush()
+}
+
+// writeScenarioJSON 非流式请求：合并所有增量为一条完整消息
+func writeScenarioJSON(w http.ResponseWriter, req ChatCompletionRequest, turn Turn) {
+	deltas, finish := scenarioDeltas(turn)
+	msg := Message{Role: "assistant"}
+	for _, d := range deltas {
+		msg.Content += d.msg.Content
+		msg.ReasoningContent += d.msg.ReasoningContent
+		for _, tc := range d.msg.ToolCalls {
+			if tc.ID != "" {
+				msg.ToolCalls = append(msg.ToolCalls, tc)
+				continue
+			}
+			last := &msg.ToolCalls[len(msg.ToolCalls)-1]
+			last.Function = &StreamToolCallFunction{Name: last.Function.Name, Arguments: last.Function.Arguments + tc.Function.Arguments}
+		}
+	}
+	resp := ChatCompletionResponse{
+		ID:      generateID("chatcmpl"),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []Choice{{Index: 0, Delta: msg, FinishReason: finish}},
+		Usage:   scenarioUsage(req, turn),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,180 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const scenarioYAML = `
+name: approval
+turns:
+  - match: please edit
+    chunks:
+      - reasoning: "need to edit"
+      - text: "Editing now."
+      - tool_call:
+          id: call_1
+          name: edit
+          arguments: {path: a.txt, text: hello}
+          split: 8
+    usage: {prompt_tokens: 10, completion_tokens: 4}
+  - status: 429
+    error: slow down
+    headers: {retry-after-ms: "20"}
+  - chunks:
+      - text: "done"
+`
+
+// streamScenario 以流式请求访问 handler，返回每个 data 帧（不含 [DONE]）与是否收到 [DONE]
+func streamScenario(t *testing.T, url, model, content string) (int, []map[string]any, bool, error) {
+	t.Helper()
+	body, _ := json.Marshal(ChatCompletionRequest{Model: model, Stream: true, Messages: []Message{{Role: "user", Content: content}}})
+	resp, err := http.Post(url+"/v1/chat/completions", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var frames []map[string]any
+	done := false
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: "); ok {
+			if data == "[DONE]" {
+				done = true
+			} else {
+				var frame map[string]any
+				json.Unmarshal([]byte(data), &frame)
+				frames = append(frames, frame)
+			}
+		}
+		if err == io.EOF {
+			return resp.StatusCode, frames, done, nil
+		}
+		if err != nil {
+			return resp.StatusCode, frames, done, err
+		}
+	}
+}
+
+func TestParseScenario(t *testing.T) {
+	s, err := ParseScenario([]byte(scenarioYAML), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "approval" || len(s.Turns) != 3 || s.Turns[1].Headers["retry-after-ms"] != "20" {
+		t.Fatalf("unexpected scenario: %+v", s)
+	}
+	if got := s.Turns[0].Chunks[2].ToolCall.arguments(); got != `{"path":"a.txt","text":"hello"}` {
+		t.Errorf("object arguments = %s", got)
+	}
+	if _, err := ParseScenario([]byte(`{"turns":[{"chunks":[{"tool_call":{"arguments":"{}"}}]}]}`), false); err == nil {
+		t.Error("tool_call without name should be rejected")
+	}
+	if _, err := ParseScenario([]byte(`{"exhausted":"loop"}`), false); err == nil {
+		t.Error("unknown exhausted mode should be rejected")
+	}
+
+	path := filepath.Join(t.TempDir(), "s.yml")
+	os.WriteFile(path, []byte(scenarioYAML), 0644)
+	if err := LoadScenario(path); err != nil {
+		t.Fatal(err)
+	}
+	defer SetScenario(nil)
+	if ScenarioRemaining() != 3 {
+		t.Errorf("remaining = %d", ScenarioRemaining())
+	}
+}
+
+func TestScenarioTurns(t *testing.T) {
+	s, err := ParseScenario([]byte(scenarioYAML), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Model = "scenario-model"
+	s.Exhausted = "error"
+	SetScenario(s)
+	defer SetScenario(nil)
+	srv := httptest.NewServer(newHandler())
+	defer srv.Close()
+
+	// 其他模型不受场景影响
+	if _, frames, _, _ := streamScenario(t, srv.URL, "test-chat-flash", "hi"); len(frames) == 0 || ScenarioRemaining() != 3 {
+		t.Fatalf("other models should use the built-in mock (remaining %d)", ScenarioRemaining())
+	}
+
+	// 第一轮要求 match：不匹配的请求由第二轮（429）响应
+	status, _, _, _ := streamScenario(t, srv.URL, "scenario-model", "hello")
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("unmatched request should get the 429 turn, got %d", status)
+	}
+
+	status, frames, done, _ := streamScenario(t, srv.URL, "scenario-model", "please edit a.txt")
+	if status != http.StatusOK || !done {
+		t.Fatalf("status %d, done %v", status, done)
+	}
+	var text, reasoning, args, finish string
+	var usage map[string]any
+	for _, f := range frames {
+		if u, ok := f["usage"].(map[string]any); ok {
+			usage = u
+		}
+		choices, _ := f["choices"].([]any)
+		if len(choices) == 0 {
+			continue
+		}
+		c := choices[0].(map[string]any)
+		if fr, _ := c["finish_reason"].(string); fr != "" {
+			finish = fr
+		}
+		d := c["delta"].(map[string]any)
+		text += d["content"].(string)
+		if r, ok := d["reasoning_content"].(string); ok {
+			reasoning += r
+		}
+		if tcs, ok := d["tool_calls"].([]any); ok {
+			fn := tcs[0].(map[string]any)["function"].(map[string]any)
+			if a, ok := fn["arguments"].(string); ok {
+				args += a
+			}
+		}
+	}
+	if text != "Editing now." || reasoning != "need to edit" || args != `{"path":"a.txt","text":"hello"}` || finish != "tool_calls" {
+		t.Errorf("text=%q reasoning=%q args=%q finish=%q", text, reasoning, args, finish)
+	}
+	if usage == nil || usage["prompt_tokens"] != float64(10) || usage["total_tokens"] != float64(14) {
+		t.Errorf("usage = %v", usage)
+	}
+
+	if _, _, _, _ = streamScenario(t, srv.URL, "scenario-model", "go on"); ScenarioRemaining() != 0 {
+		t.Errorf("all turns should be consumed, remaining %d", ScenarioRemaining())
+	}
+	if status, _, _, _ := streamScenario(t, srv.URL, "scenario-model", "extra"); status != http.StatusInternalServerError {
+		t.Errorf("exhausted scenario should return 500, got %d", status)
+	}
+	if reqs := ScenarioRequests(); len(reqs) != 4 || reqs[1].Messages[0].Content != "please edit a.txt" {
+		t.Errorf("unexpected recorded requests: %+v", reqs)
+	}
+}
+
+func TestScenarioDrop(t *testing.T) {
+	SetScenario(&Scenario{Turns: []Turn{{Chunks: []Chunk{{Text: "partial"}}, Drop: true}}})
+	defer SetScenario(nil)
+	srv := httptest.NewServer(newHandler())
+	defer srv.Close()
+
+	_, frames, done, err := streamScenario(t, srv.URL, "test-chat", "hi")
+	if done || err == nil {
+		t.Errorf("dropped stream should end without [DONE] and with a read error (done %v, err %v)", done, err)
+	}
+	if len(frames) != 1 {
+		t.Errorf("expected the partial chunk before the drop, got %d frames", len(frames))
+	}
+}
@@ -23,6 +23,10 @@ const (
 	TypeJWT     = "jwt"
 	// TypeCustom 用户通过 /mask add 手动指定的自定义脱敏值。
 	TypeCustom = "custom"
+	// TypeEntropy 关键字后的高熵字符串。
+	TypeEntropy = "entropy"
+	// TypePatternPrefix 自定义正则检测器的类型前缀（后接检测器名称）。
+	TypePatternPrefix = "pattern:"
 )
 
 // minBareKeyLen 无前缀裸 token 的最小长度。
@@ -49,10 +53,12 @@ var defaultIPWhitelist = []string{
 
 // Span 表示文本中的一个敏感区间（半开区间 [Start, End)，按字节计）。
 type Span struct {
-	Start    int
-	End      int
-	Type     string
-	Original string
+	Start     int
+	End       int
+	Type      string
+	Original  string
+	Generator string // 假值生成类，空为按 Type 选择
+	Detector  string // 命中的检测器（同类型有多个检测器时区分），空为同 Type
 }
 
 // keyPrefixes 已知密钥前缀，检测时用于识别 apikey。
@@ -138,6 +144,12 @@ func detectSensitive(text string, cfg *configStructs.DataMaskConfig, maskToOrig
 	if cfg.MaskIP {
 		spans = append(spans, detectIP(text, cfg)...)
 	}
+	if len(cfg.CustomPatterns) > 0 {
+		spans = append(spans, detectPatterns(text, cfg.CustomPatterns)...)
+	}
+	if cfg.MaskEntropy {
+		spans = append(spans, detectEntropy(text, cfg)...)
+	}
 	return resolveSpans(spans, maskToOrig)
 }
 
@@ -145,7 +157,7 @@ func detectPrefixKey(text string) []Span {
 	var spans []Span
 	for _, loc := range prefixKeyRe().FindAllStringIndex(text, -1) {
 		s := text[loc[0]:loc[1]]
-		spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeAPIKey, Original: s})
+		spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeAPIKey, Original: s, Detector: "apikey:prefix"})
 	}
 	return spans
 }
@@ -155,12 +167,12 @@ func detectBareKey(text string) []Span {
 	for _, loc := range bareHexRe().FindAllStringIndex(text, -1) {
 		s := text[loc[0]:loc[1]]
 		if isHexKey(s) {
-			spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeAPIKey, Original: s})
+			spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeAPIKey, Original: s, Detector: "apikey:hex"})
 		}
 	}
 	for _, loc := range bareAlnumRe().FindAllStringIndex(text, -1) {
 		s := text[loc[0]:loc[1]]
-		spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeAPIKey, Original: s})
+		spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeAPIKey, Original: s, Detector: "apikey:bare"})
 	}
 	return spans
 }
@@ -185,7 +197,7 @@ func detectIP(text string, cfg *configStructs.DataMaskConfig) []Span {
 		if ip == nil || ip.To4() == nil || !isPublicIP(ip) || ipWhitelisted(ip, cfg.MaskIPWhitelist) {
 			continue
 		}
-		spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeIP, Original: s})
+		spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeIP, Original: s, Detector: "ipv4"})
 	}
 	for _, loc := range ipv6RunRe().FindAllStringIndex(text, -1) {
 		s := text[loc[0]:loc[1]]
@@ -196,7 +208,7 @@ func detectIP(text string, cfg *configStructs.DataMaskConfig) []Span {
 		if ip == nil || ip.To16() == nil || ip.To4() != nil || !isPublicIP(ip) || ipWhitelisted(ip, cfg.MaskIPWhitelist) {
 			continue
 		}
-		spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeIP, Original: s})
+		spans = append(spans, Span{Start: loc[0], End: loc[1], Type: TypeIP, Original: s, Detector: "ipv6"})
 	}
 	return spans
 }
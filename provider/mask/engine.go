@@ -1,7 +1,12 @@
 package mask
 
 import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/cxykevin/alkaid0/config"
 	configStructs "github.com/cxykevin/alkaid0/config/structs"
@@ -26,11 +31,12 @@ type Engine struct {
 	db           *gorm.DB
 	cfg          configStructs.DataMaskConfig
 	mu           sync.RWMutex
-	origToMask   map[KeyRef]string     // 原值 → 假值（脱敏方向）
-	maskToOrig   map[string]string     // 假值 → 原值（还原方向）
-	contentRep   *ahocorasick.Replacer // 正文流还原器
-	reasoningRep *ahocorasick.Replacer // 思考流还原器（独立状态，避免跨流误拼接）
-	custom       []string              // /mask add 的自定义脱敏值（精确匹配）
+	origToMask   map[KeyRef]string             // 原值 → 假值（脱敏方向）
+	maskToOrig   map[string]string             // 假值 → 原值（还原方向）
+	contentRep   *ahocorasick.Replacer         // 正文流还原器
+	reasoningRep *ahocorasick.Replacer         // 思考流还原器（独立状态，避免跨流误拼接）
+	argsReps     map[int]*ahocorasick.Replacer // 各原生工具调用（按 index）参数流的还原器
+	custom       []string                      // /mask add 的自定义脱敏值（精确匹配）
 }
 
 // NewEngine 创建引擎。功能未启用 / db 为 nil / 映射表不存在时返回 nil（调用方零行为变化）。
@@ -87,12 +93,18 @@ func (e *Engine) loadMappings() {
 
 // rebuildReplacersLocked 依据当前 maskToOrig 重建还原器（调用方须持写锁）。
 func (e *Engine) rebuildReplacersLocked() {
+	e.contentRep = e.newReplacerLocked()
+	e.reasoningRep = e.newReplacerLocked()
+	e.argsReps = make(map[int]*ahocorasick.Replacer)
+}
+
+// newReplacerLocked 依据当前 maskToOrig 新建一个还原器（调用方须持锁）。
+func (e *Engine) newReplacerLocked() *ahocorasick.Replacer {
 	items := make([]ahocorasick.Item, 0, len(e.maskToOrig))
 	for masked, orig := range e.maskToOrig {
 		items = append(items, ahocorasick.Item{Keyword: masked, Replace: orig})
 	}
-	e.contentRep = ahocorasick.NewReplacer(items)
-	e.reasoningRep = ahocorasick.NewReplacer(items)
+	return ahocorasick.NewReplacer(items)
 }
 
 // MaskMessages 对消息列表逐条脱敏。返回新切片；原切片不被修改。
@@ -100,22 +112,23 @@ func (e *Engine) MaskMessages(messages []structs.Message) []structs.Message {
 	out := make([]structs.Message, len(messages))
 	copy(out, messages)
 	changed := false
+	st := &maskStats{spans: map[string]int{}, masked: map[string]struct{}{}}
 	for i := range out {
 		if out[i].Content != "" {
-			if nc, ok := e.maskText(out[i].Content); ok {
+			if nc, ok := e.maskText(out[i].Content, st); ok {
 				out[i].Content = nc
 				changed = true
 			}
 		}
 		if out[i].ReasoningContent != nil && *out[i].ReasoningContent != "" {
-			if nr, ok := e.maskText(*out[i].ReasoningContent); ok {
+			if nr, ok := e.maskText(*out[i].ReasoningContent, st); ok {
 				out[i].ReasoningContent = &nr
 				changed = true
 			}
 		}
 		for j := range out[i].ToolCalls {
 			if out[i].ToolCalls[j].Function != nil && out[i].ToolCalls[j].Function.Arguments != "" {
-				if na, ok := e.maskText(out[i].ToolCalls[j].Function.Arguments); ok {
+				if na, ok := e.maskText(out[i].ToolCalls[j].Function.Arguments, st); ok {
 					out[i].ToolCalls[j].Function.Arguments = na
 					changed = true
 				}
@@ -128,11 +141,46 @@ func (e *Engine) MaskMessages(messages []structs.Message) []structs.Message {
 		e.rebuildReplacersLocked()
 		e.mu.Unlock()
 	}
+	e.recordStats(st)
 	return out
 }
 
-// maskText 对单段文本执行脱敏替换（从右到左，假值等长索引不回移）。
-func (e *Engine) maskText(text string) (string, bool) {
+// maskStats 单次请求的脱敏统计。
+type maskStats struct {
+	spans  map[string]int      // 类型 → 脱敏区间数
+	masked map[string]struct{} // 本次命中的假值（去重，用于累计请求次数）
+}
+
+// recordStats 累计本次请求命中映射的请求次数与最近时间，按配置输出统计日志。
+func (e *Engine) recordStats(st *maskStats) {
+	if len(st.masked) == 0 {
+		return
+	}
+	fakes := make([]string, 0, len(st.masked))
+	for fake := range st.masked {
+		fakes = append(fakes, fake)
+	}
+	if err := e.db.Model(&storageStructs.KeyMapping{}).Where("masked IN ?", fakes).Updates(map[string]any{
+		"hits":      gorm.Expr("hits + 1"),
+		"last_seen": uint64(time.Now().Unix()),
+	}).Error; err != nil {
+		logger.Warn("data mask: record hits: %v", err)
+	}
+	if !e.cfg.LogStats {
+		return
+	}
+	types := make([]string, 0, len(st.spans))
+	total := 0
+	for typ, n := range st.spans {
+		types = append(types, fmt.Sprintf("%s=%d", typ, n))
+		total += n
+	}
+	sort.Strings(types)
+	logger.Info("data mask: masked %d span(s) in request (%s)", total, strings.Join(types, ", "))
+}
+
+// maskText 对单段文本执行脱敏替换（从右到左，假值等长索引不回移），命中计入 st。
+func (e *Engine) maskText(text string, st *maskStats) (string, bool) {
 	e.mu.RLock()
 	spans := detectSensitive(text, &e.cfg, e.maskToOrig)
 	if len(e.custom) > 0 {
@@ -146,13 +194,15 @@ func (e *Engine) maskText(text string) (string, bool) {
 	result := []byte(text)
 	for i := len(spans) - 1; i >= 0; i-- {
 		s := spans[i]
-		fake, err := e.lookupOrCreate(s.Type, s.Original)
+		fake, err := e.lookupOrCreate(s)
 		if err != nil {
 			continue
 		}
 		if fake == "" || fake == s.Original {
 			continue
 		}
+		st.spans[s.Type]++
+		st.masked[fake] = struct{}{}
 		buf := make([]byte, 0, len(result))
 		buf = append(buf, result[:s.Start]...)
 		buf = append(buf, fake...)
@@ -163,7 +213,9 @@ func (e *Engine) maskText(text string) (string, bool) {
 }
 
 // lookupOrCreate 查找或创建「原值 → 假值」映射（db 为唯一事实源，保证同 key 同假值）。
-func (e *Engine) lookupOrCreate(typ, original string) (string, error) {
+// span.Generator 非空时按该生成类生成假值，否则按类型生成；检测器仅在新建映射时记录。
+func (e *Engine) lookupOrCreate(span Span) (string, error) {
+	typ, original := span.Type, span.Original
 	e.mu.RLock()
 	if m, ok := e.origToMask[KeyRef{typ, original}]; ok {
 		e.mu.RUnlock()
@@ -179,11 +231,11 @@ func (e *Engine) lookupOrCreate(typ, original string) (string, error) {
 	}
 
 	for range 8 {
-		fake := genFake(original, typ)
+		fake := genFake(original, cmp.Or(span.Generator, typ))
 		if fake == original || fake == "" {
 			continue
 		}
-		row := storageStructs.KeyMapping{KeyType: typ, Original: original, Masked: fake}
+		row := storageStructs.KeyMapping{KeyType: typ, Original: original, Masked: fake, Detector: cmp.Or(span.Detector, typ)}
 		if err := e.db.Create(&row).Error; err == nil {
 			e.origToMask[KeyRef{typ, original}] = fake
 			e.maskToOrig[fake] = original
@@ -223,6 +275,100 @@ func (e *Engine) RestoreReasoning(s string) string {
 	return string(r.Stream([]byte(s)))
 }
 
+// RestoreToolArgs 流式还原原生工具调用 index 的参数 delta（各调用独立状态，
+// 避免与正文流或其他调用的参数交错时误拼接）。
+func (e *Engine) RestoreToolArgs(index int, s string) string {
+	if s == "" {
+		return s
+	}
+	e.mu.Lock()
+	r, ok := e.argsReps[index]
+	if !ok {
+		if e.argsReps == nil {
+			e.argsReps = make(map[int]*ahocorasick.Replacer)
+		}
+		r = e.newReplacerLocked()
+		e.argsReps[index] = r
+	}
+	e.mu.Unlock()
+	return string(r.Stream([]byte(s)))
+}
+
+// FinishToolArgs 流结束时刷出各工具调用参数流的残留缓冲（index → 残留，仅含非空项）。
+func (e *Engine) FinishToolArgs() map[int]string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	res := make(map[int]string)
+	for index, r := range e.argsReps {
+		if rest := r.Finish(); len(rest) > 0 {
+			res[index] = string(rest)
+		}
+	}
+	return res
+}
+
+// RestoreText 一次性还原完整文本（非流式，不影响各流式还原器的状态）。
+func (e *Engine) RestoreText(s string) string {
+	if s == "" {
+		return s
+	}
+	e.mu.RLock()
+	r := e.newReplacerLocked()
+	e.mu.RUnlock()
+	return restoreOnce(r, s)
+}
+
+// RestoreParams 还原已解析工具参数中的假值（递归处理字符串、数组与对象），返回新 map，原 map 不被修改。
+func (e *Engine) RestoreParams(params map[string]*any) map[string]*any {
+	if params == nil {
+		return nil
+	}
+	e.mu.RLock()
+	if len(e.maskToOrig) == 0 {
+		e.mu.RUnlock()
+		return params
+	}
+	r := e.newReplacerLocked()
+	e.mu.RUnlock()
+	out := make(map[string]*any, len(params))
+	for k, v := range params {
+		if v == nil {
+			out[k] = nil
+			continue
+		}
+		nv := restoreValue(r, *v)
+		out[k] = &nv
+	}
+	return out
+}
+
+// restoreOnce 用 r 完整还原 s（Finish 会重置状态，r 可复用）。
+func restoreOnce(r *ahocorasick.Replacer, s string) string {
+	return string(append(r.Stream([]byte(s)), r.Finish()...))
+}
+
+// restoreValue 递归还原 JSON 值中的字符串。
+func restoreValue(r *ahocorasick.Replacer, v any) any {
+	switch val := v.(type) {
+	case string:
+		return restoreOnce(r, val)
+	case []any:
+		res := make([]any, len(val))
+		for i, item := range val {
+			res[i] = restoreValue(r, item)
+		}
+		return res
+	case map[string]any:
+		res := make(map[string]any, len(val))
+		for k, item := range val {
+			res[k] = restoreValue(r, item)
+		}
+		return res
+	default:
+		return v
+	}
+}
+
 // FinishRestore 流结束时刷出两条流的残留缓冲。
 func (e *Engine) FinishRestore() (content, reasoning string) {
 	e.mu.RLock()
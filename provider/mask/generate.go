@@ -7,7 +7,16 @@ import (
 	"strings"
 )
 
-// genFake 按类型生成与原值同长度、同字符集的假值。
+// 自定义正则检测器可选的假值生成类（phone/ip/jwt 与同名类型共用生成器）
+const (
+	GenGeneric   = "generic"
+	GenAlnum     = "alnum"
+	GenHex       = "hex"
+	GenDigits    = "digits"
+	GenBase64URL = "base64url"
+)
+
+// genFake 按类型（或生成类）生成与原值同长度、同字符集的假值。
 // 生成结果不要求确定性（db 中的映射是唯一事实源）；仅要求格式与长度保持一致。
 func genFake(original, typ string) string {
 	switch typ {
@@ -17,6 +26,14 @@ func genFake(original, typ string) string {
 		return genIP(original)
 	case TypeJWT:
 		return genJWT(original)
+	case GenAlnum:
+		return genByCharClass(original)
+	case GenHex:
+		return genHexLike(original)
+	case GenDigits:
+		return genDigitsLike(original)
+	case GenBase64URL:
+		return genBase64URL(len(original))
 	default:
 		return genGeneric(original)
 	}
@@ -110,6 +127,17 @@ func genDigits(n int) string {
 	return string(b)
 }
 
+// genDigitsLike 只替换数字位，其余字符（如卡号中的 - 与空格）原样保留。
+func genDigitsLike(s string) string {
+	b := []byte(s)
+	for i := range b {
+		if isDigit(b[i]) {
+			b[i] = byte('0' + rand.Intn(10))
+		}
+	}
+	return string(b)
+}
+
 // genByCharClass 按同字符类连续段生成：数字→数字、小写→小写、大写→大写、符号→原样保留。
 func genByCharClass(s string) string {
 	b := make([]byte, 0, len(s))
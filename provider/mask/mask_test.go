@@ -407,6 +407,162 @@ func TestEngineDeterministic(t *testing.T) {
 	}
 }
 
+func TestRestoreToolArgsInterleaved(t *testing.T) {
+	enableMask(t)
+	db := newTestDB(t)
+	eng := NewEngine(db)
+	secret := "sk-or-v1-abc123def456ghi789"
+	masked := eng.MaskMessages([]structs.Message{{Role: structs.RoleUser, Content: "key " + secret}})[0].Content
+	fake := strings.TrimPrefix(masked, "key ")
+
+	// 两个调用的参数与正文交错到达，各自独立还原
+	args0 := `{"command":"curl -H 'Authorization: Bearer ` + fake + `' x"}`
+	args1 := `{"key":"` + fake + `"}`
+	var out0, out1, content strings.Builder
+	c0, c1 := splitChunks(args0, 3), splitChunks(args1, 4)
+	for i := 0; i < max(len(c0), len(c1)); i++ {
+		if i < len(c0) {
+			out0.WriteString(eng.RestoreToolArgs(0, c0[i]))
+		}
+		content.WriteString(eng.RestoreContent("ab"))
+		if i < len(c1) {
+			out1.WriteString(eng.RestoreToolArgs(1, c1[i]))
+		}
+	}
+	rest := eng.FinishToolArgs()
+	out0.WriteString(rest[0])
+	out1.WriteString(rest[1])
+	if want := strings.ReplaceAll(args0, fake, secret); out0.String() != want {
+		t.Errorf("args 0 = %q, want %q", out0.String(), want)
+	}
+	if want := strings.ReplaceAll(args1, fake, secret); out1.String() != want {
+		t.Errorf("args 1 = %q, want %q", out1.String(), want)
+	}
+	c, _ := eng.FinishRestore()
+	if got := content.String() + c; strings.Trim(got, "ab") != "" {
+		t.Errorf("args leaked into content: %q", got)
+	}
+}
+
+func TestRestoreParams(t *testing.T) {
+	enableMask(t)
+	db := newTestDB(t)
+	eng := NewEngine(db)
+	secret := "sk-or-v1-abc123def456ghi789"
+	fake := strings.TrimPrefix(eng.MaskMessages([]structs.Message{{Role: structs.RoleUser, Content: "key " + secret}})[0].Content, "key ")
+
+	cmd := any("echo " + fake)
+	headers := any(map[string]any{"Authorization": "Bearer " + fake, "n": float64(1)})
+	list := any([]any{fake, true})
+	params := map[string]*any{"command": &cmd, "headers": &headers, "list": &list, "nil": nil}
+	out := eng.RestoreParams(params)
+
+	if (*out["command"]).(string) != "echo "+secret {
+		t.Errorf("command not restored: %v", *out["command"])
+	}
+	h := (*out["headers"]).(map[string]any)
+	if h["Authorization"] != "Bearer "+secret || h["n"] != float64(1) {
+		t.Errorf("headers not restored: %v", h)
+	}
+	l := (*out["list"]).([]any)
+	if l[0] != secret || l[1] != true {
+		t.Errorf("list not restored: %v", l)
+	}
+	if v, ok := out["nil"]; !ok || v != nil {
+		t.Errorf("nil param changed: %v", v)
+	}
+	// 原 map 不被修改
+	if cmd.(string) != "echo "+fake {
+		t.Errorf("input params mutated: %v", cmd)
+	}
+	if got := eng.RestoreText(`{"k":"` + fake + `"}`); got != `{"k":"`+secret+`"}` {
+		t.Errorf("RestoreText = %q", got)
+	}
+}
+
+func TestDetectCustomPatterns(t *testing.T) {
+	cfg := &configStructs.DataMaskConfig{CustomPatterns: []configStructs.MaskPattern{
+		{Name: "employee", Regex: `EMP-\d{6}`},
+		{Name: "card", Regex: `card=(\d{4}-\d{4})-(\d{4})`, Generator: GenDigits},
+		{Name: "broken", Regex: `(`},
+	}}
+	spans := detectSensitive("id EMP-123456 card=1234-5678-9012 end", cfg, nil)
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %+v", spans)
+	}
+	if spans[0].Type != TypePatternPrefix+"employee" || spans[0].Original != "EMP-123456" {
+		t.Fatalf("whole-match span: %+v", spans[0])
+	}
+	if spans[1].Original != "1234-5678" || spans[2].Original != "9012" || spans[1].Generator != GenDigits {
+		t.Fatalf("capture group spans: %+v", spans[1:])
+	}
+	fake := genFake("1234-5678", GenDigits)
+	if len(fake) != 9 || fake[4] != '-' || !isDigits(fake[:4]+fake[5:]) {
+		t.Fatalf("digits generator should keep separators: %q", fake)
+	}
+}
+
+func TestDetectEntropy(t *testing.T) {
+	cfg := &configStructs.DataMaskConfig{MaskEntropy: true}
+	text := `password = "Xk9#mQ2$vL7pWz" db_password: changeme api_key=getKey() secret_token=${SECRET} pwd=aaaaaaaaaaaa`
+	spans := detectSensitive(text, cfg, nil)
+	if len(spans) != 1 || spans[0].Type != TypeEntropy || spans[0].Original != "Xk9#mQ2$vL7pWz" {
+		t.Fatalf("expected only the high-entropy password, got %+v", spans)
+	}
+	if spans := detectSensitive(text, &configStructs.DataMaskConfig{}, nil); len(spans) != 0 {
+		t.Fatalf("entropy detector should be off by default: %+v", spans)
+	}
+	// 自定义关键字与阈值
+	cfg = &configStructs.DataMaskConfig{MaskEntropy: true, EntropyKeywords: []string{"dsn"}, EntropyThreshold: 2, EntropyMinLength: 6}
+	spans = detectSensitive("DSN=changeme password=Xk9#mQ2$vL7pWz", cfg, nil)
+	if len(spans) != 1 || spans[0].Original != "changeme" {
+		t.Fatalf("custom keywords: %+v", spans)
+	}
+	// 空白关键字不能匹配任意键名，全部为空时回退到内置关键字
+	for _, keywords := range [][]string{{""}, {" ", "\t"}, {"dsn", ""}} {
+		cfg = &configStructs.DataMaskConfig{MaskEntropy: true, EntropyKeywords: keywords}
+		spans = detectSensitive("commit=Xk9#mQ2$vL7pWz", cfg, nil)
+		if len(spans) != 0 {
+			t.Fatalf("blank keywords %q should not match arbitrary keys: %+v", keywords, spans)
+		}
+	}
+	cfg = &configStructs.DataMaskConfig{MaskEntropy: true, EntropyKeywords: []string{"", " "}}
+	spans = detectSensitive("password=Xk9#mQ2$vL7pWz", cfg, nil)
+	if len(spans) != 1 || spans[0].Original != "Xk9#mQ2$vL7pWz" {
+		t.Fatalf("blank keywords should fall back to the defaults: %+v", spans)
+	}
+}
+
+func TestEnginePatternAndEntropyMappings(t *testing.T) {
+	restore := config.GlobalConfigSwap(configStructs.Config{
+		DataMask: configStructs.DataMaskConfig{
+			Enable:         true,
+			MaskEntropy:    true,
+			CustomPatterns: []configStructs.MaskPattern{{Name: "ticket", Regex: `TCK-[A-Z0-9]{8}`}},
+		},
+	})
+	t.Cleanup(restore)
+	db := newTestDB(t)
+	eng := NewEngine(db)
+	content := "ticket TCK-AB12CD34 with password=Xk9#mQ2$vL7pWz"
+	masked := eng.MaskMessages([]structs.Message{{Role: structs.RoleUser, Content: content}})[0].Content
+	if strings.Contains(masked, "TCK-AB12CD34") || strings.Contains(masked, "Xk9#mQ2$vL7pWz") || len(masked) != len(content) {
+		t.Fatalf("unexpected masked content: %s", masked)
+	}
+	var rows []storageStructs.KeyMapping
+	if err := db.Order("key_type").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].KeyType != TypeEntropy || rows[1].KeyType != "pattern:ticket" {
+		t.Fatalf("unexpected mappings: %+v", rows)
+	}
+	restored := eng.RestoreContent(masked)
+	c, _ := eng.FinishRestore()
+	if restored+c != content {
+		t.Fatalf("restore mismatch: %q", restored+c)
+	}
+}
+
 func TestAddDelCustom(t *testing.T) {
 	enableMask(t)
 	db := newTestDB(t)
@@ -545,3 +701,49 @@ func splitChunks(s string, n int) []string {
 	}
 	return chunks
 }
+
+func TestEngineHitsAndReport(t *testing.T) {
+	restore := config.GlobalConfigSwap(configStructs.Config{
+		DataMask: configStructs.DataMaskConfig{Enable: true, MaskAPIKey: true, MaskIP: true, LogStats: true},
+	})
+	defer restore()
+	db := newTestDB(t)
+	key, ip := "sk-or-v1-abc123def456ghi789", "45.45.45.45"
+
+	// 同一请求内多次出现只计一次
+	NewEngine(db).MaskMessages([]structs.Message{
+		{Role: structs.RoleUser, Content: "key " + key + " again " + key},
+		{Role: structs.RoleUser, Content: "ip " + ip},
+	})
+	NewEngine(db).MaskMessages([]structs.Message{{Role: structs.RoleUser, Content: "key " + key}})
+	NewEngine(db).MaskMessages([]structs.Message{{Role: structs.RoleUser, Content: "nothing here"}})
+
+	report, err := BuildReport(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Enabled || len(report.Entries) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	k, i := report.Entries[0], report.Entries[1]
+	if k.Type != TypeAPIKey || k.Detector != "apikey:prefix" || k.Hits != 2 || k.FirstSeen == 0 || k.LastSeen == 0 {
+		t.Errorf("unexpected apikey entry: %+v", k)
+	}
+	if i.Type != TypeIP || i.Detector != "ipv4" || i.Hits != 1 {
+		t.Errorf("unexpected ip entry: %+v", i)
+	}
+	if k.Original != "sk-o…89" || i.Original != "45.4…45" || strings.Contains(k.Original, key) {
+		t.Errorf("original not truncated: %q %q", k.Original, i.Original)
+	}
+	if k.Masked == key || !strings.HasPrefix(k.Masked, "sk-or-v1-") {
+		t.Errorf("unexpected masked value: %q", k.Masked)
+	}
+}
+
+func TestTruncateOriginal(t *testing.T) {
+	for in, want := range map[string]string{"": "", "abc": "a…", "12345678": "1…", "123456789": "1234…89", "密钥密钥密钥密钥密钥": "密钥密钥…密钥"} {
+		if got := truncateOriginal(in); got != want {
+			t.Errorf("truncateOriginal(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package mask
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+
+	configStructs "github.com/cxykevin/alkaid0/config/structs"
+)
+
+// 高熵检测默认参数
+const (
+	defaultEntropyThreshold = 3.0
+	defaultEntropyMinLength = 8
+)
+
+// defaultEntropyKeywords 高熵检测的内置关键字（匹配以其开头的键名，如 password_hash、secretKey）。
+var defaultEntropyKeywords = []string{
+	"password", "passwd", "pwd", "pass", "secret", "token", "api_key", "apikey", "api-key",
+	"access_key", "accesskey", "private_key", "privatekey", "credential", "auth",
+}
+
+// patternCache 正则源码 → 编译结果（编译失败为 nil，仅告警一次）。
+var patternCache sync.Map
+
+// compilePattern 编译并缓存自定义正则。
+func compilePattern(p configStructs.MaskPattern) *regexp.Regexp {
+	if v, ok := patternCache.Load(p.Regex); ok {
+		return v.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(p.Regex)
+	if err != nil {
+		logger.Warn("data mask: invalid custom pattern %q: %v", p.Name, err)
+		re = nil
+	}
+	patternCache.Store(p.Regex, re)
+	return re
+}
+
+// detectPatterns 按自定义正则检测。有捕获组时只取各捕获组，否则取整段匹配。
+func detectPatterns(text string, patterns []configStructs.MaskPattern) []Span {
+	var spans []Span
+	for _, p := range patterns {
+		if p.Name == "" || p.Regex == "" {
+			continue
+		}
+		re := compilePattern(p)
+		if re == nil {
+			continue
+		}
+		typ := TypePatternPrefix + p.Name
+		for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+			if len(loc) == 2 {
+				if loc[1] > loc[0] {
+					spans = append(spans, Span{Start: loc[0], End: loc[1], Type: typ, Original: text[loc[0]:loc[1]], Generator: p.Generator})
+				}
+				continue
+			}
+			for g := 2; g+1 < len(loc); g += 2 {
+				if loc[g] < 0 || loc[g+1] <= loc[g] {
+					continue
+				}
+				spans = append(spans, Span{Start: loc[g], End: loc[g+1], Type: typ, Original: text[loc[g]:loc[g+1]], Generator: p.Generator})
+			}
+		}
+	}
+	return spans
+}
+
+var entropyRe sync.Map // 关键字列表 → 编译后的正则
+
+// entropyRegexp 构造「关键字开头的键名 + 赋值符 + 值」正则，值为捕获组 1。
+// 空白关键字会使键名匹配任意单词，予以忽略；全部为空时使用内置关键字。
+func entropyRegexp(keywords []string) *regexp.Regexp {
+	key := strings.Join(keywords, "\x00")
+	if v, ok := entropyRe.Load(key); ok {
+		return v.(*regexp.Regexp)
+	}
+	alt := make([]string, 0, len(keywords))
+	for _, k := range keywords {
+		if k = strings.TrimSpace(k); k != "" {
+			alt = append(alt, regexp.QuoteMeta(k))
+		}
+	}
+	if len(alt) == 0 {
+		for _, k := range defaultEntropyKeywords {
+			alt = append(alt, regexp.QuoteMeta(k))
+		}
+	}
+	re := regexp.MustCompile(`(?i)\b(?:` + strings.Join(alt, "|") + `)[A-Za-z0-9_.-]*["']?\s*(?:=|:|=>)\s*["'` + "`" + `]?([^\s"'` + "`" + `,;&(){}<>\[\]]+)`)
+	entropyRe.Store(key, re)
+	return re
+}
+
+// detectEntropy 检测关键字后的高熵值（只替换值部分）。
+func detectEntropy(text string, cfg *configStructs.DataMaskConfig) []Span {
+	keywords := cfg.EntropyKeywords
+	if len(keywords) == 0 {
+		keywords = defaultEntropyKeywords
+	}
+	threshold := cfg.EntropyThreshold
+	if threshold <= 0 {
+		threshold = defaultEntropyThreshold
+	}
+	minLen := cfg.EntropyMinLength
+	if minLen <= 0 {
+		minLen = defaultEntropyMinLength
+	}
+	var spans []Span
+	for _, loc := range entropyRegexp(keywords).FindAllStringSubmatchIndex(text, -1) {
+		vStart, vEnd := loc[2], loc[3]
+		if vEnd-vStart < minLen {
+			continue
+		}
+		v := text[vStart:vEnd]
+		// 值后紧跟 '(' 说明是函数调用；$ 开头为变量引用，均非字面密钥
+		if (vEnd < len(text) && text[vEnd] == '(') || strings.HasPrefix(v, "$") {
+			continue
+		}
+		if shannonEntropy(v) < threshold {
+			continue
+		}
+		spans = append(spans, Span{Start: vStart, End: vEnd, Type: TypeEntropy, Original: v})
+	}
+	return spans
+}
+
+// shannonEntropy 计算字符串按字节分布的香农熵（bit/字符）。
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	n := float64(len(s))
+	var h float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
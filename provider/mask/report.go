@@ -0,0 +1,67 @@
+package mask
+
+import (
+	"unicode/utf8"
+
+	"github.com/cxykevin/alkaid0/config"
+	storageStructs "github.com/cxykevin/alkaid0/storage/structs"
+	"gorm.io/gorm"
+)
+
+// ReportEntry 脱敏审计中的一个映射。原值只保留首尾少量字符。
+type ReportEntry struct {
+	Type      string `json:"type"`
+	Detector  string `json:"detector"`
+	Original  string `json:"original"`
+	Masked    string `json:"masked"`
+	FirstSeen uint64 `json:"firstSeen"`          // 首次脱敏时间（unix 秒）
+	LastSeen  uint64 `json:"lastSeen,omitempty"` // 最近一次脱敏时间，旧数据可能为 0
+	Hits      uint64 `json:"hits"`               // 被脱敏的请求次数
+}
+
+// Report 项目级脱敏审计报告。
+type Report struct {
+	Enabled bool          `json:"enabled"`
+	Entries []ReportEntry `json:"entries"` // 按请求次数降序，同次数按首次出现先后
+}
+
+// BuildReport 读取映射表生成审计报告（映射表不存在时为空报告）。
+func BuildReport(db *gorm.DB) (*Report, error) {
+	report := &Report{Enabled: config.GlobalConfigSafe().DataMask.Enable, Entries: []ReportEntry{}}
+	if db == nil || !db.Migrator().HasTable(&storageStructs.KeyMapping{}) {
+		return report, nil
+	}
+	var rows []storageStructs.KeyMapping
+	if err := db.Order("hits DESC").Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		detector := r.Detector
+		if detector == "" {
+			detector = r.KeyType
+		}
+		report.Entries = append(report.Entries, ReportEntry{
+			Type:      r.KeyType,
+			Detector:  detector,
+			Original:  truncateOriginal(r.Original),
+			Masked:    r.Masked,
+			FirstSeen: r.Time,
+			LastSeen:  r.LastSeen,
+			Hits:      r.Hits,
+		})
+	}
+	return report, nil
+}
+
+// truncateOriginal 截断原值：长值保留前 4 与后 2 个字符，短值只保留首字符，中间以 … 代替。
+func truncateOriginal(s string) string {
+	runes := []rune(s)
+	switch n := utf8.RuneCountInString(s); {
+	case n == 0:
+		return ""
+	case n <= 8:
+		return string(runes[:1]) + "…"
+	default:
+		return string(runes[:4]) + "…" + string(runes[n-2:])
+	}
+}
@@ -3,6 +3,7 @@ package actions
 import (
 	"fmt"
 
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
 	"github.com/cxykevin/alkaid0/library/chancall"
 	"github.com/cxykevin/alkaid0/storage/structs"
 )
@@ -24,6 +25,28 @@ func AddAgent(session *structs.Chats, agentCode string, agentID string, path str
 	return err
 }
 
+// AddIsolatedAgent 添加在独立 git worktree 中工作的 Agent
+func AddIsolatedAgent(session *structs.Chats, agentCode string, agentID string, path string) error {
+	_, err := Call(Add{
+		Session:   session,
+		AgentCode: agentCode,
+		AgentID:   agentID,
+		Path:      path,
+		Isolated:  true,
+	})
+	return err
+}
+
+// ResolveAgent 合并或丢弃隔离 Agent 的分支
+func ResolveAgent(session *structs.Chats, agentCode string, mode string) error {
+	_, err := Call(Resolve{
+		Session:   session,
+		AgentCode: agentCode,
+		Mode:      mode,
+	})
+	return err
+}
+
 // UpdateAgent 更新
 func UpdateAgent(session *structs.Chats, agentCode string, agentID string, path string) error {
 	_, err := Call(Update{
@@ -70,6 +93,17 @@ func ActivateAgent(session *structs.Chats, agentCode string, prompt string) erro
 	return err
 }
 
+// ActivateAgentWithBudget 激活，budget 中的非零项覆盖代理配置的预算
+func ActivateAgentWithBudget(session *structs.Chats, agentCode string, prompt string, budget cfgStructs.BudgetConfig) error {
+	_, err := Call(Activate{
+		Session:   session,
+		AgentCode: agentCode,
+		Prompt:    prompt,
+		Budget:    budget,
+	})
+	return err
+}
+
 // DeactivateAgent 取消激活
 func DeactivateAgent(session *structs.Chats, prompt string) error {
 	_, err := Call(Deactivate{
@@ -78,3 +112,43 @@ func DeactivateAgent(session *structs.Chats, prompt string) error {
 	})
 	return err
 }
+
+// RunParallelAgents 并行激活多个Agent，按 wait（all/any）等待结束后返回结果
+func RunParallelAgents(session *structs.Chats, tasks []ParallelTask, wait string) (ParallelOutcome, error) {
+	res, err := Call(Parallel{
+		Session: session,
+		Tasks:   tasks,
+		Wait:    wait,
+	})
+	if err != nil {
+		return ParallelOutcome{}, err
+	}
+	ret, ok := res.(ParallelOutcome)
+	if !ok {
+		return ParallelOutcome{}, fmt.Errorf("RunParallelAgents: unexpected result type %T", res)
+	}
+	return ret, nil
+}
+
+// StopParallelAgents 取消所有并行Agent
+func StopParallelAgents(session *structs.Chats) error {
+	_, err := Call(StopParallel{
+		Session: session,
+	})
+	return err
+}
+
+// ListParallelAgents 获取并行Agent状态（未被收取的结果与运行中的Agent）
+func ListParallelAgents(session *structs.Chats) ([]ParallelResult, error) {
+	res, err := Call(ListParallel{
+		Session: session,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret, ok := res.([]ParallelResult)
+	if !ok {
+		return nil, fmt.Errorf("ListParallelAgents: unexpected result type %T", res)
+	}
+	return ret, nil
+}
@@ -1,6 +1,9 @@
 package actions
 
-import "github.com/cxykevin/alkaid0/storage/structs"
+import (
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+)
 
 // Add 添加Agent
 type Add struct {
@@ -8,6 +11,7 @@ type Add struct {
 	AgentCode string
 	AgentID   string
 	Path      string
+	Isolated  bool
 }
 
 // Update 更新Agent
@@ -18,6 +22,13 @@ type Update struct {
 	Path      string
 }
 
+// Resolve 合并或丢弃隔离Agent的分支
+type Resolve struct {
+	Session   *structs.Chats
+	AgentCode string
+	Mode      string
+}
+
 // Del 删除Agent
 type Del struct {
 	Session   *structs.Chats
@@ -34,6 +45,8 @@ type Activate struct {
 	Session   *structs.Chats
 	AgentCode string
 	Prompt    string
+	// Budget 非零项覆盖代理配置的预算
+	Budget cfgStructs.BudgetConfig
 }
 
 // Deactivate 退出SubAgent
@@ -41,3 +54,46 @@ type Deactivate struct {
 	Session *structs.Chats
 	Prompt  string
 }
+
+// ParallelTask 并行激活的子代理任务
+type ParallelTask struct {
+	AgentCode string
+	Prompt    string
+	// Budget 非零项覆盖代理配置的预算
+	Budget cfgStructs.BudgetConfig
+}
+
+// Parallel 并行激活多个Agent并等待其结束
+type Parallel struct {
+	Session *structs.Chats
+	Tasks   []ParallelTask
+	Wait    string
+}
+
+// ParallelResult 并行子代理的执行结果
+type ParallelResult struct {
+	AgentCode string
+	Status    string
+	// Message 子代理停用时回传的报告
+	Message string
+	Summary string
+	// Report 隔离子代理的分支 diff 报告
+	Report string
+	Error  string
+}
+
+// ParallelOutcome 一次等待的结果：已结束的子代理与仍在运行的子代理
+type ParallelOutcome struct {
+	Finished []ParallelResult
+	Running  []string
+}
+
+// StopParallel 取消会话中所有并行子代理
+type StopParallel struct {
+	Session *structs.Chats
+}
+
+// ListParallel 获取会话中并行子代理的状态
+type ListParallel struct {
+	Session *structs.Chats
+}
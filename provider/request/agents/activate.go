@@ -6,7 +6,9 @@ import (
 
 	cfgStruct "github.com/cxykevin/alkaid0/config/structs"
 	"github.com/cxykevin/alkaid0/provider/request"
+	"github.com/cxykevin/alkaid0/provider/request/agents/actions"
 	agentconfig "github.com/cxykevin/alkaid0/provider/request/agents/config"
+	"github.com/cxykevin/alkaid0/provider/request/budget"
 	"github.com/cxykevin/alkaid0/storage/structs"
 )
 
@@ -14,6 +16,11 @@ import (
 
 // ActivateAgent 激活Agent
 func ActivateAgent(session *structs.Chats, agentCode string, prompt string) error {
+	return ActivateAgentWithBudget(session, agentCode, prompt, cfgStruct.BudgetConfig{})
+}
+
+// ActivateAgentWithBudget 激活Agent，budget 中的非零项覆盖代理配置的预算
+func ActivateAgentWithBudget(session *structs.Chats, agentCode string, prompt string, budgetLimits cfgStruct.BudgetConfig) error {
 	if session == nil || session.DB == nil {
 		return errors.New("activate agent: nil session or db")
 	}
@@ -21,6 +28,9 @@ func ActivateAgent(session *structs.Chats, agentCode string, prompt string) erro
 	defer session.AgentLifecycleUnlock()
 
 	logger.Info("activating agent: %s", agentCode)
+	if err := checkNotParallel(session, agentCode); err != nil {
+		return err
+	}
 	// 取agent表
 	obj := structs.SubAgents{}
 	err := session.DB.Where("id = ?", agentCode).First(&obj).Error
@@ -29,29 +39,42 @@ func ActivateAgent(session *structs.Chats, agentCode string, prompt string) erro
 	}
 
 	// 取agent配置
-	agentConfig, ok := agentconfig.GetAgentConfig(obj.AgentID)
+	agentConfig, ok := agentconfig.GetAgentConfigAt(session.Root, obj.AgentID)
 	if !ok {
 		return errors.New("Agent not found")
 	}
 
+	// 隔离子代理：准备独立 worktree
+	if obj.Isolated {
+		if err := ensureWorktree(session, &obj); err != nil {
+			return err
+		}
+	}
+
 	// // 更新当前Agent
 	// err = session.DB.Model(&structs.Chats{}).Where("id = ?", session.ID).Update("now_agent", agentCode).Error
 	// if err != nil {
 	// 	return err
 	// }
 	// 提示词写入
-	err = session.DB.Create(&structs.Messages{
+	promptMsg := structs.Messages{
 		ChatID:  session.ID,
 		Delta:   prompt,
 		AgentID: &agentCode,
 		Type:    structs.MessagesRoleCommunicate,
-	}).Error
+	}
+	err = session.DB.Create(&promptMsg).Error
 	if err != nil {
 		return err
 	}
+	session.AgentBudget = budget.BeginAt(promptMsg.ID, agentConfig.Budget.Override(budgetLimits))
 
 	// 设置值
-	session.CurrentActivatePath = obj.BindPath
+	activatePath, err := agentActivatePath(session, &obj)
+	if err != nil {
+		return err
+	}
+	session.CurrentActivatePath = activatePath
 	session.NowAgent = agentCode
 	session.CurrentAgentID = obj.ID
 	session.CurrentAgentConfig = agentConfig
@@ -83,23 +106,30 @@ func DeactivateAgent(session *structs.Chats, prompt string) error {
 		return nil
 	}
 	hadActiveAgent := true
+	// 并行子代理：回传内容交给等待方，不写入主代理消息流（主代理正处于工具调用中）
+	run := forkParallelRun(session)
 	// 先在内存中清空激活状态，避免工具调用重入时再次把当前会话识别为活跃子代理。
 	// 总结过程可能耗时，状态必须在执行总结前完成切换。
 	session.NowAgent = ""
 	session.CurrentAgentID = ""
 	session.CurrentActivatePath = ""
 	session.CurrentAgentConfig = cfgStruct.AgentConfig{}
+	session.AgentBudget = structs.BudgetWindow{}
 
 	// 更新当前Agent
-	err := session.DB.Model(&structs.Chats{}).Where("id = ?", session.ID).Update("now_agent", "").Error
-	if err != nil {
-		return err
+	if run == nil {
+		err := session.DB.Model(&structs.Chats{}).Where("id = ?", session.ID).Update("now_agent", "").Error
+		if err != nil {
+			return err
+		}
 	}
 
-	if prompt != "" {
+	if run != nil && prompt != "" {
+		run.record(func(r *actions.ParallelResult) { r.Message = prompt })
+	} else if prompt != "" {
 		// 提示词写入
 		defaultStr := ""
-		err = session.DB.Create(&structs.Messages{
+		err := session.DB.Create(&structs.Messages{
 			ChatID:  session.ID,
 			Delta:   prompt,
 			AgentID: &defaultStr,
@@ -121,6 +151,8 @@ func DeactivateAgent(session *structs.Chats, prompt string) error {
 	if hadActiveAgent {
 		if summary, summaryErr := request.Summary(sumCtx, session.DB, session.ID, oldAgent); summaryErr != nil {
 			logger.Warn("failed to summarize deactivated agent %q: %v", oldAgent, summaryErr)
+		} else if run != nil {
+			run.record(func(r *actions.ParallelResult) { r.Summary = summary })
 		} else if summary != "" {
 			mainAgentID := ""
 			if err := session.DB.Create(&structs.Messages{
@@ -134,6 +166,23 @@ func DeactivateAgent(session *structs.Chats, prompt string) error {
 		}
 	}
 
+	// 隔离子代理：提交 worktree 改动并把分支 diff 交给主代理决定合并或丢弃
+	if report, err := finalizeWorktree(session, oldAgent); err != nil {
+		logger.Warn("failed to finalize worktree of agent %q: %v", oldAgent, err)
+	} else if run != nil {
+		run.record(func(r *actions.ParallelResult) { r.Report = report })
+	} else if report != "" {
+		mainAgentID := ""
+		if err := session.DB.Create(&structs.Messages{
+			ChatID:  session.ID,
+			Delta:   report,
+			AgentID: &mainAgentID,
+			Type:    structs.MessagesRoleCommunicate,
+		}).Error; err != nil {
+			logger.Warn("failed to persist worktree report of agent %q: %v", oldAgent, err)
+		}
+	}
+
 	session.CurrentActivatePath = ""
 	session.CurrentAgentID = ""
 	session.CurrentAgentConfig = cfgStruct.AgentConfig{}
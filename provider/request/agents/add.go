@@ -51,7 +51,7 @@ func AddAgent(session *structs.Chats, agentCode string, agentID string, path str
 		return err
 	}
 
-	_, ok := agentconfig.GetAgentConfig(agentID)
+	_, ok := agentconfig.GetAgentConfigAt(session.Root, agentID)
 	if !ok {
 		return errors.New("agent id not found")
 	}
@@ -73,6 +73,19 @@ func DeleteAgent(session *structs.Chats, agentCode string) error {
 	if session.NowAgent == agentCode {
 		return errors.New("cannot delete the currently active agent, deactivate it first")
 	}
+	if err := checkNotParallel(session, agentCode); err != nil {
+		return err
+	}
+	// 隔离分支未处理前禁止删除，避免丢失子代理的改动
+	var obj storageStructs.SubAgents
+	if err := session.DB.Where("id = ?", agentCode).First(&obj).Error; err == nil && obj.Isolated {
+		if obj.Branch != "" {
+			return errors.New("agent has a pending worktree branch, resolve it with merge or discard first")
+		}
+		if root, err := workspaceRoot(session); err == nil {
+			removeWorktree(root, agentCode)
+		}
+	}
 	err := session.DB.Where("id = ?", agentCode).Delete(storageStructs.SubAgents{}).Error
 	return err
 }
@@ -49,3 +49,27 @@ func mergeMap(a, b map[string]structs.AgentConfig) map[string]structs.AgentConfi
 	maps.Copy(result, b)
 	return result
 }
+
+// GetAgentConfigAt 获取agent信息，包含工作区 .alkaid0/agents 中定义的代理。
+// 优先级：用户配置 > 工作区定义 > 内建配置
+func GetAgentConfigAt(root string, agentID string) (structs.AgentConfig, bool) {
+	if val, ok := config.GlobalConfig.Agent.Agents[agentID]; ok {
+		return val, ok
+	}
+	if val, ok := WorkspaceAgents(root)[agentID]; ok {
+		return val, ok
+	}
+	val, ok := builtins[agentID]
+	return val, ok
+}
+
+// GetAgentConfigMapAt 获取agent信息，包含工作区 .alkaid0/agents 中定义的代理
+func GetAgentConfigMapAt(root string) map[string]structs.AgentConfig {
+	result := make(map[string]structs.AgentConfig)
+	if !config.GlobalConfig.Agent.IgnoreBuiltinAgents {
+		maps.Copy(result, builtins)
+	}
+	maps.Copy(result, WorkspaceAgents(root))
+	maps.Copy(result, config.GlobalConfig.Agent.Agents)
+	return result
+}
@@ -0,0 +1,192 @@
+package agentconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cxykevin/alkaid0/config"
+	"github.com/cxykevin/alkaid0/config/structs"
+	"gopkg.in/yaml.v3"
+)
+
+// WorkspaceAgentsDir 仓库内代理定义目录（相对工作区根目录）
+const WorkspaceAgentsDir = ".alkaid0/agents"
+
+// workspaceFrontmatter 代理定义文件的 frontmatter，正文为代理完整提示词
+type workspaceFrontmatter struct {
+	Name             string   `yaml:"name"`
+	Description      string   `yaml:"description"`
+	ShortDescription string   `yaml:"short_description"`
+	Model            int32    `yaml:"model"`
+	AutoApprove      string   `yaml:"auto_approve"`
+	AutoReject       string   `yaml:"auto_reject"`
+	DisableSandbox   bool     `yaml:"disable_sandbox"`
+	Scopes           []string `yaml:"scopes"`
+	DefaultScopes    []string `yaml:"default_scopes"`
+	AllowedTools     []string `yaml:"allowed_tools"`
+	DeniedTools      []string `yaml:"denied_tools"`
+	Color            string   `yaml:"color"`
+	MaxTokens        uint64   `yaml:"max_tokens"`
+	MaxCost          float64  `yaml:"max_cost"`
+	MaxTime          int32    `yaml:"max_time"`
+}
+
+// workspaceAgentSet 某个工作区已加载的代理定义，stamp 为目录内文件的指纹
+type workspaceAgentSet struct {
+	stamp  string
+	agents map[string]structs.AgentConfig
+}
+
+var (
+	workspaceMu     sync.Mutex
+	workspaceCaches = map[string]*workspaceAgentSet{}
+)
+
+// WorkspaceAgents 返回工作区 .alkaid0/agents 下定义的代理（键为文件名去掉 .md）。
+// 每次调用检查文件指纹，文件增删改后自动重新加载。
+// 未开启 Agent.TrustWorkspaceAgents 时忽略文件中的 auto_approve 与 disable_sandbox。
+func WorkspaceAgents(root string) map[string]structs.AgentConfig {
+	if root == "" {
+		return nil
+	}
+	dir := filepath.Join(root, WorkspaceAgentsDir)
+	files, stamp := scanWorkspaceAgents(dir)
+	trusted := config.GlobalConfigSnapshot().Agent.TrustWorkspaceAgents
+	stamp = fmt.Sprintf("trusted=%v;%s", trusted, stamp)
+
+	workspaceMu.Lock()
+	defer workspaceMu.Unlock()
+	if cached, ok := workspaceCaches[root]; ok && cached.stamp == stamp {
+		return cached.agents
+	}
+	agents := make(map[string]structs.AgentConfig, len(files))
+	for _, name := range files {
+		id := strings.TrimSuffix(name, ".md")
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			logger.Warn("read workspace agent %s: %v", name, err)
+			continue
+		}
+		cfg, err := ParseAgentFile(id, data)
+		if err != nil {
+			logger.Warn("parse workspace agent %s: %v", name, err)
+			continue
+		}
+		if !trusted && (cfg.AutoApprove != "" || cfg.DisableSandbox) {
+			// 仓库内容不可信：只允许收紧规则，不允许放宽审批或关闭沙盒
+			logger.Warn("workspace agent %s: ignoring auto_approve/disable_sandbox (Agent.TrustWorkspaceAgents is off)", name)
+			cfg.AutoApprove = ""
+			cfg.DisableSandbox = false
+		}
+		agents[id] = cfg
+	}
+	if len(files) > 0 || workspaceCaches[root] != nil {
+		logger.Info("loaded %d workspace agents from %s", len(agents), dir)
+	}
+	workspaceCaches[root] = &workspaceAgentSet{stamp: stamp, agents: agents}
+	return agents
+}
+
+// scanWorkspaceAgents 列出目录中的 .md 文件（已排序）并生成名称/大小/修改时间指纹
+func scanWorkspaceAgents(dir string) ([]string, string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, ""
+	}
+	var files []string
+	var stamp strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, entry.Name())
+		fmt.Fprintf(&stamp, "%s:%d:%d;", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return files, stamp.String()
+}
+
+// ParseAgentFile 解析 markdown + YAML frontmatter 格式的代理定义
+func ParseAgentFile(id string, data []byte) (structs.AgentConfig, error) {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(data, []byte("---\n")) {
+		return structs.AgentConfig{}, errors.New("missing frontmatter")
+	}
+	rest := data[len("---\n"):]
+	var head, body []byte
+	if bytes.HasPrefix(rest, []byte("---\n")) {
+		body = rest[len("---\n"):]
+	} else {
+		idx := bytes.Index(rest, []byte("\n---\n"))
+		if idx < 0 {
+			if !bytes.HasSuffix(rest, []byte("\n---")) {
+				return structs.AgentConfig{}, errors.New("unterminated frontmatter")
+			}
+			idx = len(rest) - len("\n---")
+			head = rest[:idx]
+		} else {
+			head, body = rest[:idx], rest[idx+len("\n---\n"):]
+		}
+	}
+	var fm workspaceFrontmatter
+	if err := yaml.Unmarshal(head, &fm); err != nil {
+		return structs.AgentConfig{}, fmt.Errorf("invalid frontmatter: %w", err)
+	}
+	prompt := strings.TrimSpace(string(body))
+	if prompt == "" {
+		return structs.AgentConfig{}, errors.New("empty agent prompt")
+	}
+
+	cfg := structs.AgentConfig{
+		Color:                 structs.Color{Red: 128, Green: 128, Blue: 128},
+		AgentName:             fm.Name,
+		AgentDescription:      fm.Description,
+		AgentPrompt:           prompt,
+		AgentModel:            fm.Model,
+		AgentShortDescription: fm.ShortDescription,
+		AutoApprove:           fm.AutoApprove,
+		AutoReject:            fm.AutoReject,
+		DisableSandbox:        fm.DisableSandbox,
+		AllowedScopes:         fm.Scopes,
+		DefaultScopes:         fm.DefaultScopes,
+		AllowedTools:          fm.AllowedTools,
+		DeniedTools:           fm.DeniedTools,
+		Budget:                structs.BudgetConfig{MaxTokens: fm.MaxTokens, MaxCost: fm.MaxCost, MaxTime: fm.MaxTime},
+	}
+	if cfg.AgentName == "" {
+		cfg.AgentName = id
+	}
+	if cfg.AgentShortDescription == "" {
+		cfg.AgentShortDescription = cfg.AgentDescription
+	}
+	if fm.Color != "" {
+		color, err := parseHexColor(fm.Color)
+		if err != nil {
+			return structs.AgentConfig{}, err
+		}
+		cfg.Color = color
+	}
+	return cfg, nil
+}
+
+// parseHexColor 解析 #RRGGBB 颜色
+func parseHexColor(s string) (structs.Color, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return structs.Color{}, fmt.Errorf("invalid color %q, expected #RRGGBB", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return structs.Color{}, fmt.Errorf("invalid color %q, expected #RRGGBB", s)
+	}
+	return structs.Color{Red: uint8(v >> 16), Green: uint8(v >> 8), Blue: uint8(v)}, nil
+}
@@ -15,12 +15,20 @@ func act(obj any) (any, error) {
 		if err := checkSessionDB(objs.Session); err != nil {
 			return nil, err
 		}
+		if objs.Isolated {
+			return nil, AddIsolatedAgent(objs.Session, objs.AgentCode, objs.AgentID, objs.Path)
+		}
 		return nil, AddAgent(objs.Session, objs.AgentCode, objs.AgentID, objs.Path)
 	case actions.Update:
 		if err := checkSessionDB(objs.Session); err != nil {
 			return nil, err
 		}
 		return nil, UpdateAgent(objs.Session, objs.AgentCode, objs.AgentID, objs.Path)
+	case actions.Resolve:
+		if err := checkSessionDB(objs.Session); err != nil {
+			return nil, err
+		}
+		return nil, ResolveAgent(objs.Session, objs.AgentCode, objs.Mode)
 	case actions.Del:
 		if err := checkSessionDB(objs.Session); err != nil {
 			return nil, err
@@ -35,12 +43,28 @@ func act(obj any) (any, error) {
 		if err := checkSessionDB(objs.Session); err != nil {
 			return nil, err
 		}
-		return nil, ActivateAgent(objs.Session, objs.AgentCode, objs.Prompt)
+		return nil, ActivateAgentWithBudget(objs.Session, objs.AgentCode, objs.Prompt, objs.Budget)
 	case actions.Deactivate:
 		if err := checkSessionDB(objs.Session); err != nil {
 			return nil, err
 		}
 		return nil, DeactivateAgent(objs.Session, objs.Prompt)
+	case actions.Parallel:
+		if err := checkSessionDB(objs.Session); err != nil {
+			return nil, err
+		}
+		return RunParallelAgents(objs.Session, objs.Tasks, objs.Wait)
+	case actions.StopParallel:
+		if err := checkSessionDB(objs.Session); err != nil {
+			return nil, err
+		}
+		StopParallelAgents(objs.Session)
+		return nil, nil
+	case actions.ListParallel:
+		if err := checkSessionDB(objs.Session); err != nil {
+			return nil, err
+		}
+		return ListParallelAgents(objs.Session), nil
 	}
 	return nil, fmt.Errorf("act not found")
 }
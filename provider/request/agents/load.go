@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	agentconfig "github.com/cxykevin/alkaid0/provider/request/agents/config"
+	"github.com/cxykevin/alkaid0/provider/request/budget"
 	"github.com/cxykevin/alkaid0/storage/structs"
 )
 
@@ -20,7 +21,7 @@ func LoadAgent(session *structs.Chats) error {
 	}
 
 	// 取agent配置
-	agentConfig, ok := agentconfig.GetAgentConfig(obj.AgentID)
+	agentConfig, ok := agentconfig.GetAgentConfigAt(session.Root, obj.AgentID)
 	if !ok {
 		return errors.New("Agent not found")
 	}
@@ -33,9 +34,21 @@ func LoadAgent(session *structs.Chats) error {
 	// 提示词写入
 
 	// 设置值
-	session.CurrentActivatePath = obj.BindPath
+	if obj.Isolated {
+		// 恢复会话时 worktree 不可用不应阻止会话打开
+		if err := ensureWorktree(session, &obj); err != nil {
+			logger.Warn("prepare worktree for agent %q failed: %v", obj.ID, err)
+		}
+	}
+	activatePath, err := agentActivatePath(session, &obj)
+	if err != nil {
+		logger.Warn("resolve worktree path for agent %q failed: %v", obj.ID, err)
+	}
+	session.CurrentActivatePath = activatePath
 	session.CurrentAgentID = obj.ID
 	session.CurrentAgentConfig = agentConfig
+	// 激活时的调用参数不持久化，恢复会话后按代理配置从此刻重新计算预算
+	session.AgentBudget = budget.Begin(session.DB, session.ID, agentConfig.Budget)
 
 	// 写DB
 	err = session.DB.Save(session).Error
@@ -0,0 +1,362 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/cxykevin/alkaid0/config"
+	"github.com/cxykevin/alkaid0/provider/request"
+	"github.com/cxykevin/alkaid0/provider/request/agents/actions"
+	agentconfig "github.com/cxykevin/alkaid0/provider/request/agents/config"
+	"github.com/cxykevin/alkaid0/provider/request/budget"
+	reqStructs "github.com/cxykevin/alkaid0/provider/request/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/ui/state"
+)
+
+// WaitAll / WaitAny 并行子代理的等待方式
+const (
+	WaitAll = "all"
+	WaitAny = "any"
+)
+
+// 并行子代理状态
+const (
+	ParallelRunning   = "running"
+	ParallelDone      = "done"
+	ParallelError     = "error"
+	ParallelCancelled = "cancelled"
+	// ParallelBudget 超出预算被强制停用
+	ParallelBudget = "budget_exceeded"
+)
+
+// parallelRun 一个并行运行的子代理
+type parallelRun struct {
+	agentCode string
+	// session Fork 出的独立会话（独立状态机、请求循环与审批）
+	session *structs.Chats
+	cancel  context.CancelFunc
+	done    chan struct{}
+	// result 由 parallelMu 保护
+	result actions.ParallelResult
+}
+
+var (
+	parallelMu sync.Mutex
+	// parallelRuns 按会话 ID 记录并行子代理（保持启动顺序），结果被收取后移除
+	parallelRuns = map[uint32][]*parallelRun{}
+)
+
+// findParallelRun 查找会话中指定子代理的并行运行记录
+func findParallelRun(chatID uint32, agentCode string) *parallelRun {
+	parallelMu.Lock()
+	defer parallelMu.Unlock()
+	for _, run := range parallelRuns[chatID] {
+		if run.agentCode == agentCode {
+			return run
+		}
+	}
+	return nil
+}
+
+// forkParallelRun 返回 Fork 会话所属的并行运行记录，非并行子代理会话返回 nil
+func forkParallelRun(session *structs.Chats) *parallelRun {
+	if session.ForkedFrom() == nil {
+		return nil
+	}
+	parallelMu.Lock()
+	defer parallelMu.Unlock()
+	for _, run := range parallelRuns[session.ID] {
+		if run.session == session {
+			return run
+		}
+	}
+	return nil
+}
+
+// checkNotParallel 拒绝对正在并行运行（或结果尚未收取）的子代理执行生命周期操作
+func checkNotParallel(session *structs.Chats, agentCode string) error {
+	if run := findParallelRun(session.ID, agentCode); run != nil && run.session != session {
+		return fmt.Errorf("agent %q is running in parallel, wait for it with activate_agents first", agentCode)
+	}
+	return nil
+}
+
+// RunParallelAgents 以独立会话并行激活多个子代理，并按 wait 等待：
+// all 等待全部结束，any 任一结束即返回（其余继续在后台运行，结果在下次等待时收取）。
+// tasks 为空时仅等待此前仍在运行的并行子代理。
+func RunParallelAgents(session *structs.Chats, tasks []actions.ParallelTask, wait string) (actions.ParallelOutcome, error) {
+	if session.ForkedFrom() != nil || session.CurrentAgentID != "" {
+		return actions.ParallelOutcome{}, errors.New("parallel subagents can only be started by the main agent")
+	}
+	if wait == "" {
+		wait = WaitAll
+	}
+	if wait != WaitAll && wait != WaitAny {
+		return actions.ParallelOutcome{}, fmt.Errorf("unknown wait mode %q, expected all or any", wait)
+	}
+
+	// 启动前校验全部任务，避免部分启动
+	objs := make([]structs.SubAgents, len(tasks))
+	for i, task := range tasks {
+		if task.AgentCode == "" || task.Prompt == "" {
+			return actions.ParallelOutcome{}, errors.New("every parallel task needs a name and a prompt")
+		}
+		if slices.ContainsFunc(tasks[:i], func(t actions.ParallelTask) bool { return t.AgentCode == task.AgentCode }) {
+			return actions.ParallelOutcome{}, fmt.Errorf("agent %q is listed more than once", task.AgentCode)
+		}
+		if err := checkNotParallel(session, task.AgentCode); err != nil {
+			return actions.ParallelOutcome{}, err
+		}
+		if err := session.DB.Where("id = ?", task.AgentCode).First(&objs[i]).Error; err != nil {
+			return actions.ParallelOutcome{}, fmt.Errorf("agent %q: %w", task.AgentCode, err)
+		}
+		if _, ok := agentconfig.GetAgentConfigAt(session.Root, objs[i].AgentID); !ok {
+			return actions.ParallelOutcome{}, fmt.Errorf("agent %q: agent tag not found", task.AgentCode)
+		}
+	}
+
+	parallelMu.Lock()
+	started := make([]*parallelRun, 0, len(tasks))
+	for _, task := range tasks {
+		child := session.Fork()
+		ctx, cancel := context.WithCancel(context.WithoutCancel(session.GetContext()))
+		child.SetContext(ctx)
+		run := &parallelRun{
+			agentCode: task.AgentCode,
+			session:   child,
+			cancel:    cancel,
+			done:      make(chan struct{}),
+			result:    actions.ParallelResult{AgentCode: task.AgentCode, Status: ParallelRunning},
+		}
+		parallelRuns[session.ID] = append(parallelRuns[session.ID], run)
+		started = append(started, run)
+	}
+	pending := slices.Clone(parallelRuns[session.ID])
+	parallelMu.Unlock()
+
+	if len(pending) == 0 {
+		return actions.ParallelOutcome{}, errors.New("no parallel subagents to wait for")
+	}
+	for i, run := range started {
+		logger.Info("starting parallel agent %s in ID=%d", run.agentCode, session.ID)
+		go runParallelAgent(session, run, tasks[i])
+	}
+
+	waitParallel(session, pending, wait)
+	return collectParallel(session.ID), nil
+}
+
+// waitParallel 等待并行子代理满足等待条件；主代理上下文取消（用户停止）时取消全部子代理并等待其退出
+func waitParallel(session *structs.Chats, pending []*parallelRun, wait string) {
+	notify := make(chan struct{}, len(pending))
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, run := range pending {
+		go func(run *parallelRun) {
+			select {
+			case <-run.done:
+				notify <- struct{}{}
+			case <-stop:
+			}
+		}(run)
+	}
+
+	countDone := func() int {
+		n := 0
+		for _, run := range pending {
+			select {
+			case <-run.done:
+				n++
+			default:
+			}
+		}
+		return n
+	}
+	ctx := session.GetContext()
+	for finished := countDone(); finished < len(pending) && (wait != WaitAny || finished == 0); finished = countDone() {
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			logger.Info("parallel wait canceled in ID=%d, stopping subagents", session.ID)
+			StopParallelAgents(session)
+			for _, run := range pending {
+				<-run.done
+			}
+			return
+		}
+	}
+}
+
+// collectParallel 取出已结束的并行子代理结果，返回仍在运行的子代理
+func collectParallel(chatID uint32) actions.ParallelOutcome {
+	parallelMu.Lock()
+	defer parallelMu.Unlock()
+	var out actions.ParallelOutcome
+	remain := parallelRuns[chatID][:0]
+	for _, run := range parallelRuns[chatID] {
+		select {
+		case <-run.done:
+			out.Finished = append(out.Finished, run.result)
+		default:
+			out.Running = append(out.Running, run.agentCode)
+			remain = append(remain, run)
+		}
+	}
+	if len(remain) == 0 {
+		delete(parallelRuns, chatID)
+	} else {
+		parallelRuns[chatID] = remain
+	}
+	return out
+}
+
+// StopParallelAgents 取消会话中所有并行子代理（不等待其退出）
+func StopParallelAgents(session *structs.Chats) {
+	parallelMu.Lock()
+	runs := slices.Clone(parallelRuns[session.ID])
+	parallelMu.Unlock()
+	for _, run := range runs {
+		run.cancel()
+		run.session.KillTool()
+	}
+}
+
+// ListParallelAgents 返回会话中并行子代理的状态（含已结束但结果尚未收取的）
+func ListParallelAgents(session *structs.Chats) []actions.ParallelResult {
+	parallelMu.Lock()
+	defer parallelMu.Unlock()
+	ret := make([]actions.ParallelResult, 0, len(parallelRuns[session.ID]))
+	for _, run := range parallelRuns[session.ID] {
+		ret = append(ret, run.result)
+	}
+	return ret
+}
+
+// runParallelAgent 在 Fork 会话中运行一个子代理直至其停用、出错或被取消
+func runParallelAgent(parent *structs.Chats, run *parallelRun, task actions.ParallelTask) {
+	defer close(run.done)
+	child := run.session
+	ctx := child.GetContext()
+	if err := ActivateAgentWithBudget(child, run.agentCode, task.Prompt, task.Budget); err != nil {
+		run.setStatus(ParallelError, err)
+		return
+	}
+
+	err := driveParallelAgent(ctx, parent, run)
+	if err != nil {
+		logger.Warn("parallel agent %s in ID=%d stopped: %v", run.agentCode, child.ID, err)
+	}
+	var exceeded *budget.ExceededError
+	isExceeded := errors.As(err, &exceeded)
+	if child.CurrentAgentID != "" {
+		// 未调用 deactivate_agent 就结束（直接回复、出错、超出预算或被取消）：代为停用以回收总结与 worktree 报告
+		report := ""
+		if isExceeded {
+			report = exceeded.Error()
+		}
+		if derr := DeactivateAgent(child, report); derr != nil {
+			logger.Warn("deactivate parallel agent %s: %v", run.agentCode, derr)
+		}
+	}
+	switch {
+	case ctx.Err() != nil:
+		run.setStatus(ParallelCancelled, nil)
+	case isExceeded:
+		run.setStatus(ParallelBudget, err)
+	case err != nil:
+		run.setStatus(ParallelError, err)
+	default:
+		run.setStatus(ParallelDone, nil)
+	}
+	run.cancel()
+}
+
+// driveParallelAgent 子代理的请求循环：请求 → 审批（子代理自己的待审批队列）→ 执行工具，
+// 直至子代理调用 deactivate_agent 或结束回复
+func driveParallelAgent(ctx context.Context, parent *structs.Chats, run *parallelRun) error {
+	child := run.session
+	maxCount := int(config.GlobalConfig.Agent.MaxCallCount)
+	for count := 0; ; count++ {
+		if maxCount > 0 && count >= maxCount {
+			return fmt.Errorf("loop count exceeded %d", maxCount)
+		}
+		if err := budget.Enforce(child); err != nil {
+			return err
+		}
+		finish, err := request.SendRequest(ctx, child, func(delta string, thinkingDelta string, msgID uint64, _ reqStructs.Usage, _ *string) error {
+			if delta != "" || thinkingDelta != "" {
+				parent.PushAgentStream(structs.AgentStreamChunk{
+					AgentID:       run.agentCode,
+					MsgID:         msgID,
+					Delta:         delta,
+					ThinkingDelta: thinkingDelta,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if child.State == state.StateWaitApprove {
+			if err := resolveParallelApproval(child); err != nil {
+				return err
+			}
+			if child.CurrentAgentID == "" {
+				return nil
+			}
+			continue
+		}
+		if finish {
+			return nil
+		}
+	}
+}
+
+// resolveParallelApproval 处理子代理自己的待审批工具调用：按其规则自动批准或拒绝，
+// 未命中规则的调用与串行子代理一致自动拒绝
+func resolveParallelApproval(child *structs.Chats) error {
+	var msg structs.Messages
+	if err := child.DB.Where("chat_id = ? AND agent_id = ? AND tool_calling_json_string != ''", child.ID, child.CurrentAgentID).
+		Order("id DESC").First(&msg).Error; err != nil {
+		return err
+	}
+	child.CurrentMessageID = msg.ID
+	calls, err := request.ParseToolsFromJSON(msg.ToolCallingJSONString)
+	if err != nil {
+		return err
+	}
+	result, err := request.EvaluateApprovalRules(child, calls)
+	if err != nil {
+		return err
+	}
+	switch result.Decision {
+	case request.DecisionApproved:
+		_, err = request.ExecuteToolCalls(child, msg.ToolCallingJSONString)
+		return err
+	case request.DecisionRejected:
+		return request.RejectToolCallsNoDeactivate(child, result.Reason, nil)
+	default:
+		return request.RejectToolCallsNoDeactivate(child, "sub-agent tool call auto-rejected: no approval rule matched", nil)
+	}
+}
+
+// setStatus 记录并行子代理的最终状态
+func (r *parallelRun) setStatus(status string, err error) {
+	parallelMu.Lock()
+	defer parallelMu.Unlock()
+	r.result.Status = status
+	if err != nil {
+		r.result.Error = err.Error()
+	}
+}
+
+// record 记录子代理停用时的回传内容
+func (r *parallelRun) record(fn func(*actions.ParallelResult)) {
+	parallelMu.Lock()
+	defer parallelMu.Unlock()
+	fn(&r.result)
+}
@@ -0,0 +1,331 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStruct "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/provider/parser"
+	"github.com/cxykevin/alkaid0/provider/request/agents/actions"
+	reqStructs "github.com/cxykevin/alkaid0/provider/request/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	toolActions "github.com/cxykevin/alkaid0/tools/actions"
+	"github.com/cxykevin/alkaid0/tools/toolobj"
+	"github.com/cxykevin/alkaid0/ui/state"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// parallelReply 模拟模型对某个子代理首轮请求的回复：tool 非空时调用 deactivate_agent 回传 tool，否则回复纯文本
+type parallelReply struct {
+	tool  string
+	block chan struct{}
+}
+
+// setupParallelEnv 建立完整表结构的数据库、指向 mock 服务的模型配置，以及直接调用 DeactivateAgent 的 deactivate_agent 工具
+// barrier > 0 时首轮请求需等齐 barrier 个子代理才回复，用于验证请求确实并发
+func setupParallelEnv(t *testing.T, replies map[string]*parallelReply, barrier int) *structs.Chats {
+	t.Helper()
+	var arrived sync.WaitGroup
+	arrived.Add(barrier)
+	var mu sync.Mutex
+	counts := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		agent := ""
+		for name := range replies {
+			if strings.Contains(string(payload), "task-"+name) {
+				agent = name
+			}
+		}
+		mu.Lock()
+		counts[agent]++
+		first := counts[agent] == 1
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		reply := replies[agent]
+		if first && reply != nil {
+			if barrier > 0 {
+				arrived.Done()
+				arrived.Wait()
+			}
+			if reply.block != nil {
+				select {
+				case <-reply.block:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			if reply.tool != "" {
+				args, _ := json.Marshal(map[string]string{"prompt": reply.tool})
+				writeSSE(w, reqStructs.Message{Role: reqStructs.RoleAssistant, ToolCalls: []reqStructs.StreamToolCall{{
+					Index: 0, ID: "call_" + agent, Type: "function",
+					Function: &reqStructs.StreamToolCallFunc{Name: "deactivate_agent", Arguments: string(args)},
+				}}}, "tool_calls")
+			} else {
+				writeSSE(w, reqStructs.Message{Role: reqStructs.RoleAssistant, Content: agent + " finished"}, "stop")
+			}
+		} else {
+			writeSSE(w, reqStructs.Message{Role: reqStructs.RoleAssistant, Content: "summary of " + agent}, "stop")
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Cleanup(config.GlobalConfigSwap(cfgStruct.Config{
+		Model: cfgStruct.ModelsConfig{
+			DefaultModelID: 1,
+			Models: map[int32]cfgStruct.ModelConfig{
+				1: {ModelName: "parallel-mock", ModelID: "parallel-mock", ProviderURL: srv.URL, ProviderKey: "k"},
+			},
+		},
+		Agent: cfgStruct.AgentsConfig{
+			IgnoreBuiltinAgents: true,
+			SummaryModel:        1,
+			Agents: map[string]cfgStruct.AgentConfig{
+				"tag-coder": {AgentName: "Coder", AgentDescription: "A coding agent"},
+			},
+		},
+	}))
+
+	toolobj.ToolsMu.Lock()
+	orig, had := toolobj.ToolsList["deactivate_agent"]
+	toolobj.ToolsMu.Unlock()
+	toolActions.AddTool(&toolobj.Tools{
+		Name: "deactivate_agent",
+		ID:   "deactivate_agent",
+		Parameters: map[string]parser.ToolParameters{
+			"prompt": {Type: parser.ToolTypeString, Required: true},
+		},
+		Hooks: []toolobj.Hook{{
+			PostHook: toolobj.PostHookFunction{
+				Func: func(session *structs.Chats, args map[string]*any, cross []*any) (bool, []*any, map[string]*any, error) {
+					prompt, _ := (*args["prompt"]).(string)
+					ok := any(DeactivateAgent(session, prompt) == nil)
+					return false, cross, map[string]*any{"success": &ok}, nil
+				},
+			},
+		}},
+	})
+	t.Cleanup(func() {
+		toolobj.ToolsMu.Lock()
+		if had {
+			toolobj.ToolsList["deactivate_agent"] = orig
+		} else {
+			delete(toolobj.ToolsList, "deactivate_agent")
+		}
+		toolobj.ToolsMu.Unlock()
+	})
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(structs.Tables...); err != nil {
+		t.Fatal(err)
+	}
+	session := &structs.Chats{ID: 1, LastModelID: 1, DB: db, Root: t.TempDir()}
+	if err := db.Create(session).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		StopParallelAgents(session)
+		parallelMu.Lock()
+		delete(parallelRuns, session.ID)
+		parallelMu.Unlock()
+	})
+	for name := range replies {
+		if err := AddAgent(session, name, "tag-coder", "."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return session
+}
+
+func writeSSE(w http.ResponseWriter, delta reqStructs.Message, finish string) {
+	for _, resp := range []reqStructs.ChatCompletionResponse{
+		{Choices: []reqStructs.Choice{{Delta: delta}}},
+		{Choices: []reqStructs.Choice{{FinishReason: finish}}},
+	} {
+		data, _ := json.Marshal(resp)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+}
+
+func resultsByName(results []actions.ParallelResult) map[string]actions.ParallelResult {
+	m := map[string]actions.ParallelResult{}
+	for _, r := range results {
+		m[r.AgentCode] = r
+	}
+	return m
+}
+
+// TestRunParallelAgents_WaitAll 测试多个子代理同时请求、各自停用回传，且不写入主代理消息流
+func TestRunParallelAgents_WaitAll(t *testing.T) {
+	session := setupParallelEnv(t, map[string]*parallelReply{
+		"alpha": {tool: "report-alpha"},
+		"beta":  {tool: "report-beta"},
+	}, 2)
+
+	outcome, err := RunParallelAgents(session, []actions.ParallelTask{
+		{AgentCode: "alpha", Prompt: "task-alpha"},
+		{AgentCode: "beta", Prompt: "task-beta"},
+	}, WaitAll)
+	if err != nil {
+		t.Fatalf("RunParallelAgents failed: %v", err)
+	}
+	if len(outcome.Running) != 0 || len(outcome.Finished) != 2 {
+		t.Fatalf("unexpected outcome: %+v", outcome)
+	}
+	got := resultsByName(outcome.Finished)
+	for _, name := range []string{"alpha", "beta"} {
+		r := got[name]
+		if r.Status != ParallelDone || r.Message != "report-"+name || r.Summary != "summary of "+name {
+			t.Fatalf("unexpected result for %s: %+v", name, r)
+		}
+	}
+
+	var mainComm int64
+	session.DB.Model(&structs.Messages{}).Where("type = ? AND (agent_id = '' OR agent_id IS NULL)", structs.MessagesRoleCommunicate).Count(&mainComm)
+	if mainComm != 0 {
+		t.Fatalf("parallel subagents must not write to the main message stream, got %d messages", mainComm)
+	}
+	var row structs.Chats
+	session.DB.First(&row, session.ID)
+	if row.NowAgent != "" || row.State != state.StateIdle {
+		t.Fatalf("forked sessions must not overwrite the chat row: now_agent=%q state=%v", row.NowAgent, row.State)
+	}
+	if session.NowAgent != "" || session.CurrentAgentID != "" {
+		t.Fatal("parent session must stay on the main agent")
+	}
+	if len(ListParallelAgents(session)) != 0 {
+		t.Fatal("collected runs must be removed")
+	}
+}
+
+// TestRunParallelAgents_WaitAny 测试任一结束即返回，其余子代理后台继续并可稍后收取
+func TestRunParallelAgents_WaitAny(t *testing.T) {
+	release := make(chan struct{})
+	session := setupParallelEnv(t, map[string]*parallelReply{
+		"alpha": {},
+		"beta":  {tool: "report-beta", block: release},
+	}, 0)
+	var streamMu sync.Mutex
+	streamed := map[string]string{}
+	session.SetAgentStreamFn(func(c structs.AgentStreamChunk) {
+		streamMu.Lock()
+		streamed[c.AgentID] += c.Delta
+		streamMu.Unlock()
+	})
+
+	outcome, err := RunParallelAgents(session, []actions.ParallelTask{
+		{AgentCode: "alpha", Prompt: "task-alpha"},
+		{AgentCode: "beta", Prompt: "task-beta"},
+	}, WaitAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outcome.Finished) != 1 || outcome.Finished[0].AgentCode != "alpha" || outcome.Finished[0].Status != ParallelDone {
+		t.Fatalf("unexpected finished: %+v", outcome.Finished)
+	}
+	if len(outcome.Running) != 1 || outcome.Running[0] != "beta" {
+		t.Fatalf("unexpected running: %+v", outcome.Running)
+	}
+	streamMu.Lock()
+	if streamed["alpha"] != "alpha finished" {
+		t.Fatalf("stream chunks must be tagged with the subagent, got %q", streamed)
+	}
+	streamMu.Unlock()
+
+	if err := ActivateAgent(session, "beta", "again"); err == nil {
+		t.Fatal("activating a running parallel agent must fail")
+	}
+	if err := DeleteAgent(session, "beta"); err == nil {
+		t.Fatal("deleting a running parallel agent must fail")
+	}
+	if _, err := RunParallelAgents(session, []actions.ParallelTask{{AgentCode: "beta", Prompt: "task-beta"}}, WaitAll); err == nil {
+		t.Fatal("starting an already running agent must fail")
+	}
+
+	close(release)
+	outcome, err = RunParallelAgents(session, nil, WaitAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outcome.Finished) != 1 || outcome.Finished[0].Message != "report-beta" || len(outcome.Running) != 0 {
+		t.Fatalf("unexpected collected outcome: %+v", outcome)
+	}
+	if _, err := RunParallelAgents(session, nil, WaitAll); err == nil {
+		t.Fatal("waiting without running agents must fail")
+	}
+}
+
+// TestRunParallelAgents_Cancel 测试主代理上下文取消时所有子代理被取消
+func TestRunParallelAgents_Cancel(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	session := setupParallelEnv(t, map[string]*parallelReply{
+		"alpha": {block: block},
+		"beta":  {block: block},
+	}, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	session.SetContext(ctx)
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	outcome, err := RunParallelAgents(session, []actions.ParallelTask{
+		{AgentCode: "alpha", Prompt: "task-alpha"},
+		{AgentCode: "beta", Prompt: "task-beta"},
+	}, WaitAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outcome.Finished) != 2 {
+		t.Fatalf("unexpected outcome: %+v", outcome)
+	}
+	for _, r := range outcome.Finished {
+		if r.Status != ParallelCancelled {
+			t.Fatalf("expected cancelled, got %+v", r)
+		}
+	}
+}
+
+// TestRunParallelAgents_Validation 测试启动前校验
+func TestRunParallelAgents_Validation(t *testing.T) {
+	db := setupTestDB(t)
+	session := setupTestSession(t, db)
+	if err := AddAgent(session, "a", "tag-coder", "."); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		tasks []actions.ParallelTask
+		wait  string
+	}{
+		{[]actions.ParallelTask{{AgentCode: "a", Prompt: "x"}}, "some"},
+		{[]actions.ParallelTask{{AgentCode: "a", Prompt: "x"}, {AgentCode: "a", Prompt: "y"}}, ""},
+		{[]actions.ParallelTask{{AgentCode: "missing", Prompt: "x"}}, ""},
+		{[]actions.ParallelTask{{AgentCode: "a"}}, ""},
+		{nil, ""},
+	}
+	for _, c := range cases {
+		if _, err := RunParallelAgents(session, c.tasks, c.wait); err == nil {
+			t.Fatalf("expected error for %+v", c)
+		}
+	}
+	session.CurrentAgentID = "a"
+	if _, err := RunParallelAgents(session, []actions.ParallelTask{{AgentCode: "a", Prompt: "x"}}, ""); err == nil {
+		t.Fatal("subagents must not start parallel agents")
+	}
+}
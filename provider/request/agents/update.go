@@ -14,10 +14,14 @@ func UpdateAgent(session *structs.Chats, agentCode string, agentID string, path
 		return err
 	}
 	// 校验 agentID 可解析，避免把子代理更新为不可加载的 tag 导致会话无法打开
-	if _, ok := agentconfig.GetAgentConfig(agentID); !ok {
+	if _, ok := agentconfig.GetAgentConfigAt(session.Root, agentID); !ok {
 		return errors.New("agent id not found")
 	}
 
+	if err := checkNotParallel(session, agentCode); err != nil {
+		return err
+	}
+
 	var existingAgent structs.SubAgents
 	err := session.DB.Where("id = ?", agentCode).First(&existingAgent).Error
 	if err != nil {
@@ -0,0 +1,318 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	agentconfig "github.com/cxykevin/alkaid0/provider/request/agents/config"
+	"github.com/cxykevin/alkaid0/storage/structs"
+)
+
+const (
+	// worktreeDirName 隔离 worktree 的存放目录名，位于仓库的 git 公共目录下：
+	// .alkaid0 对工具、沙箱与客户端均不可访问，不能存放子代理的工作区
+	worktreeDirName = "alkaid0-worktrees"
+	// worktreeBranchPrefix 隔离分支名前缀
+	worktreeBranchPrefix = "alkaid0/"
+	worktreeGitTimeout   = 60 * time.Second
+	// maxWorktreeDiffBytes 回传给主代理的 diff 上限
+	maxWorktreeDiffBytes = 8 * 1024
+)
+
+// ResolveMerge / ResolveDiscard 隔离分支的处理方式
+const (
+	ResolveMerge   = "merge"
+	ResolveDiscard = "discard"
+)
+
+var unsafeRefChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// worktreeName 将实例名转换为可用于目录与分支名的安全字符串
+func worktreeName(agentCode string) string {
+	name := strings.Trim(unsafeRefChars.ReplaceAllString(agentCode, "-"), "-.")
+	if name == "" {
+		name = "agent"
+	}
+	return name
+}
+
+// worktreeBase 返回 worktree 存放目录相对工作区根目录的路径（通常为 .git/alkaid0-worktrees）。
+// 无法确定 git 目录时按默认布局返回并附带错误。
+func worktreeBase(root string) (string, error) {
+	fallback := ".git/" + worktreeDirName
+	common, err := gitRun(root, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return fallback, errors.New("worktree isolation requires a git repository")
+	}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		root = real
+	}
+	rel, err := filepath.Rel(root, common)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fallback, errors.New("worktree isolation requires the workspace root to be the main working tree of its repository")
+	}
+	return filepath.ToSlash(filepath.Join(rel, worktreeDirName)), nil
+}
+
+// WorktreePath 返回子代理 worktree 相对工作区根目录的路径
+func WorktreePath(root, agentCode string) (string, error) {
+	base, err := worktreeBase(root)
+	return base + "/" + worktreeName(agentCode), err
+}
+
+func worktreeBranch(agentCode string) string {
+	return worktreeBranchPrefix + worktreeName(agentCode)
+}
+
+// workspaceRoot 返回会话工作区根目录的绝对路径
+func workspaceRoot(session *structs.Chats) (string, error) {
+	root := session.Root
+	if root == "" {
+		root = "."
+	}
+	return filepath.Abs(root)
+}
+
+// gitRun 在 dir 下执行 git，返回去除首尾空白的输出
+func gitRun(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), worktreeGitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_EDITOR=true", "LC_ALL=C")
+	out, err := cmd.CombinedOutput()
+	text := strings.TrimSpace(string(out))
+	if err != nil {
+		if text == "" {
+			text = err.Error()
+		}
+		return text, fmt.Errorf("git %s: %s", args[0], text)
+	}
+	return text, nil
+}
+
+// commitIdentity 仓库未配置提交身份时补充默认身份，避免提交失败
+func commitIdentity(dir string) []string {
+	if email, _ := gitRun(dir, "config", "user.email"); email != "" {
+		return nil
+	}
+	return []string{"-c", "user.name=alkaid0", "-c", "user.email=alkaid0@localhost"}
+}
+
+// AddIsolatedAgent 添加在独立 git worktree 中工作的 Agent 对象
+func AddIsolatedAgent(session *structs.Chats, agentCode string, agentID string, path string) error {
+	if err := validateBindPath(path); err != nil {
+		return err
+	}
+	if _, ok := agentconfig.GetAgentConfigAt(session.Root, agentID); !ok {
+		return errors.New("agent id not found")
+	}
+	root, err := workspaceRoot(session)
+	if err != nil {
+		return err
+	}
+	if _, err := gitRun(root, "rev-parse", "--verify", "HEAD"); err != nil {
+		return errors.New("worktree isolation requires a git repository with at least one commit")
+	}
+	if _, err := worktreeBase(root); err != nil {
+		return err
+	}
+	return session.DB.Create(&structs.SubAgents{
+		ID:       agentCode,
+		AgentID:  agentID,
+		BindPath: path,
+		Isolated: true,
+	}).Error
+}
+
+// ensureWorktree 确保隔离子代理的 worktree 存在：无分支时从 HEAD 新建分支，分支存在但目录缺失时重新检出
+func ensureWorktree(session *structs.Chats, obj *structs.SubAgents) error {
+	root, err := workspaceRoot(session)
+	if err != nil {
+		return err
+	}
+	rel, err := WorktreePath(root, obj.ID)
+	if err != nil {
+		return err
+	}
+	abs := filepath.Join(root, filepath.FromSlash(rel))
+	if obj.Branch != "" {
+		if _, err := os.Stat(abs); err == nil {
+			return nil
+		}
+		_, _ = gitRun(root, "worktree", "prune")
+		_, err := gitRun(root, "worktree", "add", rel, obj.Branch)
+		return err
+	}
+
+	base, err := gitRun(root, "rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return errors.New("worktree isolation requires a git repository with at least one commit")
+	}
+	branch := worktreeBranch(obj.ID)
+	_, _ = gitRun(root, "worktree", "prune")
+	if _, err := gitRun(root, "worktree", "add", "-b", branch, rel, base); err != nil {
+		return err
+	}
+	obj.Branch = branch
+	obj.BaseCommit = base
+	if err := session.DB.Model(&structs.SubAgents{}).Where("id = ?", obj.ID).
+		Updates(map[string]any{"branch": branch, "base_commit": base}).Error; err != nil {
+		_, _ = gitRun(root, "worktree", "remove", "--force", rel)
+		_, _ = gitRun(root, "branch", "-D", branch)
+		return err
+	}
+	logger.Info("created worktree %s on branch %s for agent %s", rel, branch, obj.ID)
+	return nil
+}
+
+// agentActivatePath 返回子代理激活后的工作路径（隔离子代理位于其 worktree 内）
+func agentActivatePath(session *structs.Chats, obj *structs.SubAgents) (string, error) {
+	if !obj.Isolated {
+		return obj.BindPath, nil
+	}
+	root, err := workspaceRoot(session)
+	if err != nil {
+		return "", err
+	}
+	rel, err := WorktreePath(root, obj.ID)
+	return filepath.ToSlash(filepath.Join(rel, obj.BindPath)), err
+}
+
+// removeWorktree 移除子代理的 worktree 目录（分支保留）
+func removeWorktree(root, agentCode string) {
+	rel, err := WorktreePath(root, agentCode)
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel))); err != nil {
+		return
+	}
+	if _, err := gitRun(root, "worktree", "remove", "--force", rel); err != nil {
+		logger.Warn("remove worktree %s failed: %v", rel, err)
+	}
+}
+
+// finalizeWorktree 停用隔离子代理时调用：提交 worktree 中未提交的改动，移除 worktree，
+// 并返回供主代理决定合并或丢弃的分支 diff 报告。无任何改动时直接清理分支并返回空串。
+func finalizeWorktree(session *structs.Chats, agentCode string) (string, error) {
+	var obj structs.SubAgents
+	if err := session.DB.Where("id = ?", agentCode).First(&obj).Error; err != nil {
+		return "", err
+	}
+	if !obj.Isolated || obj.Branch == "" {
+		return "", nil
+	}
+	root, err := workspaceRoot(session)
+	if err != nil {
+		return "", err
+	}
+	rel, err := WorktreePath(root, agentCode)
+	if err != nil {
+		return "", err
+	}
+	wt := filepath.Join(root, filepath.FromSlash(rel))
+	if _, err := os.Stat(wt); err == nil {
+		if status, err := gitRun(wt, "status", "--porcelain"); err == nil && status != "" {
+			if _, err := gitRun(wt, "add", "-A"); err != nil {
+				return "", err
+			}
+			args := append(commitIdentity(wt), "commit", "-q", "-m", "alkaid0: work of agent "+agentCode)
+			if _, err := gitRun(wt, args...); err != nil {
+				return "", err
+			}
+		}
+	}
+	removeWorktree(root, agentCode)
+
+	rng := obj.BaseCommit + ".." + obj.Branch
+	count, err := gitRun(root, "rev-list", "--count", rng)
+	if err != nil {
+		return "", err
+	}
+	if count == "0" {
+		// 无改动：直接清理分支，下次激活时从最新 HEAD 重新创建
+		if _, err := gitRun(root, "branch", "-D", obj.Branch); err != nil {
+			logger.Warn("delete empty branch %s failed: %v", obj.Branch, err)
+		}
+		return "", clearBranch(session, agentCode)
+	}
+	stat, _ := gitRun(root, "diff", "--stat", obj.BaseCommit, obj.Branch)
+	patch, _ := gitRun(root, "diff", "--no-color", "--no-ext-diff", obj.BaseCommit, obj.Branch)
+	if len(patch) > maxWorktreeDiffBytes {
+		patch = patch[:maxWorktreeDiffBytes] + "\n... diff truncated"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Subagent `%s` worked in the isolated branch `%s` (%s commit(s) since %s).\n", agentCode, obj.Branch, count, shortCommit(obj.BaseCommit))
+	fmt.Fprintf(&b, "Review the changes, then call `agent` with {\"name\":%q,\"resolve\":\"merge\"} to merge them into the current branch, or {\"name\":%q,\"resolve\":\"discard\"} to drop them.\n\n", agentCode, agentCode)
+	b.WriteString(stat)
+	b.WriteString("\n\n```diff\n")
+	b.WriteString(patch)
+	b.WriteString("\n```")
+	return b.String(), nil
+}
+
+func shortCommit(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func clearBranch(session *structs.Chats, agentCode string) error {
+	return session.DB.Model(&structs.SubAgents{}).Where("id = ?", agentCode).
+		Updates(map[string]any{"branch": "", "base_commit": ""}).Error
+}
+
+// ResolveAgent 合并或丢弃隔离子代理的分支，并清理其 worktree
+func ResolveAgent(session *structs.Chats, agentCode string, mode string) error {
+	if session.NowAgent == agentCode {
+		return errors.New("cannot resolve the branch of the currently active agent, deactivate it first")
+	}
+	if err := checkNotParallel(session, agentCode); err != nil {
+		return err
+	}
+	var obj structs.SubAgents
+	if err := session.DB.Where("id = ?", agentCode).First(&obj).Error; err != nil {
+		return err
+	}
+	if !obj.Isolated || obj.Branch == "" {
+		return errors.New("agent has no pending worktree branch")
+	}
+	root, err := workspaceRoot(session)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case ResolveMerge:
+		// 合并会改写用户的工作区，存在未提交改动时拒绝，避免与其混在一起或合并中途失败
+		if status, err := gitRun(root, "status", "--porcelain"); err != nil {
+			return err
+		} else if status != "" {
+			return errors.New("working tree has uncommitted changes, commit or stash them before merging")
+		}
+		removeWorktree(root, agentCode)
+		args := append(commitIdentity(root), "merge", "--no-ff", "--no-edit", obj.Branch)
+		if _, err := gitRun(root, args...); err != nil {
+			_, _ = gitRun(root, "merge", "--abort")
+			return fmt.Errorf("merge of %s failed and was aborted, resolve manually: %w", obj.Branch, err)
+		}
+		logger.Info("merged branch %s of agent %s", obj.Branch, agentCode)
+	case ResolveDiscard:
+		removeWorktree(root, agentCode)
+		logger.Info("discarding branch %s of agent %s", obj.Branch, agentCode)
+	default:
+		return fmt.Errorf("unknown resolve mode %q, expected merge or discard", mode)
+	}
+	if _, err := gitRun(root, "branch", "-D", obj.Branch); err != nil {
+		logger.Warn("delete branch %s failed: %v", obj.Branch, err)
+	}
+	return clearBranch(session, agentCode)
+}
@@ -0,0 +1,178 @@
+package agents
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/storage/structs"
+)
+
+// setupGitWorkspace 创建带初始提交的临时仓库
+func setupGitWorkspace(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(dir, ".gitconfig-test"))
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.name", "Tester"},
+		{"config", "user.email", "t@example.com"},
+		{"config", "commit.gpgsign", "false"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.txt"), []byte("base\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"add", "-A"}, {"commit", "-q", "-m", "init"}} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func lastCommunicate(t *testing.T, session *structs.Chats) string {
+	t.Helper()
+	var msg structs.Messages
+	if err := session.DB.Where("chat_id = ? AND type = ?", session.ID, structs.MessagesRoleCommunicate).
+		Order("id desc").First(&msg).Error; err != nil {
+		t.Fatalf("no communicate message: %v", err)
+	}
+	return msg.Delta
+}
+
+// TestIsolatedAgentLifecycle 测试隔离子代理：独立 worktree 工作、停用时回传 diff、合并后清理
+func TestIsolatedAgentLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	session := setupTestSession(t, db)
+	root := setupGitWorkspace(t)
+	session.Root = root
+
+	if err := AddIsolatedAgent(session, "worker one", "tag-coder", "."); err != nil {
+		t.Fatalf("AddIsolatedAgent failed: %v", err)
+	}
+	if err := ActivateAgent(session, "worker one", "do work"); err != nil {
+		t.Fatalf("ActivateAgent failed: %v", err)
+	}
+	if session.CurrentActivatePath != ".git/alkaid0-worktrees/worker-one" {
+		t.Fatalf("unexpected activate path %q", session.CurrentActivatePath)
+	}
+	wt := filepath.Join(root, session.CurrentActivatePath)
+	if err := os.WriteFile(filepath.Join(wt, "feature.txt"), []byte("feature\n"), 0644); err != nil {
+		t.Fatalf("write in worktree: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "feature.txt")); !os.IsNotExist(err) {
+		t.Fatal("worktree changes must not appear in the main working tree")
+	}
+
+	if err := DeactivateAgent(session, "done"); err != nil {
+		t.Fatalf("DeactivateAgent failed: %v", err)
+	}
+	report := lastCommunicate(t, session)
+	if !strings.Contains(report, "alkaid0/worker-one") || !strings.Contains(report, "+feature") || !strings.Contains(report, `"resolve":"merge"`) {
+		t.Fatalf("unexpected worktree report:\n%s", report)
+	}
+	if _, err := os.Stat(wt); !os.IsNotExist(err) {
+		t.Fatal("worktree should be removed after deactivation")
+	}
+	if err := DeleteAgent(session, "worker one"); err == nil {
+		t.Fatal("delete must be refused while the branch is pending")
+	}
+
+	// 主工作区有未提交改动时拒绝合并，分支保持待处理
+	if err := os.WriteFile(filepath.Join(root, "main.txt"), []byte("local edit\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResolveAgent(session, "worker one", ResolveMerge); err == nil || !strings.Contains(err.Error(), "uncommitted") {
+		t.Fatalf("merge into a dirty tree should be refused, got %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "main.txt")); string(b) != "local edit\n" {
+		t.Fatalf("refused merge must not touch local changes, got %q", b)
+	}
+	if out, err := exec.Command("git", "-C", root, "checkout", "--", "main.txt").CombinedOutput(); err != nil {
+		t.Fatalf("git checkout: %v\n%s", err, out)
+	}
+
+	if err := ResolveAgent(session, "worker one", ResolveMerge); err != nil {
+		t.Fatalf("ResolveAgent merge failed: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "feature.txt")); err != nil || string(b) != "feature\n" {
+		t.Fatalf("merged file missing: %q %v", b, err)
+	}
+	var obj structs.SubAgents
+	if err := db.Where("id = ?", "worker one").First(&obj).Error; err != nil {
+		t.Fatal(err)
+	}
+	if obj.Branch != "" || !obj.Isolated {
+		t.Fatalf("branch should be cleared after resolve: %+v", obj)
+	}
+	if out, _ := exec.Command("git", "-C", root, "branch", "--list", "alkaid0/*").Output(); strings.TrimSpace(string(out)) != "" {
+		t.Fatalf("branch should be deleted, got %q", out)
+	}
+	if err := DeleteAgent(session, "worker one"); err != nil {
+		t.Fatalf("DeleteAgent failed: %v", err)
+	}
+}
+
+// TestIsolatedAgentDiscardAndNoChanges 测试丢弃分支，以及无改动时自动清理
+func TestIsolatedAgentDiscardAndNoChanges(t *testing.T) {
+	db := setupTestDB(t)
+	session := setupTestSession(t, db)
+	root := setupGitWorkspace(t)
+	session.Root = root
+
+	if err := AddIsolatedAgent(session, "idle", "tag-coder", "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := ActivateAgent(session, "idle", "nothing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeactivateAgent(session, "no-op"); err != nil {
+		t.Fatal(err)
+	}
+	var obj structs.SubAgents
+	db.Where("id = ?", "idle").First(&obj)
+	if obj.Branch != "" {
+		t.Fatalf("empty branch should be cleaned up, got %q", obj.Branch)
+	}
+	if err := ResolveAgent(session, "idle", ResolveDiscard); err == nil {
+		t.Fatal("resolve without pending branch should fail")
+	}
+
+	if err := ActivateAgent(session, "idle", "work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, session.CurrentActivatePath, "main.txt"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeactivateAgent(session, "done"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResolveAgent(session, "idle", ResolveDiscard); err != nil {
+		t.Fatalf("discard failed: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "main.txt")); string(b) != "base\n" {
+		t.Fatalf("discard must not touch the main tree, got %q", b)
+	}
+}
+
+// TestAddIsolatedAgent_RequiresGit 测试非 git 仓库拒绝创建隔离子代理
+func TestAddIsolatedAgent_RequiresGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	db := setupTestDB(t)
+	session := setupTestSession(t, db)
+	session.Root = t.TempDir()
+	if err := AddIsolatedAgent(session, "x", "tag-coder", "."); err == nil {
+		t.Fatal("expected error outside a git repository")
+	}
+}
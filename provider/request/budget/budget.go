@@ -0,0 +1,163 @@
+package budget
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/log"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	"gorm.io/gorm"
+)
+
+var logger = log.New("budget")
+
+// WarnRatio 用量达到上限的该比例时提醒模型收尾
+const WarnRatio = 0.8
+
+// Usage 预算窗口内的用量
+type Usage struct {
+	Tokens  uint64
+	Cost    float64
+	Elapsed time.Duration
+}
+
+// ExceededError 预算超出。Agent 为 true 表示子代理本次激活的预算，否则为主会话本轮预算
+type ExceededError struct {
+	Agent  bool
+	Detail string
+}
+
+func (e *ExceededError) Error() string {
+	if e.Agent {
+		return "subagent budget exceeded: " + e.Detail
+	}
+	return "turn budget exceeded: " + e.Detail
+}
+
+// Begin 开启预算窗口，统计此后新写入的消息
+func Begin(db *gorm.DB, chatID uint32, limits cfgStructs.BudgetConfig) structs.BudgetWindow {
+	var lastID uint64
+	if db != nil {
+		db.Model(&structs.Messages{}).Where("chat_id = ?", chatID).Select("COALESCE(MAX(id), 0)").Scan(&lastID)
+	}
+	return BeginAt(lastID, limits)
+}
+
+// BeginAt 开启从指定消息之后开始统计的预算窗口
+func BeginAt(startMsgID uint64, limits cfgStructs.BudgetConfig) structs.BudgetWindow {
+	return structs.BudgetWindow{Limits: limits, StartMsgID: startMsgID, StartTime: time.Now()}
+}
+
+// Measure 统计窗口内的用量；agentID 非 nil 时只统计该代理的消息
+func Measure(db *gorm.DB, chatID uint32, agentID *string, w structs.BudgetWindow) (Usage, error) {
+	var rows []struct {
+		ModelID          uint32
+		PromptTokens     uint64
+		CompletionTokens uint64
+		CachedTokens     uint64
+	}
+	q := db.Model(&structs.Messages{}).
+		Select("model_id, SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, SUM(cached_tokens) AS cached_tokens").
+		Where("chat_id = ? AND id > ?", chatID, w.StartMsgID)
+	if agentID != nil {
+		q = q.Where("agent_id = ?", *agentID)
+	}
+	if err := q.Group("model_id").Scan(&rows).Error; err != nil {
+		return Usage{}, err
+	}
+	usage := Usage{Elapsed: time.Since(w.StartTime)}
+	for _, row := range rows {
+		usage.Tokens += row.PromptTokens + row.CompletionTokens
+		if modelCfg, ok := config.GlobalConfig.Model.Models[int32(row.ModelID)]; ok {
+			usage.Cost += modelCfg.Cost(row.PromptTokens, row.CompletionTokens, row.CachedTokens)
+		}
+	}
+	return usage, nil
+}
+
+// Ratio 用量相对各项上限的最大比例，未设置上限时为 0
+func Ratio(limits cfgStructs.BudgetConfig, usage Usage) float64 {
+	ratio := 0.0
+	if limits.MaxTokens > 0 {
+		ratio = max(ratio, float64(usage.Tokens)/float64(limits.MaxTokens))
+	}
+	if limits.MaxCost > 0 {
+		ratio = max(ratio, usage.Cost/limits.MaxCost)
+	}
+	if limits.MaxTime > 0 {
+		ratio = max(ratio, usage.Elapsed.Seconds()/float64(limits.MaxTime))
+	}
+	return ratio
+}
+
+// Describe 生成用量/上限的可读描述，只列出已设置的上限
+func Describe(limits cfgStructs.BudgetConfig, usage Usage) string {
+	var parts []string
+	if limits.MaxTokens > 0 {
+		parts = append(parts, fmt.Sprintf("tokens %d/%d", usage.Tokens, limits.MaxTokens))
+	}
+	if limits.MaxCost > 0 {
+		parts = append(parts, fmt.Sprintf("cost %.4f/%.4f", usage.Cost, limits.MaxCost))
+	}
+	if limits.MaxTime > 0 {
+		parts = append(parts, fmt.Sprintf("time %s/%s",
+			usage.Elapsed.Truncate(time.Second), (time.Duration(limits.MaxTime)*time.Second)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Enforce 在两次模型请求之间检查预算（此时不存在未配对的工具调用，可安全写入消息）：
+// 子代理本次激活的预算先于主会话本轮预算检查；首次达到 WarnRatio 时向当前代理注入一次提醒，
+// 超出时返回 *ExceededError，由调用方停用子代理或停止本轮。
+func Enforce(session *structs.Chats) error {
+	if session.DB == nil {
+		return nil
+	}
+	if session.CurrentAgentID != "" {
+		agentID := session.CurrentAgentID
+		if err := check(session, &session.AgentBudget, &agentID, true); err != nil {
+			return err
+		}
+	}
+	return check(session, &session.TurnBudget, nil, false)
+}
+
+func check(session *structs.Chats, w *structs.BudgetWindow, agentID *string, isAgent bool) error {
+	if w.Limits.IsZero() {
+		return nil
+	}
+	usage, err := Measure(session.DB, session.ID, agentID, *w)
+	if err != nil {
+		logger.Warn("measure budget in ID=%d: %v", session.ID, err)
+		return nil
+	}
+	ratio := Ratio(w.Limits, usage)
+	detail := Describe(w.Limits, usage)
+	if ratio >= 1 {
+		logger.Info("budget exceeded in ID=%d (agent=%v): %s", session.ID, isAgent, detail)
+		return &ExceededError{Agent: isAgent, Detail: detail}
+	}
+	if ratio < WarnRatio || w.Warned {
+		return nil
+	}
+	w.Warned = true
+	scope := "this turn"
+	if isAgent {
+		scope = "this subagent activation"
+	}
+	notice := fmt.Sprintf("Budget notice: %d%% of the budget for %s is used (%s). "+
+		"Finish the current step and wrap up; work will be stopped when the budget is exhausted.", int(ratio*100), scope, detail)
+	current := session.CurrentAgentID
+	if err := session.DB.Create(&structs.Messages{
+		ChatID:  session.ID,
+		Delta:   notice,
+		AgentID: &current,
+		Type:    structs.MessagesRoleCommunicate,
+	}).Error; err != nil {
+		logger.Warn("persist budget notice in ID=%d: %v", session.ID, err)
+	}
+	return nil
+}
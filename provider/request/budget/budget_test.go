@@ -0,0 +1,139 @@
+package budget
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStruct "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	u "github.com/cxykevin/alkaid0/utils"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupBudgetTestDB 设置预算测试数据库
+func setupBudgetTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&structs.Chats{}, &structs.Messages{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	t.Cleanup(func() { u.Unwrap(db.DB()).Close() })
+	return db
+}
+
+func addUsage(t *testing.T, db *gorm.DB, agentID string, prompt, completion uint32) {
+	t.Helper()
+	if err := db.Create(&structs.Messages{
+		ChatID:           1,
+		AgentID:          &agentID,
+		Type:             structs.MessagesRoleAgent,
+		ModelID:          1,
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMeasure 测试窗口起点与代理过滤，以及按模型价格计算费用
+func TestMeasure(t *testing.T) {
+	db := setupBudgetTestDB(t)
+	config.GlobalConfigSwap(cfgStruct.Config{
+		Model: cfgStruct.ModelsConfig{
+			Models: map[int32]cfgStruct.ModelConfig{
+				1: {InputPrice: 1, OutputPrice: 2},
+			},
+		},
+	})
+
+	addUsage(t, db, "", 1000, 1000)
+	w := Begin(db, 1, cfgStruct.BudgetConfig{MaxTokens: 100})
+	addUsage(t, db, "", 300_000, 100_000)
+	addUsage(t, db, "sub", 700_000, 400_000)
+
+	usage, err := Measure(db, 1, nil, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Tokens != 1_500_000 {
+		t.Errorf("Tokens = %d, want 1500000", usage.Tokens)
+	}
+	if math.Abs(usage.Cost-2) > 1e-9 {
+		t.Errorf("Cost = %f, want 2", usage.Cost)
+	}
+
+	agent := "sub"
+	usage, err = Measure(db, 1, &agent, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Tokens != 1_100_000 {
+		t.Errorf("agent Tokens = %d, want 1100000", usage.Tokens)
+	}
+}
+
+// TestRatioAndDescribe 测试多项上限取最大比例，描述只列出已设置的上限
+func TestRatioAndDescribe(t *testing.T) {
+	limits := cfgStruct.BudgetConfig{MaxTokens: 1000, MaxTime: 10}
+	usage := Usage{Tokens: 500, Cost: 99, Elapsed: 9 * time.Second}
+	if got := Ratio(limits, usage); math.Abs(got-0.9) > 1e-9 {
+		t.Errorf("Ratio = %f, want 0.9", got)
+	}
+	if got := Ratio(cfgStruct.BudgetConfig{}, usage); got != 0 {
+		t.Errorf("Ratio without limits = %f, want 0", got)
+	}
+	desc := Describe(limits, usage)
+	if !strings.Contains(desc, "tokens 500/1000") || !strings.Contains(desc, "time 9s/10s") || strings.Contains(desc, "cost") {
+		t.Errorf("Describe = %q", desc)
+	}
+}
+
+// TestEnforce 测试接近上限时只提醒一次，超出时返回对应类型的错误
+func TestEnforce(t *testing.T) {
+	db := setupBudgetTestDB(t)
+	config.GlobalConfigSwap(cfgStruct.Config{})
+	session := &structs.Chats{ID: 1, DB: db}
+	session.TurnBudget = Begin(db, 1, cfgStruct.BudgetConfig{MaxTokens: 1000})
+
+	addUsage(t, db, "", 400, 0)
+	if err := Enforce(session); err != nil {
+		t.Fatalf("unexpected error below warn ratio: %v", err)
+	}
+	addUsage(t, db, "", 450, 0)
+	for range 2 {
+		if err := Enforce(session); err != nil {
+			t.Fatalf("unexpected error below limit: %v", err)
+		}
+	}
+	var notices int64
+	db.Model(&structs.Messages{}).Where("type = ?", structs.MessagesRoleCommunicate).Count(&notices)
+	if notices != 1 {
+		t.Errorf("expected exactly one budget notice, got %d", notices)
+	}
+
+	addUsage(t, db, "", 200, 0)
+	var exceeded *ExceededError
+	if err := Enforce(session); !errors.As(err, &exceeded) || exceeded.Agent {
+		t.Fatalf("expected turn budget error, got %v", err)
+	}
+
+	// 子代理预算只统计该代理的消息，并先于本轮预算检查
+	session.TurnBudget = structs.BudgetWindow{}
+	session.CurrentAgentID = "sub"
+	session.AgentBudget = Begin(db, 1, cfgStruct.BudgetConfig{MaxTokens: 100})
+	addUsage(t, db, "", 5000, 0)
+	if err := Enforce(session); err != nil {
+		t.Fatalf("main agent usage should not count against the subagent: %v", err)
+	}
+	addUsage(t, db, "sub", 100, 0)
+	if err := Enforce(session); !errors.As(err, &exceeded) || !exceeded.Agent {
+		t.Fatalf("expected subagent budget error, got %v", err)
+	}
+}
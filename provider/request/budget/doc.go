@@ -0,0 +1,4 @@
+// Package budget 会话与子代理的 token / 费用 / 耗时预算
+//
+// 按 Messages 表记录的用量统计预算窗口，接近上限时提醒模型，超出时由调用方停用子代理或停止本轮
+package budget
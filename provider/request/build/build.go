@@ -7,22 +7,39 @@ import (
 	"gorm.io/gorm"
 )
 
+// buildParts 构造请求体时产生的中间结果，供上下文统计区分各组成部分
+type buildParts struct {
+	ModelID  uint32
+	Scopes   string
+	Traces   string
+	Prehooks globalPrehooks
+}
+
 // Build 构造请求体
 func Build(db *gorm.DB, session *storageStructs.Chats) (*reqStruct.ChatCompletionRequest, error) {
+	body, _, err := build(db, session)
+	return body, err
+}
+
+func build(db *gorm.DB, session *storageStructs.Chats) (*reqStruct.ChatCompletionRequest, buildParts, error) {
+	var parts buildParts
 	// lastChatID := storage.GlobalConfig.CurrentChatID
 	// if lastChatID == 0 {
 	// 	logger.Error("no last chat id")
 	// 	return nil, errors.New("no last chat id")
 	// }
 	// 构造工具
-	var scopes, traces string
 	var tools *[]*parser.ToolsDefine = &[]*parser.ToolsDefine{}
 	logger.Info("building request body for chatID=%d, agent=%s", session.ID, session.NowAgent)
 	chatLine := &storageStructs.Chats{}
 	if err := db.Where("id = ?", session.ID).First(chatLine).Error; err != nil {
 		// 重读失败时直接返回错误，避免用零值 chatLine 静默降级到错误的模型/agent 上下文
 		logger.Error("db error %v", err)
-		return nil, err
+		return nil, parts, err
+	}
+	if session.ForkedFrom() != nil {
+		// 并行子代理的 Fork 会话不回写 now_agent，以会话自身的当前代理为准
+		chatLine.NowAgent = session.NowAgent
 	}
 	if !session.InTestFlag {
 		// 检测每个 path 最近一次 read/edit 事件，写入 session.TemporyDataOfSession。
@@ -31,18 +48,19 @@ func Build(db *gorm.DB, session *storageStructs.Chats) (*reqStruct.ChatCompletio
 			logger.Warn("detect trace events error: %v", err) // 非致命：降级为全部顶部聚合
 		}
 		var err error
-		scopes, traces, tools, err = Tools(session)
+		parts.Scopes, parts.Traces, tools, parts.Prehooks, err = buildTools(session)
 		if err != nil {
 			logger.Error("build tools error %v", err)
-			return nil, err
+			return nil, parts, err
 		}
 	}
 	// 把运行时临时数据（事件映射/内容块）随 chatLine 传给 RequestBody
 	chatLine.TemporyDataOfSession = session.TemporyDataOfSession
-	body, err := RequestBody(session.ID, int32(chatLine.LastModelID), chatLine.NowAgent, tools, db, scopes, traces, session.CurrentAgentConfig, chatLine)
+	parts.ModelID = chatLine.LastModelID
+	body, err := RequestBody(session.ID, int32(chatLine.LastModelID), chatLine.NowAgent, tools, db, parts.Scopes, parts.Traces, session.CurrentAgentConfig, chatLine)
 	if err != nil {
 		logger.Error("build request body error %v", err)
-		return nil, err
+		return nil, parts, err
 	}
-	return body, nil
+	return body, parts, nil
 }
@@ -1,11 +1,15 @@
 package build
 
 import (
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
 	"github.com/cxykevin/alkaid0/config"
 	cfgStruct "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/library/chancall"
+	agents "github.com/cxykevin/alkaid0/provider/request/agents/actions"
 	"github.com/cxykevin/alkaid0/storage/structs"
 	"github.com/cxykevin/alkaid0/tools/index"
 	"github.com/glebarez/sqlite"
@@ -62,6 +66,15 @@ func setupBuildTest(t *testing.T) *gorm.DB {
 	// 加载工具注册（只执行一次）
 	loadToolsOnce.Do(func() {
 		index.Load()
+		// agents 全局 PreHook 需要列出子代理
+		agents.Call = chancall.Register(agents.ConsumerName, func(obj any) (any, error) {
+			if list, ok := obj.(agents.List); ok {
+				var ret []structs.SubAgents
+				err := list.Session.DB.Find(&ret).Error
+				return ret, err
+			}
+			return nil, nil
+		})
 	})
 
 	return db
@@ -478,3 +491,75 @@ func TestBuildWithSummary(t *testing.T) {
 		t.Errorf("Build() returned nil request")
 	}
 }
+
+// TestInspectContext 测试上下文统计按组成部分分项，且不改变会话数据
+func TestInspectContext(t *testing.T) {
+	db := setupBuildTest(t)
+	root := t.TempDir()
+	chat := structs.Chats{
+		ID:                   300,
+		LastModelID:          1,
+		Root:                 root,
+		DB:                   db,
+		TemporyDataOfSession: map[string]any{},
+	}
+	if err := db.Create(&chat).Error; err != nil {
+		t.Fatalf("Failed to create test chat: %v", err)
+	}
+	messages := []structs.Messages{
+		{ChatID: 300, Type: structs.MessagesRoleUser, Delta: "旧的问题"},
+		{ChatID: 300, Type: structs.MessagesRoleAgent, Delta: "旧的回答", Summary: "用户之前询问了旧的问题"},
+		{ChatID: 300, Type: structs.MessagesRoleUser, Delta: "新的问题"},
+		{ChatID: 300, Type: structs.MessagesRoleAgent, Delta: "新的回答"},
+	}
+	for _, msg := range messages {
+		if err := db.Create(&msg).Error; err != nil {
+			t.Fatalf("Failed to create test message: %v", err)
+		}
+	}
+
+	// 被跟踪文件已变化：正常构建会推进 last_content，统计时不应写回
+	if err := os.WriteFile(filepath.Join(root, "traced.txt"), []byte("new content\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&structs.Traces{ChatID: 300, Path: "traced.txt", LastContent: "old content\n"}).Error; err != nil {
+		t.Fatalf("Failed to create trace: %v", err)
+	}
+
+	report, err := InspectContext(db, &chat)
+	if err != nil {
+		t.Fatalf("InspectContext() returned error: %v", err)
+	}
+	if report.ModelName != "test-model" {
+		t.Errorf("ModelName = %q, want test-model", report.ModelName)
+	}
+	if report.System <= 0 || report.Scopes <= 0 || report.Tools <= 0 || len(report.ToolItems) == 0 {
+		t.Errorf("expected system, scopes and tools to be counted: %+v", report)
+	}
+	names := map[string]int{}
+	for _, item := range report.PreHooks {
+		names[item.Name] = item.Tokens
+	}
+	if names["memory"] <= 0 || names["date"] <= 0 || names["task"] <= 0 {
+		t.Errorf("expected memory, date and task prehooks, got %+v", report.PreHooks)
+	}
+	if report.Summary <= 0 {
+		t.Errorf("expected summary tokens, got %d", report.Summary)
+	}
+	if report.Messages != 2 || report.History <= 0 {
+		t.Errorf("expected 2 history messages after the summary, got %d (%d tokens)", report.Messages, report.History)
+	}
+	if report.Total < report.System+report.Tools+report.Summary+report.History {
+		t.Errorf("Total %d is smaller than its parts: %+v", report.Total, report)
+	}
+	if len(chat.TemporyDataOfSession) != 0 {
+		t.Errorf("InspectContext should not touch the session temporary data, got %v", chat.TemporyDataOfSession)
+	}
+	var traced structs.Traces
+	if err := db.Where("chat_id = ? AND path = ?", 300, "traced.txt").First(&traced).Error; err != nil {
+		t.Fatal(err)
+	}
+	if traced.LastContent != "old content\n" {
+		t.Errorf("InspectContext should not advance the trace cache, got %q", traced.LastContent)
+	}
+}
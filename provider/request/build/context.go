@@ -0,0 +1,131 @@
+package build
+
+import (
+	"strings"
+
+	reqStruct "github.com/cxykevin/alkaid0/provider/request/structs"
+	storageStructs "github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/tools/tools/trace"
+	u "github.com/cxykevin/alkaid0/utils"
+	"gorm.io/gorm"
+)
+
+// summaryMarker 摘要消息的起始标记（见 prompts/summary_wrap.md）
+const summaryMarker = "<!-- Alkaid Summary -->"
+
+// ContextItem 上下文中一个组成部分的 token 估算
+type ContextItem struct {
+	Name   string `json:"name"`
+	Tokens int    `json:"tokens"`
+}
+
+// ContextReport 当前会话下一次请求的上下文构成。
+// token 数均为 utils.EstimateTokens 的估算值，各项之和与 Total 可能略有出入（模板空白等）。
+type ContextReport struct {
+	ModelID      uint32        `json:"modelId"`
+	ModelName    string        `json:"modelName"`
+	CompressSize uint32        `json:"compressSize"` // 触发自动压缩的阈值
+	Total        int           `json:"total"`
+	System       int           `json:"system"`    // system 提示词（不含命名空间列表）
+	Scopes       int           `json:"scopes"`    // 命名空间列表与未启用命名空间提示
+	PreHooks     []ContextItem `json:"prehooks"`  // 全局 PreHook 注入（memory、AGENTS.md、task、date 等），按执行顺序
+	Tools        int           `json:"tools"`     // 工具定义合计
+	ToolItems    []ContextItem `json:"toolItems"` // 按工具名升序
+	Traced       int           `json:"traced"`    // 按事件插入历史的 traced 文件与 @task 内容块
+	Summary      int           `json:"summary"`   // 历史摘要（含 pinned 消息）
+	History      int           `json:"history"`   // 其余历史消息
+	Messages     int           `json:"messages"`  // 历史消息条数（不含摘要与内容块）
+}
+
+// InspectContext 按 Build 的流程构建当前会话的下一次请求但不发送，统计各组成部分的 token 数。
+// 构建在 DryRun 的会话副本上进行，不影响会话的 trace 缓存与数据库。
+// 不开事务：sqlite 单连接下长事务会阻塞会话的其他读写。
+func InspectContext(db *gorm.DB, session *storageStructs.Chats) (*ContextReport, error) {
+	probe := session.Fork()
+	probe.DryRun = true
+	probe.NowAgent = session.NowAgent
+	probe.CurrentAgentID = session.CurrentAgentID
+	probe.CurrentAgentConfig = session.CurrentAgentConfig
+	probe.CurrentActivatePath = session.CurrentActivatePath
+
+	body, parts, err := build(db, probe)
+	if err != nil {
+		return nil, err
+	}
+	modelConfig, err := GetModelConfig(int32(parts.ModelID))
+	if err != nil {
+		return nil, err
+	}
+	report := &ContextReport{
+		ModelID:      parts.ModelID,
+		ModelName:    modelConfig.ModelName,
+		CompressSize: modelConfig.CompressSize,
+		PreHooks:     []ContextItem{},
+		ToolItems:    []ContextItem{},
+	}
+
+	report.Scopes = u.EstimateTokens(parts.Scopes) + u.EstimateTokens(strings.Join(parts.Prehooks.Unused, "\n"))
+	for _, p := range parts.Prehooks.Active {
+		if strings.TrimSpace(p.Text) == "" {
+			continue
+		}
+		report.PreHooks = append(report.PreHooks, ContextItem{Name: p.Name, Tokens: u.EstimateTokens(p.Text)})
+	}
+	for _, t := range body.Tools {
+		tokens := u.EstimateTokens(t.Function.Name) + u.EstimateTokens(t.Function.Description) + u.EstimateTokens(string(t.Function.Parameters))
+		report.ToolItems = append(report.ToolItems, ContextItem{Name: t.Function.Name, Tokens: tokens})
+		report.Tools += tokens
+	}
+	report.Total = report.Tools
+
+	traceHeader := ""
+	if rendered, err := trace.RenderTraceBlock(nil); err == nil {
+		traceHeader, _, _ = strings.Cut(strings.TrimSpace(rendered), "\n")
+	}
+	taskBlock, _ := probe.TemporyDataOfSession[storageStructs.TempKeyTaskEventBlock].(string)
+	taskBlock = strings.TrimSpace(taskBlock)
+
+	prehookMsg := parts.Traces != ""
+	for _, msg := range body.Messages {
+		tokens := messageTokens(msg)
+		report.Total += tokens
+		switch {
+		case msg.Role == reqStruct.RoleSystem:
+			report.System += tokens - u.EstimateTokens(parts.Scopes)
+		case prehookMsg && msg.Role == reqStruct.RoleUser && msg.Content == parts.Traces:
+			// 全局 PreHook 注入已按来源分项统计
+			prehookMsg = false
+		case strings.HasPrefix(strings.TrimSpace(msg.Content), summaryMarker):
+			report.Summary += tokens
+		case msg.Role == reqStruct.RoleUser && isTracedBlock(msg.Content, traceHeader, taskBlock):
+			report.Traced += tokens
+		default:
+			report.History += tokens
+			report.Messages++
+		}
+	}
+	if report.System < 0 {
+		report.System = 0
+	}
+	return report, nil
+}
+
+// isTracedBlock 判断消息是否为插入历史的 traced 文件 / @task 内容块
+func isTracedBlock(content, traceHeader, taskBlock string) bool {
+	return (traceHeader != "" && strings.HasPrefix(content, traceHeader)) ||
+		(taskBlock != "" && strings.HasPrefix(content, taskBlock))
+}
+
+// messageTokens 估算单条消息的 token 数（正文、思考内容与工具调用参数）
+func messageTokens(msg reqStruct.Message) int {
+	n := u.EstimateTokens(msg.Content)
+	if msg.ReasoningContent != nil {
+		n += u.EstimateTokens(*msg.ReasoningContent)
+	}
+	for _, c := range msg.ToolCalls {
+		if c.Function != nil {
+			n += u.EstimateTokens(c.Function.Name) + u.EstimateTokens(c.Function.Arguments)
+		}
+	}
+	return n
+}
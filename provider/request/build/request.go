@@ -174,9 +174,11 @@ scan:
 				Content: "",
 			}
 			if v.Summary != "" {
-				rendered, err := prompts.Render(prompts.SummaryWrapTemplate, struct {
-					Summary string
-				}{Summary: v.Summary})
+				pinned, err := pinnedUpTo(db, chatID, agentCode, v.ID)
+				if err != nil {
+					return nil, err
+				}
+				rendered, err := prompts.Render(prompts.SummaryWrapTemplate, summaryWrapData{Summary: v.Summary, Pinned: pinned})
 				if err != nil {
 					return nil, err
 				}
@@ -300,7 +302,7 @@ scan:
 					msg.Content = v.Delta
 				}
 			}
-			if v.Type == structs.MessagesRoleTool {
+			if v.Type == structs.MessagesRoleTool && v.Summary == "" {
 				// 原生模式：工具结果按 id 拆分为多条 role:"tool" 消息，严格配对——
 				// 结果 id 必须命中全部回放轮次的 assistant 工具调用集合（丢弃孤立的
 				// 幽灵结果）。被终止调用的占位结果由 assistant 分支补齐。
@@ -1579,3 +1579,46 @@ func TestDetectTraceEvents(t *testing.T) {
 		t.Error("@task should have no prev event")
 	}
 }
+
+// TestRequestBody_PinnedSurvivesSummary 测试摘要边界之前的固定消息原样附在摘要之后
+func TestRequestBody_PinnedSurvivesSummary(t *testing.T) {
+	setupTestConfig()
+	db := setupTestDB(t)
+
+	messages := []structs.Messages{
+		{ChatID: 91, Type: structs.MessagesRoleUser, Delta: "forgotten detail"},
+		{ChatID: 91, Type: structs.MessagesRoleUser, Delta: "error: exact failure text", Pinned: true},
+		{ChatID: 91, Type: structs.MessagesRoleTool, Delta: `[{"name":"read","id":"x","return":"gone"}]`, Summary: "the summary"},
+		{ChatID: 91, Type: structs.MessagesRoleUser, Delta: "pinned after boundary", Pinned: true},
+	}
+	if err := db.Create(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	toolsList := []*parser.ToolsDefine{}
+	request, err := RequestBody(91, 1, "", &toolsList, db, "", "", cfgStruct.AgentConfig{}, &structs.Chats{})
+	if err != nil {
+		t.Fatalf("RequestBody failed: %v", err)
+	}
+
+	var all strings.Builder
+	summaryCount := 0
+	for _, msg := range request.Messages {
+		all.WriteString(msg.Content + "\n")
+		if strings.Contains(msg.Content, "the summary") {
+			summaryCount++
+			if !strings.Contains(msg.Content, "error: exact failure text") {
+				t.Errorf("pinned message should be attached to the summary: %q", msg.Content)
+			}
+		}
+	}
+	if summaryCount != 1 {
+		t.Fatalf("expected the summary on a tool message to be rendered once, got %d", summaryCount)
+	}
+	if strings.Contains(all.String(), "forgotten detail") {
+		t.Error("unpinned messages before the summary must not be replayed")
+	}
+	if strings.Count(all.String(), "pinned after boundary") != 1 {
+		t.Error("pinned message after the boundary should be replayed once as a normal message")
+	}
+}
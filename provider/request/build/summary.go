@@ -2,9 +2,11 @@ package build
 
 import (
 	"container/list"
+	"strings"
 
 	"github.com/cxykevin/alkaid0/config"
 	"github.com/cxykevin/alkaid0/prompts"
+	agentconfig "github.com/cxykevin/alkaid0/provider/request/agents/config"
 	reqStruct "github.com/cxykevin/alkaid0/provider/request/structs"
 	"github.com/cxykevin/alkaid0/storage/structs"
 	"gorm.io/gorm"
@@ -12,12 +14,108 @@ import (
 
 const summaryKeepNumber = 6
 
-// Summary 请求总结
+// pinnedMessage 摘要之后原样保留的固定消息
+type pinnedMessage struct {
+	ID      uint64
+	Role    string
+	Content string
+}
+
+// summaryWrapData SummaryWrapTemplate 的渲染数据
+type summaryWrapData struct {
+	Summary string
+	Pinned  []pinnedMessage
+}
+
+// pinnedRoleName 固定消息在摘要中展示的角色名
+var pinnedRoleName = map[structs.MessagesRole]string{
+	structs.MessagesRoleUser:        "user",
+	structs.MessagesRoleAgent:       "assistant",
+	structs.MessagesRoleTool:        "tool result",
+	structs.MessagesRoleCommunicate: "agent message",
+}
+
+// scopeMessages 限定到主代理或指定子代理的消息
+func scopeMessages(db *gorm.DB, chatID uint32, agentID string) *gorm.DB {
+	if agentID == "" {
+		return db.Where("`chat_id` = ? AND (`agent_id` = \"\" OR `agent_id` IS NULL)", chatID)
+	}
+	return db.Where("`chat_id` = ? AND `agent_id` = ?", chatID, agentID)
+}
+
+// pinnedUpTo 返回摘要边界（含）之前被固定的消息，按时间正序
+func pinnedUpTo(db *gorm.DB, chatID uint32, agentID string, boundary uint64) ([]pinnedMessage, error) {
+	var msgs []structs.Messages
+	if err := scopeMessages(db.Model(&structs.Messages{}), chatID, agentID).
+		Where("`pinned` = ? AND `id` <= ?", true, boundary).
+		Order("id ASC").Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	pinned := make([]pinnedMessage, 0, len(msgs))
+	for _, v := range msgs {
+		content := v.Delta
+		if v.Type == structs.MessagesRoleAgent && v.ToolCallingJSONString != "" {
+			content = strings.TrimSpace(content + "\n[tool calls] " + v.ToolCallingJSONString)
+		}
+		pinned = append(pinned, pinnedMessage{ID: v.ID, Role: pinnedRoleName[v.Type], Content: content})
+	}
+	return pinned, nil
+}
+
+// keepForToolResults 计算原样保留最近 n 条工具结果所需的消息条数（含发起这些调用的 assistant 消息），
+// 只在上次总结之后的消息中查找；工具结果不足 n 条时返回 0（按默认条数压缩）
+func keepForToolResults(db *gorm.DB, chatID uint32, agentID string, n int) int {
+	var lastSummaryID uint64
+	scopeMessages(db.Model(&structs.Messages{}), chatID, agentID).
+		Where("`summary` <> ?", "").
+		Select("COALESCE(MAX(id), 0)").Scan(&lastSummaryID)
+	var msgs []structs.Messages
+	scopeMessages(db.Model(&structs.Messages{}), chatID, agentID).
+		Where("`id` > ?", lastSummaryID).
+		Select("id", "type", "tool_calling_json_string").
+		Order("id DESC").Find(&msgs)
+	seen := 0
+	for idx, v := range msgs {
+		if v.Type == structs.MessagesRoleTool {
+			seen++
+			continue
+		}
+		if seen >= n && v.Type == structs.MessagesRoleAgent && v.ToolCallingJSONString != "" {
+			return idx + 1
+		}
+	}
+	return 0
+}
+
+// summaryAgentModelID 返回被总结代理使用的模型：子代理配置了模型时优先，否则为会话最后选择的模型
+func summaryAgentModelID(db *gorm.DB, chat *structs.Chats, agentID string) uint32 {
+	if agentID == "" {
+		return chat.LastModelID
+	}
+	var sub structs.SubAgents
+	if err := db.Select("id", "agent_id").Where("id = ?", agentID).Limit(1).Find(&sub).Error; err != nil || sub.ID == "" {
+		return chat.LastModelID
+	}
+	if agentCfg, ok := agentconfig.GetAgentConfigAt(chat.Root, sub.AgentID); ok && agentCfg.AgentModel != 0 {
+		return uint32(agentCfg.AgentModel)
+	}
+	return chat.LastModelID
+}
+
+// Summary 请求总结。保留条数默认主代理 6 条、子代理 0 条，
+// 被总结代理的模型配置了 SummaryKeepToolResults 时至少保留最近 N 条工具结果及其调用。
 func Summary(chatID uint32, agentID string, db *gorm.DB) (uint64, *reqStruct.ChatCompletionRequest, error) {
 	keepNum := summaryKeepNumber
 	if agentID != "" {
 		keepNum = 0
 	}
+	var chat structs.Chats
+	if err := db.Select("id", "last_model_id", "root").Where("id = ?", chatID).First(&chat).Error; err == nil {
+		modelID := summaryAgentModelID(db, &chat, agentID)
+		if modelCfg, err := GetModelConfig(int32(modelID)); err == nil && modelCfg.SummaryKeepToolResults > 0 {
+			keepNum = max(keepNum, keepForToolResults(db, chatID, agentID, int(modelCfg.SummaryKeepToolResults)))
+		}
+	}
 	return SummaryWithKeepNumber(chatID, agentID, db, keepNum)
 }
 
@@ -68,7 +166,7 @@ func SummaryWithKeepNumber(chatID uint32, agentID string, db *gorm.DB, keepNum i
 			// 最近 keepNum 条保持完整（不设置 lastMsgID、不触发 exitFlag），
 			// 但仍作为上下文输入给总结模型——否则模型看不到最近的进展，
 			// 在 summary 提示词强制 100-300 词的约束下会对缺失内容产生幻觉（瞎编）。
-			isRecent := totalMsgCount > int64(keepNum) && offsetPage == 0 && idx < keepNum
+			isRecent := totalMsgCount > int64(keepNum) && offsetPage*readPageSize+idx < keepNum
 			if !isRecent && lastMsgID == 0 {
 				lastMsgID = v.ID
 			}
@@ -78,9 +176,7 @@ func SummaryWithKeepNumber(chatID uint32, agentID string, db *gorm.DB, keepNum i
 			}
 			skipMsg := false
 			if v.Summary != "" {
-				rendered, err := prompts.Render(prompts.SummaryWrapTemplate, struct {
-					Summary string
-				}{Summary: v.Summary})
+				rendered, err := prompts.Render(prompts.SummaryWrapTemplate, summaryWrapData{Summary: v.Summary})
 				if err != nil {
 					return 0, nil, err
 				}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/cxykevin/alkaid0/config"
+	cfgStruct "github.com/cxykevin/alkaid0/config/structs"
 	reqStruct "github.com/cxykevin/alkaid0/provider/request/structs"
 	"github.com/cxykevin/alkaid0/storage/structs"
 )
@@ -747,3 +748,163 @@ func TestSummary_ExcludesToolCalls(t *testing.T) {
 		t.Error("summary input should keep pure-text assistant message")
 	}
 }
+
+// TestSummary_KeepToolResults 测试模型配置 SummaryKeepToolResults 时保留最近 N 条工具结果及其调用
+func TestSummary_KeepToolResults(t *testing.T) {
+	setupTestConfig()
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&structs.Chats{}); err != nil {
+		t.Fatal(err)
+	}
+	config.GlobalConfig.Agent.SummaryModel = 1
+	db.Create(&structs.Chats{ID: 90, LastModelID: 1})
+
+	call := `[{"name":"read","id":"c","parameters":{}}]`
+	messages := []structs.Messages{{ChatID: 90, Type: structs.MessagesRoleUser, Delta: "start"}}
+	for range 4 {
+		messages = append(messages,
+			structs.Messages{ChatID: 90, Type: structs.MessagesRoleAgent, ToolCallingJSONString: call},
+			structs.Messages{ChatID: 90, Type: structs.MessagesRoleTool, Delta: `[{"name":"read","id":"c","return":"ok"}]`},
+		)
+	}
+	messages = append(messages, structs.Messages{ChatID: 90, Type: structs.MessagesRoleAgent, Delta: "done"})
+	if err := db.Create(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认保留 6 条：边界为倒数第 7 条
+	boundary, _, err := Summary(90, "", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := messages[len(messages)-7].ID; boundary != want {
+		t.Fatalf("default boundary = %d, want %d", boundary, want)
+	}
+
+	// 保留最近 3 条工具结果：边界为第 3 近的工具调用之前的消息
+	model := config.GlobalConfig.Model.Models[1]
+	model.SummaryKeepToolResults = 3
+	config.GlobalConfig.Model.Models[1] = model
+	boundary, _, err = Summary(90, "", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := messages[len(messages)-8].ID; boundary != want {
+		t.Fatalf("boundary with kept tool results = %d, want %d", boundary, want)
+	}
+	var boundaryMsg structs.Messages
+	db.First(&boundaryMsg, boundary)
+	if boundaryMsg.Type != structs.MessagesRoleTool {
+		t.Fatalf("expected the kept region to start at a tool call, boundary type = %d", boundaryMsg.Type)
+	}
+}
+
+// toolRounds 构造 n 轮工具调用（assistant 调用 + 工具结果）
+func toolRounds(chatID uint32, agentID *string, n int) []structs.Messages {
+	var msgs []structs.Messages
+	for range n {
+		msgs = append(msgs,
+			structs.Messages{ChatID: chatID, AgentID: agentID, Type: structs.MessagesRoleAgent, ToolCallingJSONString: `[{"name":"read","id":"c","parameters":{}}]`},
+			structs.Messages{ChatID: chatID, AgentID: agentID, Type: structs.MessagesRoleTool, Delta: `[{"name":"read","id":"c","return":"ok"}]`},
+		)
+	}
+	return msgs
+}
+
+// TestSummary_KeepToolResultsAcrossPages 保留条数超过一页（readPageSize）时边界仍按全局位置计算
+func TestSummary_KeepToolResultsAcrossPages(t *testing.T) {
+	setupTestConfig()
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&structs.Chats{}); err != nil {
+		t.Fatal(err)
+	}
+	config.GlobalConfig.Agent.SummaryModel = 1
+	model := config.GlobalConfig.Model.Models[1]
+	model.SummaryKeepToolResults = 12
+	config.GlobalConfig.Model.Models[1] = model
+	db.Create(&structs.Chats{ID: 91, LastModelID: 1})
+
+	messages := []structs.Messages{{ChatID: 91, Type: structs.MessagesRoleUser, Delta: "start"}}
+	messages = append(messages, toolRounds(91, nil, 15)...)
+	messages = append(messages, structs.Messages{ChatID: 91, Type: structs.MessagesRoleAgent, Delta: "done"})
+	if err := db.Create(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 保留 12 条工具结果需 25 条消息，超过一页 20 条
+	boundary, _, err := Summary(91, "", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := messages[len(messages)-26].ID; boundary != want {
+		t.Fatalf("boundary = %d, want %d", boundary, want)
+	}
+}
+
+// TestSummary_KeepToolResultsStopsAtSummary 上次总结之前的工具结果不计入保留条数
+func TestSummary_KeepToolResultsStopsAtSummary(t *testing.T) {
+	setupTestConfig()
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&structs.Chats{}); err != nil {
+		t.Fatal(err)
+	}
+	config.GlobalConfig.Agent.SummaryModel = 1
+	model := config.GlobalConfig.Model.Models[1]
+	model.SummaryKeepToolResults = 2
+	config.GlobalConfig.Model.Models[1] = model
+	db.Create(&structs.Chats{ID: 92, LastModelID: 1})
+
+	messages := []structs.Messages{{ChatID: 92, Type: structs.MessagesRoleUser, Delta: "start"}}
+	messages = append(messages, toolRounds(92, nil, 2)...)
+	messages = append(messages,
+		structs.Messages{ChatID: 92, Type: structs.MessagesRoleAgent, Summary: "earlier work"},
+		structs.Messages{ChatID: 92, Type: structs.MessagesRoleUser, Delta: "next"},
+	)
+	messages = append(messages, toolRounds(92, nil, 1)...)
+	messages = append(messages, structs.Messages{ChatID: 92, Type: structs.MessagesRoleAgent, Delta: "done"})
+	if err := db.Create(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 总结之后只有 1 条工具结果，不足 2 条，按默认 6 条保留
+	boundary, _, err := Summary(92, "", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := messages[len(messages)-7].ID; boundary != want {
+		t.Fatalf("boundary = %d, want %d", boundary, want)
+	}
+}
+
+// TestSummary_KeepToolResultsUsesAgentModel 子代理按其自身模型的 SummaryKeepToolResults 保留
+func TestSummary_KeepToolResultsUsesAgentModel(t *testing.T) {
+	setupTestConfig()
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&structs.Chats{}, &structs.SubAgents{}); err != nil {
+		t.Fatal(err)
+	}
+	config.GlobalConfig.Agent.SummaryModel = 1
+	config.GlobalConfig.Agent.Agents = map[string]cfgStruct.AgentConfig{"worker": {AgentModel: 2}}
+	model := config.GlobalConfig.Model.Models[2]
+	model.SummaryKeepToolResults = 1
+	config.GlobalConfig.Model.Models[2] = model
+	db.Create(&structs.Chats{ID: 93, LastModelID: 1})
+	db.Create(&structs.SubAgents{ID: "sub1", AgentID: "worker"})
+
+	sub := "sub1"
+	messages := []structs.Messages{{ChatID: 93, AgentID: &sub, Type: structs.MessagesRoleUser, Delta: "start"}}
+	messages = append(messages, toolRounds(93, &sub, 2)...)
+	messages = append(messages, structs.Messages{ChatID: 93, AgentID: &sub, Type: structs.MessagesRoleAgent, Delta: "done"})
+	if err := db.Create(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 会话模型（1）未配置保留，子代理模型（2）保留最近 1 条工具结果及其调用
+	boundary, _, err := Summary(93, "sub1", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := messages[len(messages)-4].ID; boundary != want {
+		t.Fatalf("boundary = %d, want %d", boundary, want)
+	}
+}
@@ -1,14 +1,20 @@
 package build
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"path"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/cxykevin/alkaid0/prompts"
+	"github.com/cxykevin/alkaid0/provider/mask"
 	"github.com/cxykevin/alkaid0/provider/parser"
 	"github.com/cxykevin/alkaid0/storage/structs"
 	"github.com/cxykevin/alkaid0/tools"
+	"github.com/cxykevin/alkaid0/tools/hooks"
 	"github.com/cxykevin/alkaid0/tools/toolobj"
 	"github.com/cxykevin/alkaid0/ui/state"
 )
@@ -30,19 +36,32 @@ func map2Slice[sliceType any, originMapKeyType comparable, originMapValType any]
 	return lists
 }
 
+// globalPrehooks 全局 PreHook 的输出（未启用 scope 提示与按来源命名的注入文本）
+type globalPrehooks struct {
+	Unused []string
+	Active []tools.NamedPrompt
+}
+
 // Tools 构建工具(scopes, tool traces, tools)
 // 渲染失败时返回请求级错误而非 panic，避免拖垮整个进程
 func Tools(session *structs.Chats) (string, string, *[]*parser.ToolsDefine, error) {
+	scopes, traces, toolsDef, _, err := buildTools(session)
+	return scopes, traces, toolsDef, err
+}
+
+// buildTools 同 Tools，额外返回全局 PreHook 的分项输出，供上下文统计使用
+func buildTools(session *structs.Chats) (string, string, *[]*parser.ToolsDefine, globalPrehooks, error) {
+	var hooks globalPrehooks
 	// 按 scope ID 排序再渲染，保证 system 中 <scopes> 段字节稳定，不破坏前缀缓存
+	// 当前代理限定了 AllowedScopes 时，不在其中的命名空间不展示
 	scopes := map2Slice(toolobj.Scopes, func(k string, v string) *scopeInfo {
-		enabled := false
-		if val, ok := session.EnableScopes[k]; ok {
-			enabled = val
+		if !session.ScopeAllowed(k) {
+			return nil
 		}
 		return &scopeInfo{
 			ID:          k,
 			Description: v,
-			Enable:      enabled,
+			Enable:      session.ScopeEnabled(k),
 		}
 	})
 	sort.Slice(scopes, func(i, j int) bool { return scopes[i].ID < scopes[j].ID })
@@ -52,11 +71,16 @@ func Tools(session *structs.Chats) (string, string, *[]*parser.ToolsDefine, erro
 		Scopes: scopes,
 	})
 	if err != nil {
-		return "", "", &[]*parser.ToolsDefine{}, err
+		return "", "", &[]*parser.ToolsDefine{}, hooks, err
 	}
 	scopesString := toolScopesRendered
 
-	globalToolsTracesUnused, globalToolsTracesActive, _ := tools.ExecOneToolGetPrompts(session, "")
+	globalToolsTracesUnused, globalToolsTracesNamed, _ := tools.ExecOneToolGetNamedPrompts(session, "")
+	hooks = globalPrehooks{Unused: globalToolsTracesUnused, Active: globalToolsTracesNamed}
+	globalToolsTracesActive := make([]string, 0, len(globalToolsTracesNamed))
+	for _, p := range globalToolsTracesNamed {
+		globalToolsTracesActive = append(globalToolsTracesActive, p.Text)
+	}
 
 	globalToolTraceRendered, err := prompts.Render(prompts.ToolPrehookTemplate, struct {
 		Unused []string
@@ -66,7 +90,7 @@ func Tools(session *structs.Chats) (string, string, *[]*parser.ToolsDefine, erro
 		Active: globalToolsTracesActive,
 	})
 	if err != nil {
-		return "", "", &[]*parser.ToolsDefine{}, err
+		return "", "", &[]*parser.ToolsDefine{}, hooks, err
 	}
 	globalToolTraceStr := globalToolTraceRendered
 
@@ -90,7 +114,7 @@ func Tools(session *structs.Chats) (string, string, *[]*parser.ToolsDefine, erro
 				continue
 			}
 		}
-		if !checkToolScope(session, v.Scope) {
+		if !checkToolScope(session, v.Scope) || !checkToolAllowed(session, k) {
 			continue
 		}
 		unusedPrompt, activePrompt, paras := tools.ExecOneToolGetPrompts(session, k)
@@ -103,7 +127,7 @@ func Tools(session *structs.Chats) (string, string, *[]*parser.ToolsDefine, erro
 		})
 		if err != nil {
 			toolobj.ToolsMu.RUnlock()
-			return "", "", &[]*parser.ToolsDefine{}, err
+			return "", "", &[]*parser.ToolsDefine{}, hooks, err
 		}
 		// 工具描述 = prompt.md（UserDescription，静态 few-shot）+ PreHook 动态输出。
 		// 内置工具 PreHook 多为 nil（无动态上下文），仅保留静态描述；
@@ -122,23 +146,41 @@ func Tools(session *structs.Chats) (string, string, *[]*parser.ToolsDefine, erro
 	}
 
 	toolobj.ToolsMu.RUnlock()
-	return scopesString, globalToolTraceStr, &toolsDef, nil
+	return scopesString, globalToolTraceStr, &toolsDef, hooks, nil
 }
 
 func checkToolScope(session *structs.Chats, scope string) bool {
-	if scope == "" {
+	return session.ScopeEnabled(scope)
+}
+
+// checkToolAllowed 按当前代理的 AllowedTools/DeniedTools 判断工具是否提供给模型。
+// deactivate_agent 是生命周期收尾操作，不受限制，否则子代理可能无法退出。
+func checkToolAllowed(session *structs.Chats, name string) bool {
+	if name == "deactivate_agent" {
 		return true
 	}
-	if val, ok := session.EnableScopes[scope]; !ok || !val {
+	cfg := &session.CurrentAgentConfig
+	if matchToolPatterns(cfg.DeniedTools, name) {
 		return false
 	}
-	return true
+	return len(cfg.AllowedTools) == 0 || matchToolPatterns(cfg.AllowedTools, name)
+}
+
+func matchToolPatterns(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, name); (err == nil && ok) || pattern == name {
+			return true
+		}
+	}
+	return false
 }
 
 // ToolsSolver 构建工具处理器
 func ToolsSolver(session *structs.Chats, callback func(string, string, map[string]*any) error) *[]*parser.ToolsDefine {
 
 	toolsDef := make([]*parser.ToolsDefine, 0)
+	// 脱敏引擎按需创建、本次请求内的工具调用共用，避免每次调用都全量加载映射表
+	maskEngine := sync.OnceValue(func() *mask.Engine { return mask.NewEngine(session.DB) })
 	toolobj.ToolsMu.RLock()
 	for k, v := range toolobj.ToolsList {
 		if k == "" {
@@ -170,10 +212,26 @@ func ToolsSolver(session *structs.Chats, callback func(string, string, map[strin
 				if session.State != state.StateToolCalling {
 					return nil
 				}
+				// 参数流已按调用还原；执行前再对解析后的参数还原一次，兜底模型抄写到参数中的脱敏假值
+				if eng := maskEngine(); eng != nil {
+					arg = eng.RestoreParams(arg)
+				}
+				// pre_tool 钩子非零退出时不执行工具，以钩子 stderr 作为失败原因返回给模型
+				if err := hooks.PreTool(session, toolKey, ID, arg); err != nil {
+					return callback(toolKey, ID, hookBlockedResult(err))
+				}
 				ret, err := tools.ExecToolPostHook(session, toolKey, arg, ID)
 				if err != nil {
 					return err
 				}
+				if out := hooks.PostTool(session, toolKey, ID, arg, ret); out != "" {
+					ret = maps.Clone(ret)
+					if ret == nil {
+						ret = map[string]*any{}
+					}
+					outAny := any(out)
+					ret["hook_output"] = &outAny
+				}
 				err = callback(toolKey, ID, ret)
 				if err != nil {
 					return err
@@ -184,7 +242,7 @@ func ToolsSolver(session *structs.Chats, callback func(string, string, map[strin
 		if k == "" {
 			continue
 		}
-		if !checkToolScope(session, v.Scope) {
+		if !checkToolScope(session, v.Scope) || !checkToolAllowed(session, k) {
 			continue
 		}
 		_, _, paras := tools.ExecOneToolGetPrompts(session, k)
@@ -195,3 +253,18 @@ func ToolsSolver(session *structs.Chats, callback func(string, string, map[strin
 	toolobj.ToolsMu.RUnlock()
 	return &toolsDef
 }
+
+// hookBlockedResult 构造被 pre_tool 钩子阻止的工具调用结果
+func hookBlockedResult(err error) map[string]*any {
+	msg := err.Error()
+	var blocked *hooks.BlockedError
+	if errors.As(err, &blocked) {
+		msg = "[System] Blocked by pre_tool hook: " + blocked.Reason
+	}
+	success := any(false)
+	errAny := any(msg)
+	return map[string]*any{
+		"success": &success,
+		"error":   &errAny,
+	}
+}
@@ -3,9 +3,14 @@ package build
 import (
 	"testing"
 
+	"github.com/cxykevin/alkaid0/config"
+	cfgStruct "github.com/cxykevin/alkaid0/config/structs"
 	"github.com/cxykevin/alkaid0/storage/structs"
 	"github.com/cxykevin/alkaid0/tools/toolobj"
 	"github.com/cxykevin/alkaid0/ui/state"
+	u "github.com/cxykevin/alkaid0/utils"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
 )
 
 // registerTestTool 注册一个带 OnHook 的测试工具（OnHook 纯展示：写 ToolCallingContext）。
@@ -158,3 +163,46 @@ func TestToolsSolverCompleteInToolCalling(t *testing.T) {
 		t.Error("StateToolCalling 下 complete 调用应触发 callback")
 	}
 }
+
+// TestToolsSolverMaskEngineOncePerRequest 验证同一次请求的多次工具调用共用脱敏引擎，映射表只加载一次。
+func TestToolsSolverMaskEngineOncePerRequest(t *testing.T) {
+	registerTestTool(t)
+	t.Cleanup(config.GlobalConfigSwap(cfgStruct.Config{DataMask: cfgStruct.DataMaskConfig{Enable: true}}))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer u.Unwrap(db.DB()).Close()
+	if err := db.AutoMigrate(&structs.KeyMapping{}, &structs.CustomMask{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	loads := 0
+	if err := db.Callback().Query().After("gorm:query").Register("test:count_mappings", func(tx *gorm.DB) {
+		if tx.Statement.Table == "key_mappings" {
+			loads++
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := newSolverSession(state.StateToolCalling)
+	session.DB = db
+	toolsDef := ToolsSolver(session, func(string, string, map[string]*any) error { return nil })
+	var fn func(string, map[string]*any, bool) error
+	for _, td := range *toolsDef {
+		if td.Name == "test_tool" {
+			fn = td.Func
+		}
+	}
+	if fn == nil {
+		t.Fatal("test_tool 未出现在 ToolsSolver 结果中")
+	}
+	for _, id := range []string{"tid1", "tid2", "tid3"} {
+		if err := fn(id, map[string]*any{"path": strPtr("/tmp/a")}, true); err != nil {
+			t.Fatalf("complete 调用返回错误: %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("映射表应只加载一次，实际 %d 次", loads)
+	}
+}
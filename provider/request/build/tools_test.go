@@ -750,3 +750,114 @@ func TestTools_DeterministicOrder(t *testing.T) {
 		}
 	}
 }
+
+// TestTools_AllowedScopes 测试代理限定 AllowedScopes 时，其余命名空间及其工具不提供给模型
+func TestTools_AllowedScopes(t *testing.T) {
+	originalScopes := toolobj.Scopes
+	originalToolsList := toolobj.ToolsList
+	defer func() {
+		toolobj.Scopes = originalScopes
+		toolobj.ToolsList = originalToolsList
+	}()
+
+	toolobj.Scopes = map[string]string{
+		"":      "Global",
+		"alpha": "作用域 a",
+		"beta":  "作用域 b",
+	}
+	toolobj.ToolsList = map[string]*toolobj.Tools{
+		"":       {Name: "Global", ID: "", Hooks: make([]toolobj.Hook, 0)},
+		"a_tool": {Scope: "alpha", Name: "a_tool", ID: "a_tool", Hooks: make([]toolobj.Hook, 0)},
+		"b_tool": {Scope: "beta", Name: "b_tool", ID: "b_tool", Hooks: make([]toolobj.Hook, 0)},
+		"g_tool": {Name: "g_tool", ID: "g_tool", Hooks: make([]toolobj.Hook, 0)},
+	}
+	session := &structs.Chats{
+		ID:           1,
+		LastModelID:  1,
+		EnableScopes: map[string]bool{"": true, "alpha": true, "beta": true},
+	}
+	session.CurrentAgentConfig.AllowedScopes = []string{"alpha"}
+
+	scopeStr, _, toolsDef, err := Tools(session)
+	if err != nil {
+		t.Fatalf("Tools: %v", err)
+	}
+	if strings.Contains(scopeStr, `<scope id="beta"`) || !strings.Contains(scopeStr, `<scope id="alpha"`) {
+		t.Errorf("disallowed scope must not be listed: %q", scopeStr)
+	}
+	var names []string
+	for _, td := range *toolsDef {
+		names = append(names, td.Name)
+	}
+	if strings.Join(names, ",") != "a_tool,g_tool" {
+		t.Errorf("unexpected tools %v", names)
+	}
+	if len(*ToolsSolver(session, nil)) != 2 {
+		t.Error("ToolsSolver must skip tools of disallowed scopes")
+	}
+}
+
+// TestTools_AgentToolRestrictions 测试 AllowedTools/DeniedTools/DefaultScopes 决定提供给模型的工具
+func TestTools_AgentToolRestrictions(t *testing.T) {
+	originalScopes := toolobj.Scopes
+	originalToolsList := toolobj.ToolsList
+	defer func() {
+		toolobj.Scopes = originalScopes
+		toolobj.ToolsList = originalToolsList
+	}()
+
+	toolobj.Scopes = map[string]string{"": "Global", "web": "网络"}
+	toolobj.ToolsList = map[string]*toolobj.Tools{"": {Name: "Global", ID: "", Hooks: make([]toolobj.Hook, 0)}}
+	for _, name := range []string{"read", "edit", "run", "git", "git_log", "deactivate_agent"} {
+		toolobj.ToolsList[name] = &toolobj.Tools{Name: name, ID: name, Hooks: make([]toolobj.Hook, 0)}
+	}
+	toolobj.ToolsList["fetch"] = &toolobj.Tools{Scope: "web", Name: "fetch", ID: "fetch", Hooks: make([]toolobj.Hook, 0)}
+
+	names := func(session *structs.Chats) string {
+		_, _, defs, err := Tools(session)
+		if err != nil {
+			t.Fatalf("Tools: %v", err)
+		}
+		out := make([]string, 0, len(*defs))
+		for _, td := range *defs {
+			out = append(out, td.Name)
+		}
+		if len(*ToolsSolver(session, nil)) != len(out) {
+			t.Errorf("ToolsSolver and Tools disagree for %v", out)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name string
+		cfg  func(*structs.Chats)
+		want string
+	}{
+		{"无限制", func(*structs.Chats) {}, "deactivate_agent,edit,git,git_log,read,run"},
+		{"白名单与通配", func(s *structs.Chats) {
+			s.CurrentAgentConfig.AllowedTools = []string{"read", "git*"}
+		}, "deactivate_agent,git,git_log,read"},
+		{"黑名单优先", func(s *structs.Chats) {
+			s.CurrentAgentConfig.AllowedTools = []string{"read", "git*"}
+			s.CurrentAgentConfig.DeniedTools = []string{"git_*", "deactivate_agent"}
+		}, "deactivate_agent,git,read"},
+		{"默认命名空间", func(s *structs.Chats) {
+			s.CurrentAgentConfig.DefaultScopes = []string{"web"}
+			s.CurrentAgentConfig.DeniedTools = []string{"edit", "run"}
+		}, "deactivate_agent,fetch,git,git_log,read"},
+		{"默认命名空间不越过 AllowedScopes", func(s *structs.Chats) {
+			s.CurrentAgentConfig.DefaultScopes = []string{"web"}
+			s.CurrentAgentConfig.AllowedScopes = []string{"other"}
+			s.CurrentAgentConfig.AllowedTools = []string{"read", "fetch"}
+		}, "deactivate_agent,read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &structs.Chats{ID: 1, LastModelID: 1, EnableScopes: map[string]bool{"": true}}
+			tt.cfg(session)
+			if got := names(session); got != tt.want {
+				t.Errorf("tools = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
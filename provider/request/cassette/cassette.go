@@ -0,0 +1,208 @@
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dir cassette 文件在项目数据目录下的子目录
+const Dir = "cassettes"
+
+// Interaction 一次上游请求及其原始响应
+type Interaction struct {
+	MessageID   uint64          `json:"message_id,omitempty"` // 请求对应的 assistant 消息 ID
+	Time        time.Time       `json:"time"`
+	Endpoint    string          `json:"endpoint"` // 相对 ProviderURL 的接口路径，如 /chat/completions
+	Hash        string          `json:"hash"`     // 请求体的规范化哈希，回放时优先按它匹配
+	Request     json.RawMessage `json:"request"`  // 实际发出的请求体（已脱敏）
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Response    string          `json:"response"` // 上游原始响应体（SSE / NDJSON 原文）
+}
+
+// Path 返回会话的 cassette 文件路径：<root>/.alkaid0/cassettes/<chatID>.jsonl
+func Path(root string, chatID uint32) string {
+	if root == "" {
+		root = "."
+	}
+	return filepath.Join(root, ".alkaid0", Dir, fmt.Sprintf("%d.jsonl", chatID))
+}
+
+// RequestHash 计算请求体的规范化哈希（键排序后序列化），与字段顺序和空白无关
+func RequestHash(body []byte) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		if canon, err := json.Marshal(v); err == nil {
+			body = canon
+		}
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:16])
+}
+
+var appendMu sync.Mutex
+
+// Append 向 cassette 文件追加一条录制，目录不存在时创建
+func Append(path string, it Interaction) error {
+	if it.Hash == "" {
+		it.Hash = RequestHash(it.Request)
+	}
+	line, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	appendMu.Lock()
+	defer appendMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load 读取 cassette 文件中的全部录制，按录制顺序返回
+func Load(path string) ([]Interaction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var items []Interaction
+	reader := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var it Interaction
+			if jsonErr := json.Unmarshal(line, &it); jsonErr != nil {
+				return nil, fmt.Errorf("cassette %s line %d: %w", path, n, jsonErr)
+			}
+			items = append(items, it)
+		}
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Player 回放一组录制。每条录制只回放一次：先找请求体哈希一致的录制，
+// 找不到时（如工具代码变化导致工具结果不同）按录制顺序取同一接口的下一条
+type Player struct {
+	mu    sync.Mutex
+	items []Interaction
+	used  []bool
+}
+
+// NewPlayer 以录制列表创建回放器
+func NewPlayer(items []Interaction) *Player {
+	return &Player{items: items, used: make([]bool, len(items))}
+}
+
+// LoadPlayer 读取 cassette 文件并创建回放器
+func LoadPlayer(path string) (*Player, error) {
+	items, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewPlayer(items), nil
+}
+
+// Next 为请求路径与请求体选出下一条录制并标记为已回放
+func (p *Player) Next(path string, body []byte) (Interaction, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	hash := RequestHash(body)
+	pick := -1
+	for i, it := range p.items {
+		if p.used[i] || !strings.HasSuffix(path, it.Endpoint) {
+			continue
+		}
+		if it.Hash == hash {
+			pick = i
+			break
+		}
+		if pick < 0 {
+			pick = i
+		}
+	}
+	if pick < 0 {
+		return Interaction{}, false
+	}
+	p.used[pick] = true
+	return p.items[pick], true
+}
+
+// Remaining 尚未回放的录制数
+func (p *Player) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, used := range p.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// Serve 有匹配的录制时写出录制的响应并返回 true；否则不写任何内容
+func (p *Player) Serve(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	it, ok := p.Next(r.URL.Path, body)
+	if !ok {
+		return false
+	}
+	contentType := it.ContentType
+	if contentType == "" {
+		contentType = "text/event-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(it.Status)
+	io.WriteString(w, it.Response)
+	return true
+}
+
+// ServeHTTP 回放录制，没有可回放的录制时返回 404
+func (p *Player) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !p.Serve(w, r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":{"message":"cassette: no recorded response left for this request","type":"cassette_exhausted"}}`)
+	}
+}
+
+// Handler 优先回放录制，没有匹配的录制时交给 next
+func (p *Player) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.Serve(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
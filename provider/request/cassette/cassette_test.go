@@ -0,0 +1,92 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	if got, want := Path("/work/proj", 7), filepath.Join("/work/proj", ".alkaid0", "cassettes", "7.jsonl"); got != want {
+		t.Errorf("Path = %q, want %q", got, want)
+	}
+}
+
+func TestRequestHash_Canonical(t *testing.T) {
+	a := RequestHash([]byte(`{"model":"m","messages":[{"role":"user","content":"hi"}]}`))
+	b := RequestHash([]byte(`{ "messages": [ {"content":"hi", "role":"user"} ], "model": "m" }`))
+	if a != b {
+		t.Errorf("hash should ignore key order and whitespace: %s vs %s", a, b)
+	}
+	if a == RequestHash([]byte(`{"model":"m","messages":[{"role":"user","content":"bye"}]}`)) {
+		t.Error("different requests should hash differently")
+	}
+}
+
+func TestAppendLoad_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "1.jsonl")
+	for i, content := range []string{"one", "two"} {
+		err := Append(path, Interaction{
+			MessageID: uint64(i + 1),
+			Endpoint:  "/chat/completions",
+			Request:   []byte(`{"messages":[{"role":"user","content":"` + content + `"}]}`),
+			Status:    200,
+			Response:  "data: " + content + "\n\ndata: [DONE]\n\n",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[1].MessageID != 2 || items[1].Response != "data: two\n\ndata: [DONE]\n\n" || items[0].Hash == "" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
+
+func TestPlayer_Match(t *testing.T) {
+	req := func(content string) []byte {
+		return []byte(`{"messages":[{"role":"user","content":"` + content + `"}]}`)
+	}
+	items := []Interaction{
+		{Endpoint: "/chat/completions", Request: req("a"), Status: 200, Response: "A"},
+		{Endpoint: "/chat/completions", Request: req("b"), Status: 200, Response: "B"},
+		{Endpoint: "/api/chat", Request: req("c"), Status: 200, ContentType: "application/x-ndjson", Response: "C"},
+	}
+	for i := range items {
+		items[i].Hash = RequestHash(items[i].Request)
+	}
+	srv := httptest.NewServer(NewPlayer(items))
+	defer srv.Close()
+
+	post := func(path, body string) (int, string, string) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(data)
+	}
+
+	// 哈希一致时跳过顺序直接匹配
+	if _, ct, body := post("/v1/chat/completions", string(req("b"))); body != "B" || ct != "text/event-stream" {
+		t.Errorf("hash match: got %q (%s)", body, ct)
+	}
+	// 请求变化时按顺序取同一接口的下一条
+	if _, _, body := post("/v1/chat/completions", string(req("changed"))); body != "A" {
+		t.Errorf("order fallback: got %q", body)
+	}
+	if _, ct, body := post("/api/chat", string(req("x"))); body != "C" || ct != "application/x-ndjson" {
+		t.Errorf("ollama endpoint: got %q (%s)", body, ct)
+	}
+	if status, _, _ := post("/v1/chat/completions", string(req("a"))); status != http.StatusNotFound {
+		t.Errorf("exhausted cassette should 404, got %d", status)
+	}
+}
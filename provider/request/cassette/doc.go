@@ -0,0 +1,4 @@
+// Package cassette 录制与回放模型请求
+//
+// 每次对话请求的请求体与上游原始响应流按会话追加到 cassette 文件，回放时按请求匹配并原样返回录制的流
+package cassette
@@ -0,0 +1,42 @@
+package request
+
+import (
+	"context"
+
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/provider/mask"
+	"github.com/cxykevin/alkaid0/provider/request/structs"
+)
+
+// ChatRequest 按模型的 ProviderType 发送流式对话请求，响应统一以 OpenAI ChatCompletion 增量回调。
+// ProviderURL 配置了 Key 池时，key 从池中选取（见 withKeyPool），ProviderKey 被忽略。
+func ChatRequest(ctx context.Context, modelCfg *cfgStructs.ModelConfig, body structs.ChatCompletionRequest, masker *mask.Engine, callback func(structs.ChatCompletionResponse) error) error {
+	return withKeyPool(modelCfg.ProviderURL, modelCfg.ProviderKey, func(key string) (usageTotals, error) {
+		cfg := *modelCfg
+		cfg.ProviderKey = key
+		var usage usageTotals
+		err := chatRequest(ctx, &cfg, body, masker, func(resp structs.ChatCompletionResponse) error {
+			if u := resp.Usage; u != nil {
+				usage.prompt = max(usage.prompt, u.PromptTokens)
+				usage.completion = max(usage.completion, u.CompletionTokens)
+				usage.cached = max(usage.cached, u.CachedTokens)
+				if u.PromptTokensDetails != nil {
+					usage.cached = max(usage.cached, u.PromptTokensDetails.CachedTokens)
+				}
+			}
+			return callback(resp)
+		})
+		return usage, err
+	})
+}
+
+func chatRequest(ctx context.Context, modelCfg *cfgStructs.ModelConfig, body structs.ChatCompletionRequest, masker *mask.Engine, callback func(structs.ChatCompletionResponse) error) error {
+	switch modelCfg.ProviderType {
+	case cfgStructs.ProviderTypeOllama:
+		return SimpleOllamaRequest(ctx, modelCfg, body, masker, callback)
+	case cfgStructs.ProviderTypeResponses:
+		return SimpleResponsesRequest(ctx, modelCfg, body, masker, callback)
+	default:
+		return SimpleOpenAIRequest(ctx, modelCfg.ProviderURL, modelCfg.ProviderKey, modelCfg.ModelID, body, masker, callback)
+	}
+}
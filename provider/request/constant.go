@@ -11,6 +11,12 @@ const Timeout = 120 * time.Second
 const (
 	ChatCompletionsEndpoint = "/chat/completions"
 	EmbeddingsEndpoint      = "/embeddings"
+	ResponsesEndpoint       = "/responses"
+	OllamaChatEndpoint      = "/api/chat"
+	OllamaTagsEndpoint      = "/api/tags"
+	OllamaShowEndpoint      = "/api/show"
+	LlamaCppModelsEndpoint  = "/v1/models"
+	LlamaCppPropsEndpoint   = "/props"
 )
 
 // SSE constants
@@ -0,0 +1,180 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/product"
+)
+
+// 本地推理服务的默认地址
+const (
+	DefaultOllamaURL   = "http://localhost:11434"
+	DefaultLlamaCppURL = "http://localhost:8080"
+)
+
+// DiscoveredModel 本地推理服务上发现的模型，Config 为据模型元数据生成的模型配置
+type DiscoveredModel struct {
+	Name          string                 `json:"name"`
+	ContextLength int32                  `json:"contextLength"` // 0 为元数据中未提供
+	Capabilities  []string               `json:"capabilities,omitempty"`
+	Config        cfgStructs.ModelConfig `json:"config"`
+}
+
+// DiscoverModels 列出本地推理服务（ollama / llamacpp）上可用的模型，baseURL 为空时取默认地址
+func DiscoverModels(ctx context.Context, providerType cfgStructs.ProviderType, baseURL string) ([]DiscoveredModel, error) {
+	switch providerType {
+	case cfgStructs.ProviderTypeOllama:
+		if baseURL == "" {
+			baseURL = DefaultOllamaURL
+		}
+		return discoverOllama(ctx, ollamaBaseURL(baseURL))
+	case cfgStructs.ProviderTypeLlamaCpp:
+		if baseURL == "" {
+			baseURL = DefaultLlamaCppURL
+		}
+		return discoverLlamaCpp(ctx, strings.TrimSuffix(strings.TrimRight(baseURL, "/"), "/v1"))
+	default:
+		return nil, fmt.Errorf("unsupported provider type %q, expected ollama or llamacpp", providerType)
+	}
+}
+
+// discoverOllama 经 /api/tags 列出模型，再经 /api/show 读取上下文长度与能力
+func discoverOllama(ctx context.Context, baseURL string) ([]DiscoveredModel, error) {
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := discoverJSON(ctx, "GET", baseURL+OllamaTagsEndpoint, nil, &tags); err != nil {
+		return nil, err
+	}
+	models := make([]DiscoveredModel, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		var show struct {
+			ModelInfo    map[string]any `json:"model_info"`
+			Parameters   string         `json:"parameters"`
+			Capabilities []string       `json:"capabilities"`
+		}
+		if err := discoverJSON(ctx, "POST", baseURL+OllamaShowEndpoint, map[string]string{"model": m.Name}, &show); err != nil {
+			logger.Warn("ollama show %s error: %v", m.Name, err)
+		}
+		ctxLen := ollamaContextLength(show.ModelInfo, show.Parameters)
+		cfg := discoveredConfig(cfgStructs.ProviderTypeOllama, baseURL, m.Name, ctxLen)
+		cfg.EnableThinking = slices.Contains(show.Capabilities, "thinking")
+		if slices.Contains(show.Capabilities, "embedding") && !slices.Contains(show.Capabilities, "completion") {
+			cfg.Type = cfgStructs.ModelTypeEmbedding
+		}
+		models = append(models, DiscoveredModel{Name: m.Name, ContextLength: ctxLen, Capabilities: show.Capabilities, Config: cfg})
+	}
+	return models, nil
+}
+
+// ollamaContextLength 读取 <arch>.context_length；Modelfile 显式设置更小的 num_ctx 时以其为准
+func ollamaContextLength(info map[string]any, parameters string) int32 {
+	var ctxLen int32
+	for k, v := range info {
+		if n, ok := v.(float64); ok && strings.HasSuffix(k, ".context_length") {
+			ctxLen = int32(n)
+			break
+		}
+	}
+	for line := range strings.SplitSeq(parameters, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "num_ctx" {
+			if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 && (ctxLen == 0 || int32(n) < ctxLen) {
+				ctxLen = int32(n)
+			}
+		}
+	}
+	return ctxLen
+}
+
+// discoverLlamaCpp 经 /v1/models 列出模型，上下文长度优先取 /props 中服务实际的 n_ctx
+func discoverLlamaCpp(ctx context.Context, baseURL string) ([]DiscoveredModel, error) {
+	var list struct {
+		Data []struct {
+			ID   string `json:"id"`
+			Meta struct {
+				NCtxTrain int32 `json:"n_ctx_train"`
+			} `json:"meta"`
+		} `json:"data"`
+	}
+	if err := discoverJSON(ctx, "GET", baseURL+LlamaCppModelsEndpoint, nil, &list); err != nil {
+		return nil, err
+	}
+	var props struct {
+		NCtx                      int32 `json:"n_ctx"`
+		DefaultGenerationSettings struct {
+			NCtx int32 `json:"n_ctx"`
+		} `json:"default_generation_settings"`
+	}
+	if err := discoverJSON(ctx, "GET", baseURL+LlamaCppPropsEndpoint, nil, &props); err != nil {
+		logger.Warn("llama.cpp props error: %v", err)
+	}
+	served := max(props.NCtx, props.DefaultGenerationSettings.NCtx)
+	models := make([]DiscoveredModel, 0, len(list.Data))
+	for _, m := range list.Data {
+		ctxLen := served
+		if ctxLen == 0 {
+			ctxLen = m.Meta.NCtxTrain
+		}
+		cfg := discoveredConfig(cfgStructs.ProviderTypeLlamaCpp, baseURL+"/v1", m.ID, ctxLen)
+		models = append(models, DiscoveredModel{Name: m.ID, ContextLength: ctxLen, Config: cfg})
+	}
+	return models, nil
+}
+
+// discoveredConfig 生成本地模型配置：上下文取元数据，压缩阈值取其 3/4，本地服务无需 key
+func discoveredConfig(providerType cfgStructs.ProviderType, providerURL, name string, ctxLen int32) cfgStructs.ModelConfig {
+	cfg := cfgStructs.BuildDefault(cfgStructs.ModelConfig{})
+	cfg.ModelName = name
+	cfg.ModelID = name
+	cfg.ProviderURL = providerURL
+	cfg.ProviderKey = ""
+	cfg.ProviderType = providerType
+	if ctxLen > 0 {
+		cfg.TokenLimit = ctxLen
+		cfg.CompressSize = uint32(ctxLen) / 4 * 3
+	}
+	return cfg
+}
+
+// discoverJSON 发送发现请求并解析 JSON 响应
+func discoverJSON(ctx context.Context, method, url string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", product.UserAgent)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: HTTP %d", method, url, resp.StatusCode)
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,213 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/stats"
+)
+
+// KeyRejectedError 上游拒绝了 key（401 未授权 / 402 余额不足），Key 池会禁用该 key
+type KeyRejectedError struct {
+	Status int
+	Msg    string
+}
+
+func (e *KeyRejectedError) Error() string {
+	return fmt.Sprintf("API error: %d %s", e.Status, e.Msg)
+}
+
+// isKeyRejected 401/402 视为 key 不可用
+func isKeyRejected(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusPaymentRequired
+}
+
+// keyState 池中单个 key 的运行状态
+type keyState struct {
+	lastUsed    time.Time
+	lastLimited time.Time
+	disabled    string // 非空为禁用原因
+}
+
+// keyPool 同一 Provider URL 的 Key 池运行状态。禁用状态只保存在进程内，重启后恢复
+type keyPool struct {
+	mu    sync.Mutex
+	url   string
+	next  int
+	state map[string]*keyState
+}
+
+var keyPools sync.Map // 规范化的 ProviderURL → *keyPool
+
+// normalizeProviderURL 统一 Key 池的地址写法
+func normalizeProviderURL(u string) string {
+	return strings.TrimRight(u, "/")
+}
+
+// keyPoolConfig 查找该地址的 Key 池配置，未配置或没有 key 时返回 false
+func keyPoolConfig(baseURL string) (cfgStructs.KeyPoolConfig, bool) {
+	baseURL = normalizeProviderURL(baseURL)
+	for u, pool := range config.GlobalConfigSafe().Model.KeyPools {
+		if normalizeProviderURL(u) == baseURL && len(pool.Keys) > 0 {
+			return pool, true
+		}
+	}
+	return cfgStructs.KeyPoolConfig{}, false
+}
+
+func keyPoolFor(baseURL string) *keyPool {
+	baseURL = normalizeProviderURL(baseURL)
+	p, _ := keyPools.LoadOrStore(baseURL, &keyPool{url: baseURL, state: map[string]*keyState{}})
+	return p.(*keyPool)
+}
+
+// pick 按策略选出一个可用 key：跳过已禁用的 key，并优先选当前未被限流器挂起的 key
+func (p *keyPool) pick(cfg cfgStructs.KeyPoolConfig, exclude map[string]bool) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var enabled, free []string
+	seen := map[string]bool{}
+	for _, k := range cfg.Keys {
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		st := p.stateLocked(k)
+		if st.disabled != "" || exclude[k] {
+			continue
+		}
+		enabled = append(enabled, k)
+		if !limiterFor(p.url, k).blocked() {
+			free = append(free, k)
+		}
+	}
+	if len(enabled) == 0 {
+		return "", fmt.Errorf("no usable key in the key pool for %s (all %d disabled or rejected)", p.url, len(seen))
+	}
+	candidates := free
+	if len(candidates) == 0 {
+		candidates = enabled
+	}
+	var key string
+	switch cfg.Strategy {
+	case cfgStructs.KeyPoolLeastLimited:
+		key = candidates[0]
+		for _, k := range candidates[1:] {
+			a, b := p.state[k], p.state[key]
+			if a.lastLimited.Before(b.lastLimited) || (a.lastLimited.Equal(b.lastLimited) && a.lastUsed.Before(b.lastUsed)) {
+				key = k
+			}
+		}
+	default:
+		key = candidates[p.next%len(candidates)]
+		p.next++
+	}
+	p.state[key].lastUsed = time.Now()
+	return key, nil
+}
+
+func (p *keyPool) stateLocked(key string) *keyState {
+	st, ok := p.state[key]
+	if !ok {
+		st = &keyState{}
+		p.state[key] = st
+	}
+	return st
+}
+
+// finish 记录一次请求的结果。key 被拒绝时禁用；返回是否应换一个 key 重发
+func (p *keyPool) finish(key string, usage usageTotals, err error) bool {
+	var (
+		rejectErr *KeyRejectedError
+		rateErr   *RateLimitError
+	)
+	ev := stats.KeyEvent{PromptTokens: usage.prompt, CompletionTokens: usage.completion, CachedTokens: usage.cached}
+	retry := false
+	p.mu.Lock()
+	switch {
+	case errors.As(err, &rejectErr):
+		ev.Rejected = true
+		p.stateLocked(key).disabled = fmt.Sprintf("HTTP %d %s", rejectErr.Status, rejectErr.Msg)
+		logger.Warn("key %s for %s rejected (HTTP %d), disabled", stats.KeyLabel(key), p.url, rejectErr.Status)
+		retry = true
+	case errors.As(err, &rateErr):
+		ev.RateLimited = true
+		p.stateLocked(key).lastLimited = time.Now()
+		retry = true // 池中还有未被挂起的 key 时直接换用，否则 pick 会回到等待中的 key
+	}
+	p.mu.Unlock()
+	stats.AddKeyUsage(p.url, key, ev)
+	return retry
+}
+
+// usageTotals 一次请求中观察到的最大 token 用量（流式响应可能多次上报）
+type usageTotals struct {
+	prompt, completion, cached uint32
+}
+
+// withKeyPool 在配置了 Key 池的地址上，以池中选出的 key 执行 fn；未配置时直接使用 key。
+// key 被拒绝（401/402）时禁用并换下一个 key；被限流时若池中还有空闲 key 则立即换用，否则把限流错误交给上层重试
+func withKeyPool(baseURL, key string, fn func(key string) (usageTotals, error)) error {
+	cfg, ok := keyPoolConfig(baseURL)
+	if !ok {
+		_, err := fn(key)
+		return err
+	}
+	pool := keyPoolFor(baseURL)
+	tried := map[string]bool{}
+	var lastErr error
+	for {
+		k, err := pool.pick(cfg, tried)
+		if err != nil {
+			if lastErr != nil {
+				return fmt.Errorf("%w (%v)", lastErr, err)
+			}
+			return err
+		}
+		usage, err := fn(k)
+		if !pool.finish(k, usage, err) {
+			return err
+		}
+		lastErr = err
+		tried[k] = true
+		var rateErr *RateLimitError
+		if errors.As(err, &rateErr) && !pool.hasFree(cfg, tried) {
+			return err
+		}
+	}
+}
+
+// hasFree 池中是否还有未尝试、未禁用且未被挂起的 key
+func (p *keyPool) hasFree(cfg cfgStructs.KeyPoolConfig, tried map[string]bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, k := range cfg.Keys {
+		if k != "" && !tried[k] && p.stateLocked(k).disabled == "" && !limiterFor(p.url, k).blocked() {
+			return true
+		}
+	}
+	return false
+}
+
+// DisabledKeys 返回各 Key 池中已禁用的 key（providerURL + " " + 脱敏标签 → 原因），供用量展示
+func DisabledKeys() map[string]string {
+	out := map[string]string{}
+	keyPools.Range(func(_, v any) bool {
+		p := v.(*keyPool)
+		p.mu.Lock()
+		for k, st := range p.state {
+			if st.disabled != "" {
+				out[p.url+" "+stats.KeyLabel(k)] = st.disabled
+			}
+		}
+		p.mu.Unlock()
+		return true
+	})
+	return out
+}
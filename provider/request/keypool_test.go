@@ -0,0 +1,142 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/provider/request/structs"
+	"github.com/cxykevin/alkaid0/stats"
+)
+
+// keyPoolServer 记录每个请求使用的 key；status 返回某个 key 应得到的状态码（0 为 200）
+func keyPoolServer(t *testing.T, status func(key string) int) (*httptest.Server, func() []string) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		used []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		used = append(used, key)
+		mu.Unlock()
+		switch code := status(key); code {
+		case 0:
+			fmt.Fprint(w, `{"data":[{"embedding":[0.5]}],"usage":{"prompt_tokens":3,"total_tokens":3}}`)
+		default:
+			w.Header().Set("retry-after-ms", "5000")
+			w.WriteHeader(code)
+			fmt.Fprintf(w, `{"error":{"message":"status %d"}}`, code)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), used...)
+	}
+}
+
+// setupKeyPool 为 url 配置 Key 池，并隔离用量统计文件
+func setupKeyPool(t *testing.T, url string, pool cfgStructs.KeyPoolConfig) {
+	t.Helper()
+	stats.ResetForTest()
+	stats.SetFilePath(filepath.Join(t.TempDir(), "usage.json"))
+	old := config.GlobalConfig.Model.KeyPools
+	config.GlobalConfig.Model.KeyPools = map[string]cfgStructs.KeyPoolConfig{url + "/": pool}
+	t.Cleanup(func() {
+		config.GlobalConfig.Model.KeyPools = old
+		keyPools.Delete(normalizeProviderURL(url))
+		stats.ResetForTest()
+	})
+}
+
+func poolEmbed(url string) error {
+	_, err := SimpleOpenAIEmbeddingResponse(context.Background(), url, "sk-ignored", "emb", structs.EmbeddingRequest{Input: []string{"x"}})
+	return err
+}
+
+func TestKeyPool_RoundRobin(t *testing.T) {
+	srv, used := keyPoolServer(t, func(string) int { return 0 })
+	setupKeyPool(t, srv.URL, cfgStructs.KeyPoolConfig{Keys: []string{"rr-key-a", "rr-key-b", "rr-key-c"}})
+
+	for range 4 {
+		if err := poolEmbed(srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(used(), ","); got != "rr-key-a,rr-key-b,rr-key-c,rr-key-a" {
+		t.Errorf("keys used = %s", got)
+	}
+	snap := stats.Snapshot()
+	if len(snap.Keys) != 3 || snap.Keys[0].Requests != 2 || snap.Keys[0].PromptTokens != 6 {
+		t.Errorf("unexpected key stats: %+v", snap.Keys)
+	}
+}
+
+// TestKeyPool_RejectedKeyDisabled 401/402 的 key 被禁用，本次请求换下一个 key 重发，之后不再使用
+func TestKeyPool_RejectedKeyDisabled(t *testing.T) {
+	srv, used := keyPoolServer(t, func(key string) int {
+		if key != "rj-key-b" {
+			return http.StatusUnauthorized
+		}
+		return 0
+	})
+	setupKeyPool(t, srv.URL, cfgStructs.KeyPoolConfig{Keys: []string{"rj-key-a", "rj-key-b"}})
+
+	for range 3 {
+		if err := poolEmbed(srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(used(), ","); got != "rj-key-a,rj-key-b,rj-key-b,rj-key-b" {
+		t.Errorf("keys used = %s", got)
+	}
+	disabled := DisabledKeys()
+	if reason := disabled[srv.URL+" "+stats.KeyLabel("rj-key-a")]; !strings.Contains(reason, "401") {
+		t.Errorf("rj-key-a should be disabled, got %v", disabled)
+	}
+
+	// 剩余 key 都被拒绝时返回上游错误
+	config.GlobalConfig.Model.KeyPools[srv.URL+"/"] = cfgStructs.KeyPoolConfig{Keys: []string{"rj-key-a", "rj-key-c"}}
+	var rejectErr *KeyRejectedError
+	if err := poolEmbed(srv.URL); !errors.As(err, &rejectErr) || rejectErr.Status != http.StatusUnauthorized {
+		t.Errorf("expected KeyRejectedError, got %v", err)
+	}
+	if err := poolEmbed(srv.URL); err == nil || !strings.Contains(err.Error(), "no usable key") {
+		t.Errorf("expected no usable key error, got %v", err)
+	}
+}
+
+// TestKeyPool_SwitchOnRateLimit 被限流的 key 挂起，请求立即换用池中其他 key；策略 least_limited 之后避开它
+func TestKeyPool_SwitchOnRateLimit(t *testing.T) {
+	srv, used := keyPoolServer(t, func(key string) int {
+		if key == "rl-key-a" {
+			return http.StatusTooManyRequests
+		}
+		return 0
+	})
+	setupKeyPool(t, srv.URL, cfgStructs.KeyPoolConfig{Keys: []string{"rl-key-a", "rl-key-b"}, Strategy: cfgStructs.KeyPoolLeastLimited})
+
+	for range 2 {
+		if err := poolEmbed(srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(used(), ","); got != "rl-key-a,rl-key-b,rl-key-b" {
+		t.Errorf("keys used = %s", got)
+	}
+	snap := stats.Snapshot()
+	if len(snap.Keys) != 2 || snap.Keys[0].RateLimited != 1 || snap.Keys[1].Requests != 2 {
+		t.Errorf("unexpected key stats: %+v", snap.Keys)
+	}
+}
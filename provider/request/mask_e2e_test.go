@@ -9,14 +9,23 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/cxykevin/alkaid0/config"
 	configStructs "github.com/cxykevin/alkaid0/config/structs"
 	"github.com/cxykevin/alkaid0/provider/mask"
+	"github.com/cxykevin/alkaid0/provider/parser"
 	"github.com/cxykevin/alkaid0/provider/request/structs"
 	"github.com/cxykevin/alkaid0/storage"
+	storageStructs "github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/tools/actions"
+	"github.com/cxykevin/alkaid0/tools/toolobj"
+	"github.com/cxykevin/alkaid0/ui/state"
+	u "github.com/cxykevin/alkaid0/utils"
 )
 
 func e2eJWT() string {
@@ -125,3 +134,134 @@ func TestMaskE2E(t *testing.T) {
 		t.Errorf("restored response missing jwt")
 	}
 }
+
+var fakeKeyRe = regexp.MustCompile(`sk-or-v1-[A-Za-z0-9]+`)
+
+// TestMaskToolCallArgsE2E 验证：模型把脱敏假值抄写进原生 tool_calls 参数时，
+// 出站 payload 不含原秘密，而工具执行时拿到的是还原后的原值。
+// 服务器以 3 字节小块回显参数，并与另一调用的参数和正文交错，覆盖按调用 index 独立的流式还原。
+func TestMaskToolCallArgsE2E(t *testing.T) {
+	initAgentsConsumer()
+	var mu sync.Mutex
+	var inputs []string
+	registerMaskArgsTool(t, "mask_e2e_tool", &mu, &inputs)
+
+	const secret = "sk-or-v1-abc123def456ghi789"
+	var received [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+		var req structs.ChatCompletionRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			t.Errorf("unmarshal request: %v", err)
+		}
+		fake := fakeKeyRe.FindString(req.Messages[len(req.Messages)-1].Content)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, id := range []string{"call_mask_0", "call_mask_1"} {
+			sseChunk(w, structs.ChatCompletionResponse{ID: "x", Model: "echo", Choices: []structs.Choice{{Delta: structs.Message{
+				Role:      structs.RoleAssistant,
+				ToolCalls: []structs.StreamToolCall{{Index: i, ID: id, Type: "function", Function: &structs.StreamToolCallFunc{Name: "mask_e2e_tool"}}},
+			}}}})
+		}
+		args := []string{`{"input":"echo ` + fake + `"}`, `{"input":"key=` + fake + `"}`}
+		for off := 0; off < len(args[0]) || off < len(args[1]); off += 3 {
+			for i, a := range args {
+				if off >= len(a) {
+					continue
+				}
+				sseChunk(w, structs.ChatCompletionResponse{ID: "x", Model: "echo", Choices: []structs.Choice{{Delta: structs.Message{
+					ToolCalls: []structs.StreamToolCall{{Index: i, Function: &structs.StreamToolCallFunc{Arguments: a[off:min(off+3, len(a))]}}},
+				}}}})
+			}
+		}
+		sseChunk(w, structs.ChatCompletionResponse{ID: "x", Model: "echo", Choices: []structs.Choice{{FinishReason: "tool_calls"}}})
+		fmt.Fprintf(w, "data: %s\n\n", SSEDoneMarker)
+	}))
+	defer srv.Close()
+	setupNativeE2EConfig(srv.URL)
+	config.GlobalConfig.DataMask = configStructs.DataMaskConfig{Enable: true, MaskAPIKey: true}
+
+	db := setupTestDB(t)
+	defer u.Unwrap(db.DB()).Close()
+	if err := db.AutoMigrate(&storageStructs.KeyMapping{}, &storageStructs.CustomMask{}); err != nil {
+		t.Fatal(err)
+	}
+	chat := storageStructs.Chats{ID: 9101, LastModelID: 1}
+	if err := db.Create(&chat).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&storageStructs.Messages{ChatID: chat.ID, Type: storageStructs.MessagesRoleUser, Delta: "my key is " + secret}).Error; err != nil {
+		t.Fatal(err)
+	}
+	session := &storageStructs.Chats{ID: chat.ID, DB: db, LastModelID: 1, EnableScopes: make(map[string]bool)}
+
+	if _, err := SendRequest(context.Background(), session, noopCallback); err != nil {
+		t.Fatalf("SendRequest: %v", err)
+	}
+	if session.State != state.StateWaitApprove {
+		t.Fatalf("state = %v, want WaitApprove", session.State)
+	}
+	var assistMsg storageStructs.Messages
+	if err := db.First(&assistMsg, session.CurrentMessageID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExecuteToolCalls(session, assistMsg.ToolCallingJSONString); err != nil {
+		t.Fatalf("ExecuteToolCalls: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, payload := range received {
+		if bytes.Contains(payload, []byte(secret)) {
+			t.Fatalf("outbound payload leaked secret: %s", payload)
+		}
+	}
+	slices.Sort(inputs)
+	if want := []string{"echo " + secret, "key=" + secret}; !slices.Equal(inputs, want) {
+		t.Fatalf("tool executed with args %q, want %q", inputs, want)
+	}
+}
+
+// registerMaskArgsTool 注册一个记录执行参数 input 的测试工具（t.Cleanup 恢复原状）。
+func registerMaskArgsTool(t *testing.T, name string, mu *sync.Mutex, inputs *[]string) {
+	toolobj.ToolsMu.Lock()
+	orig, had := toolobj.ToolsList[name]
+	toolobj.ToolsMu.Unlock()
+
+	actions.AddTool(&toolobj.Tools{
+		Name:            name,
+		ID:              name,
+		UserDescription: "mask e2e test tool",
+		Parameters: map[string]parser.ToolParameters{
+			"input": {Type: parser.ToolTypeString, Required: true},
+		},
+		Hooks: []toolobj.Hook{{
+			PostHook: toolobj.PostHookFunction{
+				Func: func(session *storageStructs.Chats, args map[string]*any, passObjs []*any) (bool, []*any, map[string]*any, error) {
+					if p, ok := args["input"]; ok && p != nil {
+						if s, ok := (*p).(string); ok {
+							mu.Lock()
+							*inputs = append(*inputs, s)
+							mu.Unlock()
+						}
+					}
+					result := any("ok")
+					return false, passObjs, map[string]*any{"result": &result}, nil
+				},
+			},
+		}},
+	})
+
+	t.Cleanup(func() {
+		toolobj.ToolsMu.Lock()
+		if had {
+			toolobj.ToolsList[name] = orig
+		} else {
+			delete(toolobj.ToolsList, name)
+		}
+		toolobj.ToolsMu.Unlock()
+	})
+}
@@ -0,0 +1,281 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/product"
+	"github.com/cxykevin/alkaid0/provider/mask"
+	"github.com/cxykevin/alkaid0/provider/request/structs"
+)
+
+// ollamaChatRequest Ollama /api/chat 请求
+type ollamaChatRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Tools     []structs.Tool  `json:"tools,omitempty"`
+	Stream    bool            `json:"stream"`
+	Think     any             `json:"think,omitempty"` // true 或 "low" / "medium" / "high"
+	KeepAlive string          `json:"keep_alive,omitempty"`
+	Options   map[string]any  `json:"options,omitempty"`
+}
+
+// ollamaMessage Ollama 消息（请求与响应共用）
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // role:tool 结果对应的工具名
+}
+
+// ollamaToolCall Ollama 工具调用（一次性完整到达，arguments 为 JSON 对象）
+type ollamaToolCall struct {
+	ID       string `json:"id,omitempty"`
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaChatResponse Ollama 流式响应的一行（NDJSON）
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount uint32        `json:"prompt_eval_count"`
+	EvalCount       uint32        `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// ollamaBaseURL 规范化 Ollama 地址：兼容误填的 OpenAI 兼容地址（.../v1）
+func ollamaBaseURL(baseURL string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return strings.TrimSuffix(baseURL, "/v1")
+}
+
+// SimpleOllamaRequest 发送 Ollama /api/chat 流式请求，响应逐行转换为 OpenAI ChatCompletion 增量回调。
+// masker 非 nil 时，出站前对消息做敏感数据脱敏，并在响应中还原为原文。
+func SimpleOllamaRequest(ctx context.Context, modelCfg *cfgStructs.ModelConfig, body structs.ChatCompletionRequest, masker *mask.Engine, callback func(structs.ChatCompletionResponse) error) error {
+	endpoint := ollamaBaseURL(modelCfg.ProviderURL) + OllamaChatEndpoint
+	logger.Info("call ollama chat: %s", endpoint)
+
+	if masker != nil {
+		body.Messages = masker.MaskMessages(body.Messages)
+	}
+	payload, err := json.Marshal(buildOllamaRequest(modelCfg, body))
+	if err != nil {
+		logger.Error("call ollama chat error when marshal: %v", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		logger.Error("call ollama chat error when create request: %v", err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if modelCfg.ProviderKey != "" {
+		req.Header.Set("Authorization", "Bearer "+modelCfg.ProviderKey)
+	}
+	req.Header.Set("User-Agent", product.UserAgent)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		logger.Error("call ollama chat error when call: %v", err)
+		return fmt.Errorf("failed to send request when call: %w", err)
+	}
+	defer resp.Body.Close()
+	defer recordExchange(ctx, OllamaChatEndpoint, payload, resp)()
+
+	// 同 SimpleOpenAIRequest：取消时主动关闭 body 以中断阻塞的读取
+	responseDone := make(chan struct{})
+	defer close(responseDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			resp.Body.Close()
+		case <-responseDone:
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(respBody, &errResp); err != nil || errResp.Error == "" {
+			logger.Error("call ollama chat error when check stat %v", resp.StatusCode)
+			return fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		logger.Error("call ollama chat error when check stat %v", resp.StatusCode)
+		return fmt.Errorf("API error: %d %s", resp.StatusCode, errResp.Error)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	toolIndex := 0
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to read response: %w", readErr)
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var chunk ollamaChatResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				return fmt.Errorf("failed to unmarshal response: %w", err)
+			}
+			if chunk.Error != "" {
+				return fmt.Errorf("API error: %s", chunk.Error)
+			}
+			chatResp := convertOllamaChunk(&chunk, &toolIndex)
+			if err := restoreChatResponse(&chatResp, masker); err != nil {
+				return err
+			}
+			if err := callback(chatResp); err != nil {
+				return fmt.Errorf("callback error: %w", err)
+			}
+			if chunk.Done {
+				return finishMaskRestore(masker, callback)
+			}
+		}
+		if readErr == io.EOF {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// buildOllamaRequest 把 OpenAI 格式请求转换为 Ollama /api/chat 请求
+func buildOllamaRequest(modelCfg *cfgStructs.ModelConfig, body structs.ChatCompletionRequest) ollamaChatRequest {
+	model := body.Model
+	if model == "" {
+		model = modelCfg.ModelID
+	}
+	req := ollamaChatRequest{
+		Model:     model,
+		Messages:  convertOllamaMessages(body.Messages),
+		Tools:     body.Tools,
+		Stream:    true,
+		KeepAlive: modelCfg.ProviderSpecificConfig.OllamaKeepAlive,
+	}
+	if modelCfg.EnableThinking {
+		req.Think = true
+		if body.ReasoningEffort != nil {
+			switch effort := *body.ReasoningEffort; effort {
+			case "low", "medium", "high":
+				req.Think = effort
+			}
+		}
+	}
+
+	options := map[string]any{}
+	if numCtx := modelCfg.ProviderSpecificConfig.OllamaNumCtx; numCtx > 0 {
+		options["num_ctx"] = numCtx
+	} else if modelCfg.TokenLimit > 0 {
+		options["num_ctx"] = modelCfg.TokenLimit
+	}
+	if body.MaxTokens != nil && *body.MaxTokens > 0 {
+		options["num_predict"] = *body.MaxTokens
+	}
+	if body.Temperature != nil {
+		options["temperature"] = *body.Temperature
+	}
+	if body.TopP != nil {
+		options["top_p"] = *body.TopP
+	}
+	if modelCfg.ProviderSpecificConfig.EnableTopK && modelCfg.ModelTopK > 0 {
+		options["top_k"] = modelCfg.ModelTopK
+	}
+	maps.Copy(options, modelCfg.ProviderSpecificConfig.OllamaOptions)
+	if len(options) > 0 {
+		req.Options = options
+	}
+	return req
+}
+
+// convertOllamaMessages 转换消息：工具调用参数由 JSON 字符串转为对象，工具结果按调用 id 补全工具名
+func convertOllamaMessages(messages []structs.Message) []ollamaMessage {
+	toolNames := map[string]string{}
+	out := make([]ollamaMessage, 0, len(messages))
+	for _, m := range messages {
+		msg := ollamaMessage{Role: m.Role, Content: m.Content}
+		if m.ReasoningContent != nil {
+			msg.Thinking = *m.ReasoningContent
+		}
+		for _, tc := range m.ToolCalls {
+			if tc.Function == nil {
+				continue
+			}
+			var call ollamaToolCall
+			call.ID = tc.ID
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = json.RawMessage("{}")
+			if args := strings.TrimSpace(tc.Function.Arguments); args != "" && json.Valid([]byte(args)) {
+				call.Function.Arguments = json.RawMessage(args)
+			}
+			msg.ToolCalls = append(msg.ToolCalls, call)
+			toolNames[tc.ID] = tc.Function.Name
+		}
+		if m.Role == structs.RoleTool {
+			msg.ToolName = toolNames[m.ToolCallID]
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// convertOllamaChunk 把 Ollama 响应行转换为 OpenAI 增量。
+// Ollama 的工具调用整体到达，按到达顺序分配 index；无 id 时生成 call_<index>
+func convertOllamaChunk(chunk *ollamaChatResponse, toolIndex *int) structs.ChatCompletionResponse {
+	delta := structs.Message{Role: structs.RoleAssistant, Content: chunk.Message.Content}
+	if chunk.Message.Thinking != "" {
+		thinking := chunk.Message.Thinking
+		delta.ReasoningContent = &thinking
+	}
+	for _, tc := range chunk.Message.ToolCalls {
+		id := tc.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", *toolIndex)
+		}
+		args := string(tc.Function.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		delta.ToolCalls = append(delta.ToolCalls, structs.StreamToolCall{
+			Index:    *toolIndex,
+			ID:       id,
+			Type:     "function",
+			Function: &structs.StreamToolCallFunc{Name: tc.Function.Name, Arguments: args},
+		})
+		*toolIndex++
+	}
+	choice := structs.Choice{Delta: delta}
+	resp := structs.ChatCompletionResponse{Model: chunk.Model, Object: "chat.completion.chunk"}
+	if chunk.Done {
+		choice.FinishReason = chunk.DoneReason
+		if *toolIndex > 0 {
+			choice.FinishReason = "tool_calls"
+		}
+		resp.Usage = &structs.Usage{
+			PromptTokens:     chunk.PromptEvalCount,
+			CompletionTokens: chunk.EvalCount,
+			TotalTokens:      chunk.PromptEvalCount + chunk.EvalCount,
+		}
+	}
+	resp.Choices = []structs.Choice{choice}
+	return resp
+}
@@ -0,0 +1,214 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/provider/request/structs"
+)
+
+// ollamaTestServer 记录收到的 /api/chat 请求体并回放 NDJSON 行
+func ollamaTestServer(t *testing.T, lines []string, got *ollamaChatRequest) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != OllamaChatEndpoint {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, got); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSimpleOllamaRequest(t *testing.T) {
+	var got ollamaChatRequest
+	srv := ollamaTestServer(t, []string{
+		`{"model":"qwen3","message":{"role":"assistant","content":"","thinking":"hmm"},"done":false}`,
+		`{"model":"qwen3","message":{"role":"assistant","content":"Hi"},"done":false}`,
+		`{"model":"qwen3","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"run","arguments":{"cmd":"ls"}}}]},"done":false}`,
+		`{"model":"qwen3","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":5}`,
+	}, &got)
+
+	cfg := cfgStructs.BuildDefault(cfgStructs.ModelConfig{})
+	cfg.ProviderType = cfgStructs.ProviderTypeOllama
+	cfg.ProviderURL = srv.URL + "/v1"
+	cfg.ModelID = "qwen3"
+	cfg.EnableThinking = true
+	cfg.TokenLimit = 8192
+	cfg.ProviderSpecificConfig.OllamaKeepAlive = "10m"
+	cfg.ProviderSpecificConfig.OllamaOptions = map[string]any{"num_ctx": 4096, "seed": 1}
+
+	effort := "high"
+	maxTokens := 256
+	body := structs.ChatCompletionRequest{
+		ReasoningEffort: &effort,
+		MaxTokens:       &maxTokens,
+		Messages: []structs.Message{
+			{Role: structs.RoleUser, Content: "list files"},
+			{Role: structs.RoleAssistant, ToolCalls: []structs.StreamToolCall{{
+				ID: "call_a", Type: "function",
+				Function: &structs.StreamToolCallFunc{Name: "run", Arguments: `{"cmd":"pwd"}`},
+			}}},
+			{Role: structs.RoleTool, ToolCallID: "call_a", Content: "/root"},
+		},
+	}
+
+	var (
+		text, thinking string
+		calls          []structs.StreamToolCall
+		finish         string
+		usage          *structs.Usage
+	)
+	err := ChatRequest(context.Background(), &cfg, body, nil, func(resp structs.ChatCompletionResponse) error {
+		delta := resp.Choices[0].Delta
+		text += delta.Content
+		if delta.ReasoningContent != nil {
+			thinking += *delta.ReasoningContent
+		}
+		calls = append(calls, delta.ToolCalls...)
+		if resp.Choices[0].FinishReason != "" {
+			finish = resp.Choices[0].FinishReason
+		}
+		if resp.Usage != nil {
+			usage = resp.Usage
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatRequest failed: %v", err)
+	}
+
+	// 请求转换
+	if got.Model != "qwen3" || !got.Stream || got.KeepAlive != "10m" || got.Think != "high" {
+		t.Errorf("unexpected request: %+v", got)
+	}
+	if got.Options["num_ctx"] != float64(4096) || got.Options["num_predict"] != float64(256) || got.Options["seed"] != float64(1) {
+		t.Errorf("unexpected options: %v", got.Options)
+	}
+	if len(got.Messages) != 3 || string(got.Messages[1].ToolCalls[0].Function.Arguments) != `{"cmd":"pwd"}` {
+		t.Fatalf("unexpected messages: %+v", got.Messages)
+	}
+	if got.Messages[2].ToolName != "run" {
+		t.Errorf("tool result should carry tool_name, got %q", got.Messages[2].ToolName)
+	}
+
+	// 响应转换
+	if text != "Hi" || thinking != "hmm" {
+		t.Errorf("text=%q thinking=%q", text, thinking)
+	}
+	if len(calls) != 1 || calls[0].ID != "call_0" || calls[0].Function.Arguments != `{"cmd":"ls"}` {
+		t.Errorf("unexpected tool calls: %+v", calls)
+	}
+	if finish != "tool_calls" {
+		t.Errorf("finish reason = %q, want tool_calls", finish)
+	}
+	if usage == nil || usage.PromptTokens != 12 || usage.CompletionTokens != 5 || usage.TotalTokens != 17 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestSimpleOllamaRequest_Errors(t *testing.T) {
+	cfg := cfgStructs.BuildDefault(cfgStructs.ModelConfig{})
+	cfg.ProviderType = cfgStructs.ProviderTypeOllama
+	noop := func(structs.ChatCompletionResponse) error { return nil }
+
+	var got ollamaChatRequest
+	srv := ollamaTestServer(t, []string{`{"error":"model not found"}`}, &got)
+	cfg.ProviderURL = srv.URL
+	err := ChatRequest(context.Background(), &cfg, structs.ChatCompletionRequest{}, nil, noop)
+	if err == nil || !strings.Contains(err.Error(), "model not found") {
+		t.Errorf("expected stream error, got %v", err)
+	}
+
+	srv = ollamaTestServer(t, []string{`{"message":{"role":"assistant","content":"cut"},"done":false}`}, &got)
+	cfg.ProviderURL = srv.URL
+	err = ChatRequest(context.Background(), &cfg, structs.ChatCompletionRequest{}, nil, noop)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+}
+
+func TestDiscoverOllama(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case OllamaTagsEndpoint:
+			fmt.Fprint(w, `{"models":[{"name":"qwen3:8b"},{"name":"nomic-embed-text"}]}`)
+		case OllamaShowEndpoint:
+			var req struct {
+				Model string `json:"model"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Model == "qwen3:8b" {
+				fmt.Fprint(w, `{"model_info":{"qwen3.context_length":40960},"parameters":"num_ctx 16384\ntemperature 0.6","capabilities":["completion","tools","thinking"]}`)
+			} else {
+				fmt.Fprint(w, `{"model_info":{"nomic-bert.context_length":2048},"capabilities":["embedding"]}`)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	models, err := DiscoverModels(context.Background(), cfgStructs.ProviderTypeOllama, srv.URL+"/")
+	if err != nil {
+		t.Fatalf("DiscoverModels failed: %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("expected 2 models, got %d", len(models))
+	}
+	chat := models[0].Config
+	if models[0].ContextLength != 16384 || chat.TokenLimit != 16384 || chat.CompressSize != 12288 {
+		t.Errorf("unexpected context: %d / %+v", models[0].ContextLength, chat)
+	}
+	if !chat.EnableThinking || chat.ProviderType != cfgStructs.ProviderTypeOllama || chat.ProviderURL != srv.URL || chat.ModelID != "qwen3:8b" || chat.ProviderKey != "" {
+		t.Errorf("unexpected chat config: %+v", chat)
+	}
+	if models[1].Config.Type != cfgStructs.ModelTypeEmbedding || models[1].ContextLength != 2048 {
+		t.Errorf("unexpected embedding model: %+v", models[1])
+	}
+}
+
+func TestDiscoverLlamaCpp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case LlamaCppModelsEndpoint:
+			fmt.Fprint(w, `{"data":[{"id":"gemma-3-4b","meta":{"n_ctx_train":131072}}]}`)
+		case LlamaCppPropsEndpoint:
+			fmt.Fprint(w, `{"default_generation_settings":{"n_ctx":8192}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	models, err := DiscoverModels(context.Background(), cfgStructs.ProviderTypeLlamaCpp, srv.URL+"/v1")
+	if err != nil {
+		t.Fatalf("DiscoverModels failed: %v", err)
+	}
+	if len(models) != 1 || models[0].ContextLength != 8192 {
+		t.Fatalf("unexpected models: %+v", models)
+	}
+	if cfg := models[0].Config; cfg.ProviderURL != srv.URL+"/v1" || cfg.ProviderType != cfgStructs.ProviderTypeLlamaCpp {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	if _, err := DiscoverModels(context.Background(), cfgStructs.ProviderTypeOpenAI, srv.URL); err == nil {
+		t.Error("expected error for unsupported provider type")
+	}
+}
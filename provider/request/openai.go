@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -68,13 +69,19 @@ func SimpleOpenAIRequest(ctx context.Context, baseURL, apiKey, model string, bod
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 	req.Header.Set("User-Agent", product.UserAgent)
 
-	// 发送请求
+	// 按 provider key 共享的限流窗口排队，再发送请求
+	release, err := limiterFor(baseURL, apiKey).acquire(ctx)
+	if err != nil {
+		return err
+	}
 	resp, err := httpClient.Do(req)
 	if err != nil {
+		release(0, nil, nil)
 		logger.Error("call openai chat error when call: %v", err)
 		return fmt.Errorf("failed to send request when call: %w", err)
 	}
 	defer resp.Body.Close()
+	defer recordExchange(ctx, ChatCompletionsEndpoint, payload, resp)()
 
 	// 当 context 被取消时关闭 response body，以中断阻塞的 SSE 读取。
 	// Go 的 http.Client 在请求发送后的 body 读取阶段不会检查 context，
@@ -93,15 +100,29 @@ func SimpleOpenAIRequest(ctx context.Context, baseURL, apiKey, model string, bod
 	if resp.StatusCode != http.StatusOK {
 		// 限制错误响应体大小，防止恶意/异常服务端发送无限响应体导致 OOM
 		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		wait := release(resp.StatusCode, resp.Header, respBody)
 		var errResp structs.ErrorResponse
 		if err := json.Unmarshal(respBody, &errResp); err != nil {
 			logger.Error("call openai chat error when unmarshal: %v", err)
+			if wait > 0 {
+				return &RateLimitError{Status: resp.StatusCode, Wait: wait, Msg: http.StatusText(resp.StatusCode)}
+			}
+			if isKeyRejected(resp.StatusCode) {
+				return &KeyRejectedError{Status: resp.StatusCode, Msg: http.StatusText(resp.StatusCode)}
+			}
 			return fmt.Errorf("HTTP %d", resp.StatusCode)
 		}
 		logger.Error("call openai chat error when check stat %v", resp.StatusCode)
 		logger.Debug("error body: %s", errResp.Error.Message)
+		if wait > 0 {
+			return &RateLimitError{Status: resp.StatusCode, Wait: wait, Msg: errResp.Error.Message}
+		}
+		if isKeyRejected(resp.StatusCode) {
+			return &KeyRejectedError{Status: resp.StatusCode, Msg: errResp.Error.Message}
+		}
 		return fmt.Errorf("API error: %d %s", resp.StatusCode, errResp.Error.Message)
 	}
+	release(resp.StatusCode, resp.Header, nil)
 
 	// 读取流式响应；部分兼容网关会忽略 stream=true 并返回普通 JSON，需兼容该响应形式。
 	reader := bufio.NewReader(resp.Body)
@@ -128,23 +149,7 @@ func SimpleOpenAIRequest(ctx context.Context, baseURL, apiKey, model string, bod
 		if err := callback(chatResp); err != nil {
 			return fmt.Errorf("callback error: %w", err)
 		}
-		if masker != nil {
-			content, reasoning := masker.FinishRestore()
-			if content != "" || reasoning != "" {
-				var reasoningPtr *string
-				if reasoning != "" {
-					reasoningPtr = &reasoning
-				}
-				if err := callback(structs.ChatCompletionResponse{
-					Choices: []structs.Choice{{Delta: structs.Message{
-						Content: content, ReasoningContent: reasoningPtr,
-					}}},
-				}); err != nil {
-					return fmt.Errorf("callback error: %w", err)
-				}
-			}
-		}
-		return nil
+		return finishMaskRestore(masker, callback)
 	}
 
 	// The prefix contains the first SSE line's bytes. Re-inject it so the normal
@@ -222,21 +227,29 @@ func SimpleOpenAIRequest(ctx context.Context, baseURL, apiKey, model string, bod
 	}
 
 	// 正常结束时刷出还原器的残留缓冲（未匹配的有界缓冲也是响应文本的一部分）
-	if masker != nil {
-		if c, r := masker.FinishRestore(); c != "" || r != "" {
-			var rp *string
-			if r != "" {
-				rp = &r
-			}
-			if err := callback(structs.ChatCompletionResponse{
-				Choices: []structs.Choice{{Delta: structs.Message{Content: c, ReasoningContent: rp}}},
-			}); err != nil {
-				logger.Error("call openai chat error when callback finish: %v", err)
-				return fmt.Errorf("callback error: %w", err)
-			}
-		}
-	}
+	return finishMaskRestore(masker, callback)
+}
 
+// finishMaskRestore 流结束时把还原器的残留缓冲（正文、思考与各工具调用参数）作为一个增量派发
+func finishMaskRestore(masker *mask.Engine, callback func(structs.ChatCompletionResponse) error) error {
+	if masker == nil {
+		return nil
+	}
+	c, r := masker.FinishRestore()
+	toolCalls := toolArgsResidue(masker)
+	if c == "" && r == "" && len(toolCalls) == 0 {
+		return nil
+	}
+	var rp *string
+	if r != "" {
+		rp = &r
+	}
+	if err := callback(structs.ChatCompletionResponse{
+		Choices: []structs.Choice{{Delta: structs.Message{Content: c, ReasoningContent: rp, ToolCalls: toolCalls}}},
+	}); err != nil {
+		logger.Error("call chat error when callback finish: %v", err)
+		return fmt.Errorf("callback error: %w", err)
+	}
 	return nil
 }
 
@@ -274,24 +287,45 @@ func restoreChatResponse(chatResp *structs.ChatCompletionResponse, masker *mask.
 	}
 	for i := range chatResp.Choices {
 		choice := &chatResp.Choices[i]
-		restoreMessage := func(message *structs.Message) {
+		// 工具调用参数：流式 delta 按调用 index 独立还原，完整消息一次性还原
+		restoreMessage := func(message *structs.Message, stream bool) {
 			message.Content = masker.RestoreContent(message.Content)
 			if rc := message.ReasoningContent; rc != nil {
 				r := masker.RestoreReasoning(*rc)
 				message.ReasoningContent = &r
 			}
 			for j := range message.ToolCalls {
-				if message.ToolCalls[j].Function != nil {
-					message.ToolCalls[j].Function.Arguments = masker.RestoreContent(message.ToolCalls[j].Function.Arguments)
+				call := &message.ToolCalls[j]
+				if call.Function == nil {
+					continue
+				}
+				if stream {
+					call.Function.Arguments = masker.RestoreToolArgs(call.Index, call.Function.Arguments)
+				} else {
+					call.Function.Arguments = masker.RestoreText(call.Function.Arguments)
 				}
 			}
 		}
-		restoreMessage(&choice.Delta)
-		restoreMessage(&choice.Message)
+		restoreMessage(&choice.Delta, true)
+		restoreMessage(&choice.Message, false)
 	}
 	return nil
 }
 
+// toolArgsResidue 把各工具调用参数还原器的残留缓冲转为按 index 排序的 delta，随流结束时一并派发
+func toolArgsResidue(masker *mask.Engine) []structs.StreamToolCall {
+	residue := masker.FinishToolArgs()
+	if len(residue) == 0 {
+		return nil
+	}
+	calls := make([]structs.StreamToolCall, 0, len(residue))
+	for index, args := range residue {
+		calls = append(calls, structs.StreamToolCall{Index: index, Function: &structs.StreamToolCallFunc{Arguments: args}})
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Index < calls[j].Index })
+	return calls
+}
+
 // SimpleOpenAIEmbedding 发送 OpenAI Embedding 请求
 func SimpleOpenAIEmbedding(ctx context.Context, baseURL, apiKey, model string, body structs.EmbeddingRequest) ([][]float32, error) {
 	resp, err := SimpleOpenAIEmbeddingResponse(ctx, baseURL, apiKey, model, body)
@@ -306,7 +340,22 @@ func SimpleOpenAIEmbedding(ctx context.Context, baseURL, apiKey, model string, b
 }
 
 // SimpleOpenAIEmbeddingResponse 发送请求并保留完整的 embedding 响应（包括 usage）。
+// baseURL 配置了 Key 池时，key 从池中选取。
 func SimpleOpenAIEmbeddingResponse(ctx context.Context, baseURL, apiKey, model string, body structs.EmbeddingRequest) (structs.EmbeddingResponse, error) {
+	var resp structs.EmbeddingResponse
+	err := withKeyPool(baseURL, apiKey, func(key string) (usageTotals, error) {
+		var err error
+		resp, err = simpleOpenAIEmbeddingResponse(ctx, baseURL, key, model, body)
+		var usage usageTotals
+		if resp.Usage != nil {
+			usage.prompt = uint32(resp.Usage.PromptTokens)
+		}
+		return usage, err
+	})
+	return resp, err
+}
+
+func simpleOpenAIEmbeddingResponse(ctx context.Context, baseURL, apiKey, model string, body structs.EmbeddingRequest) (structs.EmbeddingResponse, error) {
 	var zero structs.EmbeddingResponse
 	baseURL = strings.TrimRight(baseURL, "/")
 	if body.Model == "" {
@@ -333,9 +382,14 @@ func SimpleOpenAIEmbeddingResponse(ctx context.Context, baseURL, apiKey, model s
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 	req.Header.Set("User-Agent", product.UserAgent)
 
-	// 发送请求
+	// 发送请求（与对话请求共享同一 key 的限流窗口）
+	release, err := limiterFor(baseURL, apiKey).acquire(ctx)
+	if err != nil {
+		return zero, err
+	}
 	resp, err := httpClient.Do(req)
 	if err != nil {
+		release(0, nil, nil)
 		logger.Error("call openai embedding error when call: %v", err)
 		return zero, fmt.Errorf("failed to send request when call: %w", err)
 	}
@@ -344,20 +398,35 @@ func SimpleOpenAIEmbeddingResponse(ctx context.Context, baseURL, apiKey, model s
 	// 读取响应体（限制 8MiB 上限，防止异常服务端无限输出导致内存耗尽）
 	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
 	if err != nil {
+		release(0, nil, nil)
 		logger.Error("call openai embedding error when read response body: %v", err)
 		return zero, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
+		wait := release(resp.StatusCode, resp.Header, respBody)
 		var errResp structs.ErrorResponse
 		if err := json.Unmarshal(respBody, &errResp); err != nil {
 			logger.Error("call openai embedding error when unmarshal: %v", err)
+			if wait > 0 {
+				return zero, &RateLimitError{Status: resp.StatusCode, Wait: wait, Msg: http.StatusText(resp.StatusCode)}
+			}
+			if isKeyRejected(resp.StatusCode) {
+				return zero, &KeyRejectedError{Status: resp.StatusCode, Msg: http.StatusText(resp.StatusCode)}
+			}
 			return zero, fmt.Errorf("HTTP %d", resp.StatusCode)
 		}
 		logger.Error("call openai embedding error: %s", errResp.Error.Message)
+		if wait > 0 {
+			return zero, &RateLimitError{Status: resp.StatusCode, Wait: wait, Msg: errResp.Error.Message}
+		}
+		if isKeyRejected(resp.StatusCode) {
+			return zero, &KeyRejectedError{Status: resp.StatusCode, Msg: errResp.Error.Message}
+		}
 		return zero, fmt.Errorf("API error: %s", errResp.Error.Message)
 	}
+	release(resp.StatusCode, resp.Header, nil)
 
 	// 解析响应
 	var embeddingResp structs.EmbeddingResponse
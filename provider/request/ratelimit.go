@@ -0,0 +1,240 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 限流等待的上下限
+const (
+	// defaultRateLimitWait 429 未给出任何等待提示时的等待时间
+	defaultRateLimitWait = 2 * time.Second
+	// maxRateLimitWait 单次限流等待上限，避免错误的提示把所有会话挂起过久
+	maxRateLimitWait = 5 * time.Minute
+)
+
+// retryInBodyRe 匹配 429 响应体中的 "try again in 1.5s" / "retry after 20 seconds"
+var retryInBodyRe = regexp.MustCompile(`(?i)(?:try again|retry) (?:in|after) ([0-9]+(?:\.[0-9]+)?)\s*(ms|s|sec|secs|seconds?)\b`)
+
+// RateLimitError 上游限流（429，或携带 Retry-After 的 503）。Wait 为限流器已排定的等待时间
+type RateLimitError struct {
+	Status int
+	Wait   time.Duration
+	Msg    string
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("API error: %d %s (rate limited, retry in %s)", e.Status, e.Msg, e.Wait.Round(time.Millisecond))
+}
+
+// rateLimitWaitKey 携带限流等待通知回调的 context key
+type rateLimitWaitKey struct{}
+
+// WithRateLimitWait 返回携带限流等待通知的 context：请求因限流排队时以预计等待时间调用 fn
+func WithRateLimitWait(ctx context.Context, fn func(wait time.Duration)) context.Context {
+	return context.WithValue(ctx, rateLimitWaitKey{}, fn)
+}
+
+func notifyRateLimitWait(ctx context.Context, wait time.Duration) {
+	if fn, ok := ctx.Value(rateLimitWaitKey{}).(func(time.Duration)); ok && fn != nil {
+		fn(wait)
+	}
+}
+
+// keyLimiter 单个 provider key 的限流状态，由所有会话共享。
+// 被限流后窗口结束时只放行一个探测请求，其余请求等待探测结果，避免所有会话同时重试再次触发限流
+type keyLimiter struct {
+	mu      sync.Mutex
+	until   time.Time     // 在此之前不发送请求
+	limited bool          // 最近一次请求被限流
+	probing bool          // 探测请求进行中
+	wake    chan struct{} // 状态变化时关闭并替换，唤醒等待者
+}
+
+var rateLimiters sync.Map // baseURL + "\x00" + key → *keyLimiter
+
+func limiterFor(baseURL, apiKey string) *keyLimiter {
+	l, _ := rateLimiters.LoadOrStore(strings.TrimRight(baseURL, "/")+"\x00"+apiKey, &keyLimiter{wake: make(chan struct{})})
+	return l.(*keyLimiter)
+}
+
+// acquire 等待到该 key 可以发送请求。返回的 release 必须以响应状态码、响应头与（出错时的）响应体调用一次；
+// 请求未拿到响应时以 status 0 调用
+func (l *keyLimiter) acquire(ctx context.Context) (release func(status int, header http.Header, body []byte) time.Duration, err error) {
+	notified := time.Time{}
+	for {
+		l.mu.Lock()
+		wait := time.Until(l.until)
+		wake := l.wake
+		if wait <= 0 && !(l.limited && l.probing) {
+			probe := l.limited
+			if probe {
+				l.probing = true
+			}
+			l.mu.Unlock()
+			return func(status int, header http.Header, body []byte) time.Duration {
+				return l.release(probe, status, header, body)
+			}, nil
+		}
+		l.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			if until := time.Now().Add(wait); until.Sub(notified) > time.Second {
+				notified = until
+				notifyRateLimitWait(ctx, wait)
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-timeout:
+		case <-wake:
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// blocked 该 key 当前是否被挂起（限流窗口未结束，或探测请求进行中）
+func (l *keyLimiter) blocked() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.until) || (l.limited && l.probing)
+}
+
+// release 根据响应更新限流状态，返回被限流时排定的等待时间（未限流为 0）
+func (l *keyLimiter) release(probe bool, status int, header http.Header, body []byte) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer func() {
+		close(l.wake)
+		l.wake = make(chan struct{})
+	}()
+	if probe {
+		l.probing = false
+	}
+	now := time.Now()
+	switch {
+	case status == 0:
+		// 未拿到响应：不改变限流判断，由下一个请求继续探测
+		return 0
+	case status == http.StatusTooManyRequests || (status == http.StatusServiceUnavailable && parseRetryAfter(header, now) > 0):
+		wait := parseRetryAfter(header, now)
+		if wait <= 0 {
+			wait = parseRetryInBody(body)
+		}
+		if wait <= 0 {
+			wait = parseRateLimitReset(header, now, true)
+		}
+		if wait <= 0 {
+			wait = defaultRateLimitWait
+		}
+		wait = min(wait, maxRateLimitWait)
+		l.limited = true
+		l.until = maxTime(l.until, now.Add(wait))
+		logger.Warn("rate limited (HTTP %d), hold requests for %v", status, wait)
+		return wait
+	default:
+		l.limited = false
+		// 配额已用尽但请求成功：在重置前暂停后续请求
+		if wait := parseRateLimitReset(header, now, false); wait > 0 {
+			l.until = maxTime(l.until, now.Add(min(wait, maxRateLimitWait)))
+			logger.Info("rate limit quota exhausted, hold requests for %v", wait)
+		}
+		return 0
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// parseRetryAfter 解析 Retry-After（秒数或 HTTP 日期）与 retry-after-ms
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if header == nil {
+		return 0
+	}
+	if v := header.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	v := strings.TrimSpace(header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// parseRateLimitReset 解析 x-ratelimit-remaining-* / x-ratelimit-reset-*。
+// all 为 true 时返回各项重置时间中的最大值；否则只计入剩余额度为 0 的项
+func parseRateLimitReset(header http.Header, now time.Time, all bool) time.Duration {
+	if header == nil {
+		return 0
+	}
+	var wait time.Duration
+	for _, kind := range []string{"requests", "tokens"} {
+		if !all && strings.TrimSpace(header.Get("x-ratelimit-remaining-"+kind)) != "0" {
+			continue
+		}
+		wait = max(wait, parseResetValue(header.Get("x-ratelimit-reset-"+kind), now))
+	}
+	return wait
+}
+
+// parseResetValue 重置时间的三种写法：Go 风格时长（"6m0s"、"20ms"）、秒数、RFC 3339 时间
+func parseResetValue(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// parseRetryInBody 从 429 响应体的错误信息中提取等待时间
+func parseRetryInBody(body []byte) time.Duration {
+	m := retryInBodyRe.FindSubmatch(body)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.ParseFloat(string(m[1]), 64)
+	if err != nil {
+		return 0
+	}
+	if string(m[2]) == "ms" {
+		return time.Duration(n * float64(time.Millisecond))
+	}
+	return time.Duration(n * float64(time.Second))
+}
@@ -0,0 +1,151 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cxykevin/alkaid0/provider/request/structs"
+)
+
+func TestParseRateLimitHints(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := http.Header{}
+	h.Set("Retry-After", "7")
+	if got := parseRetryAfter(h, now); got != 7*time.Second {
+		t.Errorf("Retry-After seconds = %v", got)
+	}
+	h.Set("Retry-After", now.Add(30*time.Second).Format(http.TimeFormat))
+	if got := parseRetryAfter(h, now); got != 30*time.Second {
+		t.Errorf("Retry-After date = %v", got)
+	}
+	h.Set("retry-after-ms", "250")
+	if got := parseRetryAfter(h, now); got != 250*time.Millisecond {
+		t.Errorf("retry-after-ms = %v", got)
+	}
+
+	h = http.Header{}
+	h.Set("x-ratelimit-remaining-requests", "3")
+	h.Set("x-ratelimit-reset-requests", "6m0s")
+	h.Set("x-ratelimit-remaining-tokens", "0")
+	h.Set("x-ratelimit-reset-tokens", "1.5s")
+	if got := parseRateLimitReset(h, now, false); got != 1500*time.Millisecond {
+		t.Errorf("exhausted reset = %v, want 1.5s", got)
+	}
+	if got := parseRateLimitReset(h, now, true); got != 6*time.Minute {
+		t.Errorf("max reset = %v, want 6m", got)
+	}
+
+	for body, want := range map[string]time.Duration{
+		`{"error":{"message":"Rate limit reached. Please try again in 20s."}}`: 20 * time.Second,
+		`{"error":{"message":"Please try again in 843ms. Visit ..."}}`:         843 * time.Millisecond,
+		`{"error":{"message":"quota exceeded, retry after 2.5 seconds"}}`:      2500 * time.Millisecond,
+		`{"error":{"message":"Too many requests"}}`:                            0,
+	} {
+		if got := parseRetryInBody([]byte(body)); got != want {
+			t.Errorf("parseRetryInBody(%s) = %v, want %v", body, got, want)
+		}
+	}
+}
+
+// TestRateLimiterSharedProbe 429 后所有请求共享等待窗口；窗口结束只放行一个探测请求，其余等它成功后再发
+func TestRateLimiterSharedProbe(t *testing.T) {
+	var (
+		calls    atomic.Int32
+		mu       sync.Mutex
+		arrivals []time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("retry-after-ms", "200")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"Rate limit reached"}}`)
+			return
+		}
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, `{"data":[{"embedding":[0.5]}]}`)
+	}))
+	defer srv.Close()
+
+	embed := func(ctx context.Context) error {
+		_, err := SimpleOpenAIEmbeddingResponse(ctx, srv.URL, "sk-shared", "emb", structs.EmbeddingRequest{Input: []string{"x"}})
+		return err
+	}
+
+	start := time.Now()
+	err := embed(context.Background())
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.Status != http.StatusTooManyRequests || rateErr.Wait != 200*time.Millisecond {
+		t.Fatalf("expected RateLimitError with 200ms wait, got %v", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		notified atomic.Int32
+	)
+	ctx := WithRateLimitWait(context.Background(), func(wait time.Duration) {
+		if wait > 0 && wait <= 200*time.Millisecond {
+			notified.Add(1)
+		}
+	})
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := embed(ctx); err != nil {
+				t.Errorf("queued request failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(arrivals) != 3 {
+		t.Fatalf("expected 3 successful requests, got %d", len(arrivals))
+	}
+	if first := arrivals[0].Sub(start); first < 180*time.Millisecond {
+		t.Errorf("probe sent after %v, before the Retry-After window ended", first)
+	}
+	if gap := arrivals[1].Sub(arrivals[0]); gap < 40*time.Millisecond {
+		t.Errorf("other requests should wait for the probe, gap %v", gap)
+	}
+	if notified.Load() != 3 {
+		t.Errorf("each queued request should be notified once, got %d", notified.Load())
+	}
+}
+
+// TestRateLimiterQuotaExhausted 成功响应报告剩余额度为 0 时，后续请求等待到重置
+func TestRateLimiterQuotaExhausted(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		arrivals []time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		if len(arrivals) == 1 {
+			w.Header().Set("x-ratelimit-remaining-requests", "0")
+			w.Header().Set("x-ratelimit-reset-requests", "150ms")
+		}
+		mu.Unlock()
+		fmt.Fprint(w, `{"data":[{"embedding":[0.5]}]}`)
+	}))
+	defer srv.Close()
+
+	for range 2 {
+		if _, err := SimpleOpenAIEmbeddingResponse(context.Background(), srv.URL, "sk-quota", "emb", structs.EmbeddingRequest{Input: []string{"x"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gap := arrivals[1].Sub(arrivals[0]); gap < 130*time.Millisecond {
+		t.Errorf("second request should wait for the quota reset, gap %v", gap)
+	}
+}
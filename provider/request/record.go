@@ -0,0 +1,46 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cxykevin/alkaid0/provider/request/cassette"
+)
+
+// recorderKey 携带录制回调的 context key
+type recorderKey struct{}
+
+// WithRecorder 返回携带录制回调的 context：每次对话请求结束时以实际请求体与上游原始响应调用 fn
+func WithRecorder(ctx context.Context, fn func(cassette.Interaction)) context.Context {
+	return context.WithValue(ctx, recorderKey{}, fn)
+}
+
+// teeBody 读取响应体时同时写入录制缓冲区
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// recordExchange 开启录制时把响应体旁路到缓冲区，返回的函数在请求结束时提交录制（须在读取响应前调用）
+func recordExchange(ctx context.Context, endpoint string, payload []byte, resp *http.Response) func() {
+	fn, ok := ctx.Value(recorderKey{}).(func(cassette.Interaction))
+	if !ok || fn == nil {
+		return func() {}
+	}
+	start := time.Now()
+	var buf bytes.Buffer
+	resp.Body = teeBody{io.TeeReader(resp.Body, &buf), resp.Body}
+	return func() {
+		fn(cassette.Interaction{
+			Time:        start,
+			Endpoint:    endpoint,
+			Request:     payload,
+			Status:      resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Response:    buf.String(),
+		})
+	}
+}
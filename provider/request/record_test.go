@@ -0,0 +1,98 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/config"
+	"github.com/cxykevin/alkaid0/provider/request/cassette"
+	storageStructs "github.com/cxykevin/alkaid0/storage/structs"
+	u "github.com/cxykevin/alkaid0/utils"
+	"gorm.io/gorm"
+)
+
+// recordTestSession 创建带一条用户消息的会话，Root 指向 root
+func recordTestSession(t *testing.T, db *gorm.DB, id uint32, root string) *storageStructs.Chats {
+	t.Helper()
+	if err := db.Create(&storageStructs.Chats{ID: id, LastModelID: 1}).Error; err != nil {
+		t.Fatalf("create chat: %v", err)
+	}
+	if err := db.Create(&storageStructs.Messages{ChatID: id, Type: storageStructs.MessagesRoleUser, Delta: "say something"}).Error; err != nil {
+		t.Fatalf("create user msg: %v", err)
+	}
+	return &storageStructs.Chats{
+		ID: id, DB: db, LastModelID: 1, InTestFlag: true, Root: root,
+		EnableScopes: make(map[string]bool),
+	}
+}
+
+func agentDelta(t *testing.T, db *gorm.DB, chatID uint32) (uint64, string) {
+	t.Helper()
+	var msg storageStructs.Messages
+	if err := db.Where("chat_id = ? AND type = ?", chatID, storageStructs.MessagesRoleAgent).First(&msg).Error; err != nil {
+		t.Fatalf("query agent msg: %v", err)
+	}
+	return msg.ID, msg.Delta
+}
+
+// TestSendRequest_RecordAndReplay 录制模式把请求与原始流写入 cassette，回放后得到相同的消息且不再访问上游
+func TestSendRequest_RecordAndReplay(t *testing.T) {
+	initAgentsConsumer()
+	var upstreamCalls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		emitTextSSE(w, "recorded answer")
+		fmt.Fprintf(w, "data: %s\n\n", SSEDoneMarker)
+	}))
+	defer srv.Close()
+	setupNativeE2EConfig(srv.URL)
+	config.GlobalConfig.Agent.RecordRequests = true
+
+	db := setupTestDB(t)
+	defer u.Unwrap(db.DB()).Close()
+	root := t.TempDir()
+	session := recordTestSession(t, db, 9301, root)
+	if _, err := SendRequest(context.Background(), session, noopCallback); err != nil {
+		t.Fatalf("SendRequest: %v", err)
+	}
+	msgID, delta := agentDelta(t, db, session.ID)
+
+	items, err := cassette.Load(cassette.Path(root, session.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected 1 recorded interaction, got %d", len(items))
+	}
+	it := items[0]
+	if it.MessageID != msgID || it.Endpoint != ChatCompletionsEndpoint || it.Status != http.StatusOK ||
+		!strings.Contains(string(it.Request), "say something") || !strings.Contains(it.Response, "recorded answer") {
+		t.Errorf("unexpected interaction: %+v", it)
+	}
+
+	// 回放：上游换成 cassette，重跑同样的对话
+	player := cassette.NewPlayer(items)
+	replaySrv := httptest.NewServer(player)
+	defer replaySrv.Close()
+	setupNativeE2EConfig(replaySrv.URL)
+
+	replayed := recordTestSession(t, db, 9302, root)
+	if _, err := SendRequest(context.Background(), replayed, noopCallback); err != nil {
+		t.Fatalf("replay SendRequest: %v", err)
+	}
+	if _, got := agentDelta(t, db, replayed.ID); got != delta {
+		t.Errorf("replayed delta = %q, want %q", got, delta)
+	}
+	if player.Remaining() != 0 || upstreamCalls.Load() != 1 {
+		t.Errorf("replay should consume the cassette without calling upstream (remaining %d, upstream calls %d)", player.Remaining(), upstreamCalls.Load())
+	}
+	if _, err := cassette.Load(cassette.Path(root, replayed.ID)); err == nil {
+		t.Error("recording is off, replayed session should not write a cassette")
+	}
+}
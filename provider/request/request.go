@@ -17,15 +17,18 @@ import (
 	"github.com/cxykevin/alkaid0/provider/mask"
 	"github.com/cxykevin/alkaid0/provider/request/agents/actions"
 	"github.com/cxykevin/alkaid0/provider/request/build"
+	"github.com/cxykevin/alkaid0/provider/request/cassette"
 	"github.com/cxykevin/alkaid0/provider/request/classifier"
 	"github.com/cxykevin/alkaid0/provider/request/structs"
 	"github.com/cxykevin/alkaid0/provider/response"
 	"github.com/cxykevin/alkaid0/stats"
 	storageStructs "github.com/cxykevin/alkaid0/storage/structs"
 	"github.com/cxykevin/alkaid0/tools"
+	"github.com/cxykevin/alkaid0/tools/tools/patch"
 	"github.com/cxykevin/alkaid0/ui/state"
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
+	"gorm.io/gorm"
 )
 
 // UserAddMsg 处理用户发送的消息，更新数据库并处理子代理和审批状态
@@ -39,8 +42,6 @@ func UserAddMsg(session *storageStructs.Chats, msg string, refers *storageStruct
 // UserAddMsgWithID 同 UserAddMsg，但返回持久化的用户消息 DB ID（用于 ACP v2 messageId）。
 func UserAddMsgWithID(session *storageStructs.Chats, msg string, refers *storageStructs.MessagesReferList) (uint64, error) {
 	logger.Info("UserAddMsg: chatID=%d, msgLen=%d", session.ID, len(msg))
-	db := session.DB
-	chatID := session.ID
 	var refer storageStructs.MessagesReferList
 	if refers == nil {
 		refer = storageStructs.MessagesReferList{}
@@ -49,25 +50,8 @@ func UserAddMsgWithID(session *storageStructs.Chats, msg string, refers *storage
 	}
 
 	// 第 1 步：处理 WaitApprove 状态 — 先写入拒绝消息，再继续处理用户输入
-	if session.State == state.StateWaitApprove {
-		logger.Info("UserAddMsg: state=WaitApprove, rejecting pending tools and processing user input")
-		reason, err := prompts.Render(prompts.UserRejectTemplate, msg)
-		if err != nil {
-			return 0, err
-		}
-		if err := db.Create(&storageStructs.Messages{
-			ChatID: chatID,
-			Delta:  reason,
-			Refers: refer,
-			Type:   storageStructs.MessagesRoleCommunicate,
-		}).Error; err != nil {
-			return 0, err
-		}
-		session.State = state.StateIdle
-		if err := db.Save(session).Error; err != nil {
-			return 0, err
-		}
-		// NOTE: 不 return — 继续执行后续逻辑，将用户输入作为正常消息插入
+	if err := rejectPendingForUser(session, msg, refer); err != nil {
+		return 0, err
 	}
 
 	// 第 2 步：停用子代理（如果有）
@@ -78,6 +62,47 @@ func UserAddMsgWithID(session *storageStructs.Chats, msg string, refers *storage
 		}
 	}
 
+	return insertUserMsg(session, msg, refer, nil)
+}
+
+// SteerAddMsg 在运行中的一轮内插入用户引导消息（两次模型请求之间调用）。
+// 与 UserAddMsg 不同，不停用子代理：消息写入当前代理的上下文，下一次请求即可看到。
+func SteerAddMsg(session *storageStructs.Chats, msg string) (uint64, error) {
+	logger.Info("SteerAddMsg: chatID=%d, agent=%s, msgLen=%d", session.ID, session.CurrentAgentID, len(msg))
+	refer := storageStructs.MessagesReferList{}
+	if err := rejectPendingForUser(session, msg, refer); err != nil {
+		return 0, err
+	}
+	agentID := session.CurrentAgentID
+	return insertUserMsg(session, msg, refer, &agentID)
+}
+
+// rejectPendingForUser 会话处于 WaitApprove 时写入拒绝消息并回到 Idle，用户输入随后作为正常消息插入
+func rejectPendingForUser(session *storageStructs.Chats, msg string, refer storageStructs.MessagesReferList) error {
+	if session.State != state.StateWaitApprove {
+		return nil
+	}
+	logger.Info("UserAddMsg: state=WaitApprove, rejecting pending tools and processing user input")
+	reason, err := prompts.Render(prompts.UserRejectTemplate, msg)
+	if err != nil {
+		return err
+	}
+	if err := session.DB.Create(&storageStructs.Messages{
+		ChatID: session.ID,
+		Delta:  reason,
+		Refers: refer,
+		Type:   storageStructs.MessagesRoleCommunicate,
+	}).Error; err != nil {
+		return err
+	}
+	session.State = state.StateIdle
+	return session.DB.Save(session).Error
+}
+
+// insertUserMsg 分类转换并插入用户消息，agentID 为 nil 时写入主会话
+func insertUserMsg(session *storageStructs.Chats, msg string, refer storageStructs.MessagesReferList, agentID *string) (uint64, error) {
+	db := session.DB
+	chatID := session.ID
 	// 分类并转换消息（prompt/code/log 三段分类）
 	var transformedMsg string
 	var segInfos []classifier.SegmentInfo
@@ -94,10 +119,11 @@ func UserAddMsgWithID(session *storageStructs.Chats, msg string, refers *storage
 
 	// 插入
 	msgRecord := storageStructs.Messages{
-		ChatID: chatID,
-		Delta:  transformedMsg,
-		Refers: refer,
-		Type:   storageStructs.MessagesRoleUser,
+		ChatID:  chatID,
+		Delta:   transformedMsg,
+		Refers:  refer,
+		Type:    storageStructs.MessagesRoleUser,
+		AgentID: agentID,
 	}
 	if err := db.Create(&msgRecord).Error; err != nil {
 		return 0, err
@@ -475,6 +501,7 @@ func CanAutoApprove(session *storageStructs.Chats, toolCalls []ToolCall, msg *st
 //	contains(s, sub)     - 关键字匹配，用于检查参数内容（如文件路径关键字）
 //	hasParam(call, key)  - 检查工具调用是否存在指定参数名
 //	param(call, key)     - 获取工具调用的指定参数值，支持链式调用
+//	patchPaths(call)     - 获取 patch 调用涉及的全部文件路径（diff 文件头与 edits 中的 path）
 //
 // ToolCalls 是全集（所有待审批工具），ToolCall 是当前待评估的工具，
 // Agent 包含当前 Agent 的上下文配置。这些作为表达式求值环境变量注入。
@@ -522,20 +549,8 @@ func compileExpr(program string) (*vm.Program, error) {
 		if len(params) != 2 {
 			return false, nil
 		}
-		var call ToolCall
-		if m, ok := params[0].(map[string]any); ok {
-			if name, ok := m["Name"].(string); ok {
-				call.Name = name
-			}
-			if id, ok := m["ID"].(string); ok {
-				call.ID = id
-			}
-			if params, ok := m["Parameters"].(map[string]*any); ok {
-				call.Parameters = params
-			}
-		} else if c, ok := params[0].(ToolCall); ok {
-			call = c
-		} else {
+		call, ok := exprToolCall(params[0])
+		if !ok {
 			return false, nil
 		}
 		key, ok := params[1].(string)
@@ -547,20 +562,8 @@ func compileExpr(program string) (*vm.Program, error) {
 		if len(params) != 2 {
 			return nil, nil
 		}
-		var call ToolCall
-		if m, ok := params[0].(map[string]any); ok {
-			if name, ok := m["Name"].(string); ok {
-				call.Name = name
-			}
-			if id, ok := m["ID"].(string); ok {
-				call.ID = id
-			}
-			if params, ok := m["Parameters"].(map[string]*any); ok {
-				call.Parameters = params
-			}
-		} else if c, ok := params[0].(ToolCall); ok {
-			call = c
-		} else {
+		call, ok := exprToolCall(params[0])
+		if !ok {
 			return nil, nil
 		}
 		key, ok := params[1].(string)
@@ -568,9 +571,44 @@ func compileExpr(program string) (*vm.Program, error) {
 			return nil, nil
 		}
 		return param(call, key), nil
+	}), expr.Function("patchPaths", func(params ...any) (any, error) {
+		if len(params) != 1 {
+			return []any{}, nil
+		}
+		call, ok := exprToolCall(params[0])
+		if !ok || call.Parameters == nil {
+			return []any{}, nil
+		}
+		paths := patch.TargetPaths(call.Parameters)
+		out := make([]any, len(paths))
+		for i, p := range paths {
+			out[i] = p
+		}
+		return out, nil
 	}))
 }
 
+// exprToolCall 将表达式中的 ToolCall（map 或结构体）还原为 ToolCall
+func exprToolCall(v any) (ToolCall, bool) {
+	var call ToolCall
+	if m, ok := v.(map[string]any); ok {
+		if name, ok := m["Name"].(string); ok {
+			call.Name = name
+		}
+		if id, ok := m["ID"].(string); ok {
+			call.ID = id
+		}
+		if params, ok := m["Parameters"].(map[string]*any); ok {
+			call.Parameters = params
+		}
+		return call, true
+	}
+	if c, ok := v.(ToolCall); ok {
+		return c, true
+	}
+	return call, false
+}
+
 // ParseToolsFromJSON 解析工具调用 JSON 字符串为 ToolCall 结构体切片。
 // 支持完整 map 和 ObjectSlot（流式解析未完成状态）两种对象形式，
 // 以及完整数组和 ArraySlot 两种容器形式。空 payload 返回空切片而非错误。
@@ -657,10 +695,11 @@ func RejectToolCallsNoDeactivate(session *storageStructs.Chats, reason string, r
 		return err
 	}
 	if err := session.DB.Create(&storageStructs.Messages{
-		ChatID: session.ID,
-		Delta:  finalReason,
-		Refers: refer,
-		Type:   storageStructs.MessagesRoleCommunicate,
+		ChatID:  session.ID,
+		Delta:   finalReason,
+		Refers:  refer,
+		Type:    storageStructs.MessagesRoleCommunicate,
+		AgentID: &session.CurrentAgentID,
 	}).Error; err != nil {
 		return err
 	}
@@ -668,6 +707,15 @@ func RejectToolCallsNoDeactivate(session *storageStructs.Chats, reason string, r
 	return session.DB.Save(session).Error
 }
 
+// AgentMessages 将消息查询限定在指定代理的消息流（主代理为空串，兼容历史 NULL）。
+// 并行子代理与主代理同时写入同一会话，按会话查询“最近一条”必须同时按代理过滤。
+func AgentMessages(db *gorm.DB, agentID string) *gorm.DB {
+	if agentID == "" {
+		return db.Where("(agent_id = '' OR agent_id IS NULL)")
+	}
+	return db.Where("agent_id = ?", agentID)
+}
+
 // ApplyToolOnHooks 应用工具调用，遍历所有已解析的工具调用并执行对应的 OnHook 回调
 func ApplyToolOnHooks(session *storageStructs.Chats, toolCallingJSON string) error {
 	if toolCallingJSON == "" {
@@ -766,8 +814,8 @@ func detectToolCallLoop(session *storageStructs.Chats, toolCallingJSON string) [
 		return nil
 	}
 	var msgs []storageStructs.Messages
-	if err := session.DB.Where("chat_id = ? AND type = ? AND tool_calling_json_string != ''",
-		session.ID, storageStructs.MessagesRoleAgent).
+	if err := AgentMessages(session.DB, session.CurrentAgentID).
+		Where("chat_id = ? AND type = ? AND tool_calling_json_string != ''", session.ID, storageStructs.MessagesRoleAgent).
 		Order("id DESC").Limit(toolCallLoopMaxHistory).Find(&msgs).Error; err != nil {
 		return nil
 	}
@@ -873,7 +921,7 @@ func ExecuteToolCalls(session *storageStructs.Chats, toolCallingJSON string) (bo
 		}
 		return true, err
 	}
-	for _, call := range calls {
+	for i, call := range calls {
 		parameters := call.Parameters
 		if parameters == nil {
 			parameters = make(map[string]*any)
@@ -886,8 +934,10 @@ func ExecuteToolCalls(session *storageStructs.Chats, toolCallingJSON string) (bo
 			}
 			return true, err
 		}
+		// 每个调用独立 index，否则后续调用会并入已完成的首个调用而不被执行
 		if err := solver.AddNativeToolCallDelta([]structs.StreamToolCall{{
-			ID: call.ID,
+			Index: i,
+			ID:    call.ID,
 			Function: &structs.StreamToolCallFunc{
 				Name:      call.Name,
 				Arguments: string(arguments),
@@ -1225,8 +1275,19 @@ func SendRequest(ctx context.Context, session *storageStructs.Chats, callback fu
 	// 创建安全 key 上下文引擎：请求出站脱敏 + 响应流式还原（未启用时返回 nil，零行为变化）
 	eng := mask.NewEngine(session.DB)
 
+	// 录制模式：请求体与原始响应流按消息追加到会话的 cassette 文件
+	if config.GlobalConfig.Agent.RecordRequests {
+		cassettePath := cassette.Path(session.Root, session.ID)
+		ctx = WithRecorder(ctx, func(it cassette.Interaction) {
+			it.MessageID = msgID
+			if err := cassette.Append(cassettePath, it); err != nil {
+				logger.Warn("record request to %s: %v", cassettePath, err)
+			}
+		})
+	}
+
 	// 向 LLM 发送请求，solveFunc 会在每个流式 chunk 到达时被调用
-	requestErr := SimpleOpenAIRequest(ctx, modelCfg.ProviderURL, modelCfg.ProviderKey, modelCfg.ModelID, *obj, eng, solveFunc)
+	requestErr := ChatRequest(ctx, &modelCfg, *obj, eng, solveFunc)
 
 	// 请求已发出：无论后续正常完成、工具调用预解析、用户取消或其他错误，都算一次真实对话调用——本次 token 花费计入总库
 	// 还是 native/legacy 格式打回，都算一次真实对话调用——本次 token 花费计入总库
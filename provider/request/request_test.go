@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/cxykevin/alkaid0/provider/request/structs"
 	"github.com/cxykevin/alkaid0/stats"
 	storageStructs "github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/tools/tools/edit"
 	"github.com/cxykevin/alkaid0/ui/state"
 	u "github.com/cxykevin/alkaid0/utils"
 	"github.com/glebarez/sqlite"
@@ -850,6 +853,114 @@ func TestEvaluateApprovalRules_BuiltinReject(t *testing.T) {
 	}
 }
 
+// TestEvaluateApprovalRules_BuiltinGit 测试 git 工具的内置规则：只读操作自动批准，提交需审批，强制推送拒绝
+func TestEvaluateApprovalRules_BuiltinGit(t *testing.T) {
+	db := setupTestDB(t)
+	defer u.Unwrap(db.DB()).Close()
+
+	oldIgnore := config.GlobalConfig.Agent.IgnoreDefaultRules
+	oldApprove := config.GlobalConfig.Agent.DefaultAutoApprove
+	oldReject := config.GlobalConfig.Agent.DefaultAutoReject
+	defer func() {
+		config.GlobalConfig.Agent.IgnoreDefaultRules = oldIgnore
+		config.GlobalConfig.Agent.DefaultAutoApprove = oldApprove
+		config.GlobalConfig.Agent.DefaultAutoReject = oldReject
+	}()
+	config.GlobalConfig.Agent.IgnoreDefaultRules = false
+	config.GlobalConfig.Agent.DefaultAutoApprove = ""
+	config.GlobalConfig.Agent.DefaultAutoReject = ""
+
+	session := &storageStructs.Chats{ID: 1, DB: db, CurrentAgentConfig: cfgStruct.AgentConfig{}}
+	call := func(params map[string]any) []ToolCall {
+		mp := map[string]*any{}
+		for k, v := range params {
+			mp[k] = new(v)
+		}
+		return []ToolCall{{Name: "git", ID: "g", Parameters: mp}}
+	}
+
+	cases := []struct {
+		params map[string]any
+		want   ApprovalDecision
+	}{
+		{map[string]any{"op": "status"}, DecisionApproved},
+		{map[string]any{"op": "diff", "staged": true}, DecisionApproved},
+		{map[string]any{"op": "log"}, DecisionApproved},
+		{map[string]any{"op": "branch"}, DecisionApproved},
+		{map[string]any{"op": "stash", "action": "list"}, DecisionApproved},
+		{map[string]any{"op": "branch", "action": "create", "name": "x"}, DecisionManual},
+		{map[string]any{"op": "commit", "message": "m"}, DecisionManual},
+		{map[string]any{"op": "push"}, DecisionManual},
+		{map[string]any{"op": "push", "force": false}, DecisionManual},
+		{map[string]any{"op": "push", "force": true}, DecisionRejected},
+		{map[string]any{"op": "push", "name": "main", "remote": "upstream"}, DecisionManual},
+		{map[string]any{"op": "push", "name": "+main"}, DecisionRejected},
+		{map[string]any{"op": "push", "name": "a:+b"}, DecisionRejected},
+		{map[string]any{"op": "push", "name": ":main"}, DecisionRejected},
+		{map[string]any{"op": "push", "name": "main", "remote": "https://evil.example/repo.git"}, DecisionRejected},
+		{map[string]any{"op": "push", "name": "main", "remote": "git@evil.example:repo.git"}, DecisionRejected},
+		{map[string]any{"op": "push", "name": "main", "remote": "../other"}, DecisionRejected},
+	}
+	for _, c := range cases {
+		result, err := EvaluateApprovalRules(session, call(c.params))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", c.params, err)
+		}
+		if result.Decision != c.want {
+			t.Errorf("%v: expected %v, got %v", c.params, c.want, result.Decision)
+		}
+	}
+}
+
+// TestEvaluateApprovalRules_BuiltinPatchSensitive 测试 patch 改动敏感文件时被内置规则拒绝
+func TestEvaluateApprovalRules_BuiltinPatchSensitive(t *testing.T) {
+	db := setupTestDB(t)
+	defer u.Unwrap(db.DB()).Close()
+
+	restore := config.GlobalConfigSwap(config.GlobalConfigSnapshot())
+	defer restore()
+	config.GlobalConfig.Agent.IgnoreDefaultRules = false
+	config.GlobalConfig.Agent.DefaultAutoApprove = ""
+	config.GlobalConfig.Agent.DefaultAutoReject = ""
+
+	if !strings.Contains(builtinAutoRejectExpr, strconv.Quote(edit.SensitivePathPattern)) {
+		t.Fatal("builtin reject rule is out of sync with edit.SensitivePathPattern")
+	}
+
+	session := &storageStructs.Chats{ID: 1, DB: db, CurrentAgentConfig: cfgStruct.AgentConfig{}}
+	call := func(key string, value any) []ToolCall {
+		return []ToolCall{{Name: "patch", ID: "p", Parameters: map[string]*any{key: new(value)}}}
+	}
+	diffFor := func(path string) string {
+		return "--- a/" + path + "\n+++ b/" + path + "\n@@ -1 +1 @@\n-a\n+b\n"
+	}
+
+	cases := []struct {
+		name  string
+		calls []ToolCall
+		want  ApprovalDecision
+	}{
+		{"diff normal", call("diff", diffFor("main.go")), DecisionManual},
+		{"diff env", call("diff", diffFor("main.go")+diffFor(".env")), DecisionRejected},
+		{"diff ssh", call("diff", diffFor("home/.ssh/config")), DecisionRejected},
+		{"diff create key", call("diff", "--- /dev/null\n+++ b/certs/server.key\n@@ -0,0 +1 @@\n+k\n"), DecisionRejected},
+		{"edits normal", call("edits", []any{map[string]any{"path": "a.go", "target": "", "text": "x"}}), DecisionManual},
+		{"edits alkaid0", call("edits", []any{
+			map[string]any{"path": "a.go", "target": "", "text": "x"},
+			map[string]any{"path": ".alkaid0/agents/x.md", "target": "", "text": "x"},
+		}), DecisionRejected},
+	}
+	for _, c := range cases {
+		result, err := EvaluateApprovalRules(session, c.calls)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		if result.Decision != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, result.Decision)
+		}
+	}
+}
+
 // TestEvaluateApprovalRules_NilSession 测试空会话
 func TestEvaluateApprovalRules_NilSession(t *testing.T) {
 	result, _ := EvaluateApprovalRules(nil, []ToolCall{{Name: "test", ID: "1"}})
@@ -0,0 +1,502 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/product"
+	"github.com/cxykevin/alkaid0/provider/mask"
+	"github.com/cxykevin/alkaid0/provider/request/structs"
+)
+
+// responsesRequest OpenAI /responses 请求
+type responsesRequest struct {
+	Model              string              `json:"model"`
+	Instructions       string              `json:"instructions,omitempty"`
+	Input              []responsesItem     `json:"input"`
+	Tools              []responsesTool     `json:"tools,omitempty"`
+	ToolChoice         any                 `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	Temperature        *float32            `json:"temperature,omitempty"`
+	TopP               *float32            `json:"top_p,omitempty"`
+	MaxOutputTokens    *int                `json:"max_output_tokens,omitempty"`
+	Reasoning          *responsesReasoning `json:"reasoning,omitempty"`
+	PreviousResponseID string              `json:"previous_response_id,omitempty"`
+	Store              bool                `json:"store"`
+	Stream             bool                `json:"stream"`
+}
+
+// responsesReasoning 推理配置：summary 为 auto 时流式返回推理摘要
+type responsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// responsesTool Responses API 的函数工具（字段平铺，不嵌套 function）
+type responsesTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// responsesItem 输入项：message / function_call / function_call_output
+type responsesItem struct {
+	Type      string `json:"type"`
+	Role      string `json:"role,omitempty"`
+	Content   string `json:"content,omitempty"`
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// responsesEvent 流式事件（各事件类型字段的并集）
+type responsesEvent struct {
+	Type         string `json:"type"`
+	Delta        string `json:"delta"`
+	ItemID       string `json:"item_id"`
+	OutputIndex  int    `json:"output_index"`
+	SummaryIndex int    `json:"summary_index"`
+	Message      string `json:"message"`
+	Item         struct {
+		Type      string `json:"type"`
+		ID        string `json:"id"`
+		CallID    string `json:"call_id"`
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"item"`
+	Response struct {
+		ID                string `json:"id"`
+		Model             string `json:"model"`
+		IncompleteDetails *struct {
+			Reason string `json:"reason"`
+		} `json:"incomplete_details"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Usage *struct {
+			InputTokens        uint32 `json:"input_tokens"`
+			OutputTokens       uint32 `json:"output_tokens"`
+			TotalTokens        uint32 `json:"total_tokens"`
+			InputTokensDetails struct {
+				CachedTokens uint32 `json:"cached_tokens"`
+			} `json:"input_tokens_details"`
+		} `json:"usage"`
+	} `json:"response"`
+}
+
+// responsesChainLimit 链式续写缓存的最大条目数
+const responsesChainLimit = 256
+
+// responsesChain 进程内的 previous_response_id 缓存：
+// 键为一次请求完整输入的摘要，值为该请求的响应 id。按最近使用淘汰
+var responsesChain = struct {
+	sync.Mutex
+	ids   map[string]*list.Element
+	order *list.List
+}{ids: map[string]*list.Element{}, order: list.New()}
+
+type responsesChainEntry struct {
+	key, id string
+}
+
+func chainLookup(key string) (string, bool) {
+	responsesChain.Lock()
+	defer responsesChain.Unlock()
+	el, ok := responsesChain.ids[key]
+	if !ok {
+		return "", false
+	}
+	responsesChain.order.MoveToFront(el)
+	return el.Value.(responsesChainEntry).id, true
+}
+
+func chainStore(key, id string) {
+	responsesChain.Lock()
+	defer responsesChain.Unlock()
+	if el, ok := responsesChain.ids[key]; ok {
+		el.Value = responsesChainEntry{key, id}
+		responsesChain.order.MoveToFront(el)
+		return
+	}
+	responsesChain.ids[key] = responsesChain.order.PushFront(responsesChainEntry{key, id})
+	for responsesChain.order.Len() > responsesChainLimit {
+		el := responsesChain.order.Back()
+		responsesChain.order.Remove(el)
+		delete(responsesChain.ids, el.Value.(responsesChainEntry).key)
+	}
+}
+
+func chainForget(key string) {
+	responsesChain.Lock()
+	defer responsesChain.Unlock()
+	if el, ok := responsesChain.ids[key]; ok {
+		responsesChain.order.Remove(el)
+		delete(responsesChain.ids, key)
+	}
+}
+
+// chainAccount 链式缓存的账号标识：配置了 Key 池时为池本身，轮换 key 不打断续写（跨账号被拒时按完整重发处理）；否则为 key
+func chainAccount(modelCfg *cfgStructs.ModelConfig) string {
+	if _, ok := keyPoolConfig(modelCfg.ProviderURL); ok {
+		return "pool:" + normalizeProviderURL(modelCfg.ProviderURL)
+	}
+	return modelCfg.ProviderKey
+}
+
+// chainKeys 计算输入前缀摘要：keys[n] 对应前 n 条消息。摘要包含地址、账号与模型，避免跨账号复用响应 id
+func chainKeys(modelCfg *cfgStructs.ModelConfig, model string, messages []structs.Message) []string {
+	h := sha256.Sum256([]byte(strings.Join([]string{modelCfg.ProviderURL, chainAccount(modelCfg), model}, "\x00")))
+	keys := make([]string, len(messages)+1)
+	keys[0] = hex.EncodeToString(h[:])
+	for i, m := range messages {
+		data, _ := json.Marshal(m)
+		h = sha256.Sum256(append(h[:], data...))
+		keys[i+1] = hex.EncodeToString(h[:])
+	}
+	return keys
+}
+
+// SimpleResponsesRequest 发送 OpenAI /responses 流式请求，事件转换为 OpenAI ChatCompletion 增量回调。
+// 开启 ResponsesChaining 时，若历史前缀与之前某次请求的完整输入一致，则以 previous_response_id 续写，只发送其后的新消息。
+func SimpleResponsesRequest(ctx context.Context, modelCfg *cfgStructs.ModelConfig, body structs.ChatCompletionRequest, masker *mask.Engine, callback func(structs.ChatCompletionResponse) error) error {
+	if masker != nil {
+		body.Messages = masker.MaskMessages(body.Messages)
+	}
+	return doResponsesRequest(ctx, modelCfg, body, masker, callback, true)
+}
+
+// doResponsesRequest 发送一次 /responses 请求；allowPrev 为 false 时不引用之前的响应（链被上游拒绝后的完整重发）
+func doResponsesRequest(ctx context.Context, modelCfg *cfgStructs.ModelConfig, body structs.ChatCompletionRequest, masker *mask.Engine, callback func(structs.ChatCompletionResponse) error, allowPrev bool) error {
+	endpoint := strings.TrimRight(modelCfg.ProviderURL, "/") + ResponsesEndpoint
+	logger.Info("call openai responses: %s", endpoint)
+
+	reqBody := buildResponsesRequest(modelCfg, body)
+	instructionCount := leadingSystemCount(body.Messages)
+	history := body.Messages[instructionCount:]
+	chain := modelCfg.ProviderSpecificConfig.ResponsesChaining
+	var keys []string
+	prevKey := ""
+	if chain {
+		reqBody.Store = true
+		keys = chainKeys(modelCfg, reqBody.Model, history)
+	}
+	if chain && allowPrev {
+		// 从最长前缀向前找：history[n] 须为上次的模型输出，且其后仍有新消息
+		for n := len(history) - 2; n > 0; n-- {
+			if history[n].Role != structs.RoleAssistant {
+				continue
+			}
+			if id, ok := chainLookup(keys[n]); ok {
+				reqBody.PreviousResponseID = id
+				reqBody.Input = convertResponsesInput(history[n+1:])
+				prevKey = keys[n]
+				logger.Debug("responses chain: previous_response_id=%s, skip %d messages", id, n+1)
+				break
+			}
+		}
+	}
+
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		logger.Error("call openai responses error when marshal: %v", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		logger.Error("call openai responses error when create request: %v", err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+modelCfg.ProviderKey)
+	req.Header.Set("User-Agent", product.UserAgent)
+
+	release, err := limiterFor(modelCfg.ProviderURL, modelCfg.ProviderKey).acquire(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		release(0, nil, nil)
+		logger.Error("call openai responses error when call: %v", err)
+		return fmt.Errorf("failed to send request when call: %w", err)
+	}
+	defer resp.Body.Close()
+	defer recordExchange(ctx, ResponsesEndpoint, payload, resp)()
+
+	// 同 SimpleOpenAIRequest：取消时主动关闭 body 以中断阻塞的读取
+	responseDone := make(chan struct{})
+	defer close(responseDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			resp.Body.Close()
+		case <-responseDone:
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		wait := release(resp.StatusCode, resp.Header, respBody)
+		var errResp structs.ErrorResponse
+		if err := json.Unmarshal(respBody, &errResp); err != nil {
+			logger.Error("call openai responses error when unmarshal: %v", err)
+			if wait > 0 {
+				return &RateLimitError{Status: resp.StatusCode, Wait: wait, Msg: http.StatusText(resp.StatusCode)}
+			}
+			if isKeyRejected(resp.StatusCode) {
+				return &KeyRejectedError{Status: resp.StatusCode, Msg: http.StatusText(resp.StatusCode)}
+			}
+			return fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		if wait > 0 {
+			return &RateLimitError{Status: resp.StatusCode, Wait: wait, Msg: errResp.Error.Message}
+		}
+		if isKeyRejected(resp.StatusCode) {
+			return &KeyRejectedError{Status: resp.StatusCode, Msg: errResp.Error.Message}
+		}
+		// 上游已丢弃被引用的响应（过期或 store 被关闭）：作废缓存并完整重发
+		if prevKey != "" && resp.StatusCode < http.StatusInternalServerError {
+			logger.Warn("responses chain rejected (%d %s), resend full history", resp.StatusCode, errResp.Error.Message)
+			chainForget(prevKey)
+			return doResponsesRequest(ctx, modelCfg, body, masker, callback, false)
+		}
+		logger.Error("call openai responses error when check stat %v", resp.StatusCode)
+		return fmt.Errorf("API error: %d %s", resp.StatusCode, errResp.Error.Message)
+	}
+	release(resp.StatusCode, resp.Header, nil)
+
+	conv := responsesConverter{indexes: map[string]int{}, argsSeen: map[int]bool{}}
+	reader := bufio.NewReader(resp.Body)
+	var dataLines []string
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to read response: %w", readErr)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if after, ok := strings.CutPrefix(line, "data:"); ok {
+			dataLines = append(dataLines, strings.TrimPrefix(after, " "))
+		}
+		if (line == "" || readErr == io.EOF) && len(dataLines) > 0 {
+			data := strings.Join(dataLines, "\n")
+			dataLines = dataLines[:0]
+			var event responsesEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				return fmt.Errorf("failed to unmarshal response: %w", err)
+			}
+			chatResp, done, err := conv.convert(&event)
+			if err != nil {
+				return err
+			}
+			if chatResp != nil {
+				if err := restoreChatResponse(chatResp, masker); err != nil {
+					return err
+				}
+				if err := callback(*chatResp); err != nil {
+					return fmt.Errorf("callback error: %w", err)
+				}
+			}
+			if done {
+				if chain && conv.id != "" {
+					chainStore(keys[len(history)], conv.id)
+				}
+				return finishMaskRestore(masker, callback)
+			}
+		}
+		if readErr == io.EOF {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// leadingSystemCount 开头连续的 system 消息数，这些消息合并为 instructions（不随 previous_response_id 继承，每次都需发送）
+func leadingSystemCount(messages []structs.Message) int {
+	n := 0
+	for n < len(messages) && messages[n].Role == structs.RoleSystem {
+		n++
+	}
+	return n
+}
+
+// buildResponsesRequest 把 build.Build 生成的 ChatCompletion 请求转换为 /responses 请求
+func buildResponsesRequest(modelCfg *cfgStructs.ModelConfig, body structs.ChatCompletionRequest) responsesRequest {
+	model := body.Model
+	if model == "" {
+		model = modelCfg.ModelID
+	}
+	n := leadingSystemCount(body.Messages)
+	instructions := make([]string, 0, n)
+	for _, m := range body.Messages[:n] {
+		instructions = append(instructions, m.Content)
+	}
+	req := responsesRequest{
+		Model:             model,
+		Instructions:      strings.Join(instructions, "\n\n"),
+		Input:             convertResponsesInput(body.Messages[n:]),
+		ToolChoice:        body.ToolChoice,
+		ParallelToolCalls: body.ParallelToolCalls,
+		Temperature:       body.Temperature,
+		TopP:              body.TopP,
+		MaxOutputTokens:   body.MaxCompletionTokens,
+		Stream:            true,
+	}
+	if req.MaxOutputTokens == nil {
+		req.MaxOutputTokens = body.MaxTokens
+	}
+	for _, t := range body.Tools {
+		req.Tools = append(req.Tools, responsesTool{
+			Type:        "function",
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  t.Function.Parameters,
+		})
+	}
+	if modelCfg.EnableThinking {
+		req.Reasoning = &responsesReasoning{Summary: "auto"}
+		if body.ReasoningEffort != nil {
+			req.Reasoning.Effort = *body.ReasoningEffort
+		}
+	}
+	return req
+}
+
+// convertResponsesInput 转换历史：assistant 的工具调用拆为 function_call 项，工具结果为 function_call_output 项，
+// 中途的 system 消息以 developer 角色发送
+func convertResponsesInput(messages []structs.Message) []responsesItem {
+	items := make([]responsesItem, 0, len(messages))
+	for _, m := range messages {
+		switch m.Role {
+		case structs.RoleTool:
+			items = append(items, responsesItem{Type: "function_call_output", CallID: m.ToolCallID, Output: m.Content})
+		case structs.RoleAssistant:
+			if m.Content != "" {
+				items = append(items, responsesItem{Type: "message", Role: structs.RoleAssistant, Content: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				if tc.Function == nil {
+					continue
+				}
+				items = append(items, responsesItem{Type: "function_call", CallID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+			}
+		case structs.RoleSystem:
+			items = append(items, responsesItem{Type: "message", Role: "developer", Content: m.Content})
+		default:
+			items = append(items, responsesItem{Type: "message", Role: m.Role, Content: m.Content})
+		}
+	}
+	return items
+}
+
+// responsesConverter 把流式事件转换为 ChatCompletion 增量，按 function_call 出现顺序分配工具调用 index
+type responsesConverter struct {
+	id, model string
+	indexes   map[string]int // 输出项 id → 工具调用 index
+	argsSeen  map[int]bool   // 已收到参数增量的工具调用
+}
+
+// convert 返回待派发的增量（nil 为无需派发）与流是否结束
+func (c *responsesConverter) convert(event *responsesEvent) (*structs.ChatCompletionResponse, bool, error) {
+	if event.Response.ID != "" {
+		c.id = event.Response.ID
+	}
+	if event.Response.Model != "" {
+		c.model = event.Response.Model
+	}
+	delta := structs.Message{Role: structs.RoleAssistant}
+	finish := ""
+	var usage *structs.Usage
+
+	switch event.Type {
+	case "response.output_text.delta", "response.refusal.delta":
+		delta.Content = event.Delta
+	case "response.reasoning_summary_text.delta":
+		delta.ReasoningContent = &event.Delta
+	case "response.reasoning_summary_part.added":
+		if event.SummaryIndex == 0 {
+			return nil, false, nil
+		}
+		sep := "\n\n"
+		delta.ReasoningContent = &sep
+	case "response.output_item.added":
+		if event.Item.Type != "function_call" {
+			return nil, false, nil
+		}
+		index := len(c.indexes)
+		c.indexes[event.Item.ID] = index
+		delta.ToolCalls = []structs.StreamToolCall{{
+			Index: index, ID: event.Item.CallID, Type: "function",
+			Function: &structs.StreamToolCallFunc{Name: event.Item.Name, Arguments: event.Item.Arguments},
+		}}
+		c.argsSeen[index] = event.Item.Arguments != ""
+	case "response.function_call_arguments.delta":
+		index, ok := c.indexes[event.ItemID]
+		if !ok {
+			return nil, false, nil
+		}
+		c.argsSeen[index] = true
+		delta.ToolCalls = []structs.StreamToolCall{{Index: index, Function: &structs.StreamToolCallFunc{Arguments: event.Delta}}}
+	case "response.output_item.done":
+		// 未以增量下发参数的调用在完成时一次性补齐
+		index, ok := c.indexes[event.Item.ID]
+		if event.Item.Type != "function_call" || !ok || c.argsSeen[index] || event.Item.Arguments == "" {
+			return nil, false, nil
+		}
+		c.argsSeen[index] = true
+		delta.ToolCalls = []structs.StreamToolCall{{Index: index, Function: &structs.StreamToolCallFunc{Arguments: event.Item.Arguments}}}
+	case "response.completed", "response.incomplete":
+		finish = "stop"
+		if d := event.Response.IncompleteDetails; d != nil {
+			finish = "length"
+			if d.Reason == "content_filter" {
+				finish = "content_filter"
+			}
+		}
+		if len(c.indexes) > 0 && finish == "stop" {
+			finish = "tool_calls"
+		}
+		if u := event.Response.Usage; u != nil {
+			usage = &structs.Usage{
+				PromptTokens:     u.InputTokens,
+				CompletionTokens: u.OutputTokens,
+				TotalTokens:      u.TotalTokens,
+				CachedTokens:     u.InputTokensDetails.CachedTokens,
+			}
+		}
+	case "response.failed":
+		msg := "response failed"
+		if e := event.Response.Error; e != nil && e.Message != "" {
+			msg = e.Message
+		}
+		return nil, false, fmt.Errorf("API error: %s", msg)
+	case "error":
+		return nil, false, fmt.Errorf("API error: %s", event.Message)
+	default:
+		return nil, false, nil
+	}
+	return &structs.ChatCompletionResponse{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Model:   c.model,
+		Choices: []structs.Choice{{Delta: delta, FinishReason: finish}},
+		Usage:   usage,
+	}, finish != "", nil
+}
@@ -0,0 +1,252 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/provider/request/structs"
+)
+
+// responsesSSE 以 Responses API 的 SSE 格式写出事件
+func responsesSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, e := range events {
+		var head struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal([]byte(e), &head)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", head.Type, e)
+	}
+}
+
+func responsesTestConfig(url string, chaining bool) cfgStructs.ModelConfig {
+	cfg := cfgStructs.BuildDefault(cfgStructs.ModelConfig{})
+	cfg.ProviderType = cfgStructs.ProviderTypeResponses
+	cfg.ProviderURL = url
+	cfg.ProviderKey = "sk-test"
+	cfg.ModelID = "gpt-5"
+	cfg.EnableThinking = true
+	cfg.ProviderSpecificConfig.ResponsesChaining = chaining
+	return cfg
+}
+
+func TestSimpleResponsesRequest(t *testing.T) {
+	var got responsesRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != ResponsesEndpoint {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &got)
+		responsesSSE(w,
+			`{"type":"response.created","response":{"id":"resp_1","model":"gpt-5"}}`,
+			`{"type":"response.reasoning_summary_part.added","summary_index":0}`,
+			`{"type":"response.reasoning_summary_text.delta","delta":"plan"}`,
+			`{"type":"response.reasoning_summary_part.added","summary_index":1}`,
+			`{"type":"response.reasoning_summary_text.delta","delta":"more"}`,
+			`{"type":"response.output_text.delta","delta":"Hello"}`,
+			`{"type":"response.output_item.added","output_index":2,"item":{"type":"function_call","id":"fc_1","call_id":"call_a","name":"run","arguments":""}}`,
+			`{"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"{\"cmd\":"}`,
+			`{"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"\"ls\"}"}`,
+			`{"type":"response.output_item.added","output_index":3,"item":{"type":"function_call","id":"fc_2","call_id":"call_b","name":"pwd","arguments":""}}`,
+			`{"type":"response.output_item.done","output_index":3,"item":{"type":"function_call","id":"fc_2","call_id":"call_b","name":"pwd","arguments":"{}"}}`,
+			`{"type":"response.completed","response":{"id":"resp_1","usage":{"input_tokens":20,"output_tokens":7,"total_tokens":27,"input_tokens_details":{"cached_tokens":4}}}}`,
+		)
+	}))
+	defer srv.Close()
+
+	cfg := responsesTestConfig(srv.URL+"/", false)
+	effort := "medium"
+	maxTokens := 512
+	body := structs.ChatCompletionRequest{
+		ReasoningEffort: &effort,
+		MaxTokens:       &maxTokens,
+		Tools: []structs.Tool{{Type: "function", Function: structs.ToolFunction{
+			Name: "run", Description: "run a command", Parameters: json.RawMessage(`{"type":"object"}`),
+		}}},
+		Messages: []structs.Message{
+			{Role: structs.RoleSystem, Content: "sys A"},
+			{Role: structs.RoleSystem, Content: "sys B"},
+			{Role: structs.RoleUser, Content: "hi"},
+			{Role: structs.RoleAssistant, Content: "calling", ToolCalls: []structs.StreamToolCall{{
+				ID: "call_0", Type: "function", Function: &structs.StreamToolCallFunc{Name: "run", Arguments: `{"cmd":"pwd"}`},
+			}}},
+			{Role: structs.RoleTool, ToolCallID: "call_0", Content: "/root"},
+		},
+	}
+
+	type call struct{ id, name, args string }
+	var calls []call
+	var text, thinking, finish string
+	var usage *structs.Usage
+	err := ChatRequest(context.Background(), &cfg, body, nil, func(resp structs.ChatCompletionResponse) error {
+		delta := resp.Choices[0].Delta
+		text += delta.Content
+		if delta.ReasoningContent != nil {
+			thinking += *delta.ReasoningContent
+		}
+		for _, tc := range delta.ToolCalls {
+			for len(calls) <= tc.Index {
+				calls = append(calls, call{})
+			}
+			c := &calls[tc.Index]
+			c.id += tc.ID
+			c.name += tc.Function.Name
+			c.args += tc.Function.Arguments
+		}
+		if resp.Choices[0].FinishReason != "" {
+			finish = resp.Choices[0].FinishReason
+		}
+		if resp.Usage != nil {
+			usage = resp.Usage
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatRequest failed: %v", err)
+	}
+
+	// 请求转换
+	if got.Model != "gpt-5" || got.Instructions != "sys A\n\nsys B" || !got.Stream || got.Store || got.PreviousResponseID != "" {
+		t.Errorf("unexpected request: %+v", got)
+	}
+	if got.Reasoning == nil || got.Reasoning.Effort != "medium" || got.Reasoning.Summary != "auto" || got.MaxOutputTokens == nil || *got.MaxOutputTokens != 512 {
+		t.Errorf("unexpected reasoning/max tokens: %+v", got)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Name != "run" || got.Tools[0].Type != "function" {
+		t.Errorf("unexpected tools: %+v", got.Tools)
+	}
+	wantInput := []responsesItem{
+		{Type: "message", Role: "user", Content: "hi"},
+		{Type: "message", Role: "assistant", Content: "calling"},
+		{Type: "function_call", CallID: "call_0", Name: "run", Arguments: `{"cmd":"pwd"}`},
+		{Type: "function_call_output", CallID: "call_0", Output: "/root"},
+	}
+	if fmt.Sprint(got.Input) != fmt.Sprint(wantInput) {
+		t.Errorf("input = %+v, want %+v", got.Input, wantInput)
+	}
+
+	// 响应转换
+	if text != "Hello" || thinking != "plan\n\nmore" {
+		t.Errorf("text=%q thinking=%q", text, thinking)
+	}
+	if len(calls) != 2 || calls[0].id != "call_a" || calls[0].args != `{"cmd":"ls"}` || calls[1].name != "pwd" || calls[1].args != "{}" {
+		t.Errorf("unexpected tool calls: %+v", calls)
+	}
+	if finish != "tool_calls" {
+		t.Errorf("finish = %q, want tool_calls", finish)
+	}
+	if usage == nil || usage.PromptTokens != 20 || usage.CompletionTokens != 7 || usage.CachedTokens != 4 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestSimpleResponsesRequest_Chaining(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []responsesRequest
+		reject   bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req responsesRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		n := len(requests)
+		rejectNow := reject && req.PreviousResponseID != ""
+		mu.Unlock()
+		if rejectNow {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"message":"Previous response not found","type":"invalid_request_error"}}`)
+			return
+		}
+		responsesSSE(w,
+			fmt.Sprintf(`{"type":"response.created","response":{"id":"resp_%d"}}`, n),
+			`{"type":"response.output_text.delta","delta":"ok"}`,
+			fmt.Sprintf(`{"type":"response.completed","response":{"id":"resp_%d"}}`, n),
+		)
+	}))
+	defer srv.Close()
+
+	cfg := responsesTestConfig(srv.URL, true)
+	send := func(messages ...structs.Message) {
+		t.Helper()
+		err := ChatRequest(context.Background(), &cfg, structs.ChatCompletionRequest{Messages: messages}, nil, func(structs.ChatCompletionResponse) error { return nil })
+		if err != nil {
+			t.Fatalf("ChatRequest failed: %v", err)
+		}
+	}
+	sys := structs.Message{Role: structs.RoleSystem, Content: "sys"}
+	u1 := structs.Message{Role: structs.RoleUser, Content: "first"}
+	a1 := structs.Message{Role: structs.RoleAssistant, Content: "ok"}
+	u2 := structs.Message{Role: structs.RoleUser, Content: "second"}
+	a2 := structs.Message{Role: structs.RoleAssistant, Content: "ok"}
+	u3 := structs.Message{Role: structs.RoleUser, Content: "third"}
+
+	send(sys, u1)
+	// system 变化不影响续写：instructions 每次都完整发送
+	send(structs.Message{Role: structs.RoleSystem, Content: "sys changed"}, u1, a1, u2)
+	if len(requests) != 2 || !requests[1].Store || requests[1].PreviousResponseID != "resp_1" ||
+		len(requests[1].Input) != 1 || requests[1].Input[0].Content != "second" || requests[1].Instructions != "sys changed" {
+		t.Fatalf("second request should chain on resp_1: %+v", requests[1])
+	}
+
+	// 上游拒绝续写时作废缓存并完整重发
+	mu.Lock()
+	reject = true
+	mu.Unlock()
+	send(sys, u1, a1, u2, a2, u3)
+	if len(requests) != 4 || requests[2].PreviousResponseID != "resp_2" || requests[3].PreviousResponseID != "" || len(requests[3].Input) != 5 {
+		t.Fatalf("rejected chain should resend full history: %+v", requests[2:])
+	}
+}
+
+func TestSimpleResponsesRequest_ChainingAcrossKeyPool(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []responsesRequest
+		keys     []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req responsesRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		keys = append(keys, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		n := len(requests)
+		mu.Unlock()
+		responsesSSE(w,
+			fmt.Sprintf(`{"type":"response.created","response":{"id":"resp_%d"}}`, n),
+			`{"type":"response.output_text.delta","delta":"ok"}`,
+			fmt.Sprintf(`{"type":"response.completed","response":{"id":"resp_%d"}}`, n),
+		)
+	}))
+	defer srv.Close()
+	setupKeyPool(t, srv.URL, cfgStructs.KeyPoolConfig{Keys: []string{"chain-key-a", "chain-key-b"}})
+
+	cfg := responsesTestConfig(srv.URL, true)
+	u1 := structs.Message{Role: structs.RoleUser, Content: "first"}
+	a1 := structs.Message{Role: structs.RoleAssistant, Content: "ok"}
+	u2 := structs.Message{Role: structs.RoleUser, Content: "second"}
+	for _, messages := range [][]structs.Message{{u1}, {u1, a1, u2}} {
+		err := ChatRequest(context.Background(), &cfg, structs.ChatCompletionRequest{Messages: messages}, nil, func(structs.ChatCompletionResponse) error { return nil })
+		if err != nil {
+			t.Fatalf("ChatRequest failed: %v", err)
+		}
+	}
+	if len(keys) != 2 || keys[0] == keys[1] {
+		t.Fatalf("expected the pool to rotate keys, got %v", keys)
+	}
+	if requests[1].PreviousResponseID != "resp_1" || len(requests[1].Input) != 1 {
+		t.Fatalf("key rotation should not break the chain: %+v", requests[1])
+	}
+}
@@ -41,7 +41,7 @@ func Summary(ctx context.Context, db *gorm.DB, chatID uint32, agentID string) (s
 
 	// 获取模型信息
 	resp := strings.Builder{}
-	err = SimpleOpenAIRequest(ctxn, modelConfig.ProviderURL, modelConfig.ProviderKey, modelConfig.ModelID, *obj, mask.NewEngine(db), func(ret structs.ChatCompletionResponse) error {
+	err = ChatRequest(ctxn, modelConfig, *obj, mask.NewEngine(db), func(ret structs.ChatCompletionResponse) error {
 		if len(ret.Choices) == 0 {
 			return nil
 		}
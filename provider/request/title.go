@@ -55,7 +55,7 @@ func titleRequest(ctx context.Context, db *gorm.DB, chatID uint32, full bool) (s
 
 	// 获取模型信息
 	resp := strings.Builder{}
-	err = SimpleOpenAIRequest(ctxn, modelConfig.ProviderURL, modelConfig.ProviderKey, modelConfig.ModelID, *obj, mask.NewEngine(db), func(ret structs.ChatCompletionResponse) error {
+	err = ChatRequest(ctxn, modelConfig, *obj, mask.NewEngine(db), func(ret structs.ChatCompletionResponse) error {
 		if len(ret.Choices) == 0 {
 			return nil
 		}
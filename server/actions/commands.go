@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/cxykevin/alkaid0/provider/mask"
 	"github.com/cxykevin/alkaid0/provider/phrase"
 	"github.com/cxykevin/alkaid0/stats"
+	"github.com/cxykevin/alkaid0/storage/structs"
 	"github.com/cxykevin/alkaid0/ui/funcs"
 	u "github.com/cxykevin/alkaid0/utils"
 )
@@ -62,6 +64,18 @@ var commandMaps = map[string]*cmdObj{
 			return true, nil
 		},
 	},
+	"/context": {
+		Description: "Show the estimated token usage of each part of the next request without sending it",
+		Hint:        "(no args)",
+		Function: func(obj *sessionObj, _ string) (bool, error) {
+			report, err := funcs.InspectContext(obj.session)
+			if err != nil {
+				return false, err
+			}
+			broadcastCmdText(obj, formatContext(report))
+			return false, nil
+		},
+	},
 	"/feedback": {
 		Description: "Submit feedback to the feedback server",
 		Hint:        "<feedback content>",
@@ -94,6 +108,20 @@ var commandMaps = map[string]*cmdObj{
 			}
 		},
 	},
+	"/models": {
+		Description: "Discover models on a local Ollama or llama.cpp server and print ready-to-use model config",
+		Hint:        "ollama|llamacpp [url]",
+		Function: func(obj *sessionObj, arg string) (bool, error) {
+			return false, modelsCommand(obj, arg)
+		},
+	},
+	"/notify": {
+		Description: "Turn state notifications (webhook/command from Notify config) on/off for this session, or show the current setting",
+		Hint:        "on|off (no args to show)",
+		Function: func(obj *sessionObj, arg string) (bool, error) {
+			return notifyCommand(obj, arg)
+		},
+	},
 	"/index": {
 		Description: "Build codebase index (extract LSP symbols → submit embedding tasks). Subcommands: clean (clear db), status (show progress), cancel (stop running index), lsp-reset (reset LSP fail counters)",
 		Hint:        "(no args) or 'clean' | 'status' | 'cancel' | 'lsp-reset'",
@@ -176,17 +204,61 @@ var commandMaps = map[string]*cmdObj{
 			return true, nil
 		},
 	},
+	"/pin": {
+		Description: "Pin a message so it survives context compression verbatim, unpin it with del, or list pinned messages",
+		Hint:        "(no args) | <messageId> | del <messageId>",
+		Function: func(obj *sessionObj, arg string) (bool, error) {
+			fields := strings.Fields(arg)
+			if len(fields) == 0 {
+				msgs, err := funcs.GetPinnedMessages(obj.session)
+				if err != nil {
+					return false, err
+				}
+				broadcastCmdText(obj, formatPinned(msgs))
+				return false, nil
+			}
+			pinned := true
+			if fields[0] == "del" {
+				pinned = false
+				fields = fields[1:]
+			}
+			if len(fields) != 1 {
+				return false, fmt.Errorf("Usage: /pin <messageId> | /pin del <messageId>")
+			}
+			id, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "msg_"), 10, 64)
+			if err != nil {
+				return false, fmt.Errorf("invalid messageId %q", fields[0])
+			}
+			if err := funcs.PinMessage(obj.session, id, pinned); err != nil {
+				return false, err
+			}
+			if pinned {
+				broadcastCmdText(obj, fmt.Sprintf("**pinned**: `%s` 会在上下文压缩后原样保留。", msgID(id)))
+			} else {
+				broadcastCmdText(obj, fmt.Sprintf("**unpinned**: `%s`", msgID(id)))
+			}
+			return false, nil
+		},
+	},
 	"/mask": {
-		Description: "Manage custom mask values — add <value> masks a value outbound and restores it in the response, del <value> stops masking it",
-		Hint:        "add <value> | del <value>",
+		Description: "Manage data masking — list shows masked values with hit statistics, add <value> masks a value outbound and restores it in the response, del <value> stops masking it",
+		Hint:        "list | add <value> | del <value>",
 		Function: func(obj *sessionObj, arg string) (bool, error) {
+			if strings.TrimSpace(arg) == "list" {
+				report, err := mask.BuildReport(obj.session.DB)
+				if err != nil {
+					return false, err
+				}
+				broadcastCmdText(obj, formatMaskReport(report))
+				return false, nil
+			}
 			parts := strings.SplitN(strings.TrimSpace(arg), " ", 2)
 			if len(parts) != 2 {
-				return false, fmt.Errorf("Usage: /mask add <value> | /mask del <value>")
+				return false, fmt.Errorf("Usage: /mask list | /mask add <value> | /mask del <value>")
 			}
 			op, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 			if val == "" {
-				return false, fmt.Errorf("Usage: /mask add <value> | /mask del <value>")
+				return false, fmt.Errorf("Usage: /mask list | /mask add <value> | /mask del <value>")
 			}
 			var (
 				msg string
@@ -204,7 +276,7 @@ var commandMaps = map[string]*cmdObj{
 					msg = fmt.Sprintf("**mask removed**: `%s` 不再脱敏。", val)
 				}
 			default:
-				return false, fmt.Errorf("unknown operation %q, usage: add | del", op)
+				return false, fmt.Errorf("unknown operation %q, usage: list | add | del", op)
 			}
 			if err != nil {
 				return false, err
@@ -258,7 +330,7 @@ var commandMaps = map[string]*cmdObj{
 		},
 	},
 	"/usage": {
-		Description: "Show global token usage statistics, or reset them",
+		Description: "Show global and session token usage and cost, or reset global statistics",
 		Hint:        "(no args) | reset",
 		Function: func(obj *sessionObj, arg string) (bool, error) {
 			if strings.TrimSpace(arg) == "reset" {
@@ -271,7 +343,15 @@ var commandMaps = map[string]*cmdObj{
 				broadcastCmdText(obj, msg)
 				return false, nil
 			}
-			broadcastCmdText(obj, formatUsage(stats.Snapshot()))
+			text := formatUsage(usageSnapshot())
+			if obj.session != nil && obj.session.DB != nil {
+				if cost, err := stats.ComputeSessionCost(obj.session.DB, obj.session.ID); err == nil {
+					text += "\n" + formatSessionCost(cost)
+				} else {
+					logger.Warn("compute session cost in ID=%d: %v", obj.session.ID, err)
+				}
+			}
+			broadcastCmdText(obj, text)
 			return false, nil
 		},
 	},
@@ -304,6 +384,26 @@ var commandMaps = map[string]*cmdObj{
 	},
 }
 
+// pinPreviewRunes /pin 列表中每条消息预览的最大字符数
+const pinPreviewRunes = 80
+
+// formatPinned 渲染固定消息列表，每条展示 messageId 与首行预览
+func formatPinned(msgs []structs.Messages) string {
+	if len(msgs) == 0 {
+		return "No pinned messages."
+	}
+	var b strings.Builder
+	b.WriteString("**Pinned messages:**\n")
+	for _, m := range msgs {
+		preview, _, _ := strings.Cut(strings.TrimSpace(m.Delta), "\n")
+		if r := []rune(preview); len(r) > pinPreviewRunes {
+			preview = string(r[:pinPreviewRunes]) + "…"
+		}
+		b.WriteString(fmt.Sprintf("  - `%s`: %s\n", msgID(m.ID), preview))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
 func init() {
 	commandMaps["/help"] = &cmdObj{
 		Description: "Show this help message",
@@ -1,10 +1,13 @@
 package actions
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/cxykevin/alkaid0/prompts"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	u "github.com/cxykevin/alkaid0/utils"
 )
 
 // TestInitCommandRegistered 验证 /init 命令已注册且字段完整。
@@ -57,3 +60,38 @@ func TestFeedbackCommandRegistered(t *testing.T) {
 		t.Error("/feedback command has nil Function")
 	}
 }
+
+// TestPinCommand 验证 /pin 固定、列出与取消固定消息
+func TestPinCommand(t *testing.T) {
+	dir, db, ids := newSessionListDB(t, 1)
+	sess := &structs.Chats{ID: ids[0], DB: db}
+	msg := structs.Messages{ChatID: ids[0], Type: structs.MessagesRoleUser, Delta: "keep this error\nsecond line"}
+	if err := db.Create(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+	obj := &sessionObj{cwd: dir, id: ids[0], session: sess}
+
+	collectCommandBroadcasts(t, obj, "/pin", msgID(msg.ID))
+	db.First(&msg, msg.ID)
+	if !msg.Pinned {
+		t.Fatal("message should be pinned")
+	}
+
+	updates := collectCommandBroadcasts(t, obj, "/pin", "")
+	text, _ := updates[len(updates)-1].Update.(SessionUpdateUpdate).Content.(u.H)["text"].(string)
+	if !strings.Contains(text, msgID(msg.ID)) || !strings.Contains(text, "keep this error") || strings.Contains(text, "second line") {
+		t.Fatalf("unexpected pinned list: %q", text)
+	}
+
+	collectCommandBroadcasts(t, obj, "/pin", fmt.Sprintf("del %d", msg.ID))
+	db.First(&msg, msg.ID)
+	if msg.Pinned {
+		t.Fatal("message should be unpinned")
+	}
+
+	for _, bad := range []string{"abc", "999999", "del"} {
+		if _, err := commandMaps["/pin"].Function(obj, bad); err == nil {
+			t.Errorf("/pin %q should fail", bad)
+		}
+	}
+}
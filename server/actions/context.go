@@ -0,0 +1,54 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cxykevin/alkaid0/provider/request/build"
+	"github.com/cxykevin/alkaid0/ui/funcs"
+)
+
+// SessionContextRequest 查询会话上下文构成的请求。
+type SessionContextRequest struct {
+	SessionID string `json:"sessionId"`
+}
+
+// SessionContext 构建会话的下一次请求但不发送，返回各组成部分的 token 估算。
+// 私有 ACP 方法：alk.cxykevin.top/session/context。
+func SessionContext(req SessionContextRequest, _ func(string, any, *string) error, _ uint64) (build.ContextReport, error) {
+	if req.SessionID == "" {
+		return build.ContextReport{}, fmt.Errorf("sessionId is empty")
+	}
+	sessLock.Lock()
+	sessObj, ok := sessions[req.SessionID]
+	sessLock.Unlock()
+	if !ok || sessObj.session == nil || sessObj.session.DB == nil {
+		return build.ContextReport{}, fmt.Errorf("session not found")
+	}
+	report, err := funcs.InspectContext(sessObj.session)
+	if err != nil {
+		return build.ContextReport{}, err
+	}
+	return *report, nil
+}
+
+// formatContext 把上下文构成渲染成 markdown 文本，供 /context 命令展示。
+func formatContext(report *build.ContextReport) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("**Context** (%s, estimated):\n", report.ModelName))
+	b.WriteString(fmt.Sprintf("  - Total: %d tokens", report.Total))
+	if report.CompressSize > 0 {
+		b.WriteString(fmt.Sprintf(" (%.1f%% of compress size %d)", float64(report.Total)*100/float64(report.CompressSize), report.CompressSize))
+	}
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf("  - System prompt: %d\n", report.System))
+	b.WriteString(fmt.Sprintf("  - Scopes: %d\n", report.Scopes))
+	for _, item := range report.PreHooks {
+		b.WriteString(fmt.Sprintf("  - PreHook %s: %d\n", item.Name, item.Tokens))
+	}
+	b.WriteString(fmt.Sprintf("  - Tools: %d (%d tools)\n", report.Tools, len(report.ToolItems)))
+	b.WriteString(fmt.Sprintf("  - Traced files: %d\n", report.Traced))
+	b.WriteString(fmt.Sprintf("  - Summary: %d\n", report.Summary))
+	b.WriteString(fmt.Sprintf("  - History: %d (%d messages)\n", report.History, report.Messages))
+	return strings.TrimSuffix(b.String(), "\n")
+}
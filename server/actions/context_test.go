@@ -0,0 +1,61 @@
+package actions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	u "github.com/cxykevin/alkaid0/utils"
+)
+
+func TestSessionContext(t *testing.T) {
+	defer configSetup(t)()
+	*config.GlobalConfig = cfgStructs.Config{
+		Model: cfgStructs.ModelsConfig{
+			DefaultModelID: 1,
+			Models: map[int32]cfgStructs.ModelConfig{
+				1: {ModelName: "Context", ModelID: "context-model", CompressSize: 1000},
+			},
+		},
+	}
+
+	if _, err := SessionContext(SessionContextRequest{}, nil, 1); err == nil {
+		t.Fatal("empty sessionId should fail")
+	}
+	if _, err := SessionContext(SessionContextRequest{SessionID: "missing"}, nil, 1); err == nil {
+		t.Fatal("unknown session should fail")
+	}
+
+	dir, db, ids := newSessionListDB(t, 1)
+	sessionID := cwd2SessionID(dir, ids[0])
+	sess := &structs.Chats{ID: ids[0], DB: db, InTestFlag: true}
+	obj := &sessionObj{cwd: dir, id: ids[0], session: sess}
+	sessLock.Lock()
+	sessions[sessionID] = obj
+	sessLock.Unlock()
+	t.Cleanup(func() {
+		sessLock.Lock()
+		delete(sessions, sessionID)
+		sessLock.Unlock()
+	})
+	db.Create(&[]structs.Messages{
+		{ChatID: ids[0], Type: structs.MessagesRoleUser, Delta: "hello"},
+		{ChatID: ids[0], Type: structs.MessagesRoleAgent, Delta: "hi there"},
+	})
+
+	report, err := SessionContext(SessionContextRequest{SessionID: sessionID}, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ModelName != "Context" || report.CompressSize != 1000 || report.Messages != 2 || report.System <= 0 {
+		t.Fatalf("unexpected context report: %+v", report)
+	}
+
+	updates := collectCommandBroadcasts(t, obj, "/context", "")
+	text, _ := updates[len(updates)-1].Update.(SessionUpdateUpdate).Content.(u.H)["text"].(string)
+	if !strings.Contains(text, "of compress size 1000") || !strings.Contains(text, "History:") || !strings.Contains(text, "(2 messages)") {
+		t.Fatalf("unexpected /context output: %q", text)
+	}
+}
@@ -25,6 +25,7 @@ func InitFuncs(srv *jsonrpc.Server) {
 		jsonrpc.Set(srv, "alk.cxykevin.top/reload_config", reloadFunc)
 
 		jsonrpc.Set(srv, "alk.cxykevin.top/usage", Usage)
+		jsonrpc.Set(srv, "alk.cxykevin.top/models/discover", ModelsDiscover)
 	}
 
 	{ // 会话
@@ -41,6 +42,10 @@ func InitFuncs(srv *jsonrpc.Server) {
 		jsonrpc.Set(srv, "alk.cxykevin.top/session/get_background", SessionGetBackground)
 		jsonrpc.Set(srv, "alk.cxykevin.top/session/get_effort", SessionGetEffort)
 
+		jsonrpc.Set(srv, "alk.cxykevin.top/session/cost", SessionCost)
+		jsonrpc.Set(srv, "alk.cxykevin.top/session/context", SessionContext)
+		jsonrpc.Set(srv, "alk.cxykevin.top/mask/report", MaskReport)
+
 		jsonrpc.Set(srv, "alk.cxykevin.top/list_subagent", SubAgentList)
 
 		jsonrpc.Set(srv, "alk.cxykevin.top/phrases/list", PhraseList)
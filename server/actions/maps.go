@@ -9,6 +9,7 @@ var ReasonMap = map[loop.StopReason]string{
 	loop.StopReasonUser:        "cancelled",
 	loop.StopReasonError:       "refusal",
 	loop.StopReasonPendingTool: "end_turn",
+	loop.StopReasonBudget:      "max_tokens",
 }
 
 // ToolNameToTypeMap 工具名称到类型的映射，用于规范化工具调用类型
@@ -16,8 +17,11 @@ var ToolNameToTypeMap = map[string]string{
 	"agent":            "other",
 	"scope":            "other",
 	"activate_agent":   "other",
+	"activate_agents":  "other",
 	"deactivate_agent": "other",
 	"edit":             "edit",
+	"patch":            "edit",
 	"trace":            "read",
 	"run":              "execute",
+	"git":              "execute",
 }
@@ -0,0 +1,61 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cxykevin/alkaid0/provider/mask"
+)
+
+// MaskReportRequest 查询脱敏审计报告的请求。
+type MaskReportRequest struct {
+	SessionID string `json:"sessionId"`
+}
+
+// MaskReport 返回会话所在项目的脱敏映射及命中统计。
+// 私有 ACP 方法：alk.cxykevin.top/mask/report。
+func MaskReport(req MaskReportRequest, _ func(string, any, *string) error, _ uint64) (mask.Report, error) {
+	if req.SessionID == "" {
+		return mask.Report{}, fmt.Errorf("sessionId is empty")
+	}
+	sessLock.Lock()
+	sessObj, ok := sessions[req.SessionID]
+	sessLock.Unlock()
+	if !ok || sessObj.session == nil || sessObj.session.DB == nil {
+		return mask.Report{}, fmt.Errorf("session not found")
+	}
+	report, err := mask.BuildReport(sessObj.session.DB)
+	if err != nil {
+		return mask.Report{}, err
+	}
+	return *report, nil
+}
+
+// formatMaskReport 把脱敏审计报告渲染成 markdown 表格，供 /mask list 展示。
+func formatMaskReport(report *mask.Report) string {
+	var b strings.Builder
+	status := "enabled"
+	if !report.Enabled {
+		status = "disabled"
+	}
+	b.WriteString(fmt.Sprintf("**Data mask** (%s): %d mapping(s)\n", status, len(report.Entries)))
+	if len(report.Entries) == 0 {
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+	b.WriteString("\n| Type | Detector | Original | Masked | First seen | Requests |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+	for _, e := range report.Entries {
+		b.WriteString(fmt.Sprintf("| %s | %s | `%s` | `%s` | %s | %d |\n",
+			e.Type, e.Detector, e.Original, e.Masked, formatUnix(e.FirstSeen), e.Hits))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// formatUnix 格式化 unix 秒时间，0 显示为 -。
+func formatUnix(sec uint64) string {
+	if sec == 0 {
+		return "-"
+	}
+	return time.Unix(int64(sec), 0).Local().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,52 @@
+package actions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	u "github.com/cxykevin/alkaid0/utils"
+)
+
+func TestMaskReportAndList(t *testing.T) {
+	defer configSetup(t)()
+	*config.GlobalConfig = cfgStructs.Config{DataMask: cfgStructs.DataMaskConfig{Enable: true}}
+
+	if _, err := MaskReport(MaskReportRequest{}, nil, 1); err == nil {
+		t.Fatal("empty sessionId should fail")
+	}
+
+	dir, db, ids := newSessionListDB(t, 1)
+	sessionID := cwd2SessionID(dir, ids[0])
+	obj := &sessionObj{cwd: dir, id: ids[0], session: &structs.Chats{ID: ids[0], DB: db}}
+	sessLock.Lock()
+	sessions[sessionID] = obj
+	sessLock.Unlock()
+	t.Cleanup(func() {
+		sessLock.Lock()
+		delete(sessions, sessionID)
+		sessLock.Unlock()
+	})
+
+	db.Create(&[]structs.KeyMapping{
+		{KeyType: "ip", Original: "45.45.45.45", Masked: "61.23.45.67", Detector: "ipv4", Hits: 1, LastSeen: 1700000000},
+		{KeyType: "apikey", Original: "sk-or-v1-abc123def456ghi789", Masked: "sk-or-v1-xyz", Detector: "apikey:prefix", Hits: 3, LastSeen: 1700000000},
+	})
+
+	report, err := MaskReport(MaskReportRequest{SessionID: sessionID}, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Enabled || len(report.Entries) != 2 || report.Entries[0].Type != "apikey" || report.Entries[0].Hits != 3 {
+		t.Fatalf("unexpected mask report: %+v", report)
+	}
+
+	updates := collectCommandBroadcasts(t, obj, "/mask", "list")
+	text, _ := updates[len(updates)-1].Update.(SessionUpdateUpdate).Content.(u.H)["text"].(string)
+	if !strings.Contains(text, "2 mapping(s)") || !strings.Contains(text, "| apikey | apikey:prefix | `sk-o…89` | `sk-or-v1-xyz` |") ||
+		strings.Contains(text, "sk-or-v1-abc123def456ghi789") {
+		t.Fatalf("unexpected /mask list output: %q", text)
+	}
+}
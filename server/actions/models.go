@@ -0,0 +1,117 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/provider/request"
+)
+
+// discoverTimeout 模型发现的超时（含逐个读取模型元数据）
+const discoverTimeout = 30 * time.Second
+
+// ModelsDiscoverRequest 发现本地模型的请求
+type ModelsDiscoverRequest struct {
+	Type string `json:"type"`          // ollama | llamacpp
+	URL  string `json:"url,omitempty"` // 服务地址，空为默认地址
+}
+
+// DiscoveredModelEntry 发现的模型。已配置的模型 Configured 为 true 且不分配 ID
+type DiscoveredModelEntry struct {
+	request.DiscoveredModel
+	ID         int32 `json:"id,omitempty"` // 建议使用的模型 ID（现有最大 ID 之后顺延）
+	Configured bool  `json:"configured"`
+}
+
+// ModelsDiscoverResponse 发现本地模型的响应
+type ModelsDiscoverResponse struct {
+	Models []DiscoveredModelEntry `json:"models"`
+}
+
+// ModelsDiscover 列出本地推理服务上的模型并生成模型配置。
+// 私有 ACP 方法：alk.cxykevin.top/models/discover。
+func ModelsDiscover(req ModelsDiscoverRequest, _ func(string, any, *string) error, _ uint64) (ModelsDiscoverResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), discoverTimeout)
+	defer cancel()
+	found, err := request.DiscoverModels(ctx, cfgStructs.ProviderType(req.Type), req.URL)
+	if err != nil {
+		return ModelsDiscoverResponse{}, err
+	}
+	cfg := config.GlobalConfigSafe().Model
+	nextID := int32(0)
+	for id := range cfg.Models {
+		nextID = max(nextID, id)
+	}
+	entries := make([]DiscoveredModelEntry, 0, len(found))
+	for _, m := range found {
+		entry := DiscoveredModelEntry{DiscoveredModel: m}
+		for _, existing := range cfg.Models {
+			if existing.ModelID == m.Config.ModelID && strings.TrimRight(existing.ProviderURL, "/") == m.Config.ProviderURL {
+				entry.Configured = true
+				break
+			}
+		}
+		if !entry.Configured {
+			nextID++
+			entry.ID = nextID
+		}
+		entries = append(entries, entry)
+	}
+	return ModelsDiscoverResponse{Models: entries}, nil
+}
+
+// modelsCommand 处理 /models <ollama|llamacpp> [url]：列出本地模型，并给出可直接用于 config/set 的配置片段
+func modelsCommand(obj *sessionObj, arg string) error {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("Usage: /models ollama|llamacpp [url]")
+	}
+	req := ModelsDiscoverRequest{Type: fields[0]}
+	if len(fields) == 2 {
+		req.URL = fields[1]
+	}
+	resp, err := ModelsDiscover(req, nil, 0)
+	if err != nil {
+		return err
+	}
+	broadcastCmdText(obj, formatDiscoveredModels(resp.Models))
+	return nil
+}
+
+// formatDiscoveredModels 渲染发现结果与新模型的配置片段
+func formatDiscoveredModels(models []DiscoveredModelEntry) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("**Models** (%d found):\n", len(models)))
+	patch := map[string]cfgStructs.ModelConfig{}
+	for _, m := range models {
+		ctxLen := "unknown context"
+		if m.ContextLength > 0 {
+			ctxLen = fmt.Sprintf("%d tokens", m.ContextLength)
+		}
+		b.WriteString(fmt.Sprintf("  - `%s`: %s", m.Name, ctxLen))
+		if len(m.Capabilities) > 0 {
+			b.WriteString(" (" + strings.Join(m.Capabilities, ", ") + ")")
+		}
+		if m.Configured {
+			b.WriteString(" — configured")
+		} else {
+			patch[strconv.Itoa(int(m.ID))] = m.Config
+		}
+		b.WriteString("\n")
+	}
+	if len(patch) > 0 {
+		data, err := json.MarshalIndent(map[string]any{"Model": map[string]any{"Models": patch}}, "", "  ")
+		if err == nil {
+			b.WriteString("\nAdd to config (alk.cxykevin.top/config/set):\n```json\n")
+			b.Write(data)
+			b.WriteString("\n```\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,54 @@
+package actions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	u "github.com/cxykevin/alkaid0/utils"
+)
+
+func TestModelsDiscoverAndCommand(t *testing.T) {
+	defer configSetup(t)()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models":[{"name":"llama3.2"},{"name":"qwen3:8b"}]}`)
+		case "/api/show":
+			fmt.Fprint(w, `{"model_info":{"llama.context_length":32768},"capabilities":["completion","tools"]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	*config.GlobalConfig = cfgStructs.Config{Model: cfgStructs.ModelsConfig{Models: map[int32]cfgStructs.ModelConfig{
+		3: {ModelID: "llama3.2", ProviderURL: srv.URL + "/"},
+		7: {ModelID: "gpt-4o", ProviderURL: "https://api.openai.com/v1"},
+	}}}
+
+	if _, err := ModelsDiscover(ModelsDiscoverRequest{Type: "openai"}, nil, 0); err == nil {
+		t.Fatal("unsupported type should fail")
+	}
+	resp, err := ModelsDiscover(ModelsDiscoverRequest{Type: "ollama", URL: srv.URL}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Models) != 2 || !resp.Models[0].Configured || resp.Models[0].ID != 0 ||
+		resp.Models[1].Configured || resp.Models[1].ID != 8 || resp.Models[1].Config.TokenLimit != 32768 {
+		t.Fatalf("unexpected discover response: %+v", resp)
+	}
+
+	dir, db, ids := newSessionListDB(t, 1)
+	obj := &sessionObj{cwd: dir, id: ids[0], session: &structs.Chats{ID: ids[0], DB: db}}
+	updates := collectCommandBroadcasts(t, obj, "/models", "ollama "+srv.URL)
+	text, _ := updates[len(updates)-1].Update.(SessionUpdateUpdate).Content.(u.H)["text"].(string)
+	if !strings.Contains(text, "`llama3.2`: 32768 tokens (completion, tools) — configured") ||
+		!strings.Contains(text, `"8": {`) || !strings.Contains(text, `"ProviderType": "ollama"`) {
+		t.Fatalf("unexpected /models output: %q", text)
+	}
+}
@@ -0,0 +1,214 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cxykevin/alkaid0/config"
+)
+
+// notifyTimeout 单次 webhook 请求或本地命令的超时
+const notifyTimeout = 30 * time.Second
+
+// notifyDefaultStates 未配置 Notify.States 时触发通知的状态
+var notifyDefaultStates = []string{"requires_action", "idle"}
+
+// notifyClient webhook 请求客户端
+var notifyClient = &http.Client{Timeout: notifyTimeout}
+
+// notification 通知 JSON。text 供 Slack，title/message/topic 供 ntfy，其余为结构化字段
+type notification struct {
+	Text       string `json:"text"`
+	Title      string `json:"title"`
+	Message    string `json:"message"`
+	Topic      string `json:"topic,omitempty"`
+	SessionID  string `json:"session_id"`
+	Cwd        string `json:"cwd"`
+	State      string `json:"state"`
+	StopReason string `json:"stop_reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// notifyState 会话状态变化时按配置发送通知（会话需开启通知，并受状态过滤与限流约束）
+func notifyState(sessionID, state, stopReason, errMsg string) {
+	cfg := config.GlobalConfigSafe().Notify
+	if cfg.Webhook == "" && cfg.Command == "" {
+		return
+	}
+	states := cfg.States
+	if len(states) == 0 {
+		states = notifyDefaultStates
+	}
+	if !slices.Contains(states, state) {
+		return
+	}
+	sessLock.Lock()
+	obj, ok := sessions[sessionID]
+	sessLock.Unlock()
+	if !ok {
+		return
+	}
+	if cfg.OnlyDetached {
+		sessionConnLock.Lock()
+		attached := len(sessionConnMap[sessionID]) > 0
+		sessionConnLock.Unlock()
+		if attached {
+			return
+		}
+	}
+
+	obj.notifyMu.Lock()
+	if !obj.notify {
+		obj.notifyMu.Unlock()
+		return
+	}
+	now := time.Now()
+	if last, ok := obj.lastNotify[state]; ok && cfg.MinInterval > 0 && now.Sub(last) < time.Duration(cfg.MinInterval)*time.Second {
+		obj.notifyMu.Unlock()
+		logger.Debug("notification for session %s state %s rate limited", sessionID, state)
+		return
+	}
+	if obj.lastNotify == nil {
+		obj.lastNotify = map[string]time.Time{}
+	}
+	obj.lastNotify[state] = now
+	obj.notifyMu.Unlock()
+
+	n := buildNotification(obj, sessionID, state, stopReason, errMsg)
+	n.Topic = cfg.Topic
+	body, err := json.Marshal(n)
+	if err != nil {
+		logger.Warn("marshal notification error: %v", err)
+		return
+	}
+	if cfg.Webhook != "" {
+		if err := postNotification(cfg.Webhook, body); err != nil {
+			logger.Warn("notification webhook error in session %s: %v", sessionID, err)
+		}
+	}
+	if cfg.Command != "" {
+		if err := execNotification(cfg.Command, n, body); err != nil {
+			logger.Warn("notification command error in session %s: %v", sessionID, err)
+		}
+	}
+}
+
+// buildNotification 生成通知内容
+func buildNotification(obj *sessionObj, sessionID, state, stopReason, errMsg string) notification {
+	name := obj.cwd
+	if obj.session != nil {
+		if obj.session.Title != "" {
+			name = obj.session.Title
+		} else if obj.session.AITitle != "" {
+			name = obj.session.AITitle
+		}
+	}
+	var msg string
+	switch {
+	case state == "requires_action":
+		msg = "Waiting for tool call approval"
+	case errMsg != "":
+		msg = fmt.Sprintf("Stopped (%s): %s", stopReason, errMsg)
+	case state == "idle":
+		msg = fmt.Sprintf("Finished (%s)", stopReason)
+	default:
+		msg = "State changed to " + state
+	}
+	title := "Alkaid0: " + name
+	return notification{
+		Text:       fmt.Sprintf("*%s*\n%s", title, msg),
+		Title:      title,
+		Message:    msg,
+		SessionID:  sessionID,
+		Cwd:        obj.cwd,
+		State:      state,
+		StopReason: stopReason,
+		Error:      errMsg,
+	}
+}
+
+// postNotification POST 通知 JSON 到 webhook
+func postNotification(url string, body []byte) error {
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// execNotification 执行本地通知命令，stdin 为通知 JSON，标题与正文同时经环境变量传入
+func execNotification(command string, n notification, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"ALKAID0_NOTIFY_TITLE="+n.Title,
+		"ALKAID0_NOTIFY_MESSAGE="+n.Message,
+		"ALKAID0_NOTIFY_STATE="+n.State,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// notifyCommand 处理 /notify [on|off]：开关当前会话的状态通知，无参数时显示当前设置
+func notifyCommand(obj *sessionObj, arg string) (bool, error) {
+	cfg := config.GlobalConfigSafe().Notify
+	configured := cfg.Webhook != "" || cfg.Command != ""
+	switch strings.TrimSpace(strings.ToLower(arg)) {
+	case "on":
+		obj.notifyMu.Lock()
+		obj.notify = true
+		obj.notifyMu.Unlock()
+		if !configured {
+			broadcastCmdText(obj, "Notifications enabled, but neither Notify.Webhook nor Notify.Command is configured.")
+		}
+	case "off":
+		obj.notifyMu.Lock()
+		obj.notify = false
+		obj.notifyMu.Unlock()
+	case "":
+		obj.notifyMu.Lock()
+		enabled := obj.notify
+		obj.notifyMu.Unlock()
+		status := "off"
+		if enabled {
+			status = "on"
+		}
+		targets := []string{}
+		if cfg.Webhook != "" {
+			targets = append(targets, "webhook")
+		}
+		if cfg.Command != "" {
+			targets = append(targets, "command")
+		}
+		if !configured {
+			targets = append(targets, "none configured")
+		}
+		broadcastCmdText(obj, fmt.Sprintf("Notifications: **%s** (targets: %s)", status, strings.Join(targets, ", ")))
+	default:
+		return false, fmt.Errorf("Usage: /notify on|off")
+	}
+	return false, nil
+}
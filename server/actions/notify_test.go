@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	u "github.com/cxykevin/alkaid0/utils"
+)
+
+func TestNotifyState(t *testing.T) {
+	defer configSetup(t)()
+	received := make(chan notification, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var n notification
+		if err := json.Unmarshal(data, &n); err != nil {
+			t.Errorf("invalid notification body %q: %v", data, err)
+		}
+		received <- n
+	}))
+	defer srv.Close()
+	config.GlobalConfig.Notify = cfgStructs.NotifyConfig{Webhook: srv.URL, Topic: "alk", MinInterval: 60}
+
+	dir := t.TempDir()
+	sessionID := cwd2SessionID(dir, 1)
+	obj := &sessionObj{cwd: dir, id: 1, session: &structs.Chats{ID: 1, Title: "Refactor"}}
+	sessLock.Lock()
+	sessions[sessionID] = obj
+	sessLock.Unlock()
+	t.Cleanup(func() {
+		sessLock.Lock()
+		delete(sessions, sessionID)
+		sessLock.Unlock()
+	})
+
+	// 未开启通知的会话不发送
+	notifyState(sessionID, "requires_action", "", "")
+	if _, err := notifyCommand(obj, "on"); err != nil {
+		t.Fatal(err)
+	}
+	notifyState(sessionID, "running", "", "")
+	notifyState(sessionID, "requires_action", "", "")
+	select {
+	case n := <-received:
+		if n.State != "requires_action" || n.Topic != "alk" || n.SessionID != sessionID ||
+			n.Title != "Alkaid0: Refactor" || !strings.Contains(n.Text, "approval") {
+			t.Fatalf("unexpected notification: %+v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not received")
+	}
+
+	// 同一状态在 MinInterval 内被限流，不同状态不受影响
+	notifyState(sessionID, "requires_action", "", "")
+	broadcastStateUpdate(sessionID, "idle", "refusal", "boom")
+	select {
+	case n := <-received:
+		if n.State != "idle" || n.StopReason != "refusal" || n.Error != "boom" || !strings.Contains(n.Message, "boom") {
+			t.Fatalf("unexpected notification: %+v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle notification not received")
+	}
+	select {
+	case n := <-received:
+		t.Fatalf("rate limited notification sent: %+v", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if _, err := notifyCommand(obj, "off"); err != nil {
+		t.Fatal(err)
+	}
+	obj.lastNotify = nil
+	notifyState(sessionID, "idle", "end_turn", "")
+	select {
+	case n := <-received:
+		t.Fatalf("notification sent after /notify off: %+v", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, err := notifyCommand(obj, "maybe"); err == nil {
+		t.Fatal("invalid /notify argument should fail")
+	}
+}
+
+func TestNotifyCommandTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+	defer configSetup(t)()
+	dir := t.TempDir()
+	out := filepath.Join(dir, "notify.json")
+	config.GlobalConfig.Notify = cfgStructs.NotifyConfig{Command: "cat > " + out + "; echo \"$ALKAID0_NOTIFY_STATE\" >> " + out}
+
+	sessionID := cwd2SessionID(dir, 2)
+	obj := &sessionObj{cwd: dir, id: 2, notify: true}
+	sessLock.Lock()
+	sessions[sessionID] = obj
+	sessLock.Unlock()
+	t.Cleanup(func() {
+		sessLock.Lock()
+		delete(sessions, sessionID)
+		sessLock.Unlock()
+	})
+
+	notifyState(sessionID, "idle", "end_turn", "")
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"state":"idle"`) || !strings.HasSuffix(string(data), "}idle\n") {
+		t.Fatalf("unexpected command input: %q", data)
+	}
+
+	// /notify 本身结束时的 idle 不再触发命令，避免写入已清理的临时目录
+	config.GlobalConfig.Notify.States = []string{"requires_action"}
+	updates := collectCommandBroadcasts(t, obj, "/notify", "")
+	text, _ := updates[len(updates)-1].Update.(SessionUpdateUpdate).Content.(u.H)["text"].(string)
+	if !strings.Contains(text, "**on**") || !strings.Contains(text, "command") {
+		t.Fatalf("unexpected /notify output: %q", text)
+	}
+}
@@ -15,8 +15,20 @@ import (
 type SessionPromptRequest struct {
 	SessionID string `json:"sessionId"`
 	Prompt    []u.H  `json:"prompt,omitempty"`
+	// Mode 一轮运行中发送提示词时的处理方式：queue（默认）| steer | interrupt
+	Mode string `json:"alk.cxykevin.top/mode,omitempty"`
 }
 
+// prompt 发送模式
+const (
+	// promptModeQueue 排队，当前一轮结束后再处理
+	promptModeQueue = "queue"
+	// promptModeSteer 不取消当前一轮，当前工具调用批次完成后注入下一次模型请求
+	promptModeSteer = "steer"
+	// promptModeInterrupt 取消进行中的模型请求，注入新指令后重新请求
+	promptModeInterrupt = "interrupt"
+)
+
 // SessionPromptResponse prompt turn 的响应（ACP v2：纯确认，立即返回 {}）
 type SessionPromptResponse struct{}
 
@@ -63,6 +75,11 @@ func SessionPrompt(req SessionPromptRequest, call func(string, any, *string) err
 	}
 
 	text := userMessage.String()
+	switch req.Mode {
+	case "", promptModeQueue, promptModeSteer, promptModeInterrupt:
+	default:
+		return SessionPromptResponse{}, fmt.Errorf("invalid prompt mode %q", req.Mode)
+	}
 	// isCommand 标记本 turn 是否为斜杠命令轮（命令轮不算正常请求，不触发 AI 标题生成）
 	isCommand := strings.HasPrefix(text, "/")
 
@@ -106,6 +123,24 @@ func SessionPrompt(req SessionPromptRequest, call func(string, any, *string) err
 		return SessionPromptResponse{}, err
 	}
 
+	// 引导模式：一轮运行中时由 loop 在安全点持久化并注入，注入后再广播 user_message
+	if req.Mode == promptModeSteer || req.Mode == promptModeInterrupt {
+		onInject := func(id uint64) {
+			broadcastUserMessage(req.SessionID, msgID(id), text)
+			broadcastStateUpdate(req.SessionID, "running", "", "")
+		}
+		accepted := false
+		if req.Mode == promptModeSteer {
+			accepted = sessObj.loop.Steer(text, onInject)
+		} else {
+			accepted = sessObj.loop.Interrupt(text, onInject)
+		}
+		if accepted {
+			return SessionPromptResponse{}, nil
+		}
+		// 没有正在运行的一轮：按普通 prompt 处理
+	}
+
 	// 正常 prompt：持久化用户消息获取 DB ID（作为 messageId 基础，与回放一致）
 	userMsgID, err := funcs.UserAddMsgWithID(sessObj.session, text, nil)
 	if err != nil {
@@ -114,14 +149,7 @@ func SessionPrompt(req SessionPromptRequest, call func(string, any, *string) err
 	}
 
 	// 广播 user_message（发送方也要收到——ACP v2 以 agent 的 user_message 为 messageId 真相来源）+ running
-	broadcastSessionUpdate(req.SessionID, SessionUpdate{
-		SessionID: req.SessionID,
-		Update: SessionUpdateUpdate{
-			SessionUpdate: "user_message",
-			MessageID:     msgID(userMsgID),
-			Content:       []u.H{{"type": "text", "text": text}},
-		},
-	}, 0)
+	broadcastUserMessage(req.SessionID, msgID(userMsgID), text)
 	broadcastStateUpdate(req.SessionID, "running", "", "")
 
 	err = sessObj.loop.ChatWithID(text, userMsgID, nil)
@@ -132,6 +160,18 @@ func SessionPrompt(req SessionPromptRequest, call func(string, any, *string) err
 	return SessionPromptResponse{}, nil // 立即 ack
 }
 
+// broadcastUserMessage 向会话所有客户端广播 user_message
+func broadcastUserMessage(sessionID, messageID, text string) {
+	broadcastSessionUpdate(sessionID, SessionUpdate{
+		SessionID: sessionID,
+		Update: SessionUpdateUpdate{
+			SessionUpdate: "user_message",
+			MessageID:     messageID,
+			Content:       []u.H{{"type": "text", "text": text}},
+		},
+	}, 0)
+}
+
 // // mapStopReason 将loop.StopReason映射到ACP协议中的stopReason字符串
 // func mapStopReason(reason loop.StopReason) string {
 // 	switch reason {
@@ -6,6 +6,8 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/ui/loop"
 	u "github.com/cxykevin/alkaid0/utils"
 )
 
@@ -67,6 +69,36 @@ func TestSessionPromptValidation(t *testing.T) {
 	}
 }
 
+// TestSessionPromptMode 测试 prompt 模式校验，以及没有运行中的一轮时 steer 按普通 prompt 处理
+func TestSessionPromptMode(t *testing.T) {
+	dir, db, ids := newSessionListDB(t, 1)
+	sessionID := cwd2SessionID(dir, ids[0])
+	sess := &structs.Chats{ID: ids[0], DB: db}
+	sessLock.Lock()
+	sessions[sessionID] = &sessionObj{cwd: dir, id: ids[0], session: sess, loop: loop.New(sess)}
+	sessLock.Unlock()
+	t.Cleanup(func() {
+		sessLock.Lock()
+		delete(sessions, sessionID)
+		sessLock.Unlock()
+	})
+	prompt := []u.H{{"type": "text", "text": "switch to plan B"}}
+
+	if _, err := SessionPrompt(SessionPromptRequest{SessionID: sessionID, Prompt: prompt, Mode: "later"}, nil, 1); err == nil {
+		t.Fatal("unknown mode should fail")
+	}
+	for _, mode := range []string{promptModeSteer, promptModeInterrupt} {
+		if _, err := SessionPrompt(SessionPromptRequest{SessionID: sessionID, Prompt: prompt, Mode: mode}, nil, 1); err != nil {
+			t.Fatalf("%s without a running turn: %v", mode, err)
+		}
+	}
+	var count int64
+	db.Model(&structs.Messages{}).Where("chat_id = ? AND delta = ?", ids[0], "switch to plan B").Count(&count)
+	if count != 2 {
+		t.Fatalf("idle steer/interrupt should persist like a normal prompt, got %d messages", count)
+	}
+}
+
 // TestBroadcastSessionUpdate 测试广播更新功能
 func TestBroadcastSessionUpdate(t *testing.T) {
 	sessionID := "sess_999:/tmp/test"
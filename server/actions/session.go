@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path"
 	"slices"
@@ -18,6 +19,7 @@ import (
 	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
 	"github.com/cxykevin/alkaid0/context/codebase"
 	"github.com/cxykevin/alkaid0/provider/request"
+	"github.com/cxykevin/alkaid0/stats"
 	"github.com/cxykevin/alkaid0/storage"
 	"github.com/cxykevin/alkaid0/storage/structs"
 	task "github.com/cxykevin/alkaid0/tools/tools/task"
@@ -101,8 +103,16 @@ type sessionObj struct {
 	// 为 true 时，断连后若 loop 正在活跃处理则保持运行，空闲时才释放
 	// 通过 /background on 启用，重启 loop 后自动重置为 false
 	background bool
+	// notify 状态通知开关（/notify on|off），初值为 Notify.DefaultOn
+	notify bool
+	// notifyMu 保护 notify 与 lastNotify
+	notifyMu sync.Mutex
+	// lastNotify 各状态上次发送通知的时间（限流用）
+	lastNotify map[string]time.Time
 	// lastToolStreamTime 工具调用增量流式广播的上次推送时间（限流用）
 	lastToolStreamTime time.Time
+	// cost 会话累计费用，随 usage_update 增量更新
+	cost stats.CostTracker
 	// indexDone 异步索引 goroutine（loadSession 启动）的完成信号。
 	// goroutine 完成后 close 该 channel；测试等它完成后再清理 TempDir，
 	// 避免异步索引在目录清理期间重新打开 codebase.sqlite 导致 Windows 删除失败。
@@ -419,6 +429,7 @@ func broadcastStateUpdate(sessionID, state, stopReason, errMsg string) {
 	}, 0); err != nil {
 		logger.Warn("failed to broadcast state_update: %v", err)
 	}
+	go notifyState(sessionID, state, stopReason, errMsg)
 }
 
 // broadcastToolCallCancelled 拒绝时把待审批工具标记为 cancelled
@@ -640,6 +651,7 @@ func loadSession(cwd string, id *uint32, knowID bool) (*structs.Chats, error) {
 			ctx:       context.Background(),
 			referCnt:  1,
 			indexDone: make(chan struct{}),
+			notify:    config.GlobalConfig.Notify.DefaultOn,
 		}
 
 		db, err := loadDB(cwd)
@@ -718,6 +730,25 @@ func loadSession(cwd string, id *uint32, knowID bool) (*structs.Chats, error) {
 		// 设置回调接收流式响应
 		obj.loop.SetCallback(func(resp loop.AIResponse) {
 			logger.Debug("callback respose ID=%d", resp.MsgID)
+			// 上游限流：请求在共享限流器中排队，告知客户端预计等待时间
+			if resp.RateLimitWait > 0 {
+				secs := int(math.Ceil(resp.RateLimitWait.Seconds()))
+				err = broadcastSessionUpdate(sessID, SessionUpdate{
+					SessionID: sessID,
+					Update: SessionUpdateUpdate{
+						SessionUpdate: "alk.cxykevin.top/rate_limit",
+						Content: u.H{
+							"type":    "text",
+							"text":    fmt.Sprintf("waiting for rate limit (%d s)", secs),
+							"seconds": secs,
+						},
+					},
+				}, 0)
+				if err != nil {
+					logger.Warn("failed to broadcast session update: %v", err)
+				}
+				return
+			}
 			// 处理thinking内容（ACP v2：messageId 必填）
 			if resp.ThinkingContext != "" {
 				err = broadcastSessionUpdate(sessID, SessionUpdate{
@@ -854,6 +885,7 @@ func loadSession(cwd string, id *uint32, knowID bool) (*structs.Chats, error) {
 							SessionUpdate: "usage_update",
 							Used:          uint64(resp.Usage.TotalTokens),
 							Size:          currentTokenLimit(sess),
+							Cost:          currentSessionCost(obj, resp),
 						},
 					}, 0)
 				}
@@ -1224,6 +1256,7 @@ type SessionUpdateUpdate struct {
 	AvailableCommands any            `json:"availableCommands,omitempty"` // available_commands_update
 	Used              uint64         `json:"used,omitempty"`              // usage_update
 	Size              uint64         `json:"size,omitempty"`              // usage_update
+	Cost              *UsageCost     `json:"cost,omitempty"`              // usage_update 会话累计费用（配置了模型价格时）
 	Plan              *PlanItems     `json:"plan,omitempty"`              // plan_update（嵌套在 plan 下）
 	ExpandErrorMsg    string         `json:"alk.cxykevin.top/error_msg,omitempty"`
 	AgentStatus       *string        `json:"alk.cxykevin.top/agent_status,omitempty"`
@@ -1336,6 +1369,7 @@ func SessionResume(req SessionResumeRequest, call func(string, any, *string) err
 	previousToolJSON := ""
 	previousToolContent := ""
 	prevMsgID := uint64(0)
+	replayCost := 0.0
 	if req.ReplayFrom != nil && req.ReplayFrom.Type == "start" {
 		logger.Info("replay session: %s", req.SessionID)
 		for _, val := range msgs {
@@ -1384,12 +1418,14 @@ func SessionResume(req SessionResumeRequest, call func(string, any, *string) err
 					return SessionResumeResponse{}, err
 				}
 				if val.TotalTokens != 0 || val.CachedTokens != 0 || val.PromptTokens != 0 || val.CompletionTokens != 0 {
+					replayCost += stats.MessageCost(&val)
 					err = broadcastSessionUpdate(req.SessionID, SessionUpdate{
 						SessionID: req.SessionID,
 						Update: SessionUpdateUpdate{
 							SessionUpdate: "usage_update",
 							Used:          uint64(val.TotalTokens),
 							Size:          currentTokenLimit(sess),
+							Cost:          usageCost(replayCost),
 						},
 					}, 0)
 				}
@@ -1683,22 +1719,30 @@ type SubAgentListResponse struct {
 
 // AgentsInfo subagent 信息
 type AgentsInfo struct {
-	Name string `json:"name"`
-	Tag  string `json:"tag"`
-	Path string `json:"path"`
+	Name     string `json:"name"`
+	Tag      string `json:"tag"`
+	Path     string `json:"path"`
+	Worktree bool   `json:"worktree,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Parallel string `json:"parallel,omitempty"`
 }
 
 // AgentTagsInfo subagent tag 信息
 type AgentTagsInfo struct {
-	Name        string `json:"name"`
-	ID          string `json:"id"`
-	ModelID     int32  `json:"modelId"`
-	Color       string `json:"color"`
-	AutoApprove string `json:"autoApproveExpr"`
-	AutoReject  string `json:"autoRejectExpr"`
-	Description string `json:"description"`
-	Prompt      string `json:"prompt"`
-	ShortPrompt string `json:"shortPrompt"`
+	Name          string   `json:"name"`
+	ID            string   `json:"id"`
+	ModelID       int32    `json:"modelId"`
+	Color         string   `json:"color"`
+	AutoApprove   string   `json:"autoApproveExpr"`
+	AutoReject    string   `json:"autoRejectExpr"`
+	Description   string   `json:"description"`
+	Prompt        string   `json:"prompt"`
+	ShortPrompt   string   `json:"shortPrompt"`
+	Scopes        []string `json:"scopes,omitempty"`
+	DefaultScopes []string `json:"defaultScopes,omitempty"`
+	AllowedTools  []string `json:"allowedTools,omitempty"`
+	DeniedTools   []string `json:"deniedTools,omitempty"`
+	Workspace     bool     `json:"workspace,omitempty"`
 }
 
 // SessionInfo 会话信息
@@ -2013,14 +2057,21 @@ func SubAgentList(req SubAgentListRequest, call func(string, any, *string) error
 	if err != nil {
 		return SubAgentListResponse{}, fmt.Errorf("failed to get agents: %v", err)
 	}
-	tags := funcs.GetAgentTags()
+	tags := funcs.GetAgentTags(sess)
+	parallel := map[string]string{}
+	for _, r := range funcs.ParallelAgents(sess) {
+		parallel[r.AgentCode] = r.Status
+	}
 
 	return SubAgentListResponse{
 		Subagents: u.MapFilter(agents, func(v structs.SubAgents) (AgentsInfo, bool) {
 			return AgentsInfo{
-				Name: v.ID,
-				Tag:  v.AgentID,
-				Path: v.BindPath,
+				Name:     v.ID,
+				Tag:      v.AgentID,
+				Path:     v.BindPath,
+				Worktree: v.Isolated,
+				Branch:   v.Branch,
+				Parallel: parallel[v.ID],
 			}, !v.Deleted
 		}),
 		Tags: u.Map(tags, func(v funcs.AgentTagsList) AgentTagsInfo {
@@ -2033,11 +2084,16 @@ func SubAgentList(req SubAgentListRequest, call func(string, any, *string) error
 					v.Agent.Color.Green,
 					v.Agent.Color.Blue,
 				),
-				AutoApprove: v.Agent.AutoApprove,
-				AutoReject:  v.Agent.AutoReject,
-				Description: v.Agent.AgentDescription,
-				Prompt:      v.Agent.AgentPrompt,
-				ShortPrompt: v.Agent.AgentShortDescription,
+				AutoApprove:   v.Agent.AutoApprove,
+				AutoReject:    v.Agent.AutoReject,
+				Description:   v.Agent.AgentDescription,
+				Prompt:        v.Agent.AgentPrompt,
+				ShortPrompt:   v.Agent.AgentShortDescription,
+				Scopes:        v.Agent.AllowedScopes,
+				DefaultScopes: v.Agent.DefaultScopes,
+				AllowedTools:  v.Agent.AllowedTools,
+				DeniedTools:   v.Agent.DeniedTools,
+				Workspace:     v.Workspace,
 			}
 		}),
 	}, nil
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/cxykevin/alkaid0/provider/request"
 	"github.com/cxykevin/alkaid0/stats"
+	"github.com/cxykevin/alkaid0/ui/loop"
 )
 
 // UsageRequest 查询全局 token 用量的请求（无需参数）。
@@ -13,7 +15,66 @@ type UsageRequest struct{}
 // Usage 返回全局 token 用量统计快照。
 // 私有 ACP 方法：alk.cxykevin.top/usage，供前端查询用量展示。
 func Usage(_ UsageRequest, _ func(string, any, *string) error, _ uint64) (stats.Info, error) {
-	return stats.Snapshot(), nil
+	return usageSnapshot(), nil
+}
+
+// usageSnapshot 统计快照，并标注 Key 池中已被禁用的 key。
+func usageSnapshot() stats.Info {
+	snap := stats.Snapshot()
+	disabled := request.DisabledKeys()
+	for i, k := range snap.Keys {
+		snap.Keys[i].Disabled = disabled[k.ProviderURL+" "+k.Key]
+	}
+	return snap
+}
+
+// SessionCostRequest 查询会话费用的请求。
+type SessionCostRequest struct {
+	SessionID string `json:"sessionId"`
+}
+
+// SessionCost 返回会话按代理与模型分组的用量与费用。
+// 私有 ACP 方法：alk.cxykevin.top/session/cost。
+func SessionCost(req SessionCostRequest, _ func(string, any, *string) error, _ uint64) (stats.SessionCost, error) {
+	if req.SessionID == "" {
+		return stats.SessionCost{}, fmt.Errorf("sessionId is empty")
+	}
+	sessLock.Lock()
+	sessObj, ok := sessions[req.SessionID]
+	sessLock.Unlock()
+	if !ok || sessObj.session == nil || sessObj.session.DB == nil {
+		return stats.SessionCost{}, fmt.Errorf("session not found")
+	}
+	return stats.ComputeSessionCost(sessObj.session.DB, sessObj.session.ID)
+}
+
+// UsageCost usage_update 中的费用（ACP v2 cost 字段）。
+type UsageCost struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// usageCost 构造 usage_update 的费用字段，未产生费用（未配置价格）时省略。
+func usageCost(amount float64) *UsageCost {
+	if amount <= 0 {
+		return nil
+	}
+	return &UsageCost{Amount: amount, Currency: stats.Currency()}
+}
+
+// currentSessionCost 按本次响应的累计用量增量计算会话当前累计费用，供实时 usage_update 使用。
+func currentSessionCost(obj *sessionObj, resp loop.AIResponse) *UsageCost {
+	sess := obj.session
+	if sess == nil || sess.DB == nil || resp.Usage == nil {
+		return nil
+	}
+	cost, err := obj.cost.Update(sess.DB, sess.ID, resp.MsgID,
+		uint64(resp.Usage.PromptTokens), uint64(resp.Usage.CompletionTokens), uint64(resp.Usage.CachedTokens))
+	if err != nil {
+		logger.Warn("compute session cost in ID=%d: %v", sess.ID, err)
+		return nil
+	}
+	return usageCost(cost)
 }
 
 // formatUsage 把统计快照渲染成 markdown 文本，供 /usage 命令展示。
@@ -24,11 +85,47 @@ func formatUsage(snap stats.Info) string {
 	b.WriteString(fmt.Sprintf("  - Prompt: %d | Completion: %d | Cached: %d\n",
 		snap.Total.PromptTokens, snap.Total.CompletionTokens, snap.Total.CachedTokens))
 	b.WriteString(fmt.Sprintf("  - Cache Hit Ratio: %.2f%%\n", snap.Total.CacheHitRatio*100))
+	b.WriteString(fmt.Sprintf("  - Cost: %.4f %s\n", snap.Total.Cost, snap.Currency))
 	if len(snap.Models) > 0 {
 		b.WriteString("**By Model:**\n")
 		for _, m := range snap.Models {
-			b.WriteString(fmt.Sprintf("  - %s: prompt %d / completion %d / cached %d (%.2f%%)\n",
-				m.ModelName, m.PromptTokens, m.CompletionTokens, m.CachedTokens, m.CacheHitRatio*100))
+			b.WriteString(fmt.Sprintf("  - %s: prompt %d / completion %d / cached %d (%.2f%%), cost %.4f\n",
+				m.ModelName, m.PromptTokens, m.CompletionTokens, m.CachedTokens, m.CacheHitRatio*100, m.Cost))
+		}
+	}
+	if len(snap.Keys) > 0 {
+		b.WriteString("**By Key:**\n")
+		for _, k := range snap.Keys {
+			b.WriteString(fmt.Sprintf("  - %s (%s): %d requests, prompt %d / completion %d / cached %d, rate limited %d, rejected %d",
+				k.Key, k.ProviderURL, k.Requests, k.PromptTokens, k.CompletionTokens, k.CachedTokens, k.RateLimited, k.Rejected))
+			if k.Disabled != "" {
+				b.WriteString(fmt.Sprintf(" — disabled: %s", k.Disabled))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// formatSessionCost 把会话费用渲染成 markdown 文本，供 /usage 命令展示。
+func formatSessionCost(cost stats.SessionCost) string {
+	var b strings.Builder
+	b.WriteString("**This Session:**\n")
+	b.WriteString(fmt.Sprintf("  - Requests: %d | Prompt: %d | Completion: %d | Cached: %d\n",
+		cost.Total.Requests, cost.Total.PromptTokens, cost.Total.CompletionTokens, cost.Total.CachedTokens))
+	b.WriteString(fmt.Sprintf("  - Cost: %.4f %s\n", cost.Total.Cost, cost.Currency))
+	if cost.Proxy.Requests > 0 {
+		b.WriteString(fmt.Sprintf("  - Python proxy: %d requests, cost %.4f\n", cost.Proxy.Requests, cost.Proxy.Cost))
+	}
+	for _, agent := range cost.Agents {
+		name := agent.AgentID
+		if name == "" {
+			name = "main"
+		}
+		b.WriteString(fmt.Sprintf("  - %s: %d requests, cost %.4f\n", name, agent.Requests, agent.Cost))
+		for _, m := range agent.Models {
+			b.WriteString(fmt.Sprintf("    - %s: prompt %d / completion %d / cached %d, cost %.4f\n",
+				m.ModelName, m.PromptTokens, m.CompletionTokens, m.CachedTokens, m.Cost))
 		}
 	}
 	return strings.TrimSuffix(b.String(), "\n")
@@ -7,12 +7,23 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	reqStructs "github.com/cxykevin/alkaid0/provider/request/structs"
 	"github.com/cxykevin/alkaid0/stats"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/ui/loop"
 	u "github.com/cxykevin/alkaid0/utils"
 )
 
 // collectUsageBroadcasts 启动 /usage 命令并用并发安全的 channel 收集异步广播。
 func collectUsageBroadcasts(t *testing.T, obj *sessionObj, arg string) []SessionUpdate {
+	t.Helper()
+	return collectCommandBroadcasts(t, obj, "/usage", arg)
+}
+
+// collectCommandBroadcasts 执行命令并收集其广播。
+func collectCommandBroadcasts(t *testing.T, obj *sessionObj, name, arg string) []SessionUpdate {
 	t.Helper()
 	oldConnCall, oldSessionConn := connCallMap, sessionConnMap
 	connCallMap = map[uint64]func(string, any, *string) error{}
@@ -32,8 +43,8 @@ func collectUsageBroadcasts(t *testing.T, obj *sessionObj, arg string) []Session
 		return nil
 	}
 
-	if _, err := commandMaps["/usage"].Function(obj, arg); err != nil {
-		t.Fatalf("/usage %q: %v", arg, err)
+	if _, err := commandMaps[name].Function(obj, arg); err != nil {
+		t.Fatalf("%s %q: %v", name, arg, err)
 	}
 
 	mu.Lock()
@@ -112,3 +123,85 @@ func TestUsageResetDiskFail(t *testing.T) {
 		t.Fatalf("expected disk-write warning in message, got %q", text)
 	}
 }
+
+// TestSessionCost 验证 alk.cxykevin.top/session/cost 按代理与模型返回会话费用
+func TestSessionCost(t *testing.T) {
+	defer configSetup(t)()
+	*config.GlobalConfig = cfgStructs.Config{
+		Model: cfgStructs.ModelsConfig{
+			Models: map[int32]cfgStructs.ModelConfig{
+				1: {ModelName: "Priced", InputPrice: 1, OutputPrice: 2},
+			},
+		},
+	}
+
+	if _, err := SessionCost(SessionCostRequest{}, nil, 1); err == nil {
+		t.Fatal("empty sessionId should fail")
+	}
+	if _, err := SessionCost(SessionCostRequest{SessionID: "missing"}, nil, 1); err == nil {
+		t.Fatal("unknown session should fail")
+	}
+
+	dir, db, ids := newSessionListDB(t, 1)
+	sessionID := cwd2SessionID(dir, ids[0])
+	sess := &structs.Chats{ID: ids[0], DB: db}
+	obj := &sessionObj{cwd: dir, id: ids[0], session: sess}
+	sessLock.Lock()
+	sessions[sessionID] = obj
+	sessLock.Unlock()
+	t.Cleanup(func() {
+		sessLock.Lock()
+		delete(sessions, sessionID)
+		sessLock.Unlock()
+	})
+
+	if got := currentSessionCost(&sessionObj{session: sess}, loop.AIResponse{Usage: &reqStructs.Usage{}}); got != nil {
+		t.Fatalf("session without usage should omit cost, got %+v", got)
+	}
+	sub := "helper"
+	msgs := []structs.Messages{
+		{ChatID: ids[0], ModelID: 1, PromptTokens: 1_000_000},
+		{ChatID: ids[0], ModelID: 1, AgentID: &sub, CompletionTokens: 1_000_000},
+	}
+	db.Create(&msgs)
+
+	cost, err := SessionCost(SessionCostRequest{SessionID: sessionID}, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.Total.Cost != 3 || len(cost.Agents) != 2 || cost.Agents[1].AgentID != "helper" || cost.Agents[1].Cost != 2 {
+		t.Fatalf("unexpected session cost: %+v", cost)
+	}
+	// 流式中的消息按实时用量计入，不重复计算已落库的部分
+	if got := currentSessionCost(obj, loop.AIResponse{MsgID: msgs[1].ID, Usage: &reqStructs.Usage{CompletionTokens: 1_000_000}}); got == nil || got.Amount != 3 || got.Currency != "USD" {
+		t.Fatalf("unexpected usage_update cost: %+v", got)
+	}
+	// 后续消息与期间的内置代理请求增量计入，不再全量汇总
+	next := structs.Messages{ChatID: ids[0], ModelID: 1}
+	db.Create(&next)
+	db.Create(&structs.ProxyUsages{ChatID: ids[0], ModelID: 1, PromptTokens: 1_000_000})
+	for _, prompt := range []uint32{500_000, 1_000_000} {
+		got := currentSessionCost(obj, loop.AIResponse{MsgID: next.ID, Usage: &reqStructs.Usage{PromptTokens: prompt}})
+		if want := 4 + float64(prompt)/1_000_000; got == nil || got.Amount != want {
+			t.Fatalf("usage_update cost with prompt %d = %+v, want %v", prompt, got, want)
+		}
+	}
+	// 主循环回调之外落库的消息（如并行子代理、摘要）在换消息时计入
+	child := structs.Messages{ChatID: ids[0], ModelID: 1, AgentID: &sub, CompletionTokens: 500_000}
+	db.Create(&child)
+	third := structs.Messages{ChatID: ids[0], ModelID: 1}
+	db.Create(&third)
+	if got := currentSessionCost(obj, loop.AIResponse{MsgID: third.ID, Usage: &reqStructs.Usage{}}); got == nil || got.Amount != 6 {
+		t.Fatalf("usage_update should include messages persisted outside the callback, got %+v", got)
+	}
+	// 已计入的消息被删除（回滚）后重新汇总；next 落库用量为 0
+	db.Delete(&child)
+	fourth := structs.Messages{ChatID: ids[0], ModelID: 1}
+	db.Create(&fourth)
+	if got := currentSessionCost(obj, loop.AIResponse{MsgID: fourth.ID, Usage: &reqStructs.Usage{}}); got == nil || got.Amount != 4 {
+		t.Fatalf("usage_update should resync after history is deleted, got %+v", got)
+	}
+	if text := formatSessionCost(cost); !strings.Contains(text, "main") || !strings.Contains(text, "helper") {
+		t.Fatalf("unexpected /usage session section: %q", text)
+	}
+}
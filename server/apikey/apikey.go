@@ -5,15 +5,59 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"slices"
 	"sync"
 	"time"
 )
 
 const apiKeyBytes = 32
 
+// Limits restricts what a key may be used for. Zero values mean unlimited.
+type Limits struct {
+	// Session is the chat session that owns the key, 0 when unbound.
+	Session uint32
+	// Models lists the model config IDs the key may call; empty allows all.
+	Models []int32
+	// MaxTokens caps the prompt plus completion tokens charged to the key.
+	MaxTokens uint64
+	// MaxRequests caps the number of admitted requests.
+	MaxRequests uint64
+	// OnUsage is called after usage is charged, e.g. to attribute it to Session.
+	OnUsage func(Usage)
+}
+
+// Usage is the token usage of one proxied request.
+type Usage struct {
+	ModelID          int32
+	ModelName        string
+	PromptTokens     uint32
+	CompletionTokens uint32
+	CachedTokens     uint32
+}
+
+// Info describes a key: its limits, expiration time and consumption so far.
+type Info struct {
+	Limits
+	ExpiresAt time.Time
+	Requests  uint64
+	Tokens    uint64
+}
+
+// Errors returned by Admit.
+var (
+	ErrInvalidKey      = errors.New("invalid API key")
+	ErrModelNotAllowed = errors.New("model is not allowed for this API key")
+	ErrRequestQuota    = errors.New("request quota of this API key is exhausted")
+	ErrTokenQuota      = errors.New("token quota of this API key is exhausted")
+)
+
 type apiKeyEntry struct {
 	expiresAt time.Time
 	timer     *time.Timer
+	limits    Limits
+	requests  uint64
+	tokens    uint64
+	reserved  uint64 // 已放行但尚未计费的请求预留的 token
 }
 
 var (
@@ -24,6 +68,11 @@ var (
 // New creates an in-memory API key that remains valid for timeoutMinutes
 // minutes from creation. A timeout of zero creates an immediately expired key.
 func New(timeoutMinutes int) (string, error) {
+	return NewWithLimits(timeoutMinutes, Limits{})
+}
+
+// NewWithLimits is like New but attaches limits to the key.
+func NewWithLimits(timeoutMinutes int, limits Limits) (string, error) {
 	if timeoutMinutes < 0 {
 		return "", errors.New("API key timeout must not be negative")
 	}
@@ -36,7 +85,7 @@ func New(timeoutMinutes int) (string, error) {
 	expiresAt := time.Now().Add(time.Duration(timeoutMinutes) * time.Minute)
 
 	apiKeysMu.Lock()
-	entry := &apiKeyEntry{expiresAt: expiresAt}
+	entry := &apiKeyEntry{expiresAt: expiresAt, limits: limits}
 	apiKeys[key] = entry
 	// 在同一把锁下安装 timer，避免 Delete 并发读取未初始化的 timer。
 	entry.timer = time.AfterFunc(time.Until(expiresAt), func() {
@@ -69,22 +118,118 @@ func Delete(key string) bool {
 // Validate reports whether key exists and has not reached its fixed
 // expiration time. Expired keys are removed as they are observed.
 func Validate(key string) bool {
-	now := time.Now()
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+	return liveEntryLocked(key) != nil
+}
+
+// Lookup returns the metadata of a valid key.
+func Lookup(key string) (Info, bool) {
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+
+	entry := liveEntryLocked(key)
+	if entry == nil {
+		return Info{}, false
+	}
+	return Info{Limits: entry.limits, ExpiresAt: entry.expiresAt, Requests: entry.requests, Tokens: entry.tokens}, true
+}
+
+// Admission is a request admitted by Admit. It keeps a reference to the key
+// so usage can be charged after the key is deleted or expires.
+type Admission struct {
+	entry    *apiKeyEntry
+	reserved uint64
+	done     bool
+}
+
+// Admit checks that key may call modelID and has quota left, and counts the
+// request against it. On keys with a token limit it also reserves up to
+// reserve tokens of the remaining quota (all of it when reserve is 0), so
+// concurrent requests cannot overspend the key; the request is refused once
+// charged plus reserved tokens reach the limit. Tokens are charged
+// separately by Admission.Charge once known.
+func Admit(key string, modelID int32, reserve uint64) (*Admission, error) {
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+
+	entry := liveEntryLocked(key)
+	if entry == nil {
+		return nil, ErrInvalidKey
+	}
+	limits := entry.limits
+	if len(limits.Models) > 0 && !slices.Contains(limits.Models, modelID) {
+		return nil, ErrModelNotAllowed
+	}
+	if limits.MaxRequests > 0 && entry.requests >= limits.MaxRequests {
+		return nil, ErrRequestQuota
+	}
+	adm := &Admission{entry: entry}
+	if limits.MaxTokens > 0 {
+		used := entry.tokens + entry.reserved
+		if used >= limits.MaxTokens {
+			return nil, ErrTokenQuota
+		}
+		adm.reserved = limits.MaxTokens - used
+		if reserve > 0 && reserve < adm.reserved {
+			adm.reserved = reserve
+		}
+		entry.reserved += adm.reserved
+	}
+	entry.requests++
+	return adm, nil
+}
 
+// Reserved returns the tokens reserved for the request, 0 when the key has
+// no token limit. Callers should keep the request within this budget.
+func (a *Admission) Reserved() uint64 {
+	return a.reserved
+}
+
+// Release returns the reservation of a request that produced no usage.
+// It is a no-op after Charge or a previous Release.
+func (a *Admission) Release() {
 	apiKeysMu.Lock()
 	defer apiKeysMu.Unlock()
+	a.releaseLocked()
+}
 
+func (a *Admission) releaseLocked() {
+	if a.done {
+		return
+	}
+	a.done = true
+	a.entry.reserved -= a.reserved
+}
+
+// Charge adds usage to the admitted key, releases its reservation and
+// forwards usage to the key's OnUsage callback. Keys deleted or expired since
+// admission are still charged so in-flight requests are not lost.
+func (a *Admission) Charge(usage Usage) {
+	apiKeysMu.Lock()
+	a.releaseLocked()
+	a.entry.tokens += uint64(usage.PromptTokens) + uint64(usage.CompletionTokens)
+	onUsage := a.entry.limits.OnUsage
+	apiKeysMu.Unlock()
+
+	if onUsage != nil {
+		onUsage(usage)
+	}
+}
+
+// liveEntryLocked returns the entry of key if it has not expired, removing
+// expired entries. apiKeysMu must be held.
+func liveEntryLocked(key string) *apiKeyEntry {
 	entry, ok := apiKeys[key]
 	if !ok {
-		return false
+		return nil
 	}
-	expiresAt := entry.expiresAt
-	if !now.Before(expiresAt) {
+	if !time.Now().Before(entry.expiresAt) {
 		delete(apiKeys, key)
 		if entry.timer != nil {
 			entry.timer.Stop()
 		}
-		return false
+		return nil
 	}
-	return true
+	return entry
 }
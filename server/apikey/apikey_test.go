@@ -1,6 +1,7 @@
 package apikey
 
 import (
+	"sync"
 	"testing"
 	"time"
 )
@@ -66,3 +67,135 @@ func TestValidateNonExistentKey(t *testing.T) {
 		t.Error("Validate should return false for non-existent key")
 	}
 }
+
+func TestAdmitLimits(t *testing.T) {
+	var charged []Usage
+	key, err := NewWithLimits(10, Limits{
+		Session:     7,
+		Models:      []int32{1},
+		MaxTokens:   100,
+		MaxRequests: 3,
+		OnUsage:     func(u Usage) { charged = append(charged, u) },
+	})
+	if err != nil {
+		t.Fatalf("NewWithLimits failed: %v", err)
+	}
+	defer Delete(key)
+
+	if _, err := Admit(key, 2, 0); err != ErrModelNotAllowed {
+		t.Errorf("Admit with disallowed model = %v, want ErrModelNotAllowed", err)
+	}
+	adm, err := Admit(key, 1, 0)
+	if err != nil {
+		t.Fatalf("Admit failed: %v", err)
+	}
+	adm.Charge(Usage{ModelID: 1, PromptTokens: 60, CompletionTokens: 40})
+	if _, err := Admit(key, 1, 0); err != ErrTokenQuota {
+		t.Errorf("Admit after token quota = %v, want ErrTokenQuota", err)
+	}
+
+	info, ok := Lookup(key)
+	if !ok || info.Session != 7 || info.Requests != 1 || info.Tokens != 100 || info.ExpiresAt.IsZero() {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if len(charged) != 1 || charged[0].CompletionTokens != 40 {
+		t.Errorf("OnUsage should receive the charged usage, got %+v", charged)
+	}
+	if _, err := Admit("nonexistent", 1, 0); err != ErrInvalidKey {
+		t.Errorf("Admit with unknown key = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestAdmitRequestQuota(t *testing.T) {
+	key, err := NewWithLimits(10, Limits{MaxRequests: 2})
+	if err != nil {
+		t.Fatalf("NewWithLimits failed: %v", err)
+	}
+	defer Delete(key)
+
+	for i := range 2 {
+		if _, err := Admit(key, int32(i), 0); err != nil {
+			t.Fatalf("Admit #%d failed: %v", i, err)
+		}
+	}
+	if _, err := Admit(key, 0, 0); err != ErrRequestQuota {
+		t.Errorf("third Admit = %v, want ErrRequestQuota", err)
+	}
+}
+
+func TestChargeAfterDelete(t *testing.T) {
+	var charged []Usage
+	key, err := NewWithLimits(10, Limits{OnUsage: func(u Usage) { charged = append(charged, u) }})
+	if err != nil {
+		t.Fatalf("NewWithLimits failed: %v", err)
+	}
+	adm, err := Admit(key, 1, 0)
+	if err != nil {
+		t.Fatalf("Admit failed: %v", err)
+	}
+
+	// 请求进行中 key 被撤销，用量仍应计入
+	Delete(key)
+	adm.Charge(Usage{ModelID: 1, PromptTokens: 10, CompletionTokens: 5})
+	if len(charged) != 1 || charged[0].PromptTokens != 10 {
+		t.Errorf("usage of a deleted key should still reach OnUsage, got %+v", charged)
+	}
+	if _, err := Admit(key, 1, 0); err != ErrInvalidKey {
+		t.Errorf("Admit after Delete = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestAdmitReservesTokens(t *testing.T) {
+	key, err := NewWithLimits(10, Limits{MaxTokens: 100})
+	if err != nil {
+		t.Fatalf("NewWithLimits failed: %v", err)
+	}
+	defer Delete(key)
+
+	// 并发放行的请求预留额度之和不超过配额
+	var (
+		mu       sync.Mutex
+		admitted []*Admission
+		wg       sync.WaitGroup
+	)
+	for range 10 {
+		wg.Go(func() {
+			adm, err := Admit(key, 1, 30)
+			if err == ErrTokenQuota {
+				return
+			}
+			if err != nil {
+				t.Errorf("Admit failed: %v", err)
+				return
+			}
+			mu.Lock()
+			admitted = append(admitted, adm)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	var reserved uint64
+	for _, adm := range admitted {
+		reserved += adm.Reserved()
+	}
+	if len(admitted) != 4 || reserved != 100 {
+		t.Fatalf("expected 4 admissions reserving 100 tokens, got %d reserving %d", len(admitted), reserved)
+	}
+	if _, err := Admit(key, 1, 30); err != ErrTokenQuota {
+		t.Errorf("Admit with fully reserved quota = %v, want ErrTokenQuota", err)
+	}
+
+	// 计费与释放归还预留，实际用量计入已用额度
+	admitted[0].Charge(Usage{PromptTokens: 10})
+	for _, adm := range admitted[1:] {
+		adm.Release()
+	}
+	admitted[1].Release() // 重复释放无效
+	adm, err := Admit(key, 1, 0)
+	if err != nil {
+		t.Fatalf("Admit after release failed: %v", err)
+	}
+	if adm.Reserved() != 90 {
+		t.Errorf("reserve 0 should take the remaining 90 tokens, got %d", adm.Reserved())
+	}
+}
@@ -3,6 +3,7 @@ package openai
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"sort"
 	"strconv"
@@ -17,6 +18,7 @@ import (
 	reqstructs "github.com/cxykevin/alkaid0/provider/request/structs"
 	"github.com/cxykevin/alkaid0/server/apikey"
 	"github.com/cxykevin/alkaid0/stats"
+	u "github.com/cxykevin/alkaid0/utils"
 )
 
 const apiPrefix = "/openai/v1"
@@ -45,7 +47,7 @@ type modelListResponse struct {
 }
 
 func (h *Handler) models(w http.ResponseWriter, r *http.Request) {
-	if !h.authorize(w, r) {
+	if _, ok := h.authorize(w, r); !ok {
 		return
 	}
 	if r.Method != http.MethodGet {
@@ -108,8 +110,16 @@ func providerConfig(model configuredModel) (string, string) {
 	return baseURL, key
 }
 
+// chatConfig 返回填入实际上游地址与 key 的模型配置，供按 ProviderType 转发
+func chatConfig(model configuredModel, baseURL, providerKey string) *cfgstructs.ModelConfig {
+	cfg := model.config
+	cfg.ProviderURL, cfg.ProviderKey = baseURL, providerKey
+	return &cfg
+}
+
 func (h *Handler) chatCompletions(w http.ResponseWriter, r *http.Request) {
-	if !h.authorize(w, r) {
+	key, ok := h.authorize(w, r)
+	if !ok {
 		return
 	}
 	if r.Method != http.MethodPost {
@@ -134,17 +144,57 @@ func (h *Handler) chatCompletions(w http.ResponseWriter, r *http.Request) {
 		h.error(w, http.StatusNotFound, "model not found or is not a chat model", "invalid_request_error", "model")
 		return
 	}
+	reserve, prompt := chatReserve(body)
+	adm, ok := h.admit(w, key, model, reserve)
+	if !ok {
+		return
+	}
 	baseURL, providerKey := providerConfig(model)
 	if baseURL == "" {
+		adm.Release()
 		h.error(w, http.StatusBadGateway, "model provider URL is not configured", "server_error", nil)
 		return
 	}
 	body.Model = model.config.ModelID
+	clampCompletion(&body, adm.Reserved(), prompt)
 	if body.Stream {
-		h.streamChat(w, r, body, model, baseURL, providerKey)
+		h.streamChat(w, r, adm, body, model, baseURL, providerKey)
+		return
+	}
+	h.completeChat(w, r, adm, body, model, baseURL, providerKey)
+}
+
+// chatReserve 估算请求需预留的 token：提示词估算加补全上限。
+// 未指定补全上限时 reserve 为 0，即预留 key 的全部剩余配额。
+func chatReserve(body reqstructs.ChatCompletionRequest) (reserve, prompt uint64) {
+	data, _ := json.Marshal(body.Messages)
+	prompt = uint64(u.EstimateTokens(string(data)))
+	limit := body.MaxTokens
+	if body.MaxCompletionTokens != nil {
+		limit = body.MaxCompletionTokens
+	}
+	if limit == nil || *limit <= 0 {
+		return 0, prompt
+	}
+	return prompt + uint64(*limit), prompt
+}
+
+// clampCompletion 把补全上限收紧到预留额度（扣除提示词估算）以内；reserved 为 0 表示 key 不限 token。
+func clampCompletion(body *reqstructs.ChatCompletionRequest, reserved, prompt uint64) {
+	if reserved == 0 {
 		return
 	}
-	h.completeChat(w, r, body, model, baseURL, providerKey)
+	limit := 1
+	if reserved > prompt {
+		limit = int(min(reserved-prompt, math.MaxInt32))
+	}
+	field := &body.MaxTokens
+	if body.MaxCompletionTokens != nil {
+		field = &body.MaxCompletionTokens
+	}
+	if *field == nil || **field <= 0 || **field > limit {
+		*field = &limit
+	}
 }
 
 type chatAccumulator struct {
@@ -240,9 +290,10 @@ func max32(a, b uint32) uint32 {
 	return b
 }
 
-func (h *Handler) streamChat(w http.ResponseWriter, r *http.Request, body reqstructs.ChatCompletionRequest, model configuredModel, baseURL, providerKey string) {
+func (h *Handler) streamChat(w http.ResponseWriter, r *http.Request, adm *apikey.Admission, body reqstructs.ChatCompletionRequest, model configuredModel, baseURL, providerKey string) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
+		adm.Release()
 		h.error(w, http.StatusInternalServerError, "streaming unsupported", "server_error", nil)
 		return
 	}
@@ -250,10 +301,17 @@ func (h *Handler) streamChat(w http.ResponseWriter, r *http.Request, body reqstr
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	includeUsage := body.StreamOptions != nil && body.StreamOptions.IncludeUsage
+	// 计费需要用量：上游总是带上用量，客户端未要求时在转发前去掉
+	body.StreamOptions = &reqstructs.ChatCompletionStreamOptions{IncludeUsage: true}
 	var acc chatAccumulator
-	err := request.SimpleOpenAIRequest(r.Context(), baseURL, providerKey, model.config.ModelID, body, nil, func(resp reqstructs.ChatCompletionResponse) error {
+	// 上游出错或客户端断开时已产生的用量同样计费
+	defer h.recordUsage(adm, model, &acc)
+	err := request.ChatRequest(r.Context(), chatConfig(model, baseURL, providerKey), body, nil, func(resp reqstructs.ChatCompletionResponse) error {
 		acc.add(resp)
 		if !includeUsage {
+			if resp.Usage != nil && len(resp.Choices) == 0 {
+				return nil
+			}
 			resp.Usage = nil
 		}
 		// Normalize regular upstream responses into streaming chunks.
@@ -300,7 +358,6 @@ func (h *Handler) streamChat(w http.ResponseWriter, r *http.Request, body reqstr
 		}
 		return
 	}
-	h.recordUsage(model, &acc)
 	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
 	flusher.Flush()
 }
@@ -320,17 +377,17 @@ type nonStreamingResponse struct {
 	Usage   *reqstructs.Usage    `json:"usage,omitempty"`
 }
 
-func (h *Handler) completeChat(w http.ResponseWriter, r *http.Request, body reqstructs.ChatCompletionRequest, model configuredModel, baseURL, providerKey string) {
+func (h *Handler) completeChat(w http.ResponseWriter, r *http.Request, adm *apikey.Admission, body reqstructs.ChatCompletionRequest, model configuredModel, baseURL, providerKey string) {
 	var acc chatAccumulator
-	err := request.SimpleOpenAIRequest(r.Context(), baseURL, providerKey, model.config.ModelID, body, nil, func(resp reqstructs.ChatCompletionResponse) error {
+	err := request.ChatRequest(r.Context(), chatConfig(model, baseURL, providerKey), body, nil, func(resp reqstructs.ChatCompletionResponse) error {
 		acc.add(resp)
 		return nil
 	})
+	h.recordUsage(adm, model, &acc)
 	if err != nil {
 		h.error(w, http.StatusBadGateway, err.Error(), "upstream_error", nil)
 		return
 	}
-	h.recordUsage(model, &acc)
 	acc.mu.Lock()
 	message := reqstructs.Message{Role: acc.role, Content: acc.content.String()}
 	if message.Role == "" {
@@ -359,10 +416,11 @@ func (h *Handler) completeChat(w http.ResponseWriter, r *http.Request, body reqs
 	h.json(w, http.StatusOK, resp)
 }
 
-func (h *Handler) recordUsage(model configuredModel, acc *chatAccumulator) {
+func (h *Handler) recordUsage(adm *apikey.Admission, model configuredModel, acc *chatAccumulator) {
 	acc.mu.Lock()
 	defer acc.mu.Unlock()
 	if !acc.hasUsage {
+		adm.Release()
 		return
 	}
 	cached := max32(acc.usage.CachedTokens, acc.usage.DeepseekCachedToken)
@@ -373,10 +431,18 @@ func (h *Handler) recordUsage(model configuredModel, acc *chatAccumulator) {
 		cached = max32(cached, acc.usage.BillingUsage.ClaudeUsage.CacheReadInputTokens)
 	}
 	stats.AddUsage(uint32(model.id), model.config.ModelName, acc.usage.PromptTokens, acc.usage.CompletionTokens, cached)
+	adm.Charge(apikey.Usage{
+		ModelID:          model.id,
+		ModelName:        model.config.ModelName,
+		PromptTokens:     acc.usage.PromptTokens,
+		CompletionTokens: acc.usage.CompletionTokens,
+		CachedTokens:     cached,
+	})
 }
 
 func (h *Handler) embeddings(w http.ResponseWriter, r *http.Request) {
-	if !h.authorize(w, r) {
+	key, ok := h.authorize(w, r)
+	if !ok {
 		return
 	}
 	if r.Method != http.MethodPost {
@@ -397,13 +463,24 @@ func (h *Handler) embeddings(w http.ResponseWriter, r *http.Request) {
 		h.error(w, http.StatusNotFound, "model not found or is not an embedding model", "invalid_request_error", "model")
 		return
 	}
+	input, _ := json.Marshal(body.Input)
+	adm, ok := h.admit(w, key, model, uint64(u.EstimateTokens(string(input)+string(body.InputRaw))))
+	if !ok {
+		return
+	}
 	baseURL, providerKey := providerConfig(model)
 	if baseURL == "" {
+		adm.Release()
 		h.error(w, http.StatusBadGateway, "model provider URL is not configured", "server_error", nil)
 		return
 	}
 	body.Model = model.config.ModelID
 	resp, err := request.SimpleOpenAIEmbeddingResponse(r.Context(), baseURL, providerKey, model.config.ModelID, body)
+	if err != nil || resp.Usage == nil {
+		adm.Release()
+	} else {
+		adm.Charge(apikey.Usage{ModelID: model.id, ModelName: model.config.ModelName, PromptTokens: resp.Usage.PromptTokens})
+	}
 	if err != nil {
 		h.error(w, http.StatusBadGateway, err.Error(), "upstream_error", nil)
 		return
@@ -414,14 +491,30 @@ func (h *Handler) embeddings(w http.ResponseWriter, r *http.Request) {
 	h.json(w, http.StatusOK, resp)
 }
 
-func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) bool {
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
 	auth := strings.TrimSpace(r.Header.Get("Authorization"))
 	parts := strings.SplitN(auth, " ", 2)
 	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || !apikey.Validate(strings.TrimSpace(parts[1])) {
 		h.error(w, http.StatusUnauthorized, "invalid API key", "authentication_error", nil)
-		return false
+		return "", false
 	}
-	return true
+	return strings.TrimSpace(parts[1]), true
+}
+
+// admit 按 key 的模型白名单与配额放行请求并预留 reserve 个 token，拒绝时写出 OpenAI 格式的错误。
+func (h *Handler) admit(w http.ResponseWriter, key string, model configuredModel, reserve uint64) (*apikey.Admission, bool) {
+	adm, err := apikey.Admit(key, model.id, reserve)
+	switch err {
+	case nil:
+		return adm, true
+	case apikey.ErrModelNotAllowed:
+		h.error(w, http.StatusForbidden, err.Error(), "permission_error", "model")
+	case apikey.ErrRequestQuota, apikey.ErrTokenQuota:
+		h.error(w, http.StatusTooManyRequests, err.Error(), "insufficient_quota", nil)
+	default:
+		h.error(w, http.StatusUnauthorized, err.Error(), "authentication_error", nil)
+	}
+	return nil, false
 }
 
 func (h *Handler) json(w http.ResponseWriter, status int, v any) {
@@ -0,0 +1,230 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgstructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/server/apikey"
+	"github.com/cxykevin/alkaid0/stats"
+)
+
+// setupProxy 配置两个指向假上游的模型，返回挂载了 Handler 的测试服务
+func setupProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	return setupProxyWith(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":30,"completion_tokens":20,"total_tokens":50}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+}
+
+// setupProxyWith 同 setupProxy，上游由 upstreamFn 处理
+func setupProxyWith(t *testing.T, upstreamFn http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	stats.ResetForTest()
+	stats.SetFilePath(filepath.Join(t.TempDir(), "usage.json"))
+	t.Cleanup(stats.ResetForTest)
+	upstream := httptest.NewServer(upstreamFn)
+	t.Cleanup(upstream.Close)
+	t.Cleanup(config.GlobalConfigSwap(cfgstructs.Config{
+		Model: cfgstructs.ModelsConfig{
+			ProviderURL: upstream.URL,
+			Models: map[int32]cfgstructs.ModelConfig{
+				1: {ModelID: "allowed", ModelName: "Allowed"},
+				2: {ModelID: "other", ModelName: "Other"},
+			},
+		},
+	}))
+	mux := http.NewServeMux()
+	NewHandler().Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func postChat(t *testing.T, srv *httptest.Server, key, model string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+apiPrefix+"/chat/completions",
+		strings.NewReader(`{"model":"`+model+`","messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestChatCompletions_KeyLimits(t *testing.T) {
+	srv := setupProxy(t)
+	var charged []apikey.Usage
+	key, err := apikey.NewWithLimits(10, apikey.Limits{
+		Models:    []int32{1},
+		MaxTokens: 80,
+		OnUsage:   func(u apikey.Usage) { charged = append(charged, u) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer apikey.Delete(key)
+
+	if status := postChat(t, srv, key, "other"); status != http.StatusForbidden {
+		t.Errorf("disallowed model should get 403, got %d", status)
+	}
+	for i := range 2 {
+		if status := postChat(t, srv, key, "allowed"); status != http.StatusOK {
+			t.Fatalf("request #%d should succeed, got %d", i, status)
+		}
+	}
+	// 已用 100 token，超出 80 的配额
+	if status := postChat(t, srv, key, "allowed"); status != http.StatusTooManyRequests {
+		t.Errorf("exhausted token quota should get 429, got %d", status)
+	}
+	if len(charged) != 2 || charged[0].ModelID != 1 || charged[0].PromptTokens != 30 || charged[0].CompletionTokens != 20 {
+		t.Errorf("usage should be charged to the key, got %+v", charged)
+	}
+	if status := postChat(t, srv, "bad", "allowed"); status != http.StatusUnauthorized {
+		t.Errorf("invalid key should get 401, got %d", status)
+	}
+}
+
+// TestChatCompletions_StreamChargesWithoutStreamOptions 客户端未请求用量时仍向上游要求用量并计费，但不转发用量
+func TestChatCompletions_StreamChargesWithoutStreamOptions(t *testing.T) {
+	srv := setupProxyWith(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			StreamOptions *struct {
+				IncludeUsage bool `json:"include_usage"`
+			} `json:"stream_options"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`+"\n\n")
+		// 与 OpenAI 一致：只有请求了 include_usage 才在末尾发送用量块
+		if body.StreamOptions != nil && body.StreamOptions.IncludeUsage {
+			fmt.Fprint(w, `data: {"id":"c1","choices":[],"usage":{"prompt_tokens":30,"completion_tokens":20,"total_tokens":50}}`+"\n\n")
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	var charged []apikey.Usage
+	key, err := apikey.NewWithLimits(10, apikey.Limits{
+		MaxTokens: 80,
+		OnUsage:   func(u apikey.Usage) { charged = append(charged, u) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer apikey.Delete(key)
+
+	for i := range 2 {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+apiPrefix+"/chat/completions",
+			strings.NewReader(`{"model":"allowed","stream":true,"messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(data), `"hi"`) {
+			t.Fatalf("stream #%d failed: %d %s", i, resp.StatusCode, data)
+		}
+		if strings.Contains(string(data), "usage") {
+			t.Errorf("usage must not be forwarded to a client that did not ask for it: %s", data)
+		}
+	}
+	if len(charged) != 2 || charged[0].PromptTokens != 30 || charged[0].CompletionTokens != 20 {
+		t.Errorf("streamed usage should be charged to the key, got %+v", charged)
+	}
+	if status := postChat(t, srv, key, "allowed"); status != http.StatusTooManyRequests {
+		t.Errorf("exhausted token quota should get 429, got %d", status)
+	}
+}
+
+// TestChatCompletions_StreamChargesDeletedKey 流式请求进行中 key 被撤销，用量仍计入 key 的 OnUsage
+func TestChatCompletions_StreamChargesDeletedKey(t *testing.T) {
+	var key string
+	srv := setupProxyWith(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		apikey.Delete(key)
+		fmt.Fprint(w, `data: {"id":"c1","choices":[],"usage":{"prompt_tokens":30,"completion_tokens":20,"total_tokens":50}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	var charged []apikey.Usage
+	var err error
+	key, err = apikey.NewWithLimits(10, apikey.Limits{
+		OnUsage: func(u apikey.Usage) { charged = append(charged, u) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer apikey.Delete(key)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+apiPrefix+"/chat/completions",
+		strings.NewReader(`{"model":"allowed","stream":true,"messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream failed: %d", resp.StatusCode)
+	}
+	if apikey.Validate(key) {
+		t.Fatal("key should have been deleted during the stream")
+	}
+	if len(charged) != 1 || charged[0].PromptTokens != 30 || charged[0].CompletionTokens != 20 {
+		t.Errorf("usage of a key deleted mid-stream should still be charged, got %+v", charged)
+	}
+}
+
+// TestChatCompletions_ClampsCompletionToReserve 补全上限被收紧到 key 剩余配额内
+func TestChatCompletions_ClampsCompletionToReserve(t *testing.T) {
+	var got []int
+	srv := setupProxyWith(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			MaxTokens *int `json:"max_tokens"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.MaxTokens != nil {
+			got = append(got, *body.MaxTokens)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":30,"completion_tokens":20,"total_tokens":50}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	key, err := apikey.NewWithLimits(10, apikey.Limits{MaxTokens: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer apikey.Delete(key)
+
+	for _, limit := range []string{`,"max_tokens":1000`, ""} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+apiPrefix+"/chat/completions",
+			strings.NewReader(`{"model":"allowed","messages":[{"role":"user","content":"hello"}]`+limit+`}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request failed: %d", resp.StatusCode)
+		}
+	}
+	// 第一次剩余 80，第二次剩余 30，均需扣除提示词估算
+	if len(got) != 2 || got[0] <= 0 || got[0] >= 80 || got[1] <= 0 || got[1] >= 30 {
+		t.Errorf("max_tokens should be clamped to the remaining quota, got %v", got)
+	}
+}
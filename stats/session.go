@@ -0,0 +1,280 @@
+package stats
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"github.com/cxykevin/alkaid0/config"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	"gorm.io/gorm"
+)
+
+// CostStat 一组请求的 token 用量与费用。
+type CostStat struct {
+	PromptTokens     uint64  `json:"prompt_tokens"`
+	CompletionTokens uint64  `json:"completion_tokens"`
+	CachedTokens     uint64  `json:"cached_tokens"`
+	Requests         uint64  `json:"requests"`
+	Cost             float64 `json:"cost"`
+}
+
+// ModelCost 单个模型的用量与费用。
+type ModelCost struct {
+	ModelID   uint32 `json:"model_id"`
+	ModelName string `json:"model_name"`
+	CostStat
+}
+
+// AgentCost 单个代理的用量与费用，AgentID 为空表示主代理。
+type AgentCost struct {
+	AgentID string `json:"agent_id"`
+	CostStat
+	Models []ModelCost `json:"models"`
+}
+
+// SessionCost 单个会话的费用统计，按当前配置的模型价格从消息用量计算。
+type SessionCost struct {
+	Currency string      `json:"currency"`
+	Total    CostStat    `json:"total"`
+	Agents   []AgentCost `json:"agents"` // 主代理在前，其余按 AgentID 升序
+	Models   []ModelCost `json:"models"` // 按 ModelID 升序
+	Proxy    CostStat    `json:"proxy"`  // 其中经内置 OpenAI 代理（Python 脚本）发出的部分
+}
+
+// add 累计另一组用量。
+func (c *CostStat) add(o CostStat) {
+	c.PromptTokens += o.PromptTokens
+	c.CompletionTokens += o.CompletionTokens
+	c.CachedTokens += o.CachedTokens
+	c.Requests += o.Requests
+	c.Cost += o.Cost
+}
+
+// MessageCost 按当前模型价格计算单条消息的费用，模型未配置时为 0。
+func MessageCost(msg *structs.Messages) float64 {
+	return usageCost(msg.ModelID, uint64(msg.PromptTokens), uint64(msg.CompletionTokens), uint64(msg.CachedTokens))
+}
+
+// usageCost 按模型价格计算费用。
+func usageCost(modelID uint32, prompt, completion, cached uint64) float64 {
+	modelCfg, ok := config.GlobalConfig.Model.Models[int32(modelID)]
+	if !ok {
+		return 0
+	}
+	return modelCfg.Cost(prompt, completion, cached)
+}
+
+// modelName 返回模型显示名，未配置时为空。
+func modelName(modelID uint32) string {
+	return config.GlobalConfig.Model.Models[int32(modelID)].ModelName
+}
+
+// usageRow 按代理与模型汇总的一组用量
+type usageRow struct {
+	AgentID          string
+	ModelID          uint32
+	PromptTokens     uint64
+	CompletionTokens uint64
+	CachedTokens     uint64
+	Requests         uint64
+}
+
+// sumUsage 按代理与模型汇总表内某会话带用量的记录。
+func sumUsage(db *gorm.DB, table any, chatID uint32) ([]usageRow, error) {
+	var rows []usageRow
+	err := db.Model(table).
+		Select("COALESCE(agent_id, '') AS agent_id, model_id, "+
+			"SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, "+
+			"SUM(cached_tokens) AS cached_tokens, COUNT(*) AS requests").
+		Where("chat_id = ? AND (prompt_tokens > 0 OR completion_tokens > 0)", chatID).
+		Group("COALESCE(agent_id, ''), model_id").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// ComputeSessionCost 统计会话内所有带用量的消息与内置代理请求，按代理与模型分组计算费用。
+// 代理请求计入发起它的代理，同时单独汇总在 Proxy。
+func ComputeSessionCost(db *gorm.DB, chatID uint32) (SessionCost, error) {
+	rows, err := sumUsage(db, &structs.Messages{}, chatID)
+	if err != nil {
+		return SessionCost{}, err
+	}
+	var proxyRows []usageRow
+	if db.Migrator().HasTable(&structs.ProxyUsages{}) {
+		if proxyRows, err = sumUsage(db, &structs.ProxyUsages{}, chatID); err != nil {
+			return SessionCost{}, err
+		}
+	}
+
+	result := SessionCost{Currency: Currency(), Agents: []AgentCost{}, Models: []ModelCost{}}
+	agents := map[string]*AgentCost{}
+	agentModels := map[string]map[uint32]*ModelCost{}
+	models := map[uint32]*ModelCost{}
+	for i, row := range append(rows, proxyRows...) {
+		stat := CostStat{
+			PromptTokens:     row.PromptTokens,
+			CompletionTokens: row.CompletionTokens,
+			CachedTokens:     row.CachedTokens,
+			Requests:         row.Requests,
+			Cost:             usageCost(row.ModelID, row.PromptTokens, row.CompletionTokens, row.CachedTokens),
+		}
+		result.Total.add(stat)
+		if i >= len(rows) {
+			result.Proxy.add(stat)
+		}
+
+		agent, ok := agents[row.AgentID]
+		if !ok {
+			agent = &AgentCost{AgentID: row.AgentID, Models: []ModelCost{}}
+			agents[row.AgentID] = agent
+			agentModels[row.AgentID] = map[uint32]*ModelCost{}
+		}
+		agent.add(stat)
+		agentModel, ok := agentModels[row.AgentID][row.ModelID]
+		if !ok {
+			agentModel = &ModelCost{ModelID: row.ModelID, ModelName: modelName(row.ModelID)}
+			agentModels[row.AgentID][row.ModelID] = agentModel
+		}
+		agentModel.add(stat)
+
+		model, ok := models[row.ModelID]
+		if !ok {
+			model = &ModelCost{ModelID: row.ModelID, ModelName: modelName(row.ModelID)}
+			models[row.ModelID] = model
+		}
+		model.add(stat)
+	}
+
+	byModelID := func(a, b ModelCost) int { return cmp.Compare(a.ModelID, b.ModelID) }
+	for id, agent := range agents {
+		for _, model := range agentModels[id] {
+			agent.Models = append(agent.Models, *model)
+		}
+		slices.SortFunc(agent.Models, byModelID)
+		result.Agents = append(result.Agents, *agent)
+	}
+	// 空字符串（主代理）自然排在最前
+	slices.SortFunc(result.Agents, func(a, b AgentCost) int { return cmp.Compare(a.AgentID, b.AgentID) })
+	for _, model := range models {
+		result.Models = append(result.Models, *model)
+	}
+	slices.SortFunc(result.Models, byModelID)
+	return result, nil
+}
+
+// CostTracker 维护会话累计费用，供流式 usage_update 实时展示。
+// 首次更新时汇总一次历史用量；之后每换一条消息，按 ID 增量计入期间落库的消息（子代理、摘要等）
+// 与内置代理请求，当前消息按实时用量计入。已计入的消息被删除（回滚、删除历史）时重新汇总。
+type CostTracker struct {
+	mu        sync.Mutex
+	loaded    bool
+	base      float64 // 除当前消息外的累计费用
+	msgID     uint64
+	modelID   uint32
+	msgCost   float64
+	lastMsgID uint64 // 已计入的最后一条消息
+	counted   int64  // ID 不超过 lastMsgID 的消息数，用于发现历史被删除
+	proxyID   uint64 // 已计入的最后一条内置代理用量记录
+}
+
+// Update 以消息 msgID 当前的累计用量更新并返回会话累计费用。
+func (t *CostTracker) Update(db *gorm.DB, chatID uint32, msgID uint64, prompt, completion, cached uint64) (float64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.loaded || msgID != t.msgID {
+		var msg structs.Messages
+		if err := db.Select("id", "model_id", "prompt_tokens", "completion_tokens", "cached_tokens").
+			Where("id = ?", msgID).Limit(1).Find(&msg).Error; err != nil {
+			return 0, err
+		}
+		synced := false
+		if t.loaded {
+			var n int64
+			if err := db.Model(&structs.Messages{}).Where("chat_id = ? AND id <= ?", chatID, t.lastMsgID).
+				Count(&n).Error; err != nil {
+				return 0, err
+			}
+			synced = n == t.counted
+		}
+		if synced {
+			t.base += t.msgCost
+			cost, err := t.newMessageCost(db, chatID, msgID)
+			if err != nil {
+				return 0, err
+			}
+			t.base += cost
+			if cost, err = t.newProxyCost(db, chatID); err != nil {
+				return 0, err
+			}
+			t.base += cost
+		} else if err := t.resync(db, chatID, &msg); err != nil {
+			return 0, err
+		}
+		t.msgID = msgID
+		t.modelID = msg.ModelID
+	}
+	t.msgCost = usageCost(t.modelID, prompt, completion, cached)
+	return t.base + t.msgCost, nil
+}
+
+// resync 全量汇总会话费用，扣除当前消息已落库的部分，由 Update 按实时用量重新计入。
+func (t *CostTracker) resync(db *gorm.DB, chatID uint32, msg *structs.Messages) error {
+	total, err := ComputeSessionCost(db, chatID)
+	if err != nil {
+		return err
+	}
+	if err := db.Model(&structs.Messages{}).Where("chat_id = ?", chatID).
+		Select("COALESCE(MAX(id), 0)").Scan(&t.lastMsgID).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&structs.Messages{}).Where("chat_id = ? AND id <= ?", chatID, t.lastMsgID).
+		Count(&t.counted).Error; err != nil {
+		return err
+	}
+	t.proxyID = 0
+	if db.Migrator().HasTable(&structs.ProxyUsages{}) {
+		if err := db.Model(&structs.ProxyUsages{}).Where("chat_id = ?", chatID).
+			Select("COALESCE(MAX(id), 0)").Scan(&t.proxyID).Error; err != nil {
+			return err
+		}
+	}
+	t.base = total.Total.Cost - MessageCost(msg)
+	t.loaded = true
+	return nil
+}
+
+// newMessageCost 计算上次更新后新落库的消息费用，当前消息 msgID 除外（按实时用量计入）。
+func (t *CostTracker) newMessageCost(db *gorm.DB, chatID uint32, msgID uint64) (float64, error) {
+	var rows []structs.Messages
+	if err := db.Select("id", "model_id", "prompt_tokens", "completion_tokens", "cached_tokens").
+		Where("chat_id = ? AND id > ?", chatID, t.lastMsgID).Order("id").Find(&rows).Error; err != nil {
+		return 0, err
+	}
+	cost := 0.0
+	for _, row := range rows {
+		if row.ID != msgID {
+			cost += MessageCost(&row)
+		}
+		t.lastMsgID = row.ID
+		t.counted++
+	}
+	return cost, nil
+}
+
+// newProxyCost 计算上次更新后新增的内置代理请求费用。
+func (t *CostTracker) newProxyCost(db *gorm.DB, chatID uint32) (float64, error) {
+	if !db.Migrator().HasTable(&structs.ProxyUsages{}) {
+		return 0, nil
+	}
+	var rows []structs.ProxyUsages
+	if err := db.Where("chat_id = ? AND id > ?", chatID, t.proxyID).Order("id").Find(&rows).Error; err != nil {
+		return 0, err
+	}
+	cost := 0.0
+	for _, row := range rows {
+		cost += usageCost(row.ModelID, uint64(row.PromptTokens), uint64(row.CompletionTokens), uint64(row.CachedTokens))
+		t.proxyID = row.ID
+	}
+	return cost, nil
+}
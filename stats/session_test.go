@@ -0,0 +1,112 @@
+package stats
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStruct "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	u "github.com/cxykevin/alkaid0/utils"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestComputeSessionCost(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer u.Unwrap(db.DB()).Close()
+	if err := db.AutoMigrate(&structs.Messages{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	config.GlobalConfigSwap(cfgStruct.Config{
+		Model: cfgStruct.ModelsConfig{
+			Models: map[int32]cfgStruct.ModelConfig{
+				1: {ModelName: "Big", InputPrice: 2, OutputPrice: 8},
+				2: {ModelName: "Small", InputPrice: 1, OutputPrice: 1},
+			},
+		},
+	})
+
+	sub := "reviewer"
+	msgs := []structs.Messages{
+		{ChatID: 1, ModelID: 1, PromptTokens: 1_000_000, CompletionTokens: 100_000},
+		{ChatID: 1, ModelID: 1, PromptTokens: 500_000},
+		{ChatID: 1, ModelID: 2, AgentID: &sub, PromptTokens: 1_000_000, CompletionTokens: 1_000_000},
+		{ChatID: 1, Type: structs.MessagesRoleUser},
+		{ChatID: 2, ModelID: 1, PromptTokens: 1_000_000},
+	}
+	if err := db.Create(&msgs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := MessageCost(&msgs[0]); math.Abs(got-2.8) > 1e-9 {
+		t.Fatalf("MessageCost = %v, want 2.8", got)
+	}
+
+	cost, err := ComputeSessionCost(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.Total.Requests != 3 || math.Abs(cost.Total.Cost-5.8) > 1e-9 {
+		t.Fatalf("unexpected total: %+v", cost.Total)
+	}
+	if len(cost.Agents) != 2 || cost.Agents[0].AgentID != "" || cost.Agents[1].AgentID != "reviewer" {
+		t.Fatalf("unexpected agents: %+v", cost.Agents)
+	}
+	if main := cost.Agents[0]; main.Requests != 2 || math.Abs(main.Cost-3.8) > 1e-9 || len(main.Models) != 1 {
+		t.Fatalf("unexpected main agent: %+v", main)
+	}
+	if len(cost.Models) != 2 || cost.Models[1].ModelName != "Small" || math.Abs(cost.Models[1].Cost-2) > 1e-9 {
+		t.Fatalf("unexpected models: %+v", cost.Models)
+	}
+	if cost.Currency != "USD" {
+		t.Fatalf("currency should default to USD, got %q", cost.Currency)
+	}
+}
+
+func TestComputeSessionCost_Proxy(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer u.Unwrap(db.DB()).Close()
+	if err := db.AutoMigrate(&structs.Messages{}, &structs.ProxyUsages{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	config.GlobalConfigSwap(cfgStruct.Config{
+		Model: cfgStruct.ModelsConfig{
+			Models: map[int32]cfgStruct.ModelConfig{
+				1: {ModelName: "Big", InputPrice: 2, OutputPrice: 8},
+			},
+		},
+	})
+
+	if err := db.Create(&structs.Messages{ChatID: 1, ModelID: 1, PromptTokens: 1_000_000}).Error; err != nil {
+		t.Fatal(err)
+	}
+	proxy := []structs.ProxyUsages{
+		{ChatID: 1, ModelID: 1, PromptTokens: 500_000},
+		{ChatID: 1, ModelID: 1, CompletionTokens: 250_000},
+		{ChatID: 2, ModelID: 1, PromptTokens: 1_000_000},
+	}
+	if err := db.Create(&proxy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cost, err := ComputeSessionCost(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.Proxy.Requests != 2 || math.Abs(cost.Proxy.Cost-3) > 1e-9 {
+		t.Fatalf("unexpected proxy stat: %+v", cost.Proxy)
+	}
+	if cost.Total.Requests != 3 || math.Abs(cost.Total.Cost-5) > 1e-9 {
+		t.Fatalf("proxy usage should count toward the total: %+v", cost.Total)
+	}
+	// 代理用量并入主代理的同一模型条目
+	if len(cost.Agents) != 1 || len(cost.Agents[0].Models) != 1 || cost.Agents[0].Models[0].Requests != 3 {
+		t.Fatalf("unexpected agents: %+v", cost.Agents)
+	}
+}
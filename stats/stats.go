@@ -2,7 +2,7 @@
 //
 // 统计数据持久化在配置文件同目录的 usage.json（仿全局 memory 的存放位置），
 // 只累计主对话请求（provider/request.SendRequest 路径），嵌入、标题总结等不计入。
-// 所有统计按模型（ModelID）分别累计。
+// 所有统计按模型（ModelID）分别累计，费用按请求时的模型价格计入。
 package stats
 
 import (
@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,8 +24,10 @@ import (
 // Info 对外只读快照，供 /info 等端点 JSON 序列化。
 type Info struct {
 	UpdatedAt time.Time   `json:"updated_at"`
+	Currency  string      `json:"currency"`
 	Total     TotalStat   `json:"total"`
-	Models    []ModelStat `json:"models"` // 按 ModelID 升序
+	Models    []ModelStat `json:"models"`         // 按 ModelID 升序
+	Keys      []KeyStat   `json:"keys,omitempty"` // Key 池中各 key 的用量，按地址与标签排序
 }
 
 // TotalStat 全局总计（跨所有模型）。
@@ -34,6 +37,7 @@ type TotalStat struct {
 	CachedTokens     uint64  `json:"cached_tokens"`
 	CacheHitRatio    float64 `json:"cache_hit_ratio"` // = cached / prompt，保留 4 位小数
 	Requests         uint64  `json:"requests"`
+	Cost             float64 `json:"cost"`
 }
 
 // ModelStat 单个模型的统计。
@@ -45,24 +49,47 @@ type ModelStat struct {
 	CachedTokens     uint64  `json:"cached_tokens"`
 	CacheHitRatio    float64 `json:"cache_hit_ratio"`
 	Requests         uint64  `json:"requests"`
+	Cost             float64 `json:"cost"`
 }
 
-// modelRecord 内部持久化结构（写盘 schema 的一部分）。
-type modelRecord struct {
-	ModelID          uint32 `json:"model_id"`
-	ModelName        string `json:"model_name"`
+// KeyStat 单个 provider key 的用量。key 只以脱敏标签出现，不保存原文。
+// 统计经 Key 池发出的所有请求（含标题、摘要与嵌入），因此与按模型的统计口径不同。
+type KeyStat struct {
+	ProviderURL      string `json:"provider_url"`
+	Key              string `json:"key"` // 脱敏标签，见 KeyLabel
 	PromptTokens     uint64 `json:"prompt_tokens"`
 	CompletionTokens uint64 `json:"completion_tokens"`
 	CachedTokens     uint64 `json:"cached_tokens"`
 	Requests         uint64 `json:"requests"`
+	RateLimited      uint64 `json:"rate_limited"`       // 被限流（429）的次数
+	Rejected         uint64 `json:"rejected"`           // 被拒绝（401/402）的次数
+	Disabled         string `json:"disabled,omitempty"` // 运行时禁用原因，由调用方按 Key 池状态填充，不落盘
+}
+
+// KeyEvent 一次经 Key 池发出的请求的结果。
+type KeyEvent struct {
+	PromptTokens, CompletionTokens, CachedTokens uint32
+	RateLimited, Rejected                        bool
+}
+
+// modelRecord 内部持久化结构（写盘 schema 的一部分）。
+type modelRecord struct {
+	ModelID          uint32  `json:"model_id"`
+	ModelName        string  `json:"model_name"`
+	PromptTokens     uint64  `json:"prompt_tokens"`
+	CompletionTokens uint64  `json:"completion_tokens"`
+	CachedTokens     uint64  `json:"cached_tokens"`
+	Requests         uint64  `json:"requests"`
+	Cost             float64 `json:"cost,omitempty"`
 }
 
 // totalRecord 内部持久化的总计结构。
 type totalRecord struct {
-	PromptTokens     uint64 `json:"prompt_tokens"`
-	CompletionTokens uint64 `json:"completion_tokens"`
-	CachedTokens     uint64 `json:"cached_tokens"`
-	Requests         uint64 `json:"requests"`
+	PromptTokens     uint64  `json:"prompt_tokens"`
+	CompletionTokens uint64  `json:"completion_tokens"`
+	CachedTokens     uint64  `json:"cached_tokens"`
+	Requests         uint64  `json:"requests"`
+	Cost             float64 `json:"cost,omitempty"`
 }
 
 // fileData usage.json 的磁盘 schema。缓存比属于派生字段，读时计算、不落盘。
@@ -71,6 +98,7 @@ type fileData struct {
 	UpdatedAt     time.Time              `json:"updated_at"`
 	Total         totalRecord            `json:"total"`
 	Models        map[uint32]modelRecord `json:"models"`
+	Keys          map[string]KeyStat     `json:"keys,omitempty"` // providerURL + " " + 标签 → 用量
 }
 
 // 磁盘 schema 版本，结构变更时递增并处理迁移。
@@ -105,15 +133,59 @@ func AddUsage(modelID uint32, modelName string, promptTokens, completionTokens,
 	rec.CompletionTokens += uint64(completionTokens)
 	rec.CachedTokens += uint64(cachedTokens)
 	rec.Requests++
+	cost := 0.0
+	if modelCfg, ok := config.GlobalConfig.Model.Models[int32(modelID)]; ok {
+		cost = modelCfg.Cost(uint64(promptTokens), uint64(completionTokens), uint64(cachedTokens))
+	}
+	rec.Cost += cost
 	data.Models[modelID] = rec
 	data.Total.PromptTokens += uint64(promptTokens)
 	data.Total.CompletionTokens += uint64(completionTokens)
 	data.Total.CachedTokens += uint64(cachedTokens)
 	data.Total.Requests++
+	data.Total.Cost += cost
 	data.UpdatedAt = time.Now()
 	_ = persistLocked()
 }
 
+// AddKeyUsage 累计 Key 池中某个 key 的一次请求并写盘。key 传原文，落盘前转换为脱敏标签。
+func AddKeyUsage(providerURL, key string, ev KeyEvent) {
+	ensureLoaded()
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	if data == nil {
+		data = newFileData()
+	}
+	if data.Keys == nil {
+		data.Keys = make(map[string]KeyStat)
+	}
+	label := KeyLabel(key)
+	id := providerURL + " " + label
+	rec := data.Keys[id]
+	rec.ProviderURL, rec.Key = providerURL, label
+	rec.PromptTokens += uint64(ev.PromptTokens)
+	rec.CompletionTokens += uint64(ev.CompletionTokens)
+	rec.CachedTokens += uint64(ev.CachedTokens)
+	rec.Requests++
+	if ev.RateLimited {
+		rec.RateLimited++
+	}
+	if ev.Rejected {
+		rec.Rejected++
+	}
+	data.Keys[id] = rec
+	data.UpdatedAt = time.Now()
+	_ = persistLocked()
+}
+
+// KeyLabel 返回 key 的脱敏标签：保留前 6 与后 4 个字符，短 key 只保留后 2 个
+func KeyLabel(key string) string {
+	if len(key) <= 12 {
+		return "…" + key[max(0, len(key)-2):]
+	}
+	return key[:6] + "…" + key[len(key)-4:]
+}
+
 // Reset 清零全局 token 统计并写盘，供 /usage reset 使用。
 // 返回写盘错误（若有）；内存统计无论写盘成败均已清零。
 func Reset() error {
@@ -131,16 +203,18 @@ func Snapshot() Info {
 	dataMu.RLock()
 	defer dataMu.RUnlock()
 	if data == nil {
-		return Info{Models: []ModelStat{}}
+		return Info{Currency: Currency(), Models: []ModelStat{}}
 	}
 	snap := Info{
 		UpdatedAt: data.UpdatedAt,
+		Currency:  Currency(),
 		Total: TotalStat{
 			PromptTokens:     data.Total.PromptTokens,
 			CompletionTokens: data.Total.CompletionTokens,
 			CachedTokens:     data.Total.CachedTokens,
 			CacheHitRatio:    cacheHitRatio(data.Total.PromptTokens, data.Total.CachedTokens),
 			Requests:         data.Total.Requests,
+			Cost:             data.Total.Cost,
 		},
 	}
 	for _, id := range sortedModelIDs(data.Models) {
@@ -153,11 +227,26 @@ func Snapshot() Info {
 			CachedTokens:     rec.CachedTokens,
 			CacheHitRatio:    cacheHitRatio(rec.PromptTokens, rec.CachedTokens),
 			Requests:         rec.Requests,
+			Cost:             rec.Cost,
 		})
 	}
+	for _, rec := range data.Keys {
+		snap.Keys = append(snap.Keys, rec)
+	}
+	slices.SortFunc(snap.Keys, func(a, b KeyStat) int {
+		return strings.Compare(a.ProviderURL+" "+a.Key, b.ProviderURL+" "+b.Key)
+	})
 	return snap
 }
 
+// Currency 返回模型价格的币种，未配置时为 USD。
+func Currency() string {
+	if c := config.GlobalConfig.Model.Currency; c != "" {
+		return c
+	}
+	return "USD"
+}
+
 // SetFilePath 覆盖持久化文件路径，仅测试用，须在首次 AddUsage/Snapshot 前调用。
 func SetFilePath(p string) {
 	dataMu.Lock()
@@ -5,8 +5,12 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStruct "github.com/cxykevin/alkaid0/config/structs"
 )
 
 // setup 重置单例并把持久化路径指向临时目录，避免污染真实配置目录。
@@ -203,3 +207,60 @@ func TestReset(t *testing.T) {
 		t.Fatalf("reset should persist empty state: %+v", snap)
 	}
 }
+
+func TestAddUsage_Cost(t *testing.T) {
+	setup(t)
+	config.GlobalConfigSwap(cfgStruct.Config{
+		Model: cfgStruct.ModelsConfig{
+			Currency: "CNY",
+			Models: map[int32]cfgStruct.ModelConfig{
+				1: {ModelName: "Kimi", InputPrice: 4, OutputPrice: 16, CachePrice: 1},
+			},
+		},
+	})
+	AddUsage(1, "Kimi", 1_000_000, 500_000, 250_000)
+	AddUsage(9, "Unknown", 1_000_000, 0, 0)
+	snap := Snapshot()
+	// 750k×4 + 250k×1 + 500k×16 = 3 + 0.25 + 8
+	if math.Abs(snap.Models[0].Cost-11.25) > 1e-9 || math.Abs(snap.Total.Cost-11.25) > 1e-9 {
+		t.Fatalf("unexpected cost: model %v total %v", snap.Models[0].Cost, snap.Total.Cost)
+	}
+	if snap.Models[1].Cost != 0 {
+		t.Fatalf("unpriced model should cost 0, got %v", snap.Models[1].Cost)
+	}
+	if snap.Currency != "CNY" {
+		t.Fatalf("currency = %q", snap.Currency)
+	}
+}
+
+func TestAddKeyUsage(t *testing.T) {
+	path := setup(t)
+	const key = "sk-proj-abcdefghijklmnop1234"
+	AddKeyUsage("https://api.example.com/v1", key, KeyEvent{PromptTokens: 100, CompletionTokens: 20, CachedTokens: 10})
+	AddKeyUsage("https://api.example.com/v1", key, KeyEvent{RateLimited: true})
+	AddKeyUsage("https://api.example.com/v1", "short-key", KeyEvent{Rejected: true})
+
+	snap := Snapshot()
+	if len(snap.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %+v", snap.Keys)
+	}
+	k := snap.Keys[0]
+	if k.Key != "sk-pro…1234" || k.Requests != 2 || k.PromptTokens != 100 || k.CompletionTokens != 20 || k.CachedTokens != 10 || k.RateLimited != 1 {
+		t.Errorf("unexpected key stat: %+v", k)
+	}
+	if snap.Keys[1].Key != "…ey" || snap.Keys[1].Rejected != 1 {
+		t.Errorf("unexpected short key stat: %+v", snap.Keys[1])
+	}
+	// 按模型的统计不受影响
+	if snap.Total.Requests != 0 {
+		t.Errorf("key usage should not count into model totals: %+v", snap.Total)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), key) {
+		t.Error("raw key must not be persisted")
+	}
+}
@@ -3,6 +3,7 @@ package structs
 import (
 	"context"
 	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -63,6 +64,8 @@ type Chats struct {
 	ToolState                uint64              `gorm:"-" json:"-"`
 	LatestToolCallingContext map[string]any      `gorm:"-" json:"-"`
 	LatestToolCallingType    map[string]string   `gorm:"-" json:"-"`
+	// DryRun 仅构建请求不发送（如 /context 统计），构建过程不写回数据库
+	DryRun bool `gorm:"-" json:"-"`
 	// ToolCallingStreaming 标记每个工具调用 id 是否为流式增量预览（true）还是最终状态（false）。
 	// OnHook 写入时按 session.State 判定：StateReciving/StateRequesting（AI 正在生成）→ 增量；
 	// StateToolCalling（审批后执行）→ 最终。SetCallback 据此选事件名。
@@ -80,6 +83,34 @@ type Chats struct {
 	// PlanPushFn 注册 ACP plan 推送回调（server 层在 loadSession 时注册）。
 	// task 工具每次修改 @task 后调用 PushPlan，向会话所有客户端广播完整 plan 列表。
 	PlanPushFn func(entries []PlanEntry) `gorm:"-" json:"-"`
+	// agentStreamMu 保护 AgentStreamFn 的并发访问
+	agentStreamMu sync.RWMutex `gorm:"-" json:"-"`
+	// AgentStreamFn 并行子代理流式输出回调（loop 在 Start 时注册）。
+	// 并行子代理在各自 goroutine 中请求，经此回调把增量交回主会话的响应通道。
+	AgentStreamFn func(chunk AgentStreamChunk) `gorm:"-" json:"-"`
+	// forkedFrom 非 nil 表示本会话是 Fork 出的并行子代理会话
+	forkedFrom *Chats `gorm:"-" json:"-"`
+	// TurnBudget 主会话本轮（一次用户输入到停止）的预算窗口
+	TurnBudget BudgetWindow `gorm:"-" json:"-"`
+	// AgentBudget 当前子代理本次激活的预算窗口
+	AgentBudget BudgetWindow `gorm:"-" json:"-"`
+}
+
+// BudgetWindow 预算统计窗口：统计 ID 大于 StartMsgID 的消息用量及自 StartTime 起的耗时
+type BudgetWindow struct {
+	Limits     structs.BudgetConfig
+	StartMsgID uint64
+	StartTime  time.Time
+	// Warned 已注入过接近上限的提醒
+	Warned bool
+}
+
+// AgentStreamChunk 并行子代理的流式输出片段
+type AgentStreamChunk struct {
+	AgentID       string
+	MsgID         uint64
+	Delta         string
+	ThinkingDelta string
 }
 
 // PlanEntry ACP plan 更新条目（session/update 通知中 update.sessionUpdate="plan"）。
@@ -182,6 +213,95 @@ func (c *Chats) PushPlan(entries []PlanEntry) {
 	}
 }
 
+// SetAgentStreamFn 注册并行子代理流式输出回调（nil 取消注册）。
+func (c *Chats) SetAgentStreamFn(fn func(chunk AgentStreamChunk)) {
+	if c == nil {
+		return
+	}
+	c.agentStreamMu.Lock()
+	defer c.agentStreamMu.Unlock()
+	c.AgentStreamFn = fn
+}
+
+// PushAgentStream 调用已注册的并行子代理流式输出回调，未注册时静默忽略。
+func (c *Chats) PushAgentStream(chunk AgentStreamChunk) {
+	if c == nil {
+		return
+	}
+	c.agentStreamMu.RLock()
+	fn := c.AgentStreamFn
+	c.agentStreamMu.RUnlock()
+	if fn != nil {
+		fn(chunk)
+	}
+}
+
+// ScopeAllowed 当前代理是否允许使用该命名空间（代理未限定 AllowedScopes 时不限制）。
+func (c *Chats) ScopeAllowed(scope string) bool {
+	allowed := c.CurrentAgentConfig.AllowedScopes
+	return scope == "" || len(allowed) == 0 || slices.Contains(allowed, scope)
+}
+
+// ScopeEnabled 命名空间是否对当前代理生效：需被允许，且已启用或属于代理的 DefaultScopes。
+func (c *Chats) ScopeEnabled(scope string) bool {
+	if scope == "" {
+		return true
+	}
+	if !c.ScopeAllowed(scope) {
+		return false
+	}
+	if v, ok := c.EnableScopes[scope]; ok && v {
+		return true
+	}
+	return slices.Contains(c.CurrentAgentConfig.DefaultScopes, scope)
+}
+
+// forkOmitColumns 并行子代理会话写库时忽略的 chats 列。
+// 子代理与主会话共用同一行记录，其状态/当前代理等只存在于内存，不能覆盖主会话。
+var forkOmitColumns = []string{
+	"chats.last_model_id", "chats.now_agent", "chats.root", "chats.trace_id", "chats.state",
+	"chats.title", "chats.ai_title", "chats.reasoning_effort", "chats.task",
+}
+
+// Fork 为并行子代理创建独立的会话副本。
+// 副本共享会话 ID、数据库与工作区，拥有独立的状态机、工具调用上下文、请求/会话临时数据与生命周期锁；
+// 副本对 chats 表的写入不会覆盖主会话的持久字段。
+func (c *Chats) Fork() *Chats {
+	if c == nil {
+		return nil
+	}
+	f := &Chats{
+		ID:                   c.ID,
+		LastModelID:          c.LastModelID,
+		Root:                 c.Root,
+		TraceID:              c.TraceID,
+		State:                state.StateIdle,
+		Title:                c.Title,
+		AITitle:              c.AITitle,
+		ReasoningEffort:      c.ReasoningEffort,
+		Task:                 c.Task,
+		UpdatedAt:            c.UpdatedAt,
+		EnableScopes:         maps.Clone(c.EnableScopes),
+		TemporyDataOfRequest: make(map[string]any),
+		TemporyDataOfSession: make(map[string]any),
+		InTestFlag:           c.InTestFlag,
+		forkedFrom:           c,
+	}
+	if c.DB != nil {
+		f.DB = c.DB.Omit(forkOmitColumns...).Session(&gorm.Session{})
+	}
+	f.SetContext(c.GetContext())
+	return f
+}
+
+// ForkedFrom 返回 Fork 出本会话的主会话，非并行子代理会话返回 nil。
+func (c *Chats) ForkedFrom() *Chats {
+	if c == nil {
+		return nil
+	}
+	return c.forkedFrom
+}
+
 // SetToolCalling 线程安全地写入工具调用上下文（工具 OnHook 在流式解析/执行阶段调用）。
 // 自动初始化 map，供流式增量预览与最终调用信息广播读取。
 // 阶段标记按 session.State 判定：StateReciving/StateRequesting（AI 正在生成工具调用）为流式增量，
@@ -5,8 +5,11 @@ package structs
 // Original 唯一保证同一个 key 始终映射到同一个假值；Masked 唯一保证单射、还原无歧义。
 type KeyMapping struct {
 	ID       uint64 `gorm:"primaryKey;autoIncrement"`
-	KeyType  string `gorm:"size:32;index:idx_type_orig,unique"` // apikey | phone | ip | session | cookie | jwt
+	KeyType  string `gorm:"size:32;index:idx_type_orig,unique"` // apikey | phone | ip | session | cookie | jwt | custom | entropy | pattern:<name>
 	Original string `gorm:"type:text;index:idx_type_orig,unique"`
 	Masked   string `gorm:"type:text;uniqueIndex"`
+	Detector string `gorm:"size:64"` // 首次命中的检测器，如 apikey:prefix | ipv4 | pattern:<name>
+	Hits     uint64 // 被脱敏的请求次数（同一请求内多次出现只计一次）
+	LastSeen uint64 // 最近一次被脱敏的时间（unix 秒）
 	Time     uint64 `gorm:"autoCreateTime"`
 }
@@ -102,4 +102,6 @@ type Messages struct {
 	CompletionTokens uint32
 	TotalTokens      uint32
 	CachedTokens     uint32
+	// Pinned 固定的消息在上下文压缩后仍原样附在摘要之后
+	Pinned bool
 }
@@ -0,0 +1,16 @@
+package structs
+
+// ProxyUsages 内置 OpenAI 代理的用量记录：会话内 Python 脚本经临时 key 发出的请求，
+// 不属于对话消息，单独记账后并入会话费用统计。
+type ProxyUsages struct {
+	ID               uint64  `gorm:"primaryKey;autoIncrement"`
+	ChatID           uint32  `gorm:"index"`
+	AgentID          *string // 创建 key 时的活动代理，主代理为空
+	ModelID          uint32
+	ModelName        string
+	PromptTokens     uint32
+	CompletionTokens uint32
+	CachedTokens     uint32
+	Time             uint64 `gorm:"autoCreateTime"`
+	Chats            *Chats `gorm:"foreignKey:ChatID;constraints:OnDelete:RESTRICT;OnUpdate:CASCADE"`
+}
@@ -8,5 +8,11 @@ type SubAgents struct {
 	BindPath    string
 	Deleted     bool
 	LastSummary string
+	// Isolated 子代理在独立的 git worktree 中工作
+	Isolated bool
+	// Branch 隔离 worktree 所在分支，未合并/丢弃前非空
+	Branch string
+	// BaseCommit 创建分支时的基准提交
+	BaseCommit string
 	// Chats       Chats `gorm:"foreignKey:ChatID"`
 }
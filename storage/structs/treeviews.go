@@ -0,0 +1,9 @@
+package structs
+
+// TreeViews 存储每个会话中各 agent 的 @tree 视图选项（根子路径、深度、过滤、元数据显示）。
+// AgentID 为空表示主 agent；Options 为 JSON 序列化的视图选项。
+type TreeViews struct {
+	ChatID  uint32 `gorm:"primaryKey;column:chat_id"`
+	AgentID string `gorm:"primaryKey;column:agent_id"`
+	Options string `gorm:"type:text;column:options"`
+}
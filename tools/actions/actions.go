@@ -39,6 +39,9 @@ func EnableScope(session *structs.Chats, scope string) error {
 	if !ok {
 		return fmt.Errorf("scope \"%v\" not found", scope)
 	}
+	if !session.ScopeAllowed(scope) {
+		return fmt.Errorf("scope \"%v\" is not allowed for the current agent", scope)
+	}
 	session.EnableScopes[scope] = true
 	if err := SetScopeEnabled(session.DB, session.ID, scope, true); err != nil {
 		logger.Error("failed to persist enable scope %s: %v", scope, err)
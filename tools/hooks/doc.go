@@ -0,0 +1,5 @@
+// Package hooks 用户配置的生命周期钩子
+//
+// 在工具调用前后、编辑后、每轮结束与会话启动时经沙盒执行 shell 命令，
+// stdin 传入描述事件的 JSON；pre_tool 钩子非零退出时阻止工具调用
+package hooks
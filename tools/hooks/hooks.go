@@ -0,0 +1,321 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/log"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/terminal/sandbox"
+)
+
+var logger = log.New("hooks")
+
+// 钩子事件
+const (
+	EventPreTool      = "pre_tool"      // 工具执行前，非零退出阻止调用
+	EventPostTool     = "post_tool"     // 工具执行后
+	EventPostEdit     = "post_edit"     // edit / patch 成功执行后
+	EventTurnEnd      = "turn_end"      // 一轮（一次用户输入直到停止）结束
+	EventSessionStart = "session_start" // 会话循环启动
+)
+
+// defaultTimeout 未配置 Timeout 时单个钩子的超时
+const defaultTimeout = 30 * time.Second
+
+// maxOutput 单个钩子 stdout / stderr 各自保留的字节数，超出截断
+const maxOutput = 16 * 1024
+
+// editTools 触发 post_edit 的工具
+var editTools = []string{"edit", "patch"}
+
+// Payload 经 stdin 传给钩子的事件描述
+type Payload struct {
+	Event     string          `json:"event"`
+	SessionID uint32          `json:"session_id"`
+	AgentID   string          `json:"agent_id"`
+	Cwd       string          `json:"cwd"`
+	Tool      string          `json:"tool,omitempty"`
+	ToolID    string          `json:"tool_id,omitempty"`
+	Args      map[string]*any `json:"args,omitempty"`
+	Result    map[string]*any `json:"result,omitempty"`
+}
+
+// Result 单个钩子的执行结果
+type Result struct {
+	Command  string
+	ExitCode int // 未能启动、超时或被终止时为 -1
+	Stdout   string
+	Stderr   string
+}
+
+// OK 钩子是否以 0 退出
+func (r Result) OK() bool {
+	return r.ExitCode == 0
+}
+
+// Reason 失败原因：优先 stderr，其次 stdout，都为空时为退出码
+func (r Result) Reason() string {
+	if s := strings.TrimSpace(r.Stderr); s != "" {
+		return s
+	}
+	if s := strings.TrimSpace(r.Stdout); s != "" {
+		return s
+	}
+	return fmt.Sprintf("exit status %d", r.ExitCode)
+}
+
+// BlockedError pre_tool 钩子阻止了工具调用
+type BlockedError struct {
+	Tool    string
+	Command string
+	Reason  string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("tool call %s blocked by pre_tool hook: %s", e.Tool, e.Reason)
+}
+
+// matched 返回事件匹配的钩子，按配置顺序
+func matched(hooks []cfgStructs.HookConfig, event string, tool string) []cfgStructs.HookConfig {
+	var ret []cfgStructs.HookConfig
+	for _, h := range hooks {
+		if h.Event != event || strings.TrimSpace(h.Command) == "" {
+			continue
+		}
+		if tool != "" && len(h.Tools) > 0 && !slices.ContainsFunc(h.Tools, func(p string) bool {
+			ok, _ := path.Match(p, tool)
+			return ok
+		}) {
+			continue
+		}
+		ret = append(ret, h)
+	}
+	return ret
+}
+
+// newPayload 构造会话级的事件描述
+func newPayload(session *structs.Chats, event string) Payload {
+	return Payload{
+		Event:     event,
+		SessionID: session.ID,
+		AgentID:   session.CurrentAgentID,
+		Cwd:       session.Root,
+	}
+}
+
+// Run 依次执行事件匹配的钩子。stopOnFail 为 true 时遇到首个失败的钩子即停止
+func Run(session *structs.Chats, payload Payload, stopOnFail bool) []Result {
+	// 钩子可能在会话 goroutine 中与配置重载并发执行，只读取一次配置快照
+	agentCfg := config.GlobalConfigSnapshot().Agent
+	hooks := matched(agentCfg.Hooks, payload.Event, payload.Tool)
+	if len(hooks) == 0 {
+		return nil
+	}
+	stdin, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("marshal hook payload error: %v", err)
+		return nil
+	}
+	results := make([]Result, 0, len(hooks))
+	for _, h := range hooks {
+		r := execHook(session, &agentCfg, h, payload.Event, stdin)
+		if !r.OK() {
+			logger.Warn("%s hook %q exit %d in session=%d: %s", payload.Event, h.Command, r.ExitCode, session.ID, r.Reason())
+		}
+		results = append(results, r)
+		if stopOnFail && !r.OK() {
+			break
+		}
+	}
+	return results
+}
+
+// PreTool 执行 pre_tool 钩子，任一钩子非零退出时返回 *BlockedError（原因为其 stderr）
+func PreTool(session *structs.Chats, tool string, toolID string, args map[string]*any) error {
+	payload := newPayload(session, EventPreTool)
+	payload.Tool = tool
+	payload.ToolID = toolID
+	payload.Args = args
+	for _, r := range Run(session, payload, true) {
+		if !r.OK() {
+			return &BlockedError{Tool: tool, Command: r.Command, Reason: r.Reason()}
+		}
+	}
+	return nil
+}
+
+// PostTool 执行 post_tool 钩子，edit / patch 成功时再执行 post_edit 钩子。
+// 返回有输出或失败的钩子的反馈文本（附加到工具结果供模型参考），均无输出时为空
+func PostTool(session *structs.Chats, tool string, toolID string, args map[string]*any, result map[string]*any) string {
+	payload := newPayload(session, EventPostTool)
+	payload.Tool = tool
+	payload.ToolID = toolID
+	payload.Args = args
+	payload.Result = result
+	results := Run(session, payload, false)
+	if slices.Contains(editTools, tool) && succeeded(result) {
+		payload.Event = EventPostEdit
+		results = append(results, Run(session, payload, false)...)
+	}
+	return feedback(results)
+}
+
+// TurnEnd 执行 turn_end 钩子，结果仅记录日志
+func TurnEnd(session *structs.Chats) {
+	Run(session, newPayload(session, EventTurnEnd), false)
+}
+
+// SessionStart 执行 session_start 钩子，结果仅记录日志
+func SessionStart(session *structs.Chats) {
+	Run(session, newPayload(session, EventSessionStart), false)
+}
+
+// succeeded 工具结果是否成功（无 success 字段视为成功）
+func succeeded(result map[string]*any) bool {
+	v, ok := result["success"]
+	if !ok || v == nil {
+		return true
+	}
+	b, ok := (*v).(bool)
+	return !ok || b
+}
+
+// feedback 汇总钩子输出
+func feedback(results []Result) string {
+	var b strings.Builder
+	for _, r := range results {
+		out := strings.TrimSpace(r.Stdout + "\n" + r.Stderr)
+		if r.OK() && out == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(fmt.Sprintf("$ %s (exit %d)\n", r.Command, r.ExitCode))
+		if out != "" {
+			b.WriteString(out)
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// useSandbox 是否以 OS 级隔离执行钩子，与 run 工具的禁用条件一致
+func useSandbox(session *structs.Chats, agentCfg *cfgStructs.AgentsConfig) bool {
+	if agentCfg.DisableSandbox ||
+		session.CurrentAgentConfig.DisableSandbox ||
+		os.Getenv("ALKAID0_DISABLE_SANDBOX") == "true" {
+		return false
+	}
+	return sandbox.IsSandboxSupported()
+}
+
+// shellArgs 返回执行命令的 shell 与参数
+func shellArgs(shell string, command string) (string, []string) {
+	if shell == "" {
+		switch runtime.GOOS {
+		case "darwin":
+			shell = "zsh"
+		case "windows":
+			shell = "powershell.exe"
+		default:
+			shell = "bash"
+		}
+	}
+	switch shell {
+	case "powershell", "powershell.exe", "pwsh", "pwsh.exe":
+		return shell, []string{"-Command", command}
+	case "cmd", "cmd.exe":
+		return shell, []string{"/C", command}
+	default:
+		return shell, []string{"-c", command}
+	}
+}
+
+// execHook 执行单个钩子。沙盒因 unshare 不可用时降级为无隔离重试
+func execHook(session *structs.Chats, agentCfg *cfgStructs.AgentsConfig, hook cfgStructs.HookConfig, event string, stdin []byte) Result {
+	timeout := defaultTimeout
+	if hook.Timeout > 0 {
+		timeout = time.Duration(hook.Timeout) * time.Second
+	}
+	env := append(os.Environ(), "SANDBOX=alkaid0", "ALKAID0_HOOK_EVENT="+event)
+	for k, v := range agentCfg.TerminalEnvs {
+		env = append(env, k+"="+v)
+	}
+	isolation := sandbox.IsolationNone
+	if useSandbox(session, agentCfg) {
+		isolation = sandbox.IsolationOS
+	}
+	shell, args := shellArgs(agentCfg.UseShell, hook.Command)
+	r := execIn(session.GetContext(), session.Root, env, shell, args, hook.Command, stdin, timeout, isolation)
+	if !r.OK() && isolation == sandbox.IsolationOS && strings.Contains(r.Stderr, "unshare") {
+		logger.Warn("sandbox unavailable for hook %q, fallback to non-sandbox", hook.Command)
+		r = execIn(session.GetContext(), session.Root, env, shell, args, hook.Command, stdin, timeout, sandbox.IsolationNone)
+	}
+	return r
+}
+
+// execIn 以指定隔离模式执行命令并收集输出
+func execIn(ctx context.Context, workDir string, env []string, shell string, args []string, command string, stdin []byte,
+	timeout time.Duration, isolation sandbox.IsolationMode) Result {
+	r := Result{Command: command, ExitCode: -1}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	sand, err := sandbox.New(sandbox.Config{
+		WorkDir:       workDir,
+		Env:           env,
+		Context:       ctx,
+		IsolationMode: isolation,
+	})
+	if err != nil {
+		r.Stderr = err.Error()
+		return r
+	}
+	c, err := sand.Execute(shell, args...)
+	if err != nil {
+		r.Stderr = err.Error()
+		return r
+	}
+	var stdout, stderr bytes.Buffer
+	c.SetStdin(bytes.NewReader(stdin))
+	c.SetStdout(&stdout)
+	c.SetStderr(&stderr)
+	err = c.Run()
+	r.Stdout = truncate(stdout.String())
+	r.Stderr = truncate(stderr.String())
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		r.Stderr = strings.TrimSpace(r.Stderr + "\n" + fmt.Sprintf("[Hook] timed out after %s", timeout))
+	case ctx.Err() != nil:
+		r.Stderr = strings.TrimSpace(r.Stderr + "\n[Hook] cancelled")
+	case errors.As(err, &exitErr):
+		r.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		r.Stderr = strings.TrimSpace(r.Stderr + "\n" + err.Error())
+	default:
+		r.ExitCode = 0
+	}
+	return r
+}
+
+// truncate 截断过长的输出
+func truncate(s string) string {
+	if len(s) <= maxOutput {
+		return s
+	}
+	return s[:maxOutput] + "\n...(truncated)"
+}
@@ -0,0 +1,112 @@
+package hooks
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/config"
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+	"github.com/cxykevin/alkaid0/storage/structs"
+)
+
+func setupHooks(t *testing.T, hooks ...cfgStructs.HookConfig) *structs.Chats {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use sh syntax")
+	}
+	t.Setenv("ALKAID0_DISABLE_SANDBOX", "true")
+	old := *config.GlobalConfig
+	t.Cleanup(func() { *config.GlobalConfig = old })
+	*config.GlobalConfig = cfgStructs.Config{Agent: cfgStructs.AgentsConfig{Hooks: hooks}}
+	return &structs.Chats{ID: 7, Root: t.TempDir(), CurrentAgentID: "coder"}
+}
+
+func TestPreToolBlock(t *testing.T) {
+	session := setupHooks(t,
+		cfgStructs.HookConfig{Event: EventPreTool, Tools: []string{"edit", "patch"},
+			Command: `grep -q '"path":"vendor/' && { echo "vendor/ is read-only" >&2; exit 2; }; exit 0`},
+		cfgStructs.HookConfig{Event: EventPostTool, Command: "exit 1"},
+	)
+	path := any("vendor/a.go")
+	err := PreTool(session, "edit", "call_1", map[string]*any{"path": &path})
+	blocked, ok := err.(*BlockedError)
+	if !ok || blocked.Reason != "vendor/ is read-only" {
+		t.Fatalf("expected blocked by hook stderr, got %v", err)
+	}
+
+	path = any("main.go")
+	if err := PreTool(session, "edit", "call_2", map[string]*any{"path": &path}); err != nil {
+		t.Fatalf("unexpected block: %v", err)
+	}
+	path = any("vendor/a.go")
+	if err := PreTool(session, "run", "call_3", map[string]*any{"path": &path}); err != nil {
+		t.Fatalf("hook should only match edit/patch: %v", err)
+	}
+}
+
+func TestPostToolPayloadAndFeedback(t *testing.T) {
+	session := setupHooks(t)
+	out := filepath.Join(session.Root, "payload.json")
+	*config.GlobalConfig = cfgStructs.Config{Agent: cfgStructs.AgentsConfig{Hooks: []cfgStructs.HookConfig{
+		{Event: EventPostTool, Command: "cat > " + out},
+		{Event: EventPostEdit, Command: "echo needs gofmt: main.go"},
+	}}}
+
+	success := any(true)
+	path := any("main.go")
+	fb := PostTool(session, "edit", "call_1", map[string]*any{"path": &path}, map[string]*any{"success": &success})
+	if !strings.Contains(fb, "needs gofmt: main.go") || !strings.Contains(fb, "(exit 0)") {
+		t.Fatalf("unexpected feedback: %q", fb)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload Payload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != EventPostTool || payload.Tool != "edit" || payload.ToolID != "call_1" ||
+		payload.SessionID != 7 || payload.AgentID != "coder" || payload.Cwd != session.Root ||
+		payload.Args["path"] == nil || *payload.Args["path"] != "main.go" {
+		t.Fatalf("unexpected payload: %s", data)
+	}
+
+	// 失败的编辑不触发 post_edit；post_tool 无输出时无反馈
+	failed := any(false)
+	if fb := PostTool(session, "edit", "call_2", nil, map[string]*any{"success": &failed}); fb != "" {
+		t.Fatalf("post_edit should not run on failed edit: %q", fb)
+	}
+	if fb := PostTool(session, "run", "call_3", nil, nil); fb != "" {
+		t.Fatalf("post_edit should not run for run tool: %q", fb)
+	}
+}
+
+func TestLifecycleEventsAndTimeout(t *testing.T) {
+	session := setupHooks(t)
+	out := filepath.Join(session.Root, "events")
+	*config.GlobalConfig = cfgStructs.Config{Agent: cfgStructs.AgentsConfig{Hooks: []cfgStructs.HookConfig{
+		{Event: EventSessionStart, Command: "echo $ALKAID0_HOOK_EVENT >> " + out},
+		{Event: EventTurnEnd, Command: "echo $ALKAID0_HOOK_EVENT >> " + out},
+		{Event: EventPreTool, Command: "sleep 5", Timeout: 1},
+	}}}
+
+	SessionStart(session)
+	TurnEnd(session)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "session_start\nturn_end\n" {
+		t.Fatalf("unexpected events: %q", data)
+	}
+
+	err = PreTool(session, "run", "call_1", nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("timed out pre_tool hook should block: %v", err)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	_ "github.com/cxykevin/alkaid0/tools/tools/date"
 	_ "github.com/cxykevin/alkaid0/tools/tools/edit"
 	_ "github.com/cxykevin/alkaid0/tools/tools/fetch"
+	_ "github.com/cxykevin/alkaid0/tools/tools/git"
 	_ "github.com/cxykevin/alkaid0/tools/tools/memory"
+	_ "github.com/cxykevin/alkaid0/tools/tools/patch"
 	_ "github.com/cxykevin/alkaid0/tools/tools/run"
 	_ "github.com/cxykevin/alkaid0/tools/tools/scope"
 	_ "github.com/cxykevin/alkaid0/tools/tools/search"
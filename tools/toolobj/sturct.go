@@ -7,6 +7,8 @@ import (
 
 // PreHookFunction 钩子函数
 type PreHookFunction struct {
+	// Name 注入来源名称（/context 按此分项统计），为空时取工具名
+	Name     string
 	Func     func(*structs.Chats) (string, error)
 	Priority int32
 }
@@ -22,19 +22,29 @@ func init() {
 }
 
 func checkScopeEnabled(session *structs.Chats, scope string) bool {
-	if scope == "" {
-		return true
-	}
-	if v, ok := session.EnableScopes[scope]; !ok || !v {
-		return false
-	}
-	return true
+	return session.ScopeEnabled(scope)
+}
+
+// NamedPrompt 带来源名称的 PreHook 输出
+type NamedPrompt struct {
+	Name string
+	Text string
 }
 
 // ExecOneToolGetPrompts 执行预调用，获取提示词表
 // 返回三部分：未启用 scope 的提示词、已启用 PreHook 的返回文本、工具参数定义
 // PreHook 按 Priority 降序执行（高优先级先执行），参数定义逐层合并
 func ExecOneToolGetPrompts(session *structs.Chats, name string) ([]string, []string, map[string]parser.ToolParameters) {
+	unusedHooks, named, paras := ExecOneToolGetNamedPrompts(session, name)
+	prehooks := make([]string, 0, len(named))
+	for _, p := range named {
+		prehooks = append(prehooks, p.Text)
+	}
+	return unusedHooks, prehooks, paras
+}
+
+// ExecOneToolGetNamedPrompts 同 ExecOneToolGetPrompts，PreHook 输出附带来源名称
+func ExecOneToolGetNamedPrompts(session *structs.Chats, name string) ([]string, []NamedPrompt, map[string]parser.ToolParameters) {
 	logger.Debug("getting prompts for tool: %s", name)
 	// 收集所有未启用的 scope 的提示词，用于告知 AI 哪些工具当前不可用
 	unusedHooks := make([]string, 0)
@@ -46,13 +56,14 @@ func ExecOneToolGetPrompts(session *structs.Chats, name string) ([]string, []str
 	}
 	sort.Strings(scopeKeys)
 	for _, name := range scopeKeys {
-		if !checkScopeEnabled(session, name) {
+		// 当前代理不允许的命名空间不提示启用
+		if session.ScopeAllowed(name) && !checkScopeEnabled(session, name) {
 			unusedHooks = append(unusedHooks, toolobj.Scopes[name])
 		}
 	}
 	toolobj.ScopesMu.RUnlock()
 
-	prehooks := make([]string, 0)
+	prehooks := make([]NamedPrompt, 0)
 	// 检查工具是否存在
 	t := toolobj.GetTool(name)
 	if t == nil {
@@ -84,7 +95,11 @@ func ExecOneToolGetPrompts(session *structs.Chats, name string) ([]string, []str
 				logger.Error("hook pre hook error: %v", err)
 				continue
 			}
-			prehooks = append(prehooks, ret)
+			hookName := hook.PreHook.Name
+			if hookName == "" {
+				hookName = name
+			}
+			prehooks = append(prehooks, NamedPrompt{Name: hookName, Text: ret})
 		}
 		// 合并map
 		if hook.Parameters != nil {
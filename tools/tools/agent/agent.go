@@ -12,6 +12,8 @@ import (
 	"github.com/cxykevin/alkaid0/tools/index"
 	u "github.com/cxykevin/alkaid0/utils"
 
+	cfgStructs "github.com/cxykevin/alkaid0/config/structs"
+
 	agents "github.com/cxykevin/alkaid0/provider/request/agents/actions"
 	agentconfig "github.com/cxykevin/alkaid0/provider/request/agents/config"
 	"github.com/cxykevin/alkaid0/storage/structs"
@@ -52,6 +54,21 @@ var parasIn = map[string]parser.ToolParameters{
 		Required:    true,
 		Description: "The prompt the subagent will use.",
 	},
+	"max_tokens": {
+		Type:        parser.ToolTypeNumber,
+		Required:    false,
+		Description: "Optional token budget (prompt + completion) for this activation. The subagent is stopped when exceeded.",
+	},
+	"max_cost": {
+		Type:        parser.ToolTypeNumber,
+		Required:    false,
+		Description: "Optional cost budget for this activation, in the currency of the model prices.",
+	},
+	"max_time": {
+		Type:        parser.ToolTypeNumber,
+		Required:    false,
+		Description: "Optional wall-clock budget for this activation, in seconds.",
+	},
 }
 
 // parasOut 子代理输出参数的入参定义
@@ -84,6 +101,16 @@ var parasMan = map[string]parser.ToolParameters{
 		Required:    false,
 		Description: "Delete the subagent instance. Default is false.",
 	},
+	"worktree": {
+		Type:        parser.ToolTypeBoolean,
+		Required:    false,
+		Description: "Only when creating: run the instance in a dedicated git worktree on its own branch, isolated from the main working tree and other subagents. Default is false.",
+	},
+	"resolve": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "For an isolated instance with a pending branch: \"merge\" merges its branch into the current branch, \"discard\" drops it. The worktree is cleaned up in both cases.",
+	},
 }
 
 // func buildPrompt(session *structs.Chats) (string, error) {
@@ -113,6 +140,11 @@ func updateAgentInfo(session *structs.Chats, mp map[string]*any, cross []*any, t
 			tagVal = &tag
 		}
 	}
+	if resolvePtr, ok := mp["resolve"]; ok && resolvePtr != nil {
+		if resolve, ok := (*resolvePtr).(string); ok && resolve != "" {
+			respString += "Resolve: " + resolve + "\n"
+		}
+	}
 	if detelePtr, ok := mp["delete"]; ok && detelePtr != nil {
 		if deletev, ok := (*detelePtr).(bool); ok {
 			respString += "Delete: " + u.Ternary(deletev, "true", "false") + "\n"
@@ -215,6 +247,27 @@ func editAgent(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 		}
 	}
 
+	// 合并或丢弃隔离分支
+	if resolvePtr, ok := mp["resolve"]; ok && resolvePtr != nil {
+		if mode, ok := (*resolvePtr).(string); ok && mode != "" {
+			logger.Info("resolve agent instance \"%s\" branch with %s in ID=%d", name, mode, session.ID)
+			if err := agents.ResolveAgent(session, name, mode); err != nil {
+				boolx := false
+				success := any(boolx)
+				errMsg := any(err.Error())
+				return false, cross, map[string]*any{
+					"success": &success,
+					"error":   &errMsg,
+				}, nil
+			}
+			boolx := true
+			success := any(boolx)
+			return false, cross, map[string]*any{
+				"success": &success,
+			}, nil
+		}
+	}
+
 	// 检查 tag 参数
 	tagPtr, ok := mp["tag"]
 	if !ok || tagPtr == nil {
@@ -277,8 +330,16 @@ func editAgent(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 			}, nil
 		}
 	} else {
-		// 不存在，使用 AddAgent 创建
-		err = agents.AddAgent(session, name, tag, path)
+		// 不存在，使用 AddAgent 创建；worktree=true 时创建隔离实例
+		isolated := false
+		if worktreePtr, ok := mp["worktree"]; ok && worktreePtr != nil {
+			isolated, _ = (*worktreePtr).(bool)
+		}
+		if isolated {
+			err = agents.AddIsolatedAgent(session, name, tag, path)
+		} else {
+			err = agents.AddAgent(session, name, tag, path)
+		}
 		if err != nil {
 			boolx := false
 			success := any(boolx)
@@ -325,6 +386,48 @@ func CheckPrompt(mp map[string]*any) (string, error) {
 	return prompt, nil
 }
 
+// CheckBudget 处理可选的预算参数（max_tokens/max_cost/max_time），未设置的项为 0
+func CheckBudget(mp map[string]*any) (cfgStructs.BudgetConfig, error) {
+	var budget cfgStructs.BudgetConfig
+	number := func(key string) (float64, error) {
+		p, ok := mp[key]
+		if !ok || p == nil {
+			return 0, nil
+		}
+		var v float64
+		switch x := (*p).(type) {
+		case float64:
+			v = x
+		case int:
+			v = float64(x)
+		case int64:
+			v = float64(x)
+		default:
+			return 0, fmt.Errorf("parameter %s must be a number", key)
+		}
+		if v < 0 {
+			return 0, fmt.Errorf("parameter %s must not be negative", key)
+		}
+		return v, nil
+	}
+	tokens, err := number("max_tokens")
+	if err != nil {
+		return budget, err
+	}
+	cost, err := number("max_cost")
+	if err != nil {
+		return budget, err
+	}
+	seconds, err := number("max_time")
+	if err != nil {
+		return budget, err
+	}
+	budget.MaxTokens = uint64(tokens)
+	budget.MaxCost = cost
+	budget.MaxTime = int32(seconds)
+	return budget, nil
+}
+
 // useAgent 激活一个子代理实例，将其绑定到当前会话
 func useAgent(session *structs.Chats, mp map[string]*any, cross []*any) (bool, []*any, map[string]*any, error) {
 	name, err := CheckName(mp)
@@ -349,9 +452,20 @@ func useAgent(session *structs.Chats, mp map[string]*any, cross []*any) (bool, [
 		}, nil
 	}
 
+	limits, err := CheckBudget(mp)
+	if err != nil {
+		boolx := false
+		success := any(boolx)
+		errMsg := any(err.Error())
+		return false, cross, map[string]*any{
+			"success": &success,
+			"error":   &errMsg,
+		}, nil
+	}
+
 	logger.Info("use agent \"%s\" in ID=%d", name, session.ID)
 
-	err = agents.ActivateAgent(session, name, prompt)
+	err = agents.ActivateAgentWithBudget(session, name, prompt, limits)
 	if err != nil {
 		boolx := false
 		success := any(boolx)
@@ -413,14 +527,16 @@ func unuseAgent(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 // agentTemplate 子代理全局提示词模板的数据结构
 type agentTemplate struct {
 	Agents []struct {
-		Name string
-		Path string
-		Tag  string
+		Name   string
+		Path   string
+		Tag    string
+		Branch string
 	}
 	Tags []struct {
 		Name        string
 		Description string
 	}
+	Parallel []agents.ParallelResult
 }
 
 // buildGlobalPrompt 构建包含所有子代理信息的全局提示词
@@ -431,26 +547,34 @@ func buildGlobalPrompt(session *structs.Chats) (string, error) {
 		return "", err
 	}
 	tmpl.Agents = make([]struct {
-		Name string
-		Path string
-		Tag  string
+		Name   string
+		Path   string
+		Tag    string
+		Branch string
 	}, len(listAgent))
 	for i, agent := range listAgent {
 		tmpl.Agents[i].Name = agent.ID
 		tmpl.Agents[i].Path = agent.BindPath
 		tmpl.Agents[i].Tag = agent.AgentID
+		if agent.Isolated {
+			tmpl.Agents[i].Branch = u.Ternary(agent.Branch == "", "(created on activation)", agent.Branch)
+		}
 	}
 
+	tagConfigs := agentconfig.GetAgentConfigMapAt(session.Root)
 	tmpl.Tags = make([]struct {
 		Name        string
 		Description string
-	}, len(agentconfig.GetAgentConfigMap()))
+	}, len(tagConfigs))
 	idx := 0
-	for i, agent := range agentconfig.GetAgentConfigMap() {
+	for i, agent := range tagConfigs {
 		tmpl.Tags[idx].Name = i
 		tmpl.Tags[idx].Description = agent.AgentDescription
 		idx++
 	}
+	if tmpl.Parallel, err = agents.ListParallelAgents(session); err != nil {
+		return "", err
+	}
 	rendered, err := prompts.Render(agentsTemplate, tmpl)
 	if err != nil {
 		return "", err
@@ -486,6 +610,14 @@ func load() string {
 		ID:              "activate_agent",
 		Enable:          enableActivate,
 	})
+	actions.AddTool(&toolobj.Tools{
+		Scope:           "", // Global Tools
+		Name:            "activate_agents",
+		UserDescription: promptParallel,
+		Parameters:      parasParallel,
+		ID:              "activate_agents",
+		Enable:          enableActivate,
+	})
 	actions.AddTool(&toolobj.Tools{
 		Scope:           "", // Global Tools
 		Name:            "deactivate_agent",
@@ -497,6 +629,7 @@ func load() string {
 	if err := actions.HookTool("", &toolobj.Hook{
 		Scope: "",
 		PreHook: toolobj.PreHookFunction{
+			Name:     "agents",
 			Priority: 100,
 			Func:     buildGlobalPrompt,
 		},
@@ -545,6 +678,23 @@ func load() string {
 	}); err != nil {
 		panic(err)
 	}
+	if err := actions.HookTool("activate_agents", &toolobj.Hook{
+		Scope: "",
+		PreHook: toolobj.PreHookFunction{
+			Priority: 100,
+			Func:     nil,
+		},
+		OnHook: toolobj.OnHookFunction{
+			Priority: 100,
+			Func:     updateParallelInfo,
+		},
+		PostHook: toolobj.PostHookFunction{
+			Priority: 100,
+			Func:     useAgents,
+		},
+	}); err != nil {
+		panic(err)
+	}
 	if err := actions.HookTool("deactivate_agent", &toolobj.Hook{
 		Scope: "",
 		PreHook: toolobj.PreHookFunction{
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"errors"
 	"sync"
 	"testing"
 
@@ -33,7 +34,17 @@ func initTestAgentsConsumer() {
 					ID:       o.AgentCode,
 					AgentID:  o.AgentID,
 					BindPath: o.Path,
+					Isolated: o.Isolated,
 				}).Error
+			case agents.Resolve:
+				var existing storageStructs.SubAgents
+				if err := o.Session.DB.Where("id = ?", o.AgentCode).First(&existing).Error; err != nil {
+					return nil, err
+				}
+				if !existing.Isolated || existing.Branch == "" {
+					return nil, errors.New("agent has no pending worktree branch")
+				}
+				return nil, o.Session.DB.Model(&existing).Update("branch", "").Error
 			case agents.Update:
 				var existing storageStructs.SubAgents
 				if err := o.Session.DB.Where("id = ?", o.AgentCode).First(&existing).Error; err != nil {
@@ -367,6 +378,77 @@ func TestEditAgent_Create(t *testing.T) {
 	}
 }
 
+func TestEditAgent_CreateIsolated(t *testing.T) {
+	db := setupTestDB(t)
+	session := setupTestSession(t, db)
+
+	_, _, result, err := editAgent(session, map[string]*any{
+		"name":     anyPtr("iso-agent"),
+		"tag":      anyPtr("tag-coder"),
+		"path":     anyPtr("."),
+		"worktree": anyPtr(true),
+	}, nil)
+	if err != nil {
+		t.Fatalf("editAgent failed: %v", err)
+	}
+	if success, ok := (*result["success"]).(bool); !ok || !success {
+		t.Fatalf("editAgent success = %v, want true", result["success"])
+	}
+
+	var agent storageStructs.SubAgents
+	if err := db.Where("id = ?", "iso-agent").First(&agent).Error; err != nil {
+		t.Fatalf("Agent should have been created: %v", err)
+	}
+	if !agent.Isolated {
+		t.Error("worktree=true should create an isolated agent")
+	}
+}
+
+func TestEditAgent_Resolve(t *testing.T) {
+	db := setupTestDB(t)
+	session := setupTestSession(t, db)
+
+	if err := db.Create(&storageStructs.SubAgents{
+		ID:       "iso-agent",
+		AgentID:  "tag-coder",
+		BindPath: ".",
+		Isolated: true,
+		Branch:   "alkaid0/iso-agent",
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, result, err := editAgent(session, map[string]*any{
+		"name":    anyPtr("iso-agent"),
+		"resolve": anyPtr("discard"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("editAgent resolve failed: %v", err)
+	}
+	if success, ok := (*result["success"]).(bool); !ok || !success {
+		t.Fatalf("editAgent resolve success = %v, want true", result["success"])
+	}
+	var agent storageStructs.SubAgents
+	if err := db.Where("id = ?", "iso-agent").First(&agent).Error; err != nil {
+		t.Fatal(err)
+	}
+	if agent.Branch != "" {
+		t.Errorf("branch should be cleared after resolve, got %q", agent.Branch)
+	}
+
+	// 无待处理分支时返回错误结果
+	_, _, result, err = editAgent(session, map[string]*any{
+		"name":    anyPtr("iso-agent"),
+		"resolve": anyPtr("discard"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("editAgent resolve failed: %v", err)
+	}
+	if success, ok := (*result["success"]).(bool); !ok || success {
+		t.Errorf("resolve without pending branch success = %v, want false", result["success"])
+	}
+}
+
 func TestEditAgent_Update(t *testing.T) {
 	db := setupTestDB(t)
 	session := setupTestSession(t, db)
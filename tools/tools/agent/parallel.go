@@ -0,0 +1,196 @@
+package agent
+
+import (
+	_ "embed" // embed
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	libjson "github.com/cxykevin/alkaid0/library/json"
+	"github.com/cxykevin/alkaid0/provider/parser"
+	agents "github.com/cxykevin/alkaid0/provider/request/agents/actions"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	u "github.com/cxykevin/alkaid0/utils"
+)
+
+//go:embed prompt_parallel.md
+var promptParallel string
+
+// parasParallel 并行激活子代理的入参定义
+var parasParallel = map[string]parser.ToolParameters{
+	"agents": {
+		Type:        parser.ToolTypeArray,
+		Required:    false,
+		Description: "Subagent instances to run concurrently, each an object {\"name\": \"<exact instance name>\", \"prompt\": \"<task>\"}, optionally with max_tokens, max_cost and max_time (seconds) budgets. Omit to wait for subagents that are still running.",
+	},
+	"wait": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "\"all\" (default) resumes when every subagent has finished; \"any\" resumes as soon as one finishes while the others keep running.",
+	},
+}
+
+// parseParallelTasks 解析 agents 参数（数组或 JSON 字符串）
+func parseParallelTasks(mp map[string]*any) ([]agents.ParallelTask, error) {
+	p, ok := mp["agents"]
+	if !ok || p == nil {
+		return nil, nil
+	}
+	var items []any
+	switch v := (*p).(type) {
+	case []*any:
+		for _, item := range v {
+			if item != nil {
+				items = append(items, *item)
+			}
+		}
+	case []any:
+		items = v
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return nil, nil
+		}
+		if err := json.Unmarshal([]byte(v), &items); err != nil {
+			return nil, errors.New("parameter agents must be an array of {name, prompt} objects")
+		}
+	default:
+		return nil, errors.New("parameter agents must be an array of {name, prompt} objects")
+	}
+	tasks := make([]agents.ParallelTask, 0, len(items))
+	for i, item := range items {
+		var obj map[string]*any
+		switch v := item.(type) {
+		case map[string]*any:
+			obj = v
+		case libjson.ObjectSlot:
+			obj = map[string]*any(v)
+		case map[string]any:
+			obj = make(map[string]*any, len(v))
+			for k, val := range v {
+				obj[k] = &val
+			}
+		default:
+			return nil, fmt.Errorf("agents[%d] must be an object with name and prompt", i)
+		}
+		name, err := CheckName(obj)
+		if err != nil {
+			return nil, fmt.Errorf("agents[%d]: %w", i, err)
+		}
+		prompt, err := CheckPrompt(obj)
+		if err != nil {
+			return nil, fmt.Errorf("agents[%d]: %w", i, err)
+		}
+		limits, err := CheckBudget(obj)
+		if err != nil {
+			return nil, fmt.Errorf("agents[%d]: %w", i, err)
+		}
+		tasks = append(tasks, agents.ParallelTask{AgentCode: name, Prompt: prompt, Budget: limits})
+	}
+	return tasks, nil
+}
+
+// updateParallelInfo 处理并行激活子代理的调用信息记录
+func updateParallelInfo(session *structs.Chats, mp map[string]*any, cross []*any, toolID string) (bool, []*any, error) {
+	toolCallID := fmt.Sprintf("call_%d_%d_%s", session.ID, session.CurrentMessageID, toolID)
+	respString := ""
+	names := []string{}
+	// 流式阶段参数可能尚不完整，解析失败时只展示已得到的部分
+	if tasks, err := parseParallelTasks(mp); err == nil {
+		for _, task := range tasks {
+			respString += "Agent: " + task.AgentCode + "\n"
+			names = append(names, task.AgentCode)
+		}
+	}
+	var waitVal *string
+	if waitPtr, ok := mp["wait"]; ok && waitPtr != nil {
+		if wait, ok := (*waitPtr).(string); ok && wait != "" {
+			respString += "Wait: " + wait + "\n"
+			waitVal = &wait
+		}
+	}
+	respObj := []u.H{{
+		"type": "content",
+		"content": u.H{
+			"type": "text",
+			"text": respString,
+		},
+	}, {
+		"type":      "alk.cxykevin.top/calling_info",
+		"name":      "activate_agents",
+		"messageID": session.CurrentMessageID,
+		"args": u.H{
+			"agents": names,
+			"wait":   waitVal,
+		},
+	}}
+	session.SetToolCalling(toolCallID, respObj, "activate_agents")
+	return true, cross, nil
+}
+
+// useAgents 并行激活多个子代理，等待全部或任一结束后返回其结果
+func useAgents(session *structs.Chats, mp map[string]*any, cross []*any) (bool, []*any, map[string]*any, error) {
+	tasks, err := parseParallelTasks(mp)
+	if err != nil {
+		boolx := false
+		success := any(boolx)
+		errMsg := any(err.Error())
+		return false, cross, map[string]*any{
+			"success": &success,
+			"error":   &errMsg,
+		}, nil
+	}
+	wait := ""
+	if waitPtr, ok := mp["wait"]; ok && waitPtr != nil {
+		wait, _ = (*waitPtr).(string)
+	}
+
+	logger.Info("run %d agents in parallel (wait=%q) in ID=%d", len(tasks), wait, session.ID)
+
+	outcome, err := agents.RunParallelAgents(session, tasks, wait)
+	if err != nil {
+		boolx := false
+		success := any(boolx)
+		errMsg := any(err.Error())
+		return false, cross, map[string]*any{
+			"success": &success,
+			"error":   &errMsg,
+		}, nil
+	}
+
+	results := make([]any, 0, len(outcome.Finished))
+	for _, r := range outcome.Finished {
+		item := map[string]any{
+			"name":   r.AgentCode,
+			"status": r.Status,
+		}
+		if r.Message != "" {
+			item["report"] = r.Message
+		}
+		if r.Summary != "" {
+			item["summary"] = r.Summary
+		}
+		if r.Report != "" {
+			item["worktree"] = r.Report
+		}
+		if r.Error != "" {
+			item["error"] = r.Error
+		}
+		results = append(results, item)
+	}
+	running := make([]any, 0, len(outcome.Running))
+	for _, name := range outcome.Running {
+		running = append(running, name)
+	}
+
+	boolx := true
+	success := any(boolx)
+	resultsAny := any(results)
+	runningAny := any(running)
+	return false, cross, map[string]*any{
+		"success": &success,
+		"results": &resultsAny,
+		"running": &runningAny,
+	}, nil
+}
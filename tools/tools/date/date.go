@@ -18,6 +18,7 @@ func load() string {
 	if err := actions.HookTool("", &toolobj.Hook{
 		Scope: "",
 		PreHook: toolobj.PreHookFunction{
+			Name:     "date",
 			Priority: 100,
 			Func:     buildGlobalPrompt,
 		},
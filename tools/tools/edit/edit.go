@@ -292,9 +292,9 @@ func buildGitPatch(absPath, oldContent, newContent string, isNew bool) string {
 	return buf.String()
 }
 
-// buildDiffContent 构造 ACP v2 tool_call_update 的 Diffs 段。
+// BuildDiffContent 构造 ACP v2 tool_call_update 的 Diffs 段。
 // 无实际内容变化时返回 nil（如空文本触发 LSP 诊断）。
-func buildDiffContent(absPath string, oldContent, newContent string, isNew bool) u.H {
+func BuildDiffContent(absPath string, oldContent, newContent string, isNew bool) u.H {
 	patchText := buildGitPatch(absPath, oldContent, newContent, isNew)
 	if patchText == "" {
 		return nil
@@ -321,9 +321,9 @@ func buildDiffContent(absPath string, oldContent, newContent string, isNew bool)
 	}
 }
 
-// saveToolCallingContent 将工具调用的展示 content（含 Diffs 段）持久化到当前消息，
+// SaveToolCallingContent 将工具调用的展示 content（含 Diffs 段）持久化到当前消息，
 // 按工具调用 ID 索引（map JSON），供会话还原时按 ID 重放 Content。
-func saveToolCallingContent(session *structs.Chats, toolID string, content []u.H) {
+func SaveToolCallingContent(session *structs.Chats, toolID string, content []u.H) {
 	if session == nil || session.DB == nil {
 		return
 	}
@@ -360,9 +360,16 @@ func CheckPath(mp map[string]*any) (string, error) {
 	if !ok || path == "" {
 		return "", errors.New("invalid or empty path parameter")
 	}
-	// 检查path
+	if err := ValidatePath(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ValidatePath 校验相对路径是否合法（不含 ".."、不以根路径开头、不含非法字符）
+func ValidatePath(path string) error {
 	if strings.Contains(path, "..") {
-		return "", errors.New("path cannot contains '..'")
+		return errors.New("path cannot contains '..'")
 	}
 
 	if strings.HasPrefix(path, "/") ||
@@ -379,9 +386,19 @@ func CheckPath(mp map[string]*any) (string, error) {
 		strings.Contains(path, "\r") ||
 		strings.Contains(path, "\t") ||
 		strings.Contains(path, "..") {
-		return "", errors.New("path must be a correct and relative path")
+		return errors.New("path must be a correct and relative path")
 	}
-	return path, nil
+	return nil
+}
+
+// SensitivePathPattern 敏感文件路径（凭据、密钥、alkaid0 配置等），内置 reject 规则使用同一表达式
+const SensitivePathPattern = `(^|/)(\.env($|\.)|\.npmrc$|\.pypirc$|\.netrc$|\.git-credentials$|\.aws/credentials$|\.kube/config$|\.ssh/|id_rsa$|id_dsa$|id_ed25519$|authorized_keys$|known_hosts$|[^/]*\.(pem|key|crt|p12|pfx|der|jks|keystore)$|\.alkaid0/)`
+
+var sensitivePathRe = regexp.MustCompile(SensitivePathPattern)
+
+// IsSensitivePath 判断相对路径是否指向敏感文件
+func IsSensitivePath(path string) bool {
+	return sensitivePathRe.MatchString(strings.ReplaceAll(path, "\\", "/"))
 }
 
 // CheckTargetText 处理目标和文本
@@ -599,7 +616,7 @@ func writeFile(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 	logger.Info("edit file \"%s\" mode \"%s\" in ID=%d,agentID=%s", path, target, session.ID, session.CurrentAgentID)
 	newContent, err := ProcessString(content, target, text, fileExists)
 	if err == nil {
-		newContent = normalizeTrailingNewline(newContent)
+		newContent = NormalizeTrailingNewline(newContent)
 	}
 	if err != nil {
 		logger.Warn("failed to process string: %v", err)
@@ -664,14 +681,14 @@ func writeFile(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 	}
 	trace.ConfirmEditContent(session, origRelPath, finalContent)
 	respObj := buildRespObj(session, mp)
-	if diffObj := buildDiffContent(path, oldContentRaw, finalContent, !fileExists); diffObj != nil {
+	if diffObj := BuildDiffContent(path, oldContentRaw, finalContent, !fileExists); diffObj != nil {
 		respObj = append(respObj, diffObj)
 	}
 	if toolIDPtr, ok := mp["_id"]; ok && toolIDPtr != nil {
 		if toolID, ok := (*toolIDPtr).(string); ok && toolID != "" {
 			toolCallID := fmt.Sprintf("call_%d_%d_%s", session.ID, session.CurrentMessageID, toolID)
 			session.SetToolCalling(toolCallID, respObj, "edit")
-			saveToolCallingContent(session, toolID, respObj)
+			SaveToolCallingContent(session, toolID, respObj)
 		}
 	}
 
@@ -693,7 +710,8 @@ func writeFile(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 	return false, cross, resultMap, nil
 }
 
-func normalizeTrailingNewline(s string) string {
+// NormalizeTrailingNewline 将末尾连续换行规范为单个换行
+func NormalizeTrailingNewline(s string) string {
 	return strings.TrimRight(s, "\n") + "\n"
 }
 
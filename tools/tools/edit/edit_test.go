@@ -323,7 +323,7 @@ func TestBuildGitPatch(t *testing.T) {
 
 func TestBuildDiffContent(t *testing.T) {
 	// 修改文件
-	obj := buildDiffContent("/abs/main.go", "package main\n\nfunc main() {}\n", "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n", false)
+	obj := BuildDiffContent("/abs/main.go", "package main\n\nfunc main() {}\n", "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n", false)
 	if obj == nil {
 		t.Fatalf("expected diff content for modified file")
 	}
@@ -343,7 +343,7 @@ func TestBuildDiffContent(t *testing.T) {
 	}
 
 	// 新建文件：operation = add
-	obj = buildDiffContent("/abs/new.go", "", "package main\n", true)
+	obj = BuildDiffContent("/abs/new.go", "", "package main\n", true)
 	changes, ok = obj["changes"].([]u.H)
 	if !ok || len(changes) != 1 {
 		t.Fatalf("unexpected add changes: %v", obj["changes"])
@@ -353,7 +353,7 @@ func TestBuildDiffContent(t *testing.T) {
 	}
 
 	// 无变化：返回 nil
-	if obj := buildDiffContent("/abs/same.go", "a\n", "a\n", false); obj != nil {
+	if obj := BuildDiffContent("/abs/same.go", "a\n", "a\n", false); obj != nil {
 		t.Fatalf("identical content should yield nil diff: %v", obj)
 	}
 }
@@ -0,0 +1,4 @@
+// Package git 实现类型化的 git 工具，以结构化参数执行 status/diff/log/add/commit/branch/stash/worktree/push
+//
+// 参数对审批规则可见，便于按操作自动批准或拒绝；所有路径与引用在执行前校验，避免选项注入
+package git
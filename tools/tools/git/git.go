@@ -0,0 +1,607 @@
+package git
+
+import (
+	"context"
+	_ "embed" // embed
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxykevin/alkaid0/log"
+	"github.com/cxykevin/alkaid0/provider/parser"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/tools/actions"
+	"github.com/cxykevin/alkaid0/tools/index"
+	"github.com/cxykevin/alkaid0/tools/toolobj"
+	"github.com/cxykevin/alkaid0/tools/tools/edit"
+	u "github.com/cxykevin/alkaid0/utils"
+)
+
+const toolName = "git"
+
+//go:embed prompt.md
+var prompt string
+
+var logger = log.New("tools:git")
+
+const (
+	gitTimeout      = 60 * time.Second
+	maxOutputBytes  = 64 * 1024
+	defaultLogCount = 20
+)
+
+var paras = map[string]parser.ToolParameters{
+	"op": {
+		Type:        parser.ToolTypeString,
+		Required:    true,
+		Description: "Operation. Must Be First Parameter. Enum: [\"status\", \"diff\", \"log\", \"add\", \"commit\", \"branch\", \"stash\", \"worktree\", \"push\"]",
+	},
+	"action": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "Sub-action. branch: [\"list\", \"create\", \"switch\", \"delete\"]; stash: [\"list\", \"show\", \"push\", \"pop\", \"apply\", \"drop\"]; worktree: [\"list\", \"add\", \"remove\"]. Default is \"list\"",
+	},
+	"name": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "Branch name (branch/worktree add/push), stash entry such as stash@{0} (stash), or workspace-relative worktree path (worktree add/remove)",
+	},
+	"ref": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "Revision or range: diff/log target (e.g. HEAD~3, main..HEAD), start point for branch create and worktree add",
+	},
+	"paths": {
+		Type:        parser.ToolTypeArray,
+		Required:    false,
+		Description: "Workspace-relative paths limiting status/diff/log/add/commit/stash push",
+	},
+	"message": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "Commit message (required for commit) or stash message",
+	},
+	"staged": {
+		Type:        parser.ToolTypeBoolean,
+		Required:    false,
+		Description: "diff: show staged changes instead of unstaged. Default is false",
+	},
+	"all": {
+		Type:        parser.ToolTypeBoolean,
+		Required:    false,
+		Description: "add: stage all changes including untracked files; commit: stage tracked modifications first. Default is false",
+	},
+	"max_count": {
+		Type:        parser.ToolTypeNumber,
+		Required:    false,
+		Description: "log: maximum number of commits. Default is 20",
+	},
+	"remote": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "push: remote name listed by git remote (not a URL). Default is origin",
+	},
+	"force": {
+		Type:        parser.ToolTypeBoolean,
+		Required:    false,
+		Description: "branch delete: delete unmerged branch; worktree remove: discard local changes; push: force push. Default is false",
+	},
+}
+
+// gitOps 操作 → 允许的子动作（首个为默认值）
+var gitOps = map[string][]string{
+	"status":   nil,
+	"diff":     nil,
+	"log":      nil,
+	"add":      nil,
+	"commit":   nil,
+	"push":     nil,
+	"branch":   {"list", "create", "switch", "delete"},
+	"stash":    {"list", "show", "push", "pop", "apply", "drop"},
+	"worktree": {"list", "add", "remove"},
+}
+
+// request 解析后的 git 工具参数
+type request struct {
+	Op       string
+	Action   string
+	Name     string
+	Ref      string
+	Paths    []string
+	Message  string
+	Staged   bool
+	All      bool
+	MaxCount int
+	Remote   string
+	Force    bool
+}
+
+func getString(mp map[string]*any, key string) string {
+	if p, ok := mp[key]; ok && p != nil {
+		if v, ok := (*p).(string); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func getBool(mp map[string]*any, key string) bool {
+	if p, ok := mp[key]; ok && p != nil {
+		if v, ok := (*p).(bool); ok {
+			return v
+		}
+	}
+	return false
+}
+
+func getInt(mp map[string]*any, key string) int {
+	if p, ok := mp[key]; ok && p != nil {
+		switch v := (*p).(type) {
+		case float64:
+			return int(v)
+		case int:
+			return v
+		case int64:
+			return int(v)
+		case string:
+			n, _ := strconv.Atoi(v)
+			return n
+		}
+	}
+	return 0
+}
+
+// getStrings 读取字符串数组参数，兼容 []*any、[]any、JSON 字符串与单个字符串
+func getStrings(mp map[string]*any, key string) ([]string, error) {
+	p, ok := mp[key]
+	if !ok || p == nil {
+		return nil, nil
+	}
+	var items []any
+	switch v := (*p).(type) {
+	case []*any:
+		for _, item := range v {
+			if item != nil {
+				items = append(items, *item)
+			}
+		}
+	case []any:
+		items = v
+	case []string:
+		for _, s := range v {
+			items = append(items, s)
+		}
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return nil, nil
+		}
+		if strings.HasPrefix(v, "[") {
+			var arr []string
+			if err := json.Unmarshal([]byte(v), &arr); err != nil {
+				return nil, fmt.Errorf("parameter %s must be an array of strings", key)
+			}
+			for _, s := range arr {
+				items = append(items, s)
+			}
+		} else {
+			items = append(items, v)
+		}
+	default:
+		return nil, fmt.Errorf("parameter %s must be an array of strings", key)
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("parameter %s must be an array of strings", key)
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// parseRequest 解析并校验参数
+func parseRequest(mp map[string]*any) (*request, error) {
+	req := &request{
+		Op:       strings.ToLower(getString(mp, "op")),
+		Action:   strings.ToLower(getString(mp, "action")),
+		Name:     getString(mp, "name"),
+		Ref:      getString(mp, "ref"),
+		Message:  getString(mp, "message"),
+		Staged:   getBool(mp, "staged"),
+		All:      getBool(mp, "all"),
+		MaxCount: getInt(mp, "max_count"),
+		Remote:   getString(mp, "remote"),
+		Force:    getBool(mp, "force"),
+	}
+	if req.Op == "push" && req.Remote == "" {
+		req.Remote = "origin"
+	}
+	actionsOfOp, ok := gitOps[req.Op]
+	if !ok {
+		return nil, fmt.Errorf("unknown op %q", req.Op)
+	}
+	if len(actionsOfOp) == 0 {
+		if req.Action != "" {
+			return nil, fmt.Errorf("op %s does not take an action", req.Op)
+		}
+	} else {
+		if req.Action == "" {
+			req.Action = actionsOfOp[0]
+		}
+		found := false
+		for _, a := range actionsOfOp {
+			if a == req.Action {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown action %q for op %s, expected one of %s", req.Action, req.Op, strings.Join(actionsOfOp, ", "))
+		}
+	}
+	paths, err := getStrings(mp, "paths")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		if err := edit.ValidatePath(p); err != nil {
+			return nil, fmt.Errorf("invalid path %q: %w", p, err)
+		}
+	}
+	req.Paths = paths
+	if err := checkRef("ref", req.Ref); err != nil {
+		return nil, err
+	}
+	if err := checkRef("remote", req.Remote); err != nil {
+		return nil, err
+	}
+	if req.Op == "worktree" {
+		if req.Name != "" {
+			if err := edit.ValidatePath(req.Name); err != nil {
+				return nil, fmt.Errorf("invalid worktree path %q: %w", req.Name, err)
+			}
+		}
+	} else if err := checkRef("name", req.Name); err != nil {
+		return nil, err
+	}
+	if req.Op == "push" {
+		if err := checkPushRefspec(req.Name); err != nil {
+			return nil, err
+		}
+	}
+	if req.MaxCount <= 0 {
+		req.MaxCount = defaultLogCount
+	}
+	return req, nil
+}
+
+// checkRef 拒绝以 '-' 开头（选项注入）或含空白/控制字符的引用
+func checkRef(key, value string) error {
+	if value == "" {
+		return nil
+	}
+	if strings.HasPrefix(value, "-") {
+		return fmt.Errorf("%s must not start with '-'", key)
+	}
+	for _, r := range value {
+		if r <= ' ' || r == 0x7f {
+			return fmt.Errorf("%s must not contain whitespace or control characters", key)
+		}
+	}
+	return nil
+}
+
+// checkPushRefspec 拒绝强制推送（"+src"、"src:+dst"）与删除远程分支（":dst"）的 refspec，
+// 强制推送只能通过 force 参数显式请求
+func checkPushRefspec(name string) error {
+	if strings.HasPrefix(name, "+") || strings.HasPrefix(name, ":") || strings.Contains(name, ":+") {
+		return fmt.Errorf("push name %q must not force-push or delete a remote ref", name)
+	}
+	return nil
+}
+
+// checkRemote 要求 remote 是仓库已配置的远程名，拒绝 URL 或路径
+func checkRemote(ctx context.Context, dir, remote string) error {
+	out, err := runGit(ctx, dir, []string{"remote"})
+	if err != nil {
+		return fmt.Errorf("list remotes: %s", strings.TrimSpace(out))
+	}
+	for name := range strings.FieldsSeq(out) {
+		if name == remote {
+			return nil
+		}
+	}
+	return fmt.Errorf("remote %q is not configured, use one of the names listed by git remote", remote)
+}
+
+// withPaths 追加 "--" 与路径，避免路径被解析为选项或引用
+func withPaths(args []string, paths []string) []string {
+	if len(paths) == 0 {
+		return args
+	}
+	return append(append(args, "--"), paths...)
+}
+
+// buildArgs 将请求转换为 git 参数（不含全局选项）
+func buildArgs(req *request) ([]string, error) {
+	switch req.Op {
+	case "status":
+		return withPaths([]string{"status", "--short", "--branch"}, req.Paths), nil
+	case "diff":
+		args := []string{"diff", "--no-color", "--no-ext-diff", "--stat", "--patch"}
+		if req.Staged {
+			args = append(args, "--cached")
+		}
+		if req.Ref != "" {
+			args = append(args, req.Ref)
+		}
+		return withPaths(args, req.Paths), nil
+	case "log":
+		args := []string{"log", "--no-color", "--date=iso", "--format=%h %ad %an%n    %s", "-n", strconv.Itoa(req.MaxCount)}
+		if req.Ref != "" {
+			args = append(args, req.Ref)
+		}
+		return withPaths(args, req.Paths), nil
+	case "add":
+		if req.All {
+			return withPaths([]string{"add", "--all"}, req.Paths), nil
+		}
+		if len(req.Paths) == 0 {
+			return nil, errors.New("add requires paths or all=true")
+		}
+		return withPaths([]string{"add"}, req.Paths), nil
+	case "commit":
+		if req.Message == "" {
+			return nil, errors.New("commit requires message")
+		}
+		args := []string{"commit", "-m", req.Message}
+		if req.All {
+			args = append(args, "--all")
+		}
+		return withPaths(args, req.Paths), nil
+	case "branch":
+		switch req.Action {
+		case "list":
+			return []string{"branch", "--list", "-vv", "--no-color"}, nil
+		case "create":
+			if req.Name == "" {
+				return nil, errors.New("branch create requires name")
+			}
+			args := []string{"branch", req.Name}
+			if req.Ref != "" {
+				args = append(args, req.Ref)
+			}
+			return args, nil
+		case "switch":
+			if req.Name == "" {
+				return nil, errors.New("branch switch requires name")
+			}
+			return []string{"switch", req.Name}, nil
+		case "delete":
+			if req.Name == "" {
+				return nil, errors.New("branch delete requires name")
+			}
+			return []string{"branch", u.Ternary(req.Force, "-D", "-d"), req.Name}, nil
+		}
+	case "stash":
+		switch req.Action {
+		case "list":
+			return []string{"stash", "list"}, nil
+		case "show":
+			return appendIf([]string{"stash", "show", "--patch", "--no-color"}, req.Name), nil
+		case "push":
+			args := []string{"stash", "push"}
+			if req.Message != "" {
+				args = append(args, "-m", req.Message)
+			}
+			return withPaths(args, req.Paths), nil
+		case "pop", "apply", "drop":
+			return appendIf([]string{"stash", req.Action}, req.Name), nil
+		}
+	case "worktree":
+		switch req.Action {
+		case "list":
+			return []string{"worktree", "list"}, nil
+		case "add":
+			if req.Name == "" {
+				return nil, errors.New("worktree add requires name (the worktree path)")
+			}
+			args := []string{"worktree", "add"}
+			if req.Ref != "" {
+				args = append(args, req.Name, req.Ref)
+			} else {
+				args = append(args, req.Name)
+			}
+			return args, nil
+		case "remove":
+			if req.Name == "" {
+				return nil, errors.New("worktree remove requires name (the worktree path)")
+			}
+			args := []string{"worktree", "remove"}
+			if req.Force {
+				args = append(args, "--force")
+			}
+			return append(args, req.Name), nil
+		}
+	case "push":
+		args := []string{"push"}
+		if req.Force {
+			args = append(args, "--force")
+		}
+		return appendIf(append(args, req.Remote), req.Name), nil
+	}
+	return nil, fmt.Errorf("unsupported op %s %s", req.Op, req.Action)
+}
+
+func appendIf(args []string, value string) []string {
+	if value != "" {
+		return append(args, value)
+	}
+	return args
+}
+
+// workDir 返回执行 git 的工作目录
+func workDir(session *structs.Chats) string {
+	root := session.Root
+	if root == "" {
+		root = "."
+	}
+	return filepath.Join(root, session.CurrentActivatePath)
+}
+
+// runGit 在工作目录执行 git；禁用分页器、编辑器与交互式凭据提示
+func runGit(ctx context.Context, dir string, args []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir, "--no-pager", "-c", "core.quotepath=false"}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_EDITOR=true",
+		"GIT_PAGER=cat",
+		"LC_ALL=C",
+	)
+	out, err := cmd.CombinedOutput()
+	text := string(out)
+	if len(text) > maxOutputBytes {
+		text = text[:maxOutputBytes] + fmt.Sprintf("\n... output truncated (%d bytes total)", len(out))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return text, fmt.Errorf("git %s timed out after %s", args[0], gitTimeout)
+	}
+	return text, err
+}
+
+func updateInfo(session *structs.Chats, mp map[string]*any, cross []*any, toolID string) (bool, []*any, error) {
+	toolCallID := fmt.Sprintf("call_%d_%d_%s", session.ID, session.CurrentMessageID, toolID)
+	respString := ""
+	op := getString(mp, "op")
+	if op != "" {
+		respString += "git " + op
+		if action := getString(mp, "action"); action != "" {
+			respString += " " + action
+		}
+		if name := getString(mp, "name"); name != "" {
+			respString += " " + name
+		}
+		if ref := getString(mp, "ref"); ref != "" {
+			respString += " " + ref
+		}
+		if getBool(mp, "force") {
+			respString += " (force)"
+		}
+		respString += "\n"
+	}
+	if msg := getString(mp, "message"); msg != "" {
+		respString += "Message: " + msg + "\n"
+	}
+	respObj := []u.H{{
+		"type": "content",
+		"content": u.H{
+			"type": "text",
+			"text": respString,
+		},
+	}, {
+		"type":      "alk.cxykevin.top/calling_info",
+		"name":      toolName,
+		"messageID": session.CurrentMessageID,
+		"args": u.H{
+			"op":     mp["op"],
+			"action": mp["action"],
+		},
+	}}
+	session.SetToolCalling(toolCallID, respObj, toolName)
+	return true, cross, nil
+}
+
+func errResult(cross []*any, msg string) (bool, []*any, map[string]*any, error) {
+	boolx := false
+	success := any(boolx)
+	errMsg := any(msg)
+	return false, cross, map[string]*any{
+		"success": &success,
+		"error":   &errMsg,
+	}, nil
+}
+
+// runTool PostHook：执行 git 操作
+func runTool(session *structs.Chats, mp map[string]*any, cross []*any) (bool, []*any, map[string]*any, error) {
+	req, err := parseRequest(mp)
+	if err != nil {
+		return errResult(cross, err.Error())
+	}
+	args, err := buildArgs(req)
+	if err != nil {
+		return errResult(cross, err.Error())
+	}
+	ctx := session.GetContext()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if req.Op == "push" {
+		if err := checkRemote(ctx, workDir(session), req.Remote); err != nil {
+			return errResult(cross, err.Error())
+		}
+	}
+	logger.Info("git %s", strings.Join(args, " "))
+	out, err := runGit(ctx, workDir(session), args)
+	if err != nil {
+		logger.Warn("git %s failed: %v", req.Op, err)
+		msg := strings.TrimSpace(out)
+		if msg == "" {
+			msg = err.Error()
+		}
+		return errResult(cross, fmt.Sprintf("git %s failed: %s", req.Op, msg))
+	}
+	if strings.TrimSpace(out) == "" {
+		out = "(no output)"
+	}
+	boolx := true
+	success := any(boolx)
+	output := any(out)
+	return false, cross, map[string]*any{
+		"success": &success,
+		"output":  &output,
+	}, nil
+}
+
+func load() string {
+	actions.AddTool(&toolobj.Tools{
+		Scope:           "", // Global Tools
+		Name:            toolName,
+		UserDescription: prompt,
+		Parameters:      paras,
+		ID:              toolName,
+	})
+	if err := actions.HookTool(toolName, &toolobj.Hook{
+		Scope: "",
+		PreHook: toolobj.PreHookFunction{
+			Priority: 100,
+			Func:     nil,
+		},
+		OnHook: toolobj.OnHookFunction{
+			Priority: 100,
+			Func:     updateInfo,
+		},
+		PostHook: toolobj.PostHookFunction{
+			Priority: 100,
+			Func:     runTool,
+		},
+	}); err != nil {
+		panic(err)
+	}
+	return toolName
+}
+
+func init() {
+	index.AddIndex(load)
+}
@@ -0,0 +1,156 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/storage/structs"
+)
+
+func params(kv map[string]any) map[string]*any {
+	mp := map[string]*any{}
+	for k, v := range kv {
+		mp[k] = new(v)
+	}
+	return mp
+}
+
+func TestParseRequestValidation(t *testing.T) {
+	bad := []map[string]any{
+		{"op": "rebase"},
+		{"op": "status", "action": "list"},
+		{"op": "branch", "action": "rename"},
+		{"op": "diff", "ref": "--output=/tmp/x"},
+		{"op": "branch", "action": "create", "name": "-D"},
+		{"op": "push", "remote": "origin main"},
+		{"op": "push", "name": "+main"},
+		{"op": "push", "name": "a:+b"},
+		{"op": "push", "name": ":main"},
+		{"op": "add", "paths": []*any{new(any("../outside"))}},
+		{"op": "add", "paths": []*any{new(any(1))}},
+		{"op": "worktree", "action": "add", "name": "/tmp/wt"},
+	}
+	for _, kv := range bad {
+		if _, err := parseRequest(params(kv)); err == nil {
+			t.Fatalf("expected error for %v", kv)
+		}
+	}
+
+	req, err := parseRequest(params(map[string]any{"op": "stash", "paths": `["a.go","b.go"]`}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Action != "list" || !slices.Equal(req.Paths, []string{"a.go", "b.go"}) || req.MaxCount != defaultLogCount {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	cases := []struct {
+		kv   map[string]any
+		want []string
+	}{
+		{map[string]any{"op": "status", "paths": []*any{new(any("src"))}}, []string{"status", "--short", "--branch", "--", "src"}},
+		{map[string]any{"op": "diff", "staged": true, "ref": "HEAD~1"}, []string{"diff", "--no-color", "--no-ext-diff", "--stat", "--patch", "--cached", "HEAD~1"}},
+		{map[string]any{"op": "commit", "message": "-m trick", "all": true}, []string{"commit", "-m", "-m trick", "--all"}},
+		{map[string]any{"op": "branch", "action": "delete", "name": "old", "force": true}, []string{"branch", "-D", "old"}},
+		{map[string]any{"op": "worktree", "action": "add", "name": "wt/a", "ref": "main"}, []string{"worktree", "add", "wt/a", "main"}},
+		{map[string]any{"op": "push", "force": true, "name": "main"}, []string{"push", "--force", "origin", "main"}},
+	}
+	for _, c := range cases {
+		req, err := parseRequest(params(c.kv))
+		if err != nil {
+			t.Fatalf("%v: %v", c.kv, err)
+		}
+		got, err := buildArgs(req)
+		if err != nil {
+			t.Fatalf("%v: %v", c.kv, err)
+		}
+		if !slices.Equal(got, c.want) {
+			t.Fatalf("%v: got %q, want %q", c.kv, got, c.want)
+		}
+	}
+
+	for _, kv := range []map[string]any{
+		{"op": "commit"},
+		{"op": "add"},
+		{"op": "branch", "action": "switch"},
+		{"op": "worktree", "action": "remove"},
+	} {
+		req, err := parseRequest(params(kv))
+		if err != nil {
+			t.Fatalf("%v: %v", kv, err)
+		}
+		if _, err := buildArgs(req); err == nil {
+			t.Fatalf("expected missing-argument error for %v", kv)
+		}
+	}
+}
+
+func TestRunToolCommitFlow(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "Tester")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Tester")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@example.com")
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(dir, "gitconfig"))
+	if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	session := &structs.Chats{Root: dir, CurrentActivatePath: "."}
+	run := func(kv map[string]any) (bool, string) {
+		_, _, ret, err := runTool(session, params(kv), nil)
+		if err != nil {
+			t.Fatalf("runTool error: %v", err)
+		}
+		ok, _ := (*ret["success"]).(bool)
+		if !ok {
+			return false, (*ret["error"]).(string)
+		}
+		return true, (*ret["output"]).(string)
+	}
+
+	if ok, out := run(map[string]any{"op": "status"}); !ok || !strings.Contains(out, "?? a.txt") {
+		t.Fatalf("unexpected status (ok=%v): %s", ok, out)
+	}
+	if ok, out := run(map[string]any{"op": "add", "paths": []*any{new(any("a.txt"))}}); !ok {
+		t.Fatalf("add failed: %s", out)
+	}
+	if ok, out := run(map[string]any{"op": "diff", "staged": true}); !ok || !strings.Contains(out, "+hello") {
+		t.Fatalf("unexpected staged diff (ok=%v): %s", ok, out)
+	}
+	if ok, out := run(map[string]any{"op": "commit", "message": "add a.txt"}); !ok {
+		t.Fatalf("commit failed: %s", out)
+	}
+	if ok, out := run(map[string]any{"op": "log"}); !ok || !strings.Contains(out, "add a.txt") || !strings.Contains(out, "Tester") {
+		t.Fatalf("unexpected log (ok=%v): %s", ok, out)
+	}
+	if ok, out := run(map[string]any{"op": "commit", "message": "empty"}); ok || !strings.Contains(out, "git commit failed") {
+		t.Fatalf("expected failure for empty commit (ok=%v): %s", ok, out)
+	}
+
+	// push 只接受已配置的远程名
+	remoteDir := filepath.Join(dir, "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", remoteDir).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare: %v\n%s", err, out)
+	}
+	if ok, out := run(map[string]any{"op": "push", "remote": remoteDir, "name": "HEAD"}); ok || !strings.Contains(out, "not configured") {
+		t.Fatalf("expected unconfigured remote to be rejected (ok=%v): %s", ok, out)
+	}
+	if out, err := exec.Command("git", "-C", dir, "remote", "add", "backup", remoteDir).CombinedOutput(); err != nil {
+		t.Fatalf("git remote add: %v\n%s", err, out)
+	}
+	if ok, out := run(map[string]any{"op": "push", "remote": "backup", "name": "HEAD:refs/heads/main"}); !ok {
+		t.Fatalf("push to configured remote failed: %s", out)
+	}
+}
@@ -283,6 +283,7 @@ func load() string {
 	if err := actions.HookTool("", &toolobj.Hook{
 		Scope: "",
 		PreHook: toolobj.PreHookFunction{
+			Name:     "memory",
 			Priority: 101,
 			Func:     buildMemoryPrompt,
 		},
@@ -293,6 +294,7 @@ func load() string {
 	if err := actions.HookTool("", &toolobj.Hook{
 		Scope: "",
 		PreHook: toolobj.PreHookFunction{
+			Name:     "agents_md",
 			Priority: 100,
 			Func:     buildAgentsPrompt,
 		},
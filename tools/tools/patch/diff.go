@@ -0,0 +1,302 @@
+package patch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// devNull unified diff 中表示"文件不存在"的路径
+const devNull = "/dev/null"
+
+// hunkLine 表示 hunk 中的一行：' ' 上下文、'-' 删除、'+' 新增。
+type hunkLine struct {
+	kind byte
+	text string
+}
+
+// hunk 一个 @@ 块
+type hunk struct {
+	oldStart int
+	oldCount int
+	newCount int
+	lines    []hunkLine
+	newNoEOL bool // 新内容末行没有换行（"\ No newline at end of file" 标在新增或上下文行后）
+}
+
+// done 报告 hunk 头声明的新旧行数是否都已读满
+func (h *hunk) done() bool {
+	var oldSeen, newSeen int
+	for _, l := range h.lines {
+		if l.kind != '+' {
+			oldSeen++
+		}
+		if l.kind != '-' {
+			newSeen++
+		}
+	}
+	return oldSeen >= h.oldCount && newSeen >= h.newCount
+}
+
+// filePatch 单个文件的补丁。oldPath/newPath 为空表示 /dev/null（新建/删除）。
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []hunk
+}
+
+// oldLines 返回 hunk 期望在当前内容中出现的行（上下文 + 删除行）
+func (h *hunk) oldLines() []string {
+	out := make([]string, 0, len(h.lines))
+	for _, l := range h.lines {
+		if l.kind != '+' {
+			out = append(out, l.text)
+		}
+	}
+	return out
+}
+
+// newLines 返回 hunk 应用后的行（上下文 + 新增行）
+func (h *hunk) newLines() []string {
+	out := make([]string, 0, len(h.lines))
+	for _, l := range h.lines {
+		if l.kind != '-' {
+			out = append(out, l.text)
+		}
+	}
+	return out
+}
+
+// parseDiffPath 解析 ---/+++ 行中的路径：去掉时间戳后缀与 a/、b/ 前缀，/dev/null 返回空串。
+func parseDiffPath(s string) string {
+	s = strings.TrimSpace(s)
+	if idx := strings.Index(s, "\t"); idx >= 0 {
+		s = s[:idx]
+	}
+	if s == devNull {
+		return ""
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+// parseHunkHeader 解析 "@@ -l,c +l,c @@"，省略 count 时按 1 处理（diff 惯例）。
+func parseHunkHeader(line string) (hunk, error) {
+	rest := strings.TrimPrefix(line, "@@")
+	end := strings.Index(rest, "@@")
+	if end < 0 {
+		return hunk{}, fmt.Errorf("invalid hunk header: %s", line)
+	}
+	fields := strings.Fields(rest[:end])
+	if len(fields) < 1 || !strings.HasPrefix(fields[0], "-") {
+		return hunk{}, fmt.Errorf("invalid hunk header: %s", line)
+	}
+	start, count, err := parseRange(fields[0][1:])
+	if err != nil {
+		return hunk{}, fmt.Errorf("invalid hunk header %q: %w", line, err)
+	}
+	h := hunk{oldStart: start, oldCount: count}
+	if len(fields) > 1 && strings.HasPrefix(fields[1], "+") {
+		if _, h.newCount, err = parseRange(fields[1][1:]); err != nil {
+			return hunk{}, fmt.Errorf("invalid hunk header %q: %w", line, err)
+		}
+	}
+	return h, nil
+}
+
+func parseRange(s string) (int, int, error) {
+	startStr, countStr, hasCount := strings.Cut(s, ",")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	count := 1
+	if hasCount {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, count, nil
+}
+
+// parseUnifiedDiff 将 unified diff 文本解析为按文件分组的补丁。
+//
+// 解析是宽松的：不依赖 hunk 头中的行数判断块结束（模型常写错），而是读到下一个
+// @@ / ---+++ / diff --git 头为止；hunk 内的空行视为空上下文行（模型常丢掉行首空格）。
+// 例外是 ---/+++ 头：hunk 行数读满之前它们是以 "-- "、"++ " 开头的删除/新增行。
+func parseUnifiedDiff(text string) ([]filePatch, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	var patches []filePatch
+	var cur *filePatch
+	var curHunk *hunk
+
+	flushHunk := func() {
+		if cur != nil && curHunk != nil {
+			// 去掉末尾的空上下文行（多为 diff 文本尾部的空行）
+			for len(curHunk.lines) > 0 {
+				last := curHunk.lines[len(curHunk.lines)-1]
+				if last.kind != ' ' || last.text != "" {
+					break
+				}
+				curHunk.lines = curHunk.lines[:len(curHunk.lines)-1]
+			}
+			cur.hunks = append(cur.hunks, *curHunk)
+		}
+		curHunk = nil
+	}
+	flushFile := func() {
+		flushHunk()
+		if cur != nil {
+			patches = append(patches, *cur)
+		}
+		cur = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flushFile()
+			cur = &filePatch{}
+			// 以 diff --git a/x b/x 作为缺省路径，后续 ---/+++ 覆盖
+			if fields := strings.Fields(strings.TrimPrefix(line, "diff --git ")); len(fields) == 2 {
+				cur.oldPath = parseDiffPath(fields[0])
+				cur.newPath = parseDiffPath(fields[1])
+			}
+			continue
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") &&
+			(curHunk == nil || curHunk.done()):
+			// diff --git 之后的 ---/+++ 属于同一文件，否则开启新文件
+			if cur == nil || curHunk != nil || len(cur.hunks) > 0 {
+				flushFile()
+				cur = &filePatch{}
+			}
+			cur.oldPath = parseDiffPath(strings.TrimPrefix(line, "--- "))
+			cur.newPath = parseDiffPath(strings.TrimPrefix(lines[i+1], "+++ "))
+			i++
+			continue
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk without file header", i+1)
+			}
+			flushHunk()
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			curHunk = &h
+			continue
+		}
+		if curHunk == nil {
+			// 文件头之间的 index/mode/similarity 等元数据行
+			continue
+		}
+		switch {
+		case line == "":
+			curHunk.lines = append(curHunk.lines, hunkLine{' ', ""})
+		case line[0] == ' ', line[0] == '-', line[0] == '+':
+			curHunk.lines = append(curHunk.lines, hunkLine{line[0], line[1:]})
+		case line[0] == '\\':
+			// "\ No newline at end of file"：作用于上一行，删除行只影响旧内容
+			if n := len(curHunk.lines); n > 0 && curHunk.lines[n-1].kind != '-' {
+				curHunk.newNoEOL = true
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unexpected content in hunk: %q", i+1, line)
+		}
+	}
+	flushFile()
+
+	for _, p := range patches {
+		if p.oldPath == "" && p.newPath == "" {
+			return nil, fmt.Errorf("file patch without path")
+		}
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file patches found in diff")
+	}
+	return patches, nil
+}
+
+// splitContent 将文件内容按行切分，忽略末尾换行。
+func splitContent(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// matchAt 判断 want 是否与 lines[pos:] 逐行一致；loose=true 时忽略行尾空白与 \r。
+func matchAt(lines []string, pos int, want []string, loose bool) bool {
+	if pos < 0 || pos+len(want) > len(lines) {
+		return false
+	}
+	for i, w := range want {
+		got := lines[pos+i]
+		if loose {
+			got = strings.TrimRight(got, " \t\r")
+			w = strings.TrimRight(w, " \t\r")
+		}
+		if got != w {
+			return false
+		}
+	}
+	return true
+}
+
+// findHunk 以期望位置为中心向两侧查找 hunk 的实际位置（容忍行号偏移），先精确后宽松。
+func findHunk(lines []string, want []string, expected, minPos int) int {
+	for _, loose := range []bool{false, true} {
+		for d := 0; ; d++ {
+			fwd, back := expected+d, expected-d
+			if fwd > len(lines) && back < minPos {
+				break
+			}
+			if fwd >= minPos && matchAt(lines, fwd, want, loose) {
+				return fwd
+			}
+			if d > 0 && back >= minPos && matchAt(lines, back, want, loose) {
+				return back
+			}
+		}
+	}
+	return -1
+}
+
+// applyHunks 将 hunks 依次应用到 content，任一 hunk 不匹配返回错误（内容不变）。
+// 末尾换行保持原样，除非最后一个 hunk 覆盖到文件末尾，此时以其 "\ No newline" 标记为准。
+func applyHunks(content string, hunks []hunk) (string, error) {
+	lines := splitContent(content)
+	out := make([]string, 0, len(lines))
+	eol := content == "" || strings.HasSuffix(content, "\n")
+	pos := 0
+	for idx, h := range hunks {
+		want := h.oldLines()
+		expected := max(h.oldStart-1, 0)
+		if h.oldCount == 0 && len(want) == 0 {
+			// 纯插入：oldStart 为插入点之前的行号
+			expected = h.oldStart
+		}
+		at := findHunk(lines, want, expected, pos)
+		if at < 0 {
+			return "", fmt.Errorf("hunk #%d (@@ -%d,%d @@) does not match the current content", idx+1, h.oldStart, h.oldCount)
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, h.newLines()...)
+		pos = at + len(want)
+		if pos == len(lines) {
+			eol = !h.newNoEOL
+		}
+	}
+	out = append(out, lines[pos:]...)
+	if len(out) == 0 {
+		return "", nil
+	}
+	if !eol {
+		return strings.Join(out, "\n"), nil
+	}
+	return strings.Join(out, "\n") + "\n", nil
+}
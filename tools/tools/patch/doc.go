@@ -0,0 +1,4 @@
+// Package patch 实现多文件原子补丁工具，支持 unified diff 与编辑操作列表
+//
+// 该包先对全部文件校验每个 hunk/编辑操作，全部通过后才统一写入，任一失败则整体回滚
+package patch
@@ -0,0 +1,562 @@
+package patch
+
+import (
+	_ "embed" // embed
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cxykevin/alkaid0/context/lsp"
+	"github.com/cxykevin/alkaid0/log"
+	"github.com/cxykevin/alkaid0/provider/parser"
+	"github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/tools/actions"
+	"github.com/cxykevin/alkaid0/tools/index"
+	"github.com/cxykevin/alkaid0/tools/toolobj"
+	"github.com/cxykevin/alkaid0/tools/tools/edit"
+	"github.com/cxykevin/alkaid0/tools/tools/trace"
+	u "github.com/cxykevin/alkaid0/utils"
+)
+
+const toolName = "patch"
+
+//go:embed prompt.md
+var prompt string
+
+var logger = log.New("tools:patch")
+
+var paras = map[string]parser.ToolParameters{
+	"diff": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "A unified diff (git diff format) touching one or more files. Paths are RELATIVE to the workspace; 'a/' and 'b/' prefixes are accepted. Use either `diff` or `edits`, not both.",
+	},
+	"edits": {
+		Type:        parser.ToolTypeArray,
+		Required:    false,
+		Description: "A list of edit operations, each an object {\"path\",\"target\",\"text\"} with the same semantics as the `edit` tool. Operations on the same file are applied in order.",
+	},
+}
+
+// fileChange 单个文件的待提交变更（校验阶段生成，提交阶段写入）
+type fileChange struct {
+	relPath    string
+	absPath    string
+	oldContent string
+	oldExists  bool
+	newContent string
+	present    bool // 应用已累积的变更后文件是否存在
+}
+
+// operation 返回 ACP Diffs 段使用的操作类型
+func (c *fileChange) operation() string {
+	switch {
+	case !c.present:
+		return "delete"
+	case !c.oldExists:
+		return "add"
+	default:
+		return "modify"
+	}
+}
+
+// buildRespObj 构造 patch 工具调用的展示内容（文本 + calling_info）
+func buildRespObj(session *structs.Chats, mp map[string]*any) []u.H {
+	respString := ""
+	var diffVal *string
+	var editsVal any
+	if diffPtr, ok := mp["diff"]; ok && diffPtr != nil {
+		if diff, ok := (*diffPtr).(string); ok {
+			respString += "=== Diff ===\n" + diff + "\n"
+			diffVal = &diff
+		}
+	}
+	if editsPtr, ok := mp["edits"]; ok && editsPtr != nil {
+		if ops, err := parseEditOps(*editsPtr); err == nil {
+			respString += fmt.Sprintf("Edits: %d operation(s)\n", len(ops))
+			for _, op := range ops {
+				respString += "- " + op.path + " (" + op.target + ")\n"
+			}
+		}
+		editsVal = *editsPtr
+	}
+	return []u.H{{
+		"type": "content",
+		"content": u.H{
+			"type": "text",
+			"text": respString,
+		},
+	}, {
+		"type":      "alk.cxykevin.top/calling_info",
+		"name":      toolName,
+		"messageID": session.CurrentMessageID,
+		"args": u.H{
+			"diff":  diffVal,
+			"edits": editsVal,
+		},
+	}}
+}
+
+func updateInfo(session *structs.Chats, mp map[string]*any, cross []*any, toolID string) (bool, []*any, error) {
+	toolCallID := fmt.Sprintf("call_%d_%d_%s", session.ID, session.CurrentMessageID, toolID)
+	session.SetToolCalling(toolCallID, buildRespObj(session, mp), "edit")
+	return true, cross, nil
+}
+
+// errResult 构造失败返回
+func errResult(cross []*any, msg string) (bool, []*any, map[string]*any, error) {
+	boolx := false
+	success := any(boolx)
+	errMsg := any(msg)
+	return false, cross, map[string]*any{
+		"success": &success,
+		"error":   &errMsg,
+	}, nil
+}
+
+// resolvePath 校验相对路径并返回绝对路径；不支持 @tree 等虚拟对象。
+func resolvePath(session *structs.Chats, rel string) (string, error) {
+	if rel == "" {
+		return "", errors.New("empty path")
+	}
+	if strings.HasPrefix(rel, "@") {
+		return "", fmt.Errorf("%s: virtual objects are not supported by patch, use edit", rel)
+	}
+	if err := edit.ValidatePath(rel); err != nil {
+		return "", fmt.Errorf("%s: %w", rel, err)
+	}
+	if edit.IsSensitivePath(rel) {
+		return "", fmt.Errorf("%s: sensitive path is not allowed", rel)
+	}
+	return filepath.Join(session.Root, filepath.Join(session.CurrentActivatePath, rel)), nil
+}
+
+// changeSet 按首次出现顺序记录各文件变更，同一文件的多次操作累积在同一条目上
+type changeSet struct {
+	order   []string
+	changes map[string]*fileChange
+}
+
+// get 返回 rel 对应的变更条目，首次访问时读取磁盘内容并校验 trace 一致性
+func (cs *changeSet) get(session *structs.Chats, rel string) (*fileChange, error) {
+	if c, ok := cs.changes[rel]; ok {
+		return c, nil
+	}
+	abs, err := resolvePath(session, rel)
+	if err != nil {
+		return nil, err
+	}
+	c := &fileChange{relPath: rel, absPath: abs}
+	raw, err := os.ReadFile(abs)
+	switch {
+	case err == nil:
+		c.oldExists = true
+		c.oldContent = string(raw)
+	case os.IsNotExist(err):
+	default:
+		return nil, fmt.Errorf("%s: failed to read file: %v", rel, err)
+	}
+	if c.oldExists {
+		if err := trace.CheckEditContent(session, rel, c.oldContent); err != nil {
+			return nil, err
+		}
+	}
+	c.newContent = c.oldContent
+	c.present = c.oldExists
+	if cs.changes == nil {
+		cs.changes = make(map[string]*fileChange)
+	}
+	cs.changes[rel] = c
+	cs.order = append(cs.order, rel)
+	return c, nil
+}
+
+// planDiff 校验 unified diff 的所有 hunk 并生成变更集（不写盘）
+func planDiff(session *structs.Chats, diffText string) (*changeSet, error) {
+	patches, err := parseUnifiedDiff(diffText)
+	if err != nil {
+		return nil, err
+	}
+	cs := &changeSet{}
+	for _, p := range patches {
+		switch {
+		case p.oldPath == "":
+			// 新建文件
+			c, err := cs.get(session, p.newPath)
+			if err != nil {
+				return nil, err
+			}
+			if c.present {
+				return nil, fmt.Errorf("%s: file already exists, cannot create", p.newPath)
+			}
+			content, err := applyHunks("", p.hunks)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.newPath, err)
+			}
+			c.present = true
+			c.newContent = content
+		case p.newPath == "":
+			// 删除文件：hunk 仍需与当前内容一致
+			c, err := cs.get(session, p.oldPath)
+			if err != nil {
+				return nil, err
+			}
+			if !c.present {
+				return nil, fmt.Errorf("%s: file does not exist, cannot delete", p.oldPath)
+			}
+			content, err := applyHunks(c.newContent, p.hunks)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.oldPath, err)
+			}
+			if len(p.hunks) > 0 && content != "" {
+				return nil, fmt.Errorf("%s: delete patch does not remove the whole file", p.oldPath)
+			}
+			c.present = false
+			c.newContent = ""
+		default:
+			src, err := cs.get(session, p.oldPath)
+			if err != nil {
+				return nil, err
+			}
+			if !src.present {
+				return nil, fmt.Errorf("%s: file does not exist", p.oldPath)
+			}
+			content, err := applyHunks(src.newContent, p.hunks)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.oldPath, err)
+			}
+			dst := src
+			if p.newPath != p.oldPath {
+				// 重命名：旧文件删除，新文件写入
+				if dst, err = cs.get(session, p.newPath); err != nil {
+					return nil, err
+				}
+				if dst.present {
+					return nil, fmt.Errorf("%s: rename target already exists", p.newPath)
+				}
+				src.present = false
+				src.newContent = ""
+			}
+			dst.present = true
+			dst.newContent = content
+		}
+	}
+	return cs, nil
+}
+
+// editOp 编辑操作列表中的一项，语义与 edit 工具一致
+type editOp struct {
+	path   string
+	target string
+	text   string
+}
+
+// parseEditOps 解析 edits 参数（对象数组）。
+// 流式解析完成的数组为 []*any，其余来源可能为 []any 或 JSON 字符串，统一处理。
+func parseEditOps(raw any) ([]editOp, error) {
+	var items []any
+	switch v := raw.(type) {
+	case []*any:
+		for _, p := range v {
+			if p == nil {
+				items = append(items, nil)
+				continue
+			}
+			items = append(items, *p)
+		}
+	case []any:
+		items = v
+	case string:
+		if err := json.Unmarshal([]byte(v), &items); err != nil {
+			return nil, fmt.Errorf("edits must be an array: %v", err)
+		}
+	default:
+		return nil, errors.New("edits must be an array")
+	}
+	if len(items) == 0 {
+		return nil, errors.New("edits is empty")
+	}
+	ops := make([]editOp, 0, len(items))
+	for i, item := range items {
+		var obj map[string]*any
+		switch v := item.(type) {
+		case map[string]*any:
+			obj = v
+		case map[string]any:
+			obj = make(map[string]*any, len(v))
+			for k, val := range v {
+				obj[k] = &val
+			}
+		default:
+			return nil, fmt.Errorf("edits[%d] must be an object", i)
+		}
+		path, err := edit.CheckPath(obj)
+		if err != nil {
+			return nil, fmt.Errorf("edits[%d]: %w", i, err)
+		}
+		target, text, err := edit.CheckTargetText(obj)
+		if err != nil {
+			return nil, fmt.Errorf("edits[%d]: %w", i, err)
+		}
+		ops = append(ops, editOp{path: path, target: target, text: text})
+	}
+	return ops, nil
+}
+
+// planEdits 依次执行编辑操作并生成变更集（不写盘）
+func planEdits(session *structs.Chats, ops []editOp) (*changeSet, error) {
+	cs := &changeSet{}
+	for i, op := range ops {
+		c, err := cs.get(session, op.path)
+		if err != nil {
+			return nil, fmt.Errorf("edits[%d]: %w", i, err)
+		}
+		// 与 edit 一致：按行读取后的内容不含末尾换行
+		content, err := edit.ProcessString(strings.TrimSuffix(c.newContent, "\n"), op.target, op.text, c.present)
+		if err != nil {
+			return nil, fmt.Errorf("edits[%d] (%s): %w", i, op.path, err)
+		}
+		c.newContent = edit.NormalizeTrailingNewline(content)
+		c.present = true
+	}
+	return cs, nil
+}
+
+// commit 写入全部变更；任一写入失败时回滚已写入的文件，保证全有或全无。
+func (cs *changeSet) commit() error {
+	type undo struct {
+		change     *fileChange
+		createdDir string
+	}
+	done := make([]undo, 0, len(cs.order))
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			c := done[i].change
+			var err error
+			if c.oldExists {
+				err = os.WriteFile(c.absPath, []byte(c.oldContent), 0644)
+			} else {
+				err = os.Remove(c.absPath)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				logger.Error("failed to roll back %s: %v", c.absPath, err)
+			}
+			if done[i].createdDir != "" {
+				_ = os.RemoveAll(done[i].createdDir)
+			}
+		}
+	}
+	for _, rel := range cs.order {
+		c := cs.changes[rel]
+		if !c.oldExists && !c.present {
+			continue
+		}
+		if c.oldExists && c.present && c.oldContent == c.newContent {
+			continue
+		}
+		step := undo{change: c}
+		var err error
+		if !c.present {
+			err = os.Remove(c.absPath)
+		} else {
+			if !c.oldExists {
+				step.createdDir = firstMissingDir(filepath.Dir(c.absPath))
+				if step.createdDir != "" {
+					err = os.MkdirAll(filepath.Dir(c.absPath), 0755)
+				}
+			}
+			if err == nil {
+				err = os.WriteFile(c.absPath, []byte(c.newContent), 0644)
+			}
+		}
+		if err != nil {
+			done = append(done, step)
+			rollback()
+			return fmt.Errorf("%s: %v", rel, err)
+		}
+		done = append(done, step)
+	}
+	return nil
+}
+
+// firstMissingDir 返回 dir 路径上第一个不存在的目录（全部存在时返回空串），用于回滚时清理
+func firstMissingDir(dir string) string {
+	missing := ""
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return missing
+		}
+		missing = dir
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return missing
+		}
+		dir = parent
+	}
+}
+
+// TargetPaths 返回 patch 调用涉及的全部文件路径，供审批规则检查；无法解析的部分忽略
+func TargetPaths(mp map[string]*any) []string {
+	var paths []string
+	if diffPtr, ok := mp["diff"]; ok && diffPtr != nil {
+		if diffText, ok := (*diffPtr).(string); ok {
+			patches, _ := parseUnifiedDiff(diffText)
+			for _, p := range patches {
+				for _, path := range []string{p.oldPath, p.newPath} {
+					if path != "" {
+						paths = append(paths, path)
+					}
+				}
+			}
+		}
+	}
+	if editsPtr, ok := mp["edits"]; ok && editsPtr != nil {
+		ops, _ := parseEditOps(*editsPtr)
+		for _, op := range ops {
+			paths = append(paths, op.path)
+		}
+	}
+	return paths
+}
+
+func applyPatch(session *structs.Chats, mp map[string]*any, cross []*any) (bool, []*any, map[string]*any, error) {
+	var diffText string
+	if diffPtr, ok := mp["diff"]; ok && diffPtr != nil {
+		diffText, _ = (*diffPtr).(string)
+	}
+	var editsRaw any
+	if editsPtr, ok := mp["edits"]; ok && editsPtr != nil {
+		editsRaw = *editsPtr
+	}
+
+	var cs *changeSet
+	var err error
+	switch {
+	case strings.TrimSpace(diffText) != "" && editsRaw != nil:
+		return errResult(cross, "use either diff or edits, not both")
+	case strings.TrimSpace(diffText) != "":
+		cs, err = planDiff(session, diffText)
+	case editsRaw != nil:
+		var ops []editOp
+		if ops, err = parseEditOps(editsRaw); err == nil {
+			cs, err = planEdits(session, ops)
+		}
+	default:
+		return errResult(cross, "missing diff or edits parameter")
+	}
+	if err != nil {
+		logger.Warn("patch validation failed: %v", err)
+		return errResult(cross, "patch rejected, no files were changed: "+err.Error())
+	}
+
+	// 写入前检查取消信号
+	if session.GetContext().Err() != nil {
+		return errResult(cross, "patch cancelled: "+session.GetContext().Err().Error())
+	}
+	logger.Info("apply patch to %d file(s) in ID=%d,agentID=%s", len(cs.order), session.ID, session.CurrentAgentID)
+	if err := cs.commit(); err != nil {
+		logger.Warn("failed to apply patch: %v", err)
+		return errResult(cross, "patch failed and was rolled back: "+err.Error())
+	}
+
+	respObj := buildRespObj(session, mp)
+	files := make([]any, 0, len(cs.order))
+	diagnostics := map[string]any{}
+	formatted := []any{}
+	for _, rel := range cs.order {
+		c := cs.changes[rel]
+		if !c.oldExists && !c.present {
+			continue
+		}
+		files = append(files, u.H{"path": rel, "operation": c.operation()})
+		finalContent := c.newContent
+		if c.present {
+			pathStr := any(rel)
+			trace.Trace(session, map[string]*any{
+				"path": &pathStr,
+			}, []*any{})
+			fmtResult := lsp.FormatAndDiagnose(session.Root, c.absPath)
+			if fmtResult.Error != "" {
+				logger.Warn("LSP format+diagnose for %s: %s", c.absPath, fmtResult.Error)
+			}
+			if fmtResult.Formatted {
+				formatted = append(formatted, rel)
+			}
+			if len(fmtResult.Diagnostics) > 0 {
+				diagnostics[rel] = fmtResult.Diagnostics
+			}
+			if fb, err := os.ReadFile(c.absPath); err == nil {
+				finalContent = string(fb)
+			}
+			trace.ConfirmEditContent(session, rel, finalContent)
+		}
+		if diffObj := edit.BuildDiffContent(c.absPath, c.oldContent, finalContent, !c.oldExists); diffObj != nil {
+			if !c.present {
+				if changes, ok := diffObj["changes"].([]u.H); ok && len(changes) > 0 {
+					changes[0]["operation"] = "delete"
+				}
+			}
+			respObj = append(respObj, diffObj)
+		}
+	}
+	if toolIDPtr, ok := mp["_id"]; ok && toolIDPtr != nil {
+		if toolID, ok := (*toolIDPtr).(string); ok && toolID != "" {
+			toolCallID := fmt.Sprintf("call_%d_%d_%s", session.ID, session.CurrentMessageID, toolID)
+			session.SetToolCalling(toolCallID, respObj, "edit")
+			edit.SaveToolCallingContent(session, toolID, respObj)
+		}
+	}
+
+	boolx := true
+	success := any(boolx)
+	filesAny := any(files)
+	resultMap := map[string]*any{
+		"success": &success,
+		"files":   &filesAny,
+	}
+	if len(formatted) > 0 {
+		formatAny := any(formatted)
+		resultMap["format_applied"] = &formatAny
+	}
+	if len(diagnostics) > 0 {
+		// 按文件返回诊断信息，AI 将看到并可以修复
+		diagAny := any(diagnostics)
+		resultMap["diagnostics"] = &diagAny
+	}
+	return false, cross, resultMap, nil
+}
+
+func load() string {
+	actions.AddTool(&toolobj.Tools{
+		Scope:           "", // Global Tools
+		Name:            toolName,
+		UserDescription: prompt,
+		Parameters:      paras,
+		ID:              toolName,
+	})
+	if err := actions.HookTool(toolName, &toolobj.Hook{
+		Scope: "",
+		PreHook: toolobj.PreHookFunction{
+			Priority: 100,
+			Func:     nil,
+		},
+		OnHook: toolobj.OnHookFunction{
+			Priority: 100,
+			Func:     updateInfo,
+		},
+		PostHook: toolobj.PostHookFunction{
+			Priority: 100,
+			Func:     applyPatch,
+		},
+	}); err != nil {
+		panic(err)
+	}
+	return toolName
+}
+
+func init() {
+	index.AddIndex(load)
+}
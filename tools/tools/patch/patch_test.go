@@ -0,0 +1,383 @@
+package patch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/storage/structs"
+)
+
+func success(ret map[string]*any) bool {
+	if ret == nil || ret["success"] == nil {
+		return false
+	}
+	b, _ := (*ret["success"]).(bool)
+	return b
+}
+
+func errorText(ret map[string]*any) string {
+	if ret == nil || ret["error"] == nil {
+		return ""
+	}
+	s, _ := (*ret["error"]).(string)
+	return s
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(b)
+}
+
+func TestParseUnifiedDiff(t *testing.T) {
+	diff := `diff --git a/a.txt b/a.txt
+index 111..222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++hello
++world
+`
+	patches, err := parseUnifiedDiff(diff)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("expected 2 file patches, got %d", len(patches))
+	}
+	if patches[0].oldPath != "a.txt" || patches[0].newPath != "a.txt" {
+		t.Fatalf("unexpected paths: %+v", patches[0])
+	}
+	if len(patches[0].hunks) != 1 || len(patches[0].hunks[0].lines) != 4 {
+		t.Fatalf("unexpected hunks: %+v", patches[0].hunks)
+	}
+	if patches[1].oldPath != "" || patches[1].newPath != "new.txt" {
+		t.Fatalf("unexpected new file paths: %+v", patches[1])
+	}
+
+	if _, err := parseUnifiedDiff("just text"); err == nil {
+		t.Fatal("expected error for diff without file patches")
+	}
+}
+
+func TestParseUnifiedDiffDashLinesInHunk(t *testing.T) {
+	// 删除 "-- note"、新增 "++ note" 在 hunk 行数读满前不是文件头
+	diff := `--- a/a.sql
++++ b/a.sql
+@@ -1,3 +1,3 @@
+ select 1;
+--- note
++++ note
+ select 2;
+--- a/b.txt
++++ b/b.txt
+@@ -1 +1 @@
+-x
++y
+`
+	patches, err := parseUnifiedDiff(diff)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(patches) != 2 || patches[1].newPath != "b.txt" {
+		t.Fatalf("expected 2 file patches, got %+v", patches)
+	}
+	got, err := applyHunks("select 1;\n-- note\nselect 2;\n", patches[0].hunks)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if got != "select 1;\n++ note\nselect 2;\n" {
+		t.Fatalf("unexpected content: %q", got)
+	}
+}
+
+func TestApplyHunksNoNewlineAtEOF(t *testing.T) {
+	// 新内容去掉末尾换行
+	patches, err := parseUnifiedDiff(`--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ a
+-b
++c
+\ No newline at end of file
+`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got, err := applyHunks("a\nb\n", patches[0].hunks); err != nil || got != "a\nc" {
+		t.Fatalf("expected no trailing newline, got %q (%v)", got, err)
+	}
+
+	// 旧内容无末尾换行，新内容补上
+	patches, err = parseUnifiedDiff(`--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got, err := applyHunks("a\nb", patches[0].hunks); err != nil || got != "a\nc\n" {
+		t.Fatalf("expected trailing newline to be added, got %q (%v)", got, err)
+	}
+
+	// 未触及末尾的 hunk 保持原有的无换行状态
+	h := hunk{oldStart: 1, oldCount: 1, lines: []hunkLine{{'-', "a"}, {'+', "A"}}}
+	if got, err := applyHunks("a\nb", []hunk{h}); err != nil || got != "A\nb" {
+		t.Fatalf("expected missing newline to be kept, got %q (%v)", got, err)
+	}
+}
+
+func TestApplyHunksOffsetAndMismatch(t *testing.T) {
+	content := "a\nb\nc\nd\ne\n"
+	// 行号偏移 2 行仍能按内容定位
+	h := hunk{oldStart: 1, oldCount: 2, lines: []hunkLine{{' ', "c"}, {'-', "d"}, {'+', "D"}}}
+	got, err := applyHunks(content, []hunk{h})
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if got != "a\nb\nc\nD\ne\n" {
+		t.Fatalf("unexpected content: %q", got)
+	}
+
+	bad := hunk{oldStart: 1, oldCount: 1, lines: []hunkLine{{'-', "zzz"}}}
+	if _, err := applyHunks(content, []hunk{bad}); err == nil {
+		t.Fatal("expected mismatch error")
+	}
+}
+
+func TestApplyPatchMultiFile(t *testing.T) {
+	tmpdir := t.TempDir()
+	writeFiles(t, tmpdir, map[string]string{
+		"a.txt":     "one\ntwo\nthree\n",
+		"b.txt":     "alpha\nbeta\n",
+		"old.txt":   "gone\n",
+		"src/c.txt": "x\n",
+	})
+	session := &structs.Chats{CurrentActivatePath: tmpdir}
+
+	diff := `--- a/a.txt
++++ b/a.txt
+@@ -2,1 +2,1 @@
+-two
++TWO
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,3 @@
+ alpha
+ beta
++gamma
+--- /dev/null
++++ b/sub/dir/new.txt
+@@ -0,0 +1 @@
++created
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+--- a/src/c.txt
++++ b/src/d.txt
+`
+	_, _, ret, err := applyPatch(session, map[string]*any{"diff": new(any(diff))}, nil)
+	if err != nil {
+		t.Fatalf("applyPatch returned error: %v", err)
+	}
+	if !success(ret) {
+		t.Fatalf("expected success, got %q", errorText(ret))
+	}
+	if got := readFile(t, tmpdir, "a.txt"); got != "one\nTWO\nthree\n" {
+		t.Fatalf("a.txt mismatch: %q", got)
+	}
+	if got := readFile(t, tmpdir, "b.txt"); got != "alpha\nbeta\ngamma\n" {
+		t.Fatalf("b.txt mismatch: %q", got)
+	}
+	if got := readFile(t, tmpdir, "sub/dir/new.txt"); got != "created\n" {
+		t.Fatalf("new.txt mismatch: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "old.txt")); !os.IsNotExist(err) {
+		t.Fatalf("old.txt should be deleted, stat err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "src/c.txt")); !os.IsNotExist(err) {
+		t.Fatalf("src/c.txt should be renamed away, stat err=%v", err)
+	}
+	if got := readFile(t, tmpdir, "src/d.txt"); got != "x\n" {
+		t.Fatalf("src/d.txt mismatch: %q", got)
+	}
+}
+
+func TestApplyPatchAllOrNothing(t *testing.T) {
+	tmpdir := t.TempDir()
+	writeFiles(t, tmpdir, map[string]string{
+		"a.txt": "one\ntwo\n",
+		"b.txt": "alpha\n",
+	})
+	session := &structs.Chats{CurrentActivatePath: tmpdir}
+
+	// 第二个文件的 hunk 不匹配，第一个文件也不应被修改
+	diff := `--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+-one
++ONE
+ two
+--- a/b.txt
++++ b/b.txt
+@@ -1 +1 @@
+-not-alpha
++beta
+--- /dev/null
++++ b/c.txt
+@@ -0,0 +1 @@
++new
+`
+	_, _, ret, _ := applyPatch(session, map[string]*any{"diff": new(any(diff))}, nil)
+	if success(ret) {
+		t.Fatal("expected failure for mismatched hunk")
+	}
+	if !strings.Contains(errorText(ret), "b.txt") {
+		t.Fatalf("error should name the failing file: %q", errorText(ret))
+	}
+	if got := readFile(t, tmpdir, "a.txt"); got != "one\ntwo\n" {
+		t.Fatalf("a.txt should be untouched: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "c.txt")); !os.IsNotExist(err) {
+		t.Fatal("c.txt should not be created")
+	}
+}
+
+func TestApplyPatchEdits(t *testing.T) {
+	tmpdir := t.TempDir()
+	writeFiles(t, tmpdir, map[string]string{
+		"a.txt": "one\ntwo\nthree\n",
+	})
+	session := &structs.Chats{CurrentActivatePath: tmpdir}
+
+	obj := func(path, target, text string) *any {
+		return new(any(map[string]*any{
+			"path":   new(any(path)),
+			"target": new(any(target)),
+			"text":   new(any(text)),
+		}))
+	}
+	edits := any([]*any{
+		obj("a.txt", "@ln:2", "TWO"),
+		obj("a.txt", "three", "THREE"),
+		obj("b.txt", "@all", "bee"),
+	})
+	_, _, ret, _ := applyPatch(session, map[string]*any{"edits": &edits}, nil)
+	if !success(ret) {
+		t.Fatalf("expected success, got %q", errorText(ret))
+	}
+	if got := readFile(t, tmpdir, "a.txt"); got != "one\nTWO\nTHREE\n" {
+		t.Fatalf("a.txt mismatch: %q", got)
+	}
+	if got := readFile(t, tmpdir, "b.txt"); got != "bee\n" {
+		t.Fatalf("b.txt mismatch: %q", got)
+	}
+
+	// 任一操作失败则全部不写入
+	edits = any([]*any{
+		obj("a.txt", "@all", "replaced"),
+		obj("a.txt", "missing-target", "x"),
+	})
+	_, _, ret, _ = applyPatch(session, map[string]*any{"edits": &edits}, nil)
+	if success(ret) {
+		t.Fatal("expected failure for missing target")
+	}
+	if got := readFile(t, tmpdir, "a.txt"); got != "one\nTWO\nTHREE\n" {
+		t.Fatalf("a.txt should be untouched: %q", got)
+	}
+}
+
+func TestApplyPatchRejectsBadInput(t *testing.T) {
+	session := &structs.Chats{CurrentActivatePath: t.TempDir()}
+	cases := []map[string]*any{
+		{},
+		{"diff": new(any("--- a/../x\n+++ b/../x\n@@ -0,0 +1 @@\n+x\n"))},
+		{"diff": new(any("--- a/@tree\n+++ b/@tree\n@@ -0,0 +1 @@\n+x\n"))},
+	}
+	for i, mp := range cases {
+		_, _, ret, _ := applyPatch(session, mp, nil)
+		if success(ret) {
+			t.Fatalf("case %d: expected failure", i)
+		}
+	}
+}
+
+func TestApplyPatchRejectsSensitivePath(t *testing.T) {
+	tmpdir := t.TempDir()
+	writeFiles(t, tmpdir, map[string]string{
+		"a.txt": "one\n",
+		".env":  "TOKEN=x\n",
+	})
+	session := &structs.Chats{CurrentActivatePath: tmpdir}
+
+	// 同一 patch 中包含 .env，整个 patch 都不应写入
+	diff := `--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-one
++ONE
+--- a/.env
++++ b/.env
+@@ -1 +1 @@
+-TOKEN=x
++TOKEN=y
+`
+	mp := map[string]*any{"diff": new(any(diff))}
+	_, _, ret, _ := applyPatch(session, mp, nil)
+	if success(ret) {
+		t.Fatal("expected failure for sensitive path")
+	}
+	if !strings.Contains(errorText(ret), ".env") {
+		t.Fatalf("error should name the sensitive file: %q", errorText(ret))
+	}
+	if got := readFile(t, tmpdir, "a.txt"); got != "one\n" {
+		t.Fatalf("a.txt should be untouched: %q", got)
+	}
+	if got := readFile(t, tmpdir, ".env"); got != "TOKEN=x\n" {
+		t.Fatalf(".env should be untouched: %q", got)
+	}
+	if got := TargetPaths(mp); len(got) != 4 || got[2] != ".env" {
+		t.Fatalf("unexpected target paths: %v", got)
+	}
+
+	for _, p := range []string{".ssh/id_rsa", "certs/server.pem", ".alkaid0/agents/x.md", ".git-credentials"} {
+		d := "--- /dev/null\n+++ b/" + p + "\n@@ -0,0 +1 @@\n+x\n"
+		_, _, ret, _ := applyPatch(session, map[string]*any{"diff": new(any(d))}, nil)
+		if success(ret) {
+			t.Fatalf("%s: expected failure", p)
+		}
+		if _, err := os.Stat(filepath.Join(tmpdir, p)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not be created", p)
+		}
+	}
+}
@@ -92,7 +92,18 @@ func buildProxyEnv(session *storageStructs.Chats) (key, baseURL, modelID string,
 		return "", "", "", err
 	}
 
-	key, err = apikey.New(30) // 30 分钟有效期
+	py := config.GlobalConfig.Python
+	timeout := py.ProxyKeyTimeout
+	if timeout <= 0 {
+		timeout = 30 // 未配置时默认 30 分钟有效期
+	}
+	key, err = apikey.NewWithLimits(timeout, apikey.Limits{
+		Session:     session.ID,
+		Models:      py.ProxyModels,
+		MaxTokens:   py.ProxyMaxTokens,
+		MaxRequests: py.ProxyMaxRequests,
+		OnUsage:     proxyUsageRecorder(session),
+	})
 	if err != nil {
 		return "", "", "", fmt.Errorf("create temporary API key: %w", err)
 	}
@@ -108,6 +119,33 @@ func buildProxyEnv(session *storageStructs.Chats) (key, baseURL, modelID string,
 	return key, baseURL, modelID, nil
 }
 
+// proxyUsageRecorder 返回把代理用量记入会话的回调，计入创建 key 时的活动代理。
+func proxyUsageRecorder(session *storageStructs.Chats) func(apikey.Usage) {
+	db, chatID := session.DB, session.ID
+	var agentID *string
+	if session.CurrentAgentID != "" {
+		id := session.CurrentAgentID
+		agentID = &id
+	}
+	return func(usage apikey.Usage) {
+		if db == nil {
+			return
+		}
+		err := db.Create(&storageStructs.ProxyUsages{
+			ChatID:           chatID,
+			AgentID:          agentID,
+			ModelID:          uint32(usage.ModelID),
+			ModelName:        usage.ModelName,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			CachedTokens:     usage.CachedTokens,
+		}).Error
+		if err != nil {
+			logger.Warn("record proxy usage in ID=%d: %v", chatID, err)
+		}
+	}
+}
+
 // mergeEnv 合并环境变量，新值覆盖同名旧值。
 func mergeEnv(base, overlay []string) []string {
 	m := make(map[string]string)
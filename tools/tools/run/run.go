@@ -743,6 +743,7 @@ func load() string {
 	if err := actions.HookTool("", &toolobj.Hook{
 		Scope: "",
 		PreHook: toolobj.PreHookFunction{
+			Name:     "os_info",
 			Priority: 100,
 			Func:     genOSInfo,
 		},
@@ -0,0 +1,459 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxykevin/alkaid0/storage/structs"
+)
+
+// git 历史查询模式（search 的 git 参数）
+const (
+	gitModePickaxe = "pickaxe" // git log -S：引入或删除查询文本的提交
+	gitModeRegex   = "regex"   // git log -G：diff 中有行匹配正则的提交
+	gitModeMessage = "message" // git log --grep：提交信息匹配
+	gitModeBlame   = "blame"   // git blame：逐行追溯
+)
+
+const (
+	gitTimeout         = 20 * time.Second
+	maxHunksPerCommit  = 3
+	maxHunkLines       = 30
+	maxBodyLines       = 5
+	maxBlameLines      = 200
+	gitRecordSeparator = "\x1e"
+	gitFieldSeparator  = "\x1f"
+)
+
+// gitLogFormat 提交头格式：hash、作者、日期、标题、正文，字段间以 \x1f 分隔，之后紧跟 patch
+const gitLogFormat = "--format=" + gitRecordSeparator + "%H" + gitFieldSeparator + "%an" + gitFieldSeparator + "%aI" + gitFieldSeparator + "%s" + gitFieldSeparator + "%b" + gitFieldSeparator
+
+// gitHunk diff 中的单个 hunk
+type gitHunk struct {
+	File   string
+	Header string
+	Lines  []string
+}
+
+// gitCommit 一条历史查询结果
+type gitCommit struct {
+	Hash    string
+	Author  string
+	Date    string
+	Subject string
+	Body    string
+	Files   []string
+	Hunks   []gitHunk
+}
+
+// blameLine git blame 单行结果
+type blameLine struct {
+	Hash    string
+	Author  string
+	Date    string
+	Summary string
+	Line    int
+	Content string
+}
+
+// runGit 在 dir 下执行只读 git 命令
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir, "--no-pager"}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// isSensitiveGitPath 路径任一段命中黑名单时不输出其历史内容
+func isSensitiveGitPath(path string) bool {
+	for part := range strings.SplitSeq(filepath.ToSlash(path), "/") {
+		if dirBlacklists[part] {
+			return true
+		}
+	}
+	return false
+}
+
+// runGitSearch 执行 git 历史查询（pickaxe/regex/message/blame）
+func runGitSearch(session *structs.Chats, mp map[string]*any, cross []*any, mode string) (bool, []*any, map[string]*any, error) {
+	query, _ := getStringParamDefault(mp, "query", "")
+	maxResults, _ := getIntParamDefault(mp, "max_results", 10)
+	if maxResults <= 0 {
+		maxResults = 10
+	}
+	if mode == gitModeBlame {
+		// blame 未给 path 时以 query 作为文件路径
+		if p, _ := getStringParamDefault(mp, "path", ""); p == "" && query != "" {
+			pathAny := any(query)
+			mp = map[string]*any{"path": &pathAny, "lines": mp["lines"]}
+		}
+	}
+	root, relPath, err := resolveSearchPath(session, mp)
+	if err != nil {
+		return errResult(err.Error(), cross)
+	}
+	if relPath != "" && isSensitiveGitPath(relPath) {
+		return errResult("path is excluded from search", cross)
+	}
+
+	ctx := session.GetContext()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, err := runGit(ctx, root, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return errResult("workspace is not a git repository or git is unavailable: "+err.Error(), cross)
+	}
+
+	var output string
+	switch mode {
+	case gitModeBlame:
+		lines, _ := getStringParamDefault(mp, "lines", "")
+		output, err = gitBlame(ctx, root, relPath, lines)
+	case gitModePickaxe, gitModeRegex, gitModeMessage:
+		if query == "" {
+			return errResult("parameter query cannot be empty", cross)
+		}
+		output, err = gitLogSearch(ctx, root, relPath, mode, query, maxResults)
+	default:
+		return errResult(fmt.Sprintf("unknown git mode %q, expected pickaxe, regex, message or blame", mode), cross)
+	}
+	if err != nil {
+		return errResult(err.Error(), cross)
+	}
+
+	outAny := any(output)
+	successAny := any(true)
+	return false, cross, map[string]*any{
+		"success": &successAny,
+		"output":  &outAny,
+	}, nil
+}
+
+// gitLogArgs 构造 git log 查询参数，并返回用于筛选 hunk 的匹配函数。
+// 正则由 git 按 POSIX ERE 解释（无效时 git 报错），不再用 Go 正则重复匹配，
+// 此时 match 为 nil，保留 git 输出的全部 hunk（git 只输出命中的文件）。
+func gitLogArgs(mode, query string, maxResults int) ([]string, func(string) bool) {
+	args := []string{"log", "--no-color", "--no-ext-diff", gitLogFormat, "-n", strconv.Itoa(maxResults)}
+	pattern, flags, delimited := parseDelimitedRegex(query)
+	ignoreCase := delimited && strings.ContainsRune(flags, 'i')
+
+	var match func(string) bool
+	if !delimited {
+		pattern = query
+		match = func(s string) bool { return strings.Contains(s, query) }
+	}
+
+	switch mode {
+	case gitModePickaxe:
+		if delimited {
+			args = append(args, "--pickaxe-regex")
+		}
+		args = append(args, "-S", pattern, "-p", "--unified=2")
+	case gitModeRegex:
+		// 非 /pattern/ 形式时整体作为正则
+		match = nil
+		args = append(args, "-G", pattern, "-p", "--unified=2")
+	case gitModeMessage:
+		if !delimited {
+			args = append(args, "--fixed-strings")
+		} else {
+			args = append(args, "--extended-regexp")
+		}
+		args = append(args, "--grep="+pattern, "--name-only")
+		match = nil
+	}
+	if ignoreCase {
+		args = append(args, "--regexp-ignore-case")
+	}
+	return args, match
+}
+
+// gitLogSearch 执行 git log 查询并格式化
+func gitLogSearch(ctx context.Context, root, relPath, mode, query string, maxResults int) (string, error) {
+	args, match := gitLogArgs(mode, query, maxResults)
+	args = append(args, "--")
+	if relPath != "" {
+		args = append(args, filepath.ToSlash(relPath))
+	}
+	out, err := runGit(ctx, root, args...)
+	if err != nil {
+		return "", err
+	}
+	commits := parseGitLog(out, mode != gitModeMessage, match)
+	return formatGitCommits(commits), nil
+}
+
+// parseGitLog 解析 gitLogFormat 输出；withPatch 为 true 时解析 diff 并按 match 筛选 hunk
+func parseGitLog(out string, withPatch bool, match func(string) bool) []gitCommit {
+	var commits []gitCommit
+	for record := range strings.SplitSeq(out, gitRecordSeparator) {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		fields := strings.SplitN(record, gitFieldSeparator, 6)
+		if len(fields) < 6 {
+			continue
+		}
+		c := gitCommit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Date:    fields[2],
+			Subject: fields[3],
+			Body:    strings.TrimSpace(fields[4]),
+		}
+		rest := fields[5]
+		if withPatch {
+			c.Files, c.Hunks = parseGitPatch(rest, match)
+		} else {
+			for name := range strings.SplitSeq(rest, "\n") {
+				if name = strings.TrimSpace(name); name != "" && !isSensitiveGitPath(name) {
+					c.Files = append(c.Files, name)
+				}
+			}
+		}
+		commits = append(commits, c)
+	}
+	return commits
+}
+
+// parseGitPatch 解析 unified diff，返回改动文件与匹配的 hunk（match 为 nil 时保留全部）
+func parseGitPatch(patch string, match func(string) bool) ([]string, []gitHunk) {
+	var files []string
+	var hunks []gitHunk
+	var cur *gitHunk
+	file := ""
+	skip := false
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		if !skip && hunkMatches(cur, match) {
+			hunks = append(hunks, *cur)
+		}
+		cur = nil
+	}
+	for line := range strings.SplitSeq(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			file = ""
+		case cur == nil && strings.HasPrefix(line, "--- "):
+			if p := strings.TrimPrefix(line, "--- "); p != "/dev/null" {
+				file = strings.TrimPrefix(p, "a/")
+			}
+		case cur == nil && strings.HasPrefix(line, "+++ "):
+			if p := strings.TrimPrefix(line, "+++ "); p != "/dev/null" {
+				file = strings.TrimPrefix(p, "b/")
+			}
+			skip = isSensitiveGitPath(file)
+			if !skip {
+				files = append(files, file)
+			}
+		case strings.HasPrefix(line, "@@"):
+			flush()
+			cur = &gitHunk{File: file, Header: line}
+		case cur != nil && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "+") ||
+			strings.HasPrefix(line, "-") || strings.HasPrefix(line, "\\")):
+			cur.Lines = append(cur.Lines, line)
+		}
+	}
+	flush()
+	return files, hunks
+}
+
+func hunkMatches(h *gitHunk, match func(string) bool) bool {
+	if match == nil {
+		return true
+	}
+	for _, l := range h.Lines {
+		if (strings.HasPrefix(l, "+") || strings.HasPrefix(l, "-")) && match(l[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// formatGitCommits 格式化历史查询结果
+func formatGitCommits(commits []gitCommit) string {
+	if len(commits) == 0 {
+		return "No results found."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d commit(s):\n\n", len(commits))
+	for _, c := range commits {
+		fmt.Fprintf(&b, "[commit] %s %s <%s>\n  %s\n", shortHash(c.Hash), c.Date, c.Author, c.Subject)
+		if c.Body != "" {
+			bodyLines := strings.Split(c.Body, "\n")
+			for i, l := range bodyLines {
+				if i >= maxBodyLines {
+					b.WriteString("  ...\n")
+					break
+				}
+				fmt.Fprintf(&b, "  %s\n", l)
+			}
+		}
+		if len(c.Hunks) == 0 && len(c.Files) > 0 {
+			fmt.Fprintf(&b, "  files: %s\n", strings.Join(c.Files, ", "))
+		}
+		for i, h := range c.Hunks {
+			if i >= maxHunksPerCommit {
+				fmt.Fprintf(&b, "  ... %d more matching hunk(s)\n", len(c.Hunks)-i)
+				break
+			}
+			fmt.Fprintf(&b, "  %s %s\n", h.File, h.Header)
+			for j, l := range h.Lines {
+				if j >= maxHunkLines {
+					fmt.Fprintf(&b, "    ... %d more line(s)\n", len(h.Lines)-j)
+					break
+				}
+				fmt.Fprintf(&b, "    %s\n", l)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// parseLineRange 解析 "start-end" 或 "start"，空串表示整个文件
+func parseLineRange(lines string) (int, int, error) {
+	lines = strings.TrimSpace(lines)
+	if lines == "" {
+		return 0, 0, nil
+	}
+	startStr, endStr, hasEnd := strings.Cut(lines, "-")
+	start, err := strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil || start <= 0 {
+		return 0, 0, fmt.Errorf("invalid lines %q, expected 'start-end'", lines)
+	}
+	end := start
+	if hasEnd {
+		if end, err = strconv.Atoi(strings.TrimSpace(endStr)); err != nil || end < start {
+			return 0, 0, fmt.Errorf("invalid lines %q, expected 'start-end'", lines)
+		}
+	}
+	return start, end, nil
+}
+
+// gitBlame 对文件的行范围执行 git blame
+func gitBlame(ctx context.Context, root, relPath, lines string) (string, error) {
+	if relPath == "" {
+		return "", errors.New("blame requires path to be a file")
+	}
+	start, end, err := parseLineRange(lines)
+	if err != nil {
+		return "", err
+	}
+	args := []string{"blame", "--porcelain"}
+	if start > 0 {
+		args = append(args, "-L", fmt.Sprintf("%d,%d", start, end))
+	}
+	args = append(args, "--", filepath.ToSlash(relPath))
+	out, err := runGit(ctx, root, args...)
+	if err != nil {
+		return "", err
+	}
+	return formatBlame(relPath, parseBlamePorcelain(out)), nil
+}
+
+// parseBlamePorcelain 解析 git blame --porcelain 输出
+func parseBlamePorcelain(out string) []blameLine {
+	type commitInfo struct {
+		author, date, summary string
+	}
+	infos := map[string]*commitInfo{}
+	var result []blameLine
+	var cur *blameLine
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\t") {
+			if cur != nil {
+				if info := infos[cur.Hash]; info != nil {
+					cur.Author, cur.Date, cur.Summary = info.author, info.date, info.summary
+				}
+				cur.Content = line[1:]
+				result = append(result, *cur)
+				cur = nil
+			}
+			continue
+		}
+		if cur == nil {
+			// 头行：<hash> <orig-line> <final-line> [<num-lines>]
+			parts := strings.Fields(line)
+			if len(parts) < 3 || len(parts[0]) < 40 {
+				continue
+			}
+			n, _ := strconv.Atoi(parts[2])
+			cur = &blameLine{Hash: parts[0], Line: n}
+			if infos[cur.Hash] == nil {
+				infos[cur.Hash] = &commitInfo{}
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		info := infos[cur.Hash]
+		switch key {
+		case "author":
+			info.author = value
+		case "author-time":
+			if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+				info.date = time.Unix(sec, 0).UTC().Format("2006-01-02")
+			}
+		case "summary":
+			info.summary = value
+		}
+	}
+	return result
+}
+
+// formatBlame 合并相邻同提交的行并格式化
+func formatBlame(path string, lines []blameLine) string {
+	if len(lines) == 0 {
+		return "No results found."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Blame %s (%d line(s)):\n\n", filepath.ToSlash(path), len(lines))
+	prev := ""
+	for i, l := range lines {
+		if i >= maxBlameLines {
+			fmt.Fprintf(&b, "... %d more line(s), narrow the range with lines\n", len(lines)-i)
+			break
+		}
+		if l.Hash != prev {
+			if prev != "" {
+				b.WriteString("\n")
+			}
+			if strings.Trim(l.Hash, "0") == "" {
+				b.WriteString("[blame] (uncommitted)\n")
+			} else {
+				fmt.Fprintf(&b, "[blame] %s %s <%s> %s\n", shortHash(l.Hash), l.Date, l.Author, l.Summary)
+			}
+			prev = l.Hash
+		}
+		fmt.Fprintf(&b, "  %d: %s\n", l.Line, l.Content)
+	}
+	return b.String()
+}
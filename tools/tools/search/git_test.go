@@ -0,0 +1,185 @@
+package search
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/storage/structs"
+)
+
+// initGitRepo 创建临时仓库并按顺序提交 commits（文件名 → 内容，提交信息）
+func initGitRepo(t *testing.T, commits []struct {
+	files   map[string]string
+	message string
+}) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Tester", "-c", "user.email=t@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	for _, c := range commits {
+		for name, content := range c.files {
+			p := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		git("add", "-A")
+		git("commit", "-q", "-m", c.message)
+	}
+	return dir
+}
+
+func runGitQuery(t *testing.T, dir string, params map[string]any) (bool, string) {
+	t.Helper()
+	mp := map[string]*any{"online": new(any(false))}
+	for k, v := range params {
+		mp[k] = new(v)
+	}
+	session := &structs.Chats{Root: dir}
+	_, _, ret, err := runSearch(session, mp, nil)
+	if err != nil {
+		t.Fatalf("runSearch error: %v", err)
+	}
+	ok, _ := (*ret["success"]).(bool)
+	if !ok {
+		return false, (*ret["error"]).(string)
+	}
+	return true, (*ret["output"]).(string)
+}
+
+func TestGitSearchModes(t *testing.T) {
+	dir := initGitRepo(t, []struct {
+		files   map[string]string
+		message string
+	}{
+		{map[string]string{"main.go": "package main\n\nfunc main() {}\n"}, "initial commit"},
+		{map[string]string{"main.go": "package main\n\nfunc main() {\n\tretryLimit := 3\n\t_ = retryLimit\n}\n", "util.go": "package main\n"}, "add retry limit\n\nNeeded for flaky uploads."},
+		{map[string]string{"util.go": "package main\n\nfunc helper() {}\n"}, "add helper"},
+	})
+
+	ok, out := runGitQuery(t, dir, map[string]any{"query": "retryLimit", "git": "pickaxe"})
+	if !ok {
+		t.Fatalf("pickaxe failed: %s", out)
+	}
+	if !strings.Contains(out, "add retry limit") || !strings.Contains(out, "Needed for flaky uploads.") ||
+		!strings.Contains(out, "+\tretryLimit := 3") || strings.Contains(out, "add helper") {
+		t.Fatalf("unexpected pickaxe output:\n%s", out)
+	}
+	if !strings.Contains(out, "<Tester>") {
+		t.Fatalf("expected author in output:\n%s", out)
+	}
+
+	ok, out = runGitQuery(t, dir, map[string]any{"query": "func helper", "git": "regex"})
+	if !ok || !strings.Contains(out, "add helper") || strings.Contains(out, "initial commit") {
+		t.Fatalf("unexpected regex output (ok=%v):\n%s", ok, out)
+	}
+
+	// 正则交给 git 按 POSIX ERE 解释
+	ok, out = runGitQuery(t, dir, map[string]any{"query": "/func[[:space:]]+HELPER/i", "git": "regex"})
+	if !ok || !strings.Contains(out, "add helper") || !strings.Contains(out, "+func helper() {}") {
+		t.Fatalf("unexpected POSIX regex output (ok=%v):\n%s", ok, out)
+	}
+
+	ok, out = runGitQuery(t, dir, map[string]any{"query": "/HELPER/i", "git": "message"})
+	if !ok || !strings.Contains(out, "add helper") || !strings.Contains(out, "files: util.go") {
+		t.Fatalf("unexpected message output (ok=%v):\n%s", ok, out)
+	}
+
+	ok, out = runGitQuery(t, dir, map[string]any{"query": "retry", "git": "pickaxe", "path": "util.go"})
+	if !ok || out != "No results found." {
+		t.Fatalf("path should restrict history (ok=%v):\n%s", ok, out)
+	}
+
+	ok, out = runGitQuery(t, dir, map[string]any{"query": "main.go", "git": "blame", "lines": "4-5"})
+	if !ok {
+		t.Fatalf("blame failed: %s", out)
+	}
+	if !strings.Contains(out, "add retry limit") || !strings.Contains(out, "4: \tretryLimit := 3") || strings.Contains(out, "3: ") {
+		t.Fatalf("unexpected blame output:\n%s", out)
+	}
+
+	for _, bad := range []map[string]any{
+		{"query": "x", "git": "unknown"},
+		{"query": "x", "git": "blame", "path": "main.go", "lines": "5-2"},
+		{"query": "x", "git": "blame", "path": "../main.go"},
+		{"query": ".env", "git": "blame"},
+	} {
+		if ok, _ := runGitQuery(t, dir, bad); ok {
+			t.Fatalf("expected failure for %v", bad)
+		}
+	}
+}
+
+func TestGitSearchNotRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ok, out := runGitQuery(t, t.TempDir(), map[string]any{"query": "x", "git": "pickaxe"})
+	if ok || !strings.Contains(out, "not a git repository") {
+		t.Fatalf("expected not-a-repository error, got ok=%v %q", ok, out)
+	}
+}
+
+func TestParseGitPatchFiltersHunksAndSensitiveFiles(t *testing.T) {
+	patch := `
+diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,2 +1,2 @@
+ keep
+-old value
++new value
+@@ -10,1 +10,1 @@
+-unrelated
++changed
+diff --git a/.env b/.env
+--- a/.env
++++ b/.env
+@@ -1 +1 @@
+-KEY=value
++KEY=secret value
+`
+	files, hunks := parseGitPatch(patch, func(s string) bool { return strings.Contains(s, "value") })
+	if len(files) != 1 || files[0] != "a.go" {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	if len(hunks) != 1 || hunks[0].Header != "@@ -1,2 +1,2 @@" || len(hunks[0].Lines) != 3 {
+		t.Fatalf("unexpected hunks: %+v", hunks)
+	}
+}
+
+func TestParseLineRange(t *testing.T) {
+	cases := []struct {
+		in         string
+		start, end int
+		wantErr    bool
+	}{
+		{"", 0, 0, false},
+		{"7", 7, 7, false},
+		{"3-9", 3, 9, false},
+		{" 3 - 9 ", 3, 9, false},
+		{"0-1", 0, 0, true},
+		{"9-3", 0, 0, true},
+		{"a-b", 0, 0, true},
+	}
+	for _, c := range cases {
+		start, end, err := parseLineRange(c.in)
+		if (err != nil) != c.wantErr || start != c.start || end != c.end {
+			t.Fatalf("parseLineRange(%q) = %d, %d, %v", c.in, start, end, err)
+		}
+	}
+}
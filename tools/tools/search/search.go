@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	_ "embed" // embed
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -68,6 +69,16 @@ var paras = map[string]parser.ToolParameters{
 		Required:    false,
 		Description: "Maximum results per search source. Default is 10",
 	},
+	"git": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "Search git history instead of the working tree: 'pickaxe' (commits adding/removing query), 'regex' (commits whose diff matches query), 'message' (commit messages) or 'blame' (per-line blame of the file in path). Only when online=false",
+	},
+	"lines": {
+		Type:        parser.ToolTypeString,
+		Required:    false,
+		Description: "Line range for git='blame', e.g. '10-20'. Defaults to the whole file",
+	},
 }
 
 // grepResult 单条 grep 匹配结果
@@ -367,6 +378,11 @@ func updateInfo(session *structs.Chats, mp map[string]*any, cross []*any, toolID
 			respString += "Path: " + path + "\n"
 		}
 	}
+	if gitPtr, ok := mp["git"]; ok && gitPtr != nil {
+		if mode, ok := (*gitPtr).(string); ok && mode != "" {
+			respString += "Git: " + mode + "\n"
+		}
+	}
 	if recursivePtr, ok := mp["recursive"]; ok && recursivePtr != nil {
 		if recursive, ok := (*recursivePtr).(bool); ok {
 			respString += "Recursive: " + u.Ternary(recursive, "true", "false") + "\n"
@@ -410,25 +426,21 @@ func runSearch(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 		return runOnlineSearch(session, mp, cross)
 	}
 
+	if mode, _ := getStringParamDefault(mp, "git", ""); mode != "" {
+		return runGitSearch(session, mp, cross, mode)
+	}
+
 	includeGitignored, _ := getBoolParamDefault(mp, "include_ignored", false)
 	maxResults, _ := getIntParamDefault(mp, "max_results", 10)
 	recursive, _ := getBoolParamDefault(mp, "recursive", true)
 
 	// 确定搜索根路径
-	root := session.Root
-	if root == "" {
-		root = "."
+	root, relPath, err := resolveSearchPath(session, mp)
+	if err != nil {
+		return errResult(err.Error(), cross)
 	}
-	if searchPath, _ := getStringParamDefault(mp, "path", ""); searchPath != "" {
-		// 校验 path 不能逃逸工作区：拒绝绝对路径与 '..' 穿越
-		if filepath.IsAbs(searchPath) {
-			return errResult("path must be relative to the workspace", cross)
-		}
-		cleanedSearch := filepath.Clean(searchPath)
-		if cleanedSearch == ".." || strings.HasPrefix(cleanedSearch, ".."+string(filepath.Separator)) {
-			return errResult("path escapes the workspace", cross)
-		}
-		root = filepath.Join(root, cleanedSearch)
+	if relPath != "" {
+		root = filepath.Join(root, relPath)
 	}
 
 	ctx := session.GetContext()
@@ -501,6 +513,30 @@ func runSearch(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 	}, nil
 }
 
+// resolveSearchPath 返回工作区根路径与 path 参数对应的相对路径（为空表示根目录）
+func resolveSearchPath(session *structs.Chats, mp map[string]*any) (string, string, error) {
+	root := session.Root
+	if root == "" {
+		root = "."
+	}
+	searchPath, _ := getStringParamDefault(mp, "path", "")
+	if searchPath == "" {
+		return root, "", nil
+	}
+	// 校验 path 不能逃逸工作区：拒绝绝对路径与 '..' 穿越
+	if filepath.IsAbs(searchPath) {
+		return "", "", errors.New("path must be relative to the workspace")
+	}
+	cleanedSearch := filepath.Clean(searchPath)
+	if cleanedSearch == ".." || strings.HasPrefix(cleanedSearch, ".."+string(filepath.Separator)) {
+		return "", "", errors.New("path escapes the workspace")
+	}
+	if cleanedSearch == "." {
+		cleanedSearch = ""
+	}
+	return root, cleanedSearch, nil
+}
+
 // ---------------------------------------------------------------------------
 // AI Grep
 // ---------------------------------------------------------------------------
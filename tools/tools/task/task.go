@@ -153,6 +153,7 @@ func load() string {
 	if err := actions.HookTool("", &toolobj.Hook{
 		Scope: "",
 		PreHook: toolobj.PreHookFunction{
+			Name:     "task",
 			Priority: 100,
 			Func:     buildGlobalPrompt,
 		},
@@ -413,7 +413,7 @@ func confirmTraceContent(session *structs.Chats, path, content string) {
 // 方案2只在旧块和 diff 都成功插入时保留 LastContent；请求构建阶段若锚点或成本复核失败，
 // 模型收到的是完整当前块，缓存也必须同步到该内容，避免下一轮重复生成同一份 diff。
 func AdvanceTraceCache(session *structs.Chats, path string) {
-	if session == nil || session.DB == nil || strings.HasPrefix(path, "@temp/") {
+	if session == nil || session.DB == nil || session.DryRun || strings.HasPrefix(path, "@temp/") {
 		return
 	}
 	confirmed, _ := session.TemporyDataOfSession[structs.TempKeyTraceConfirmedContent].(traceExpectedContent)
@@ -620,7 +620,7 @@ func RenderTraceBlocks(session *structs.Chats) (topBlock string, eventBlocks map
 		// 模型从未见过的字节，前缀缓存恰在旧块处断裂（连续编辑缓存率下跌的根因）。
 		if keep {
 			diffPlans[traceObj.Path] = plan
-		} else if traceObj.LastContent != newContent && !strings.HasPrefix(traceObj.Path, "@temp/") {
+		} else if traceObj.LastContent != newContent && !strings.HasPrefix(traceObj.Path, "@temp/") && !session.DryRun {
 			session.DB.Model(&structs.Traces{}).
 				Where("chat_id = ? AND path = ? AND agent_id = ?", session.ID, traceObj.Path, session.NowAgent).
 				Update("last_content", newContent)
@@ -687,6 +687,7 @@ func load() string {
 	if err := actions.HookTool("", &toolobj.Hook{
 		Scope: "",
 		PreHook: toolobj.PreHookFunction{
+			Name:     "trace",
 			Priority: 100,
 			Func:     buildTrace,
 		},
@@ -35,6 +35,12 @@ type Node struct {
 	IDStart     int32
 	IDEnd       int32
 	RemoveFlag  bool
+	// Collapsed 目录被视图深度折叠（子项未展开），编辑时与子项过多的目录一样整体保留
+	Collapsed bool
+	// Filtered 目录下有被视图过滤隐藏的条目，删除该目录时只删除可见条目
+	Filtered bool
+	// Annotation 文件标注（大小、git 状态），渲染在 ID 之后的括号中，解析时忽略
+	Annotation string
 }
 
 var dirBlacklistsOrigin = map[string]bool{
@@ -208,6 +214,9 @@ func BuildString(node *Node) string {
 	return builder.String()
 }
 
+// annotationRe 匹配 ID 之后的视图标注
+var annotationRe = regexp.MustCompile(`^\s*\([^()]*\)\s*$`)
+
 // MaxNodeCount 最大节点个数 (真实案例：递归扫用户目录 OOM)
 const MaxNodeCount = 1000
 
@@ -239,12 +248,17 @@ func buildStringRecursive(node *Node, prefix string, builder *strings.Builder, n
 		builder.WriteString(" `")
 		builder.WriteString(strconv.Itoa(int(node.ID)))
 		builder.WriteString("`")
+		if node.Annotation != "" {
+			builder.WriteString(" (")
+			builder.WriteString(node.Annotation)
+			builder.WriteString(")")
+		}
 	}
 
 	// 处理子节点
 	if node.IsDir {
-		// 如果有大量子节点，显示省略号
-		if node.ChildrenNum > MaxChildrenNum {
+		// 如果有大量子节点或被视图深度折叠，显示省略号
+		if node.ChildrenNum > MaxChildrenNum || node.Collapsed {
 			builder.WriteString("\n")
 			builder.WriteString(prefix)
 			builder.WriteString("... (")
@@ -325,6 +339,10 @@ func BuildNodeFromString(str string) (*Node, error) {
 				continue
 			}
 			nameTemps := strings.Split(nameTemp, quote)
+			// ID 之后允许视图标注 " (1.2 KB, M)"，解析时忽略
+			if len(nameTemps) == 3 && annotationRe.MatchString(nameTemps[2]) {
+				nameTemps[2] = ""
+			}
 			if (len(nameTemps)) != 3 || nameTemps[2] != "" {
 				return nil, errors.New("invalid name")
 			}
@@ -453,8 +471,8 @@ func solveNodesTreeDiff(result *Node, origin *Node, target *Node) error {
 				continue
 			}
 
-			// 如果 origin 节点有错误或是省略节点（ChildrenNum 太大），则跳过删除/覆盖，保留 origin
-			if oc != nil && (oc.Error != nil || oc.ChildrenNum > MaxChildrenNum) {
+			// 如果 origin 节点有错误或是省略节点（ChildrenNum 太大或被视图折叠），则跳过删除/覆盖，保留 origin
+			if oc != nil && (oc.Error != nil || oc.ChildrenNum > MaxChildrenNum || oc.Collapsed) {
 				// 直接拷贝 origin 到结果
 				clone := &Node{
 					Name:        oc.Name,
@@ -475,15 +493,7 @@ func solveNodesTreeDiff(result *Node, origin *Node, target *Node) error {
 			// origin 存在但 target 不存在 -> 标记删除（文件或目录）
 			if oc != nil && tc == nil {
 				// 如果是文件且该文件的 ID 在 target 中被引用到其它路径，则也应删除原位置（移动场景）
-				del := &Node{
-					Name:       oc.Name,
-					Path:       oc.Path,
-					IsDir:      oc.IsDir,
-					Children:   []*Node{},
-					ID:         oc.ID,
-					RemoveFlag: true,
-				}
-				res.Children = append(res.Children, del)
+				res.Children = append(res.Children, removedNode(oc))
 				continue
 			}
 
@@ -536,8 +546,7 @@ func solveNodesTreeDiff(result *Node, origin *Node, target *Node) error {
 				// 类型不一致：目录->文件 或 文件->目录，需要同时删除原项并创建目标项
 				if oc.IsDir && !tc.IsDir {
 					// 删除目录
-					del := &Node{Name: oc.Name, Path: oc.Path, IsDir: true, RemoveFlag: true}
-					res.Children = append(res.Children, del)
+					res.Children = append(res.Children, removedNode(oc))
 					// 创建文件
 					newFile := &Node{Name: tc.Name, Path: tc.Path, IsDir: false, ID: tc.ID}
 					res.Children = append(res.Children, newFile)
@@ -568,6 +577,31 @@ func solveNodesTreeDiff(result *Node, origin *Node, target *Node) error {
 	return nil
 }
 
+// removedNode 构造 origin 节点的删除标记。含视图隐藏条目的目录不能整体删除，
+// 改为保留目录本身、逐个删除可见子项，避免误删视图之外的文件。
+func removedNode(oc *Node) *Node {
+	if !oc.IsDir || !oc.Filtered {
+		return &Node{
+			Name:       oc.Name,
+			Path:       oc.Path,
+			IsDir:      oc.IsDir,
+			Children:   []*Node{},
+			ID:         oc.ID,
+			RemoveFlag: true,
+		}
+	}
+	keep := &Node{Name: oc.Name, Path: oc.Path, IsDir: true, Children: []*Node{}}
+	for _, c := range oc.Children {
+		if c.Error != nil || c.ChildrenNum > MaxChildrenNum || c.Collapsed {
+			// 未展开的子目录同样可能含不可见条目，保留
+			keep.Children = append(keep.Children, &Node{Name: c.Name, Path: c.Path, IsDir: c.IsDir, ID: c.ID, Children: []*Node{}})
+			continue
+		}
+		keep.Children = append(keep.Children, removedNode(c))
+	}
+	return keep
+}
+
 // DiffStatus 差异表状态
 type DiffStatus int8
 
@@ -55,6 +55,8 @@ type cacheStruct struct {
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	Generation  uint64
+	// View 构建该快照时的视图签名（默认视图为空串），视图变化时快照失效
+	View string
 }
 
 const (
@@ -62,7 +64,20 @@ const (
 	treeCacheRetention = 180 * time.Second
 )
 
+// treeWorkPath 返回 @tree 的根目录：工作目录叠加当前 agent 视图的 root 子路径
 func treeWorkPath(session *structs.Chats) (string, error) {
+	base, err := treeBasePath(session)
+	if err != nil {
+		return "", err
+	}
+	if view := LoadView(session); view.Root != "" {
+		return filepath.Join(base, filepath.FromSlash(view.Root)), nil
+	}
+	return base, nil
+}
+
+// treeBasePath 返回未叠加视图的工作目录绝对路径
+func treeBasePath(session *structs.Chats) (string, error) {
 	if session == nil {
 		return "", fmt.Errorf("session is nil")
 	}
@@ -198,6 +213,9 @@ func treeCache(session *structs.Chats, workPath, fingerprint string) (*cacheStru
 	if !ok || ret == nil || ret.WorkPath != workPath || ret.TreeObj == nil {
 		return nil, false
 	}
+	if ret.View != LoadView(session).signature() {
+		return nil, false
+	}
 	if time.Since(ret.UpdatedAt) > treeCacheRetention {
 		return nil, false
 	}
@@ -467,11 +485,15 @@ func buildGlobalPrompt(session *structs.Chats) (string, error) {
 	if stateErr == nil && treeStatesComplete(states) {
 		fingerprint = treeStateFingerprint(states)
 	}
+	view := LoadView(session)
 	cache, exact := treeCache(session, workPath, fingerprint)
 	if exact {
 		storeTreeCache(session, cache)
 	} else if cache != nil && fingerprint != "" {
-		if updated, ok := incrementalTree(cache, states, fingerprint); ok {
+		// 增量刷新基于未过滤的 BuildTree，仅适用于默认视图
+		if !view.IsDefault() {
+			cache = nil
+		} else if updated, ok := incrementalTree(cache, states, fingerprint); ok {
 			cache = updated
 			storeTreeCache(session, cache)
 		} else {
@@ -491,6 +513,9 @@ func buildGlobalPrompt(session *structs.Chats) (string, error) {
 			return "", fmt.Errorf("tree build returned nil")
 		}
 		tree.Name = "(root)"
+		if err := applyView(tree, workPath, view); err != nil {
+			logger.Warn("tree view apply error: %v", err)
+		}
 		cache = &cacheStruct{
 			TreeObj:     tree,
 			TreeString:  BuildString(tree),
@@ -500,6 +525,7 @@ func buildGlobalPrompt(session *structs.Chats) (string, error) {
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
 			Generation:  1,
+			View:        view.signature(),
 		}
 		storeTreeCache(session, cache)
 	}
@@ -511,7 +537,17 @@ func buildGlobalPrompt(session *structs.Chats) (string, error) {
 		fmt.Fprintf(&builder, "%*d|%s\n", allLenStrLen, lineno+1, line)
 	}
 
-	rendered, err := prompts.Render(treeTempate, builder.String())
+	viewText := ""
+	if !view.IsDefault() {
+		viewText = view.String()
+	}
+	rendered, err := prompts.Render(treeTempate, struct {
+		Tree string
+		View string
+	}{
+		Tree: builder.String(),
+		View: viewText,
+	})
 	if err != nil {
 		return "", err
 	}
@@ -539,7 +575,7 @@ func writeTree(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 		return true, cross, nil, nil
 	}
 
-	if path != "@tree" {
+	if path != "@tree" && path != viewPath {
 		return true, cross, nil, nil
 	}
 
@@ -554,6 +590,21 @@ func writeTree(session *structs.Chats, mp map[string]*any, cross []*any) (bool,
 		}, nil
 	}
 
+	if path == viewPath {
+		ret, err := writeView(session, target, text)
+		if err != nil {
+			logger.Warn("tree view edit error: %v", err)
+			boolx := false
+			success := any(boolx)
+			errMsg := any(err.Error())
+			return false, cross, map[string]*any{
+				"success": &success,
+				"error":   &errMsg,
+			}, nil
+		}
+		return false, cross, ret, nil
+	}
+
 	workPath, pathErr := treeWorkPath(session)
 	if pathErr != nil {
 		boolx := false
@@ -692,6 +743,7 @@ func load() string {
 	if err := actions.HookTool("", &toolobj.Hook{
 		Scope: "",
 		PreHook: toolobj.PreHookFunction{
+			Name:     "tree",
 			Priority: 100,
 			Func:     buildGlobalPrompt,
 		},
@@ -0,0 +1,468 @@
+package tree
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/tools/tools/edit"
+	"gorm.io/gorm"
+)
+
+// viewPath @tree 视图选项虚拟对象
+const viewPath = "@tree/view"
+
+// treeViewKey 会话级视图选项缓存（按 agent ID 索引）
+const treeViewKey = "tools:tree:view"
+
+// gitStatusTimeout git status 超时，避免大仓库阻塞提示词构建
+const gitStatusTimeout = 5 * time.Second
+
+// ViewOptions @tree 视图选项，按 agent 持久化
+type ViewOptions struct {
+	Root    string   `json:"root,omitempty"`    // 相对工作目录的子路径
+	Depth   int      `json:"depth,omitempty"`   // 最大展开深度（0 表示默认 MaxDepth）
+	Include []string `json:"include,omitempty"` // 文件 glob 白名单（为空表示全部）
+	Exclude []string `json:"exclude,omitempty"` // 文件/目录 glob 黑名单
+	Size    bool     `json:"size,omitempty"`    // 显示文件大小
+	Git     bool     `json:"git,omitempty"`     // 显示 git 状态标记
+}
+
+// IsDefault 是否为默认视图（不做任何过滤与标注）
+func (o ViewOptions) IsDefault() bool {
+	return o.Root == "" && o.Depth == 0 && len(o.Include) == 0 && len(o.Exclude) == 0 && !o.Size && !o.Git
+}
+
+// signature 视图签名，作为缓存有效性的一部分
+func (o ViewOptions) signature() string {
+	if o.IsDefault() {
+		return ""
+	}
+	b, _ := json.Marshal(o)
+	return string(b)
+}
+
+// String 渲染为 @tree/view 的文本形式（每行 key: value）
+func (o ViewOptions) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "root: %s\n", o.Root)
+	fmt.Fprintf(&b, "depth: %d\n", o.Depth)
+	fmt.Fprintf(&b, "include: %s\n", strings.Join(o.Include, ", "))
+	fmt.Fprintf(&b, "exclude: %s\n", strings.Join(o.Exclude, ", "))
+	fmt.Fprintf(&b, "size: %t\n", o.Size)
+	fmt.Fprintf(&b, "git: %t", o.Git)
+	return b.String()
+}
+
+func splitPatterns(s string) []string {
+	var out []string
+	for p := range strings.SplitSeq(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ParseViewOptions 解析 @tree/view 文本。未出现的键取默认值，未知键报错。
+func ParseViewOptions(text string) (ViewOptions, error) {
+	opts := ViewOptions{}
+	for ln := range strings.SplitSeq(text, "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(ln, ":")
+		if !ok {
+			return opts, fmt.Errorf("invalid view line %q, expected 'key: value'", ln)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "root":
+			opts.Root = path.Clean(filepath.ToSlash(value))
+			opts.Root = strings.Trim(opts.Root, "/")
+			if opts.Root == "." {
+				opts.Root = ""
+			}
+		case "depth":
+			if value == "" {
+				opts.Depth = 0
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n > MaxDepth {
+				return opts, fmt.Errorf("depth must be between 0 and %d", MaxDepth)
+			}
+			opts.Depth = n
+		case "include":
+			opts.Include = splitPatterns(value)
+		case "exclude":
+			opts.Exclude = splitPatterns(value)
+		case "size", "git":
+			b := false
+			if value != "" {
+				var err error
+				if b, err = strconv.ParseBool(value); err != nil {
+					return opts, fmt.Errorf("%s must be true or false", key)
+				}
+			}
+			if key == "size" {
+				opts.Size = b
+			} else {
+				opts.Git = b
+			}
+		default:
+			return opts, fmt.Errorf("unknown view option %q", key)
+		}
+	}
+	if opts.Root != "" {
+		if err := edit.ValidatePath(opts.Root); err != nil {
+			return opts, fmt.Errorf("invalid root: %w", err)
+		}
+	}
+	for _, p := range slices.Concat(opts.Include, opts.Exclude) {
+		if _, err := globRegexp(p); err != nil {
+			return opts, fmt.Errorf("invalid glob %q: %w", p, err)
+		}
+	}
+	return opts, nil
+}
+
+// globRegexp 将 glob 转换为正则：** 跨目录，* 和 ? 不跨 '/'；不含 '/' 的模式匹配任意层级的名称。
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// globPrefix 返回 glob 中第一个通配符之前的字面前缀
+func globPrefix(pattern string) string {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if idx := strings.IndexAny(pattern, "*?["); idx >= 0 {
+		return pattern[:idx]
+	}
+	return pattern
+}
+
+// viewFilter 编译后的 include/exclude 过滤器
+type viewFilter struct {
+	include  []*regexp.Regexp
+	prefixes []string
+	exclude  []*regexp.Regexp
+}
+
+func newViewFilter(opts ViewOptions) (*viewFilter, error) {
+	f := &viewFilter{}
+	for _, p := range opts.Include {
+		re, err := globRegexp(p)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, re)
+		f.prefixes = append(f.prefixes, globPrefix(p))
+	}
+	for _, p := range opts.Exclude {
+		re, err := globRegexp(p)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	return f, nil
+}
+
+func matchAny(res []*regexp.Regexp, rel string) bool {
+	for _, re := range res {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *viewFilter) excluded(rel string, isDir bool) bool {
+	return matchAny(f.exclude, rel) || (isDir && matchAny(f.exclude, rel+"/"))
+}
+
+func (f *viewFilter) included(rel string) bool {
+	return len(f.include) == 0 || matchAny(f.include, rel)
+}
+
+// mayContain 判断未展开目录下是否可能存在 include 命中的文件
+func (f *viewFilter) mayContain(rel string) bool {
+	if len(f.include) == 0 || matchAny(f.include, rel+"/") {
+		return true
+	}
+	for _, prefix := range f.prefixes {
+		if prefix == "" || strings.HasPrefix(prefix, rel+"/") || strings.HasPrefix(rel+"/", prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyView 按视图选项裁剪树（深度折叠、include/exclude 过滤）并补充大小与 git 标注。
+// 被过滤掉的条目从树中移除，其父目录标记 Filtered，保证 @tree 编辑不会误删不可见条目。
+func applyView(root *Node, workPath string, opts ViewOptions) error {
+	if root == nil || opts.IsDefault() {
+		return nil
+	}
+	filter, err := newViewFilter(opts)
+	if err != nil {
+		return err
+	}
+	var gitMarks map[string]string
+	if opts.Git {
+		gitMarks = gitStatusMarks(workPath)
+	}
+	var walk func(node *Node, depth int) bool
+	walk = func(node *Node, depth int) bool {
+		rel := ""
+		if node != root {
+			if r, err := filepath.Rel(workPath, node.Path); err == nil {
+				rel = filepath.ToSlash(r)
+			}
+			if filter.excluded(rel, node.IsDir) {
+				return false
+			}
+		}
+		if !node.IsDir {
+			if node.Error == nil && !filter.included(rel) {
+				return false
+			}
+			node.Annotation = fileAnnotation(node.Path, opts.Size, gitMarks)
+			return true
+		}
+		if node.Error != nil {
+			return true
+		}
+		if node.Children == nil || node.ChildrenNum > MaxChildrenNum {
+			// 未展开（过深或子项过多）：无法逐项过滤，按前缀判断是否保留
+			return node == root || filter.mayContain(rel)
+		}
+		if opts.Depth > 0 && depth >= opts.Depth && node != root {
+			node.Collapsed = true
+			node.Children = nil
+			return filter.mayContain(rel)
+		}
+		kept := node.Children[:0]
+		for _, child := range node.Children {
+			if walk(child, depth+1) {
+				kept = append(kept, child)
+			} else {
+				node.Filtered = true
+			}
+		}
+		node.Children = kept
+		if len(kept) == 0 && node.Filtered && node != root {
+			return false
+		}
+		return true
+	}
+	walk(root, 0)
+	return nil
+}
+
+// fileAnnotation 生成文件标注（大小、git 状态），均未启用时返回空串
+func fileAnnotation(path string, showSize bool, gitMarks map[string]string) string {
+	parts := []string{}
+	if showSize {
+		if info, err := os.Stat(path); err == nil {
+			parts = append(parts, formatSize(info.Size()))
+		}
+	}
+	if mark, ok := gitMarks[path]; ok {
+		parts = append(parts, mark)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatSize 以 B/KB/MB/GB 格式化文件大小
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// gitStatusMarks 返回 workPath 所在仓库中有变更文件的状态标记（绝对路径 → M/A/D/R/?）。
+// 不在 git 仓库内或 git 不可用时返回空 map。
+func gitStatusMarks(workPath string) map[string]string {
+	marks := map[string]string{}
+	ctx, cancel := context.WithTimeout(context.Background(), gitStatusTimeout)
+	defer cancel()
+	top, err := exec.CommandContext(ctx, "git", "-C", workPath, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return marks
+	}
+	topDir := strings.TrimSpace(string(top))
+	out, err := exec.CommandContext(ctx, "git", "-C", workPath, "status", "--porcelain=v1", "-z", "--untracked-files=all").Output()
+	if err != nil {
+		logger.Debug("git status failed: %v", err)
+		return marks
+	}
+	entries := bytes.Split(out, []byte{0})
+	for i := 0; i < len(entries); i++ {
+		entry := string(entries[i])
+		if len(entry) < 4 {
+			continue
+		}
+		x, y, path := entry[0], entry[1], entry[3:]
+		if x == 'R' || x == 'C' {
+			// 重命名/复制条目后紧跟原路径
+			i++
+		}
+		mark := string(y)
+		switch {
+		case x == '?' && y == '?':
+			mark = "?"
+		case y == ' ':
+			mark = string(x)
+		}
+		marks[filepath.Join(topDir, filepath.FromSlash(path))] = mark
+	}
+	return marks
+}
+
+// viewCache 返回会话级视图缓存表
+func viewCache(session *structs.Chats) map[string]ViewOptions {
+	if session.TemporyDataOfSession == nil {
+		session.TemporyDataOfSession = make(map[string]any)
+	}
+	cache, ok := session.TemporyDataOfSession[treeViewKey].(map[string]ViewOptions)
+	if !ok {
+		cache = make(map[string]ViewOptions)
+		session.TemporyDataOfSession[treeViewKey] = cache
+	}
+	return cache
+}
+
+// LoadView 读取当前 agent 的 @tree 视图选项（会话缓存优先，其次数据库）
+func LoadView(session *structs.Chats) ViewOptions {
+	if session == nil {
+		return ViewOptions{}
+	}
+	cache := viewCache(session)
+	if opts, ok := cache[session.CurrentAgentID]; ok {
+		return opts
+	}
+	opts := ViewOptions{}
+	if session.DB != nil {
+		var row structs.TreeViews
+		err := session.DB.Where("chat_id = ? AND agent_id = ?", session.ID, session.CurrentAgentID).First(&row).Error
+		switch {
+		case err == nil:
+			if err := json.Unmarshal([]byte(row.Options), &opts); err != nil {
+				logger.Warn("invalid tree view options for chat %d agent %q: %v", session.ID, session.CurrentAgentID, err)
+				opts = ViewOptions{}
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			logger.Warn("failed to load tree view: %v", err)
+		}
+	}
+	cache[session.CurrentAgentID] = opts
+	return opts
+}
+
+// SaveView 保存当前 agent 的 @tree 视图选项（写入会话缓存并持久化）
+func SaveView(session *structs.Chats, opts ViewOptions) error {
+	if session.DB != nil {
+		b, err := json.Marshal(opts)
+		if err != nil {
+			return err
+		}
+		// 主 agent 的 AgentID 为空串（零值主键），不能用 Save，先查找再更新或创建
+		var existing structs.TreeViews
+		result := session.DB.Where("chat_id = ? AND agent_id = ?", session.ID, session.CurrentAgentID).First(&existing)
+		switch {
+		case result.Error == nil:
+			err = session.DB.Model(&structs.TreeViews{}).
+				Where("chat_id = ? AND agent_id = ?", session.ID, session.CurrentAgentID).
+				Update("options", string(b)).Error
+		case errors.Is(result.Error, gorm.ErrRecordNotFound):
+			err = session.DB.Create(&structs.TreeViews{ChatID: session.ID, AgentID: session.CurrentAgentID, Options: string(b)}).Error
+		default:
+			err = result.Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+	viewCache(session)[session.CurrentAgentID] = opts
+	return nil
+}
+
+// writeView 处理 edit 对 @tree/view 的编辑
+func writeView(session *structs.Chats, target, text string) (map[string]*any, error) {
+	current := LoadView(session)
+	str, err := edit.ProcessString(current.String(), target, text, true)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := ParseViewOptions(str)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Root != "" {
+		base, err := treeBasePath(session)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(filepath.Join(base, filepath.FromSlash(opts.Root)))
+		if err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("root %q is not a directory", opts.Root)
+		}
+	}
+	if err := SaveView(session, opts); err != nil {
+		return nil, fmt.Errorf("failed to save view: %w", err)
+	}
+	InvalidateTreeCache(session)
+	boolx := true
+	success := any(boolx)
+	view := any(opts.String())
+	return map[string]*any{
+		"success": &success,
+		"view":    &view,
+	}, nil
+}
@@ -0,0 +1,185 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cxykevin/alkaid0/storage/structs"
+)
+
+func TestParseViewOptions(t *testing.T) {
+	opts, err := ParseViewOptions("root: ./src/\ndepth: 2\ninclude: *.go, docs/**\nexclude: vendor\nsize: true\ngit: false\n")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if opts.Root != "src" || opts.Depth != 2 || !opts.Size || opts.Git {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	if len(opts.Include) != 2 || opts.Include[1] != "docs/**" || len(opts.Exclude) != 1 {
+		t.Fatalf("unexpected patterns: %+v", opts)
+	}
+
+	// String 与 Parse 互逆
+	back, err := ParseViewOptions(opts.String())
+	if err != nil || back.signature() != opts.signature() {
+		t.Fatalf("round trip mismatch: %+v vs %+v (%v)", back, opts, err)
+	}
+
+	empty, err := ParseViewOptions(ViewOptions{}.String())
+	if err != nil || !empty.IsDefault() {
+		t.Fatalf("default view should round trip, got %+v (%v)", empty, err)
+	}
+
+	for _, bad := range []string{"colour: red", "depth: -1", "size: maybe", "root: ../x", "no separator"} {
+		if _, err := ParseViewOptions(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "a/b/main.go", true},
+		{"*.go", "main.gox", false},
+		{"docs/**", "docs/a/b.md", true},
+		{"docs/**", "src/docs/a.md", false},
+		{"src/*.go", "src/a.go", true},
+		{"src/*.go", "src/sub/a.go", false},
+		{"src/**/*.go", "src/a.go", true},
+		{"src/**/*.go", "src/x/y/a.go", true},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "ab.txt", false},
+	}
+	for _, c := range cases {
+		re, err := globRegexp(c.pattern)
+		if err != nil {
+			t.Fatalf("compile %q: %v", c.pattern, err)
+		}
+		if got := re.MatchString(c.path); got != c.want {
+			t.Fatalf("glob %q on %q = %v, want %v", c.pattern, c.path, got, c.want)
+		}
+	}
+}
+
+func writeViewFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestApplyViewFilterAndDepth(t *testing.T) {
+	tmpdir := t.TempDir()
+	writeViewFiles(t, tmpdir, map[string]string{
+		"main.go":          "package main\n",
+		"README.md":        "readme",
+		"pkg/a.go":         "package pkg\n",
+		"pkg/a.txt":        "text",
+		"pkg/deep/b.go":    "package deep\n",
+		"vendor/v.go":      "package v\n",
+		"docs/guide.md":    "guide",
+		"docs/img/pic.png": "png",
+	})
+
+	var id int32
+	root, errs := BuildTree(tmpdir, &id, 0)
+	if len(errs) > 0 {
+		t.Fatalf("build tree: %v", errs)
+	}
+	opts := ViewOptions{Include: []string{"*.go"}, Exclude: []string{"vendor"}, Size: true}
+	if err := applyView(root, tmpdir, opts); err != nil {
+		t.Fatalf("applyView: %v", err)
+	}
+	out := BuildString(root)
+	for _, want := range []string{"main.go", "a.go", "b.go", "(13 B)"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in view:\n%s", want, out)
+		}
+	}
+	for _, hidden := range []string{"README.md", "a.txt", "vendor", "v.go", "docs", "guide.md"} {
+		if strings.Contains(out, hidden) {
+			t.Fatalf("expected %q to be hidden:\n%s", hidden, out)
+		}
+	}
+	if !root.Filtered {
+		t.Fatal("root should be marked filtered")
+	}
+
+	// 深度折叠
+	id = 0
+	root, _ = BuildTree(tmpdir, &id, 0)
+	if err := applyView(root, tmpdir, ViewOptions{Depth: 1}); err != nil {
+		t.Fatalf("applyView: %v", err)
+	}
+	out = BuildString(root)
+	if strings.Contains(out, "b.go") || strings.Contains(out, "a.go") {
+		t.Fatalf("depth 1 should collapse subdirectories:\n%s", out)
+	}
+	if !strings.Contains(out, "main.go") || !strings.Contains(out, "...") {
+		t.Fatalf("expected top-level files and collapsed markers:\n%s", out)
+	}
+}
+
+func TestBuildNodeFromStringIgnoresAnnotation(t *testing.T) {
+	node, err := BuildNodeFromString("root\n    - main.go `1` (1.2 KB, M)\n    src\n        - a.go `2` (?)\n")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(node.Children) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(node.Children))
+	}
+	for _, child := range node.Children {
+		if child.Name == "main.go" && child.ID != 1 {
+			t.Fatalf("main.go id = %d, want 1", child.ID)
+		}
+		if child.Name == "src" && (len(child.Children) != 1 || child.Children[0].ID != 2 || child.Children[0].Name != "a.go") {
+			t.Fatalf("unexpected src children: %+v", child.Children)
+		}
+	}
+}
+
+func TestWriteTreeView(t *testing.T) {
+	tmpdir := t.TempDir()
+	writeViewFiles(t, tmpdir, map[string]string{"src/a.go": "package src\n"})
+	session := &structs.Chats{Root: tmpdir, CurrentActivatePath: "."}
+
+	mp := map[string]*any{
+		"path":   strPtr(viewPath),
+		"target": strPtr("@all"),
+		"text":   strPtr("root: src\ninclude: *.go\ngit: true"),
+	}
+	pass, _, ret, err := writeTree(session, mp, nil)
+	if err != nil || pass {
+		t.Fatalf("unexpected pass=%v err=%v", pass, err)
+	}
+	if ok, _ := (*ret["success"]).(bool); !ok {
+		t.Fatalf("expected success, got %v", *ret["error"])
+	}
+	opts := LoadView(session)
+	if opts.Root != "src" || !opts.Git || len(opts.Include) != 1 {
+		t.Fatalf("view not saved: %+v", opts)
+	}
+
+	// root 不是目录时拒绝，且保留原视图
+	mp["text"] = strPtr("root: missing")
+	_, _, ret, _ = writeTree(session, mp, nil)
+	if ok, _ := (*ret["success"]).(bool); ok {
+		t.Fatal("expected failure for missing root")
+	}
+	if LoadView(session).Root != "src" {
+		t.Fatal("failed edit should keep previous view")
+	}
+}
@@ -10,6 +10,10 @@ import (
 	"github.com/cxykevin/alkaid0/log"
 	"github.com/cxykevin/alkaid0/provider/request"
 	"github.com/cxykevin/alkaid0/provider/request/agents"
+	agentActions "github.com/cxykevin/alkaid0/provider/request/agents/actions"
+	agentconfig "github.com/cxykevin/alkaid0/provider/request/agents/config"
+	"github.com/cxykevin/alkaid0/provider/request/budget"
+	"github.com/cxykevin/alkaid0/provider/request/build"
 	reqStructs "github.com/cxykevin/alkaid0/provider/request/structs"
 	"github.com/cxykevin/alkaid0/storage"
 	"github.com/cxykevin/alkaid0/storage/structs"
@@ -66,6 +70,9 @@ func DeleteChat(db *gorm.DB, chat *structs.Chats) error {
 		if err := tx.Where("chat_id = ?", chat.ID).Delete(&structs.ReferFiles{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("chat_id = ?", chat.ID).Delete(&structs.ProxyUsages{}).Error; err != nil {
+			return err
+		}
 		return tx.Delete(&structs.Chats{}, chat.ID).Error
 	})
 }
@@ -117,7 +124,8 @@ func PendingToolCall(session *structs.Chats) ([]ToolCall, *structs.Messages, uin
 		return nil, nil, 0, nil
 	}
 	var msg structs.Messages
-	err := session.DB.Where("chat_id = ? AND tool_calling_json_string != ''", session.ID).Order("id DESC").First(&msg).Error
+	err := request.AgentMessages(session.DB, session.CurrentAgentID).
+		Where("chat_id = ? AND tool_calling_json_string != ''", session.ID).Order("id DESC").First(&msg).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil, msg.ID, nil
@@ -220,7 +228,8 @@ func ApproveToolCalls(session *structs.Chats) (uint64, error) {
 		return 0, nil
 	}
 	var msg structs.Messages
-	err := session.DB.Where("chat_id = ? AND tool_calling_json_string != ''", session.ID).Order("id DESC").First(&msg).Error
+	err := request.AgentMessages(session.DB, session.CurrentAgentID).
+		Where("chat_id = ? AND tool_calling_json_string != ''", session.ID).Order("id DESC").First(&msg).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return msg.ID, nil
@@ -291,20 +300,53 @@ func GetHistory(session *structs.Chats) ([]structs.Messages, error) {
 	return chatMsgs, err
 }
 
+// PinMessage 固定或取消固定会话中的消息，固定的消息在上下文压缩后仍原样保留
+func PinMessage(session *structs.Chats, msgID uint64, pinned bool) error {
+	result := session.DB.Model(&structs.Messages{}).
+		Where("id = ? AND chat_id = ?", msgID, session.ID).
+		Update("pinned", pinned)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("message %d not found in this session", msgID)
+	}
+	return nil
+}
+
+// GetPinnedMessages 获取会话中固定的消息
+func GetPinnedMessages(session *structs.Chats) ([]structs.Messages, error) {
+	msgs := []structs.Messages{}
+	err := session.DB.Where("chat_id = ? AND pinned = ?", session.ID, true).Order("id ASC").Find(&msgs).Error
+	return msgs, err
+}
+
+// InspectContext 构建当前会话的下一次请求但不发送，返回各组成部分的 token 估算
+func InspectContext(session *structs.Chats) (*build.ContextReport, error) {
+	return build.InspectContext(session.DB, session)
+}
+
 // AgentTagsList 代理标签列表
 type AgentTagsList struct {
 	ID    string
 	Agent cfgStructs.AgentConfig
+	// Workspace 定义于工作区 .alkaid0/agents
+	Workspace bool
 }
 
-// GetAgentTags 获取代理标签列表
-func GetAgentTags() []AgentTagsList {
+// GetAgentTags 获取代理标签列表（用户配置与工作区定义，同名时用户配置优先）
+func GetAgentTags(session *structs.Chats) []AgentTagsList {
 	agents := config.GlobalConfig.Agent.Agents
-	agentsObj := make([]AgentTagsList, len(agents))
-	idx := 0
+	workspace := agentconfig.WorkspaceAgents(session.Root)
+	agentsObj := make([]AgentTagsList, 0, len(agents)+len(workspace))
 	for i, agent := range agents {
-		agentsObj[idx] = AgentTagsList{ID: i, Agent: agent}
-		idx++
+		agentsObj = append(agentsObj, AgentTagsList{ID: i, Agent: agent})
+	}
+	for i, agent := range workspace {
+		if _, ok := agents[i]; ok {
+			continue
+		}
+		agentsObj = append(agentsObj, AgentTagsList{ID: i, Agent: agent, Workspace: true})
 	}
 	slices.SortFunc(agentsObj, func(a, b AgentTagsList) int {
 		if a.ID < b.ID {
@@ -335,6 +377,29 @@ func DeactivateAgent(session *structs.Chats, agentID string) error {
 	return agents.DeactivateAgent(session, agentID)
 }
 
+// BeginTurnBudget 开启主会话本轮的预算窗口
+func BeginTurnBudget(session *structs.Chats) {
+	session.TurnBudget = budget.Begin(session.DB, session.ID, config.GlobalConfig.Agent.Budget)
+}
+
+// EnforceBudget 请求前检查预算，超出时返回 *budget.ExceededError
+func EnforceBudget(session *structs.Chats) error {
+	return budget.Enforce(session)
+}
+
+// StopParallelAgents 取消会话中所有并行运行的子代理
+func StopParallelAgents(session *structs.Chats) {
+	if session == nil {
+		return
+	}
+	agents.StopParallelAgents(session)
+}
+
+// ParallelAgents 获取会话中并行子代理的状态
+func ParallelAgents(session *structs.Chats) []agentActions.ParallelResult {
+	return agents.ListParallelAgents(session)
+}
+
 // Scopes 作用域
 type Scopes struct {
 	ID     string
@@ -378,6 +443,11 @@ func UserAddMsgWithID(session *structs.Chats, msg string, refers *structs.Messag
 	return request.UserAddMsgWithID(session, msg, refers)
 }
 
+// SteerAddMsg 在运行中的一轮内插入用户引导消息，不停用子代理
+func SteerAddMsg(session *structs.Chats, msg string) (uint64, error) {
+	return request.SteerAddMsg(session, msg)
+}
+
 // SubAgentReject 子代理拒绝
 func SubAgentReject(session *structs.Chats) error {
 	return request.SubAgentReject(session)
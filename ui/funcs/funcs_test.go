@@ -2,6 +2,7 @@ package funcs
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/cxykevin/alkaid0/config"
@@ -243,7 +244,7 @@ func TestGetAgentTags(t *testing.T) {
 		},
 	}
 
-	tags := GetAgentTags()
+	tags := GetAgentTags(&structs.Chats{Root: t.TempDir()})
 	if len(tags) != 2 {
 		t.Fatalf("Expected 2 agent tags, got %d", len(tags))
 	}
@@ -259,12 +260,50 @@ func TestGetAgentTags_Empty(t *testing.T) {
 		},
 	}
 
-	tags := GetAgentTags()
+	tags := GetAgentTags(&structs.Chats{Root: t.TempDir()})
 	if len(tags) != 0 {
 		t.Errorf("Expected empty tags, got %d", len(tags))
 	}
 }
 
+// TestGetAgentTags_Workspace 测试合并工作区 .alkaid0/agents 定义，同名时用户配置优先
+func TestGetAgentTags_Workspace(t *testing.T) {
+	defer configSetup()()
+
+	*config.GlobalConfig = cfgStructs.Config{
+		Agent: cfgStructs.AgentsConfig{
+			IgnoreBuiltinAgents: true,
+			Agents: map[string]cfgStructs.AgentConfig{
+				"coder": {AgentName: "Coder"},
+			},
+		},
+	}
+	root := t.TempDir()
+	dir := filepath.Join(root, ".alkaid0", "agents")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"reviewer.md": "---\nname: Reviewer\n---\nReview the code.\n",
+		"coder.md":    "---\nname: Repo Coder\n---\nWrite code.\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tags := GetAgentTags(&structs.Chats{Root: root})
+	if len(tags) != 2 {
+		t.Fatalf("Expected 2 agent tags, got %d", len(tags))
+	}
+	if tags[0].ID != "coder" || tags[0].Agent.AgentName != "Coder" || tags[0].Workspace {
+		t.Errorf("user config should win over workspace definition, got %+v", tags[0])
+	}
+	if tags[1].ID != "reviewer" || !tags[1].Workspace || tags[1].Agent.AgentPrompt != "Review the code." {
+		t.Errorf("unexpected workspace tag %+v", tags[1])
+	}
+}
+
 func TestGetScopes(t *testing.T) {
 	oldScopes := toolobj.Scopes
 	toolobj.Scopes = map[string]string{
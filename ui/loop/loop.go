@@ -11,8 +11,11 @@ import (
 
 	"github.com/cxykevin/alkaid0/config"
 	"github.com/cxykevin/alkaid0/log"
+	"github.com/cxykevin/alkaid0/provider/request"
+	"github.com/cxykevin/alkaid0/provider/request/budget"
 	reqStructs "github.com/cxykevin/alkaid0/provider/request/structs"
 	"github.com/cxykevin/alkaid0/storage/structs"
+	"github.com/cxykevin/alkaid0/tools/hooks"
 	"github.com/cxykevin/alkaid0/ui/funcs"
 	"github.com/cxykevin/alkaid0/ui/state"
 )
@@ -23,6 +26,8 @@ const (
 	maxRetries = 3
 	// baseBackoff 指数退避的基准间隔（秒），第 n 次重试等待 baseBackoff * 2^(n-1)
 	baseBackoff = 1 * time.Second
+	// maxRateLimitRetries 限流（429）的最大重试次数，不占用 maxRetries；等待由共享限流器按上游提示排定
+	maxRateLimitRetries = 10
 )
 
 var logger = log.New("loop")
@@ -41,6 +46,8 @@ const (
 	StopReasonError
 	// StopReasonPendingTool 等待工具调用
 	StopReasonPendingTool
+	// StopReasonBudget 超出本轮预算
+	StopReasonBudget
 )
 
 // AIResponse AI 响应
@@ -56,6 +63,7 @@ type AIResponse struct {
 	Usage           *reqStructs.Usage
 	SummaryFlag     bool
 	AgentID         *string
+	RateLimitWait   time.Duration // 非 0：请求因上游限流排队，预计等待时间
 }
 
 // msgAction 停止原因
@@ -75,6 +83,14 @@ type msgObj struct {
 	Command msgAction
 	// MsgID 已由 ACP 层持久化的用户消息 DB ID（ChatWithID 设置，非 0 时跳过重复插入）
 	MsgID uint64
+	// OnInject 消息持久化后回调（一轮结束时仍未注入的引导消息转为普通消息时携带）
+	OnInject func(msgID uint64)
+}
+
+// steerObj 一轮运行中收到的引导消息
+type steerObj struct {
+	Msg      string
+	OnInject func(msgID uint64)
 }
 
 // Object 循环对象
@@ -92,6 +108,11 @@ type Object struct {
 	done           chan struct{}
 	closeOnce      sync.Once
 	stopped        atomic.Bool // Stop() 已调用标记，防止 cancel 后 AI 继续重试（多协程读写，用原子类型避免 data race）
+	// steerMu 保护 turnRunning、steerQueue 与 interrupted 的一致性
+	steerMu     sync.Mutex
+	turnRunning bool       // 一轮（runResponseLoop）运行中
+	steerQueue  []steerObj // 等待注入下一次请求的引导消息
+	interrupted bool       // Interrupt() 取消了当前请求：注入引导消息后重新请求，而非停止本轮
 }
 
 // queueSize 队列缓冲区大小
@@ -137,6 +158,7 @@ func (p *Object) Start(ctx context.Context) {
 	p.session.SetContext(p.ctx)
 
 	session := p.session
+	hooks.SessionStart(session)
 	call := func(resp AIResponse) {
 		select {
 		case p.recvQueue <- resp:
@@ -149,6 +171,18 @@ func (p *Object) Start(ctx context.Context) {
 		}
 	}
 
+	// 并行子代理在各自 goroutine 中请求，其流式增量经主会话回调并入响应通道，按 AgentID 区分来源
+	session.SetAgentStreamFn(func(chunk structs.AgentStreamChunk) {
+		agentID := chunk.AgentID
+		call(AIResponse{
+			MsgID:           chunk.MsgID,
+			ThinkingContext: chunk.ThinkingDelta,
+			Content:         chunk.Delta,
+			AgentID:         &agentID,
+		})
+	})
+	defer session.SetAgentStreamFn(nil)
+
 	var needCompress bool
 
 	// doAutoSummary 执行自动摘要并发送回调通知（提取的公共逻辑，复用 4 次）
@@ -167,6 +201,10 @@ func (p *Object) Start(ctx context.Context) {
 	var runResponseLoop func()
 	runResponseLoop = func() {
 		loopCount := 0
+		funcs.BeginTurnBudget(session)
+		p.beginTurn()
+		defer hooks.TurnEnd(session)
+		defer p.endTurn()
 		for {
 			// Stop() 已调用，跳过此轮 AI 交互
 			if p.stopped.Load() {
@@ -176,11 +214,43 @@ func (p *Object) Start(ctx context.Context) {
 				break
 			}
 
+			// 注入本轮运行期间收到的引导消息（上一批工具调用已执行完毕）
+			if err := p.injectSteering(session); err != nil {
+				call(AIResponse{
+					Error:      fmt.Errorf("loop error when steering %v", err),
+					StopReason: StopReasonError,
+				})
+				break
+			}
+
+			// 预算检查：子代理超出时强制停用并把控制权交回主代理，主会话本轮超出时停止
+			if err := funcs.EnforceBudget(session); err != nil {
+				var exceeded *budget.ExceededError
+				if errors.As(err, &exceeded) && exceeded.Agent {
+					if derr := funcs.DeactivateAgent(session, exceeded.Error()); derr != nil {
+						call(AIResponse{
+							Error:      fmt.Errorf("loop error when deactivating agent over budget: %v", derr),
+							StopReason: StopReasonError,
+						})
+						break
+					}
+					continue
+				}
+				call(AIResponse{
+					Error:      err,
+					StopReason: StopReasonBudget,
+				})
+				break
+			}
+
 			thinkingFlag := false
 			responseStarted := false
 
-			// 为每次请求创建独立的可取消 context
+			// 为每次请求创建独立的可取消 context；限流排队时通知客户端等待时间
 			responseCtx, responseCancel := context.WithCancel(p.ctx)
+			requestCtx := request.WithRateLimitWait(responseCtx, func(wait time.Duration) {
+				call(AIResponse{RateLimitWait: wait})
+			})
 			p.lock.Lock()
 			p.isResponding = true
 			p.cancelFunc = responseCancel
@@ -198,7 +268,7 @@ func (p *Object) Start(ctx context.Context) {
 				thinkingFlag = false
 				responseStarted = false
 
-				finish, err := funcs.SendRequest(responseCtx, session, func(delta string, thinkingDelta string, id uint64, usage reqStructs.Usage, agentID *string) error {
+				finish, err := funcs.SendRequest(requestCtx, session, func(delta string, thinkingDelta string, id uint64, usage reqStructs.Usage, agentID *string) error {
 					select {
 					case <-responseCtx.Done():
 						return responseCtx.Err()
@@ -259,10 +329,21 @@ func (p *Object) Start(ctx context.Context) {
 					// 用户主动取消，不重试
 					logger.Info("request canceled by user, skip retry")
 				} else {
+					rateLimitRetries := 0
 					for retryCount := 1; retryCount <= maxRetries; retryCount++ {
 						backoff := baseBackoff * (1 << (retryCount - 1)) // 指数退避: 1s, 2s, 4s
-						logger.Warn("request failed (attempt %d/%d), retrying in %v: %v",
-							retryCount, maxRetries, backoff, err)
+						var rateErr *request.RateLimitError
+						if errors.As(err, &rateErr) && rateLimitRetries < maxRateLimitRetries {
+							// 限流：下次请求在共享限流器中排队到上游给出的时间，这里不再退避，也不计入普通重试次数
+							rateLimitRetries++
+							retryCount--
+							backoff = 0
+							logger.Warn("request rate limited (%d/%d), retrying after %v: %v",
+								rateLimitRetries, maxRateLimitRetries, rateErr.Wait, err)
+						} else {
+							logger.Warn("request failed (attempt %d/%d), retrying in %v: %v",
+								retryCount, maxRetries, backoff, err)
+						}
 
 						select {
 						case <-time.After(backoff):
@@ -291,6 +372,11 @@ func (p *Object) Start(ctx context.Context) {
 			responseCancel() // 释放本轮 response context，避免长期会话累积泄漏多级 context
 
 			if err != nil {
+				if p.takeInterrupted() {
+					// Interrupt() 取消了本次请求：丢弃未完成的响应，注入新指令后重新请求
+					logger.Info("request interrupted by steering message in session=%d", session.ID)
+					continue
+				}
 				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 					call(AIResponse{
 						StopReason: StopReasonUser,
@@ -314,6 +400,10 @@ func (p *Object) Start(ctx context.Context) {
 					}
 					break
 				}
+				// 模型已停止但有待注入的引导消息：继续本轮响应新指令
+				if p.hasSteering() {
+					continue
+				}
 				if !responseStarted && !thinkingFlag {
 					call(AIResponse{
 						Error:      errors.New("no response"),
@@ -439,12 +529,14 @@ func (p *Object) Start(ctx context.Context) {
 				input = ""
 			} else if callObj.MsgID == 0 {
 				// v2：ACP 层（SessionPrompt）已用 ChatWithID 持久化用户消息，MsgID 非 0 时跳过重复插入
-				err := funcs.UserAddMsg(session, input, nil)
+				msgID, err := funcs.UserAddMsgWithID(session, input, nil)
 				if err != nil {
 					call(AIResponse{
 						Error:      fmt.Errorf("loop error when calling %v", err),
 						StopReason: StopReasonError,
 					})
+				} else if callObj.OnInject != nil {
+					callObj.OnInject(msgID)
 				}
 			}
 
@@ -479,7 +571,102 @@ func (p *Object) Stop() {
 	// 调用工具注册的直接停止函数（所有工具通用的中断入口）
 	if p.session != nil {
 		p.session.KillTool()
+		funcs.StopParallelAgents(p.session)
+	}
+}
+
+// Steer 在一轮运行中发送引导消息：不取消当前操作，当前工具调用批次完成后注入下一次模型请求。
+// 消息持久化后调用 onInject（在 loop goroutine 中）。没有正在运行的一轮时返回 false，调用方应改用 ChatWithID。
+func (p *Object) Steer(msg string, onInject func(msgID uint64)) bool {
+	p.steerMu.Lock()
+	defer p.steerMu.Unlock()
+	if !p.turnRunning {
+		return false
+	}
+	p.steerQueue = append(p.steerQueue, steerObj{Msg: msg, OnInject: onInject})
+	return true
+}
+
+// Interrupt 同 Steer，但同时取消进行中的模型请求，注入新指令后立即重新请求。
+// 工具执行期间不中断工具，消息在本批工具完成后注入。
+func (p *Object) Interrupt(msg string, onInject func(msgID uint64)) bool {
+	p.steerMu.Lock()
+	defer p.steerMu.Unlock()
+	if !p.turnRunning {
+		return false
+	}
+	p.steerQueue = append(p.steerQueue, steerObj{Msg: msg, OnInject: onInject})
+	p.lock.Lock()
+	cancel := p.cancelFunc
+	p.lock.Unlock()
+	if cancel != nil {
+		p.interrupted = true
+		cancel()
 	}
+	return true
+}
+
+// beginTurn 标记一轮开始，此后的 Steer/Interrupt 消息在本轮内注入
+func (p *Object) beginTurn() {
+	p.steerMu.Lock()
+	p.turnRunning = true
+	p.steerMu.Unlock()
+}
+
+// endTurn 标记一轮结束。未注入的引导消息转为普通消息入队，由下一轮处理。
+func (p *Object) endTurn() {
+	p.steerMu.Lock()
+	pending := p.steerQueue
+	p.steerQueue = nil
+	p.turnRunning = false
+	p.interrupted = false
+	p.steerMu.Unlock()
+	for _, st := range pending {
+		select {
+		case p.sendQueue <- msgObj{Msg: st.Msg, OnInject: st.OnInject}:
+		default:
+			logger.Warn("drop steering message in session=%d: send queue full", p.session.ID)
+		}
+	}
+}
+
+// hasSteering 是否有待注入的引导消息
+func (p *Object) hasSteering() bool {
+	p.steerMu.Lock()
+	defer p.steerMu.Unlock()
+	return len(p.steerQueue) > 0
+}
+
+// takeInterrupted 读取并清除 Interrupt() 标记
+func (p *Object) takeInterrupted() bool {
+	p.steerMu.Lock()
+	defer p.steerMu.Unlock()
+	interrupted := p.interrupted
+	p.interrupted = false
+	return interrupted
+}
+
+// injectSteering 持久化待注入的引导消息，使下一次模型请求可见
+func (p *Object) injectSteering(session *structs.Chats) error {
+	p.steerMu.Lock()
+	pending := p.steerQueue
+	p.steerQueue = nil
+	p.interrupted = false
+	p.steerMu.Unlock()
+	for i, st := range pending {
+		msgID, err := funcs.SteerAddMsg(session, strings.TrimSpace(st.Msg))
+		if err != nil {
+			// 未写入的消息放回队列，本轮结束时转为普通消息
+			p.steerMu.Lock()
+			p.steerQueue = append(pending[i:], p.steerQueue...)
+			p.steerMu.Unlock()
+			return err
+		}
+		if st.OnInject != nil {
+			st.OnInject(msgID)
+		}
+	}
+	return nil
 }
 
 // Cancel 终止整个 Loop 生命周期（而非仅当前请求）。
@@ -495,6 +682,9 @@ func (p *Object) Cancel() {
 	if cancel != nil {
 		cancel()
 	}
+	if p.session != nil {
+		funcs.StopParallelAgents(p.session)
+	}
 }
 
 // handleWaitApprove 统一处理 WaitApprove 状态的审批逻辑。
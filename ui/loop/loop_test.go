@@ -37,12 +37,12 @@ func setupConfigForTest() {
 	// 设置 mock 服务器地址
 	apiKey := "test-key"
 
-	if config.GlobalConfig == nil {
-		config.GlobalConfig = &structs.Config{}
-	}
+	// 上一个测试的 loop goroutine 可能仍在读取配置（如 turn_end 钩子），需在写锁下修改
+	cfg, unlock := config.GlobalConfigForWrite()
+	defer unlock()
 
-	config.GlobalConfig.Version = 1
-	config.GlobalConfig.Model = structs.ModelsConfig{
+	cfg.Version = 1
+	cfg.Model = structs.ModelsConfig{
 		Models: map[int32]structs.ModelConfig{
 			1: {
 				ModelName:   "test-chat",
@@ -58,7 +58,7 @@ func setupConfigForTest() {
 			},
 		},
 	}
-	config.GlobalConfig.Agent = structs.AgentsConfig{
+	cfg.Agent = structs.AgentsConfig{
 		MaxCallCount:        5,
 		DisableSandbox:      true,
 		IgnoreBuiltinAgents: true,
@@ -789,3 +789,107 @@ func TestMessageWithReferences(t *testing.T) {
 		t.Fatal("Expected message to be queued")
 	}
 }
+
+// TestSteerAndInterrupt 测试引导消息在一轮内注入、轮次结束后转为普通消息，以及 Interrupt 取消当前请求
+func TestSteerAndInterrupt(t *testing.T) {
+	setupConfigForTest()
+	db := setupTestDB(t)
+	defer u.Unwrap(db.DB()).Close()
+	chat := createTestChat(db, t)
+	loopObj := New(chat)
+
+	if loopObj.Steer("idle", nil) || loopObj.Interrupt("idle", nil) {
+		t.Fatal("Steer/Interrupt should refuse when no turn is running")
+	}
+
+	loopObj.beginTurn()
+	var injected []uint64
+	if !loopObj.Steer("use tabs instead", func(id uint64) { injected = append(injected, id) }) {
+		t.Fatal("Steer should accept while a turn is running")
+	}
+	if err := loopObj.injectSteering(chat); err != nil {
+		t.Fatal(err)
+	}
+	if len(injected) != 1 || loopObj.hasSteering() {
+		t.Fatalf("steering message should be injected once, got %v", injected)
+	}
+	var msg storageStructs.Messages
+	if err := db.First(&msg, injected[0]).Error; err != nil || msg.Delta != "use tabs instead" || msg.Type != storageStructs.MessagesRoleUser {
+		t.Fatalf("unexpected injected message %+v: %v", msg, err)
+	}
+
+	canceled := false
+	loopObj.cancelFunc = func() { canceled = true }
+	if !loopObj.Interrupt("stop and do X", nil) || !canceled {
+		t.Fatal("Interrupt should cancel the in-flight request")
+	}
+	if !loopObj.takeInterrupted() || loopObj.takeInterrupted() {
+		t.Fatal("interrupted flag should be consumed once")
+	}
+
+	// 一轮结束时未注入的消息转为普通消息入队
+	loopObj.endTurn()
+	select {
+	case obj := <-loopObj.sendQueue:
+		if obj.Msg != "stop and do X" {
+			t.Fatalf("unexpected queued message %q", obj.Msg)
+		}
+	default:
+		t.Fatal("pending steering message should be queued when the turn ends")
+	}
+	if loopObj.Steer("late", nil) {
+		t.Fatal("Steer should refuse after the turn ends")
+	}
+}
+
+// TestScenarioRetry 按 mock 场景脚本验证重试：429 走共享限流器立即重试，500 退避重试，最终流式返回完整内容
+func TestScenarioRetry(t *testing.T) {
+	openai.StartServerTask()
+	setupConfigForTest()
+	if err := openai.LoadScenario("testdata/retry.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	defer openai.SetScenario(nil)
+
+	db := setupTestDB(t)
+	defer u.Unwrap(db.DB()).Close()
+	chat := createTestChat(db, t)
+	loopObj := New(chat)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	respChan := make(chan AIResponse, 100)
+	loopObj.SetCallback(func(resp AIResponse) {
+		respChan <- resp
+	})
+	go loopObj.Start(ctx)
+
+	if err := loopObj.Chat("Hello, scenario!", nil); err != nil {
+		t.Fatalf("Failed to send chat message: %v", err)
+	}
+
+	var content, thinking string
+	var stop AIResponse
+	timeout := time.After(8 * time.Second)
+	for stop.StopReason == StopReasonNone {
+		select {
+		case resp := <-respChan:
+			content += resp.Content
+			thinking += resp.ThinkingContext
+			if resp.StopReason != StopReasonNone {
+				stop = resp
+			}
+		case <-timeout:
+			t.Fatal("Timeout waiting for LLM response")
+		}
+	}
+	if stop.StopReason != StopReasonModel {
+		t.Fatalf("expected StopReasonModel, got %v (%v)", stop.StopReason, stop.Error)
+	}
+	if content != "recovered after retries" || thinking != "retrying" {
+		t.Errorf("content=%q thinking=%q", content, thinking)
+	}
+	if openai.ScenarioRemaining() != 0 || len(openai.ScenarioRequests()) != 3 {
+		t.Errorf("expected 3 requests consuming the scenario, got %d (remaining %d)", len(openai.ScenarioRequests()), openai.ScenarioRemaining())
+	}
+}
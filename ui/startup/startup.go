@@ -188,8 +188,7 @@ func Startup() {
 		}
 
 		var sb strings.Builder
-		err = request.SimpleOpenAIRequest(ctx, modelConfig.ProviderURL, modelConfig.ProviderKey,
-			modelConfig.ModelID, req, nil,
+		err = request.ChatRequest(ctx, modelConfig, req, nil,
 			func(resp reqstructs.ChatCompletionResponse) error {
 				if len(resp.Choices) > 0 {
 					sb.WriteString(resp.Choices[0].Delta.Content)
@@ -228,8 +227,7 @@ func Startup() {
 		}
 
 		var sb strings.Builder
-		err = request.SimpleOpenAIRequest(ctx, modelConfig.ProviderURL, modelConfig.ProviderKey,
-			modelConfig.ModelID, req, nil,
+		err = request.ChatRequest(ctx, modelConfig, req, nil,
 			func(resp reqstructs.ChatCompletionResponse) error {
 				if len(resp.Choices) > 0 {
 					sb.WriteString(resp.Choices[0].Delta.Content)